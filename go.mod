@@ -1,5 +1,5 @@
 module github.com/scottcagno/storage
 
-go 1.17
+go 1.18
 
 //require github.com/dominikh/go-tools latest
\ No newline at end of file
@@ -0,0 +1,547 @@
+package bitcask
+
+import (
+	"github.com/scottcagno/storage/pkg/hashmap/chained"
+	"github.com/scottcagno/storage/pkg/lsmt/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// keydirSize is the initial size of the keydir
+const keydirSize = 128
+
+// dataFile is a data file along with some accounting information
+type dataFile struct {
+	id   uint32   // id of the file
+	fd   *os.File // file descriptor (only the active file is written to)
+	size int64    // size of the file
+	dead int64    // bytes of the file taken by overwritten or deleted records
+}
+
+// Bitcask is a log-structured hash table for workloads that only do point
+// lookups. Every write is appended to the active data file, and an in-memory
+// keydir maps every key to the location of its latest record, so a read is
+// a single hash table lookup followed by a single read from disk. The active
+// data file is rotated once it grows past the configured size, and merging
+// rewrites the live records of the older files into new ones to reclaim the
+// space taken by overwritten and deleted records.
+type Bitcask struct {
+	conf      *Config
+	base      string                  // base is the directory holding the data and hint files
+	lock      sync.RWMutex            // lock synchronizes access to the files
+	keydir    *chained.ShardedHashMap // keydir maps every key to its encoded location
+	files     map[uint32]*dataFile    // files holds every data file, including the active one
+	active    *dataFile               // active is the data file currently written to
+	hints     []byte                  // hints are the hints for the records in the active file
+	nextID    uint32                  // nextID is the id of the next data file
+	seq       uint64                  // seq is the sequence number of the latest record
+	mergeLock sync.Mutex              // mergeLock makes sure only one merge runs at a time
+	done      chan struct{}           // done stops the background merges
+	wg        sync.WaitGroup          // wg waits for the background merges to stop
+	closed    bool
+}
+
+// Open opens or creates a Bitcask instance. The keydir is rebuilt from the
+// hint files when they are present, and from the data files otherwise. Any
+// partially written records (left behind by a crash) are truncated.
+func Open(c *Config) (*Bitcask, error) {
+	// check config
+	conf := checkConfig(c)
+	// make sure we are working with absolute paths
+	base, err := filepath.Abs(conf.BaseDir)
+	if err != nil {
+		return nil, err
+	}
+	// create base directory
+	err = os.MkdirAll(base, os.ModeDir|0755)
+	if err != nil {
+		return nil, err
+	}
+	b := &Bitcask{
+		conf:   conf,
+		base:   base,
+		keydir: chained.NewShardedHashMap(keydirSize),
+		files:  make(map[uint32]*dataFile),
+		done:   make(chan struct{}),
+	}
+	// finish any merge that was interrupted
+	err = b.finishMerge()
+	if err != nil {
+		return nil, err
+	}
+	// rebuild the keydir
+	err = b.load()
+	if err != nil {
+		b.closeFiles()
+		return nil, err
+	}
+	// always start writing to a new data file
+	err = b.newActiveFile()
+	if err != nil {
+		b.closeFiles()
+		return nil, err
+	}
+	// start background merges
+	if conf.MergeInterval > 0 {
+		b.wg.Add(1)
+		go b.mergeLoop()
+	}
+	return b, nil
+}
+
+// fileIDs returns the ids of the files in the base directory
+// with the provided suffix, in ascending order
+func (b *Bitcask) fileIDs(suffix string) ([]uint32, error) {
+	paths, err := filepath.Glob(filepath.Join(b.base, "*"+suffix))
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint32
+	for _, path := range paths {
+		id, err := IDFromFileName(path)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids, nil
+}
+
+// path returns the path of a file in the base directory
+func (b *Bitcask) path(name string) string {
+	return filepath.Join(b.base, name)
+}
+
+// load rebuilds the keydir from the data and hint files
+func (b *Bitcask) load() error {
+	// remove any leftover temporary files
+	tmps, err := filepath.Glob(filepath.Join(b.base, "*.tmp"))
+	if err != nil {
+		return err
+	}
+	for _, tmp := range tmps {
+		_ = os.Remove(tmp)
+	}
+	ids, err := b.fileIDs(dataFileSuffix)
+	if err != nil {
+		return err
+	}
+	// keys deleted so far, along with the sequence number of the
+	// deletion, so that older records found later are ignored
+	tombs := make(map[string]uint64)
+	for _, id := range ids {
+		err = b.loadFile(id, tombs)
+		if err != nil {
+			return err
+		}
+		if id >= b.nextID {
+			b.nextID = id + 1
+		}
+	}
+	return nil
+}
+
+// hint is a decoded hint
+type hint struct {
+	key       string
+	loc       location
+	tombstone bool
+}
+
+// loadFile adds the records of a data file to the keydir, using its hint
+// file if it has one, and writing one for it otherwise
+func (b *Bitcask) loadFile(id uint32, tombs map[string]uint64) error {
+	path := b.path(DataFileNameFromID(id))
+	fd, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		return err
+	}
+	fi, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	if fi.Size() == 0 {
+		// nothing was ever written to it
+		fd.Close()
+		_ = os.Remove(b.path(HintFileNameFromID(id)))
+		return os.Remove(path)
+	}
+	df := &dataFile{id: id, fd: fd, size: fi.Size()}
+	b.files[id] = df
+	// try the hint file first
+	var hints []hint
+	err = readHints(b.path(HintFileNameFromID(id)), func(key string, loc location, tombstone bool) {
+		loc.fid = id
+		hints = append(hints, hint{key: key, loc: loc, tombstone: tombstone})
+	})
+	if err == nil {
+		for _, h := range hints {
+			b.apply(h.key, h.loc, h.tombstone, tombs)
+		}
+		return nil
+	}
+	// otherwise read the whole data file
+	var buf []byte
+	rr := newRecordReader(io.NewSectionReader(fd, 0, df.size))
+	for {
+		loc, e, _, err := rr.next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			// a partially written record, so truncate
+			// the file to the last complete record
+			err = fd.Truncate(rr.offset)
+			if err != nil {
+				return err
+			}
+			df.size = rr.offset
+			break
+		}
+		loc.fid = id
+		tombstone := e.Value == nil
+		b.apply(string(e.Key), loc, tombstone, tombs)
+		buf = appendHint(buf, e.Key, loc, tombstone)
+	}
+	return writeFile(b.path(HintFileNameFromID(id)), buf)
+}
+
+// apply adds a record found while loading to the keydir, unless a newer
+// record of the same key has already been found
+func (b *Bitcask) apply(key string, loc location, tombstone bool, tombs map[string]uint64) {
+	if loc.seq > b.seq {
+		b.seq = loc.seq
+	}
+	if seq, ok := tombs[key]; ok && seq > loc.seq {
+		// already deleted
+		b.files[loc.fid].dead += int64(loc.size)
+		return
+	}
+	if v, ok := b.keydir.Get(key); ok {
+		old := decodeLocation(v)
+		if old.seq >= loc.seq {
+			// already found a newer record
+			b.files[loc.fid].dead += int64(loc.size)
+			return
+		}
+		b.files[old.fid].dead += int64(old.size)
+	}
+	if tombstone {
+		b.keydir.Del(key)
+		tombs[key] = loc.seq
+		// tombstones are only needed until the
+		// older records have been merged away
+		b.files[loc.fid].dead += int64(loc.size)
+		return
+	}
+	delete(tombs, key)
+	b.keydir.Put(key, loc.encode())
+}
+
+// newActiveFile creates a new active data file
+func (b *Bitcask) newActiveFile() error {
+	id := b.nextID
+	fd, err := os.OpenFile(b.path(DataFileNameFromID(id)), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	b.nextID++
+	b.active = &dataFile{id: id, fd: fd}
+	b.files[id] = b.active
+	b.hints = nil
+	return nil
+}
+
+// rotate makes the active data file immutable, writing its hint
+// file, and creates a new active data file
+func (b *Bitcask) rotate() error {
+	err := b.active.fd.Sync()
+	if err != nil {
+		return err
+	}
+	err = writeFile(b.path(HintFileNameFromID(b.active.id)), b.hints)
+	if err != nil {
+		return err
+	}
+	return b.newActiveFile()
+}
+
+// write appends a record to the active data file and updates the keydir.
+// A nil value writes a tombstone. The lock must be held.
+func (b *Bitcask) write(k string, v []byte) error {
+	e := &binary.Entry{Key: []byte(k), Value: v}
+	// rotate the active file if the record does not fit
+	if b.active.size > 0 && b.active.size+recordSize(e) > b.conf.MaxFileSize {
+		err := b.rotate()
+		if err != nil {
+			return err
+		}
+	}
+	rec := appendRecord(nil, b.seq+1, e)
+	_, err := b.active.fd.Write(rec)
+	if err != nil {
+		return err
+	}
+	if b.conf.SyncOnWrite {
+		err = b.active.fd.Sync()
+		if err != nil {
+			return err
+		}
+	}
+	b.seq++
+	loc := location{
+		fid:    b.active.id,
+		size:   uint32(len(rec)),
+		offset: b.active.size,
+		seq:    b.seq,
+	}
+	b.active.size += int64(len(rec))
+	b.hints = appendHint(b.hints, e.Key, loc, v == nil)
+	// update the keydir
+	var old []byte
+	var ok bool
+	if v == nil {
+		old, ok = b.keydir.Del(k)
+		b.active.dead += int64(len(rec))
+	} else {
+		old, ok = b.keydir.Put(k, loc.encode())
+	}
+	if ok {
+		ol := decodeLocation(old)
+		b.files[ol.fid].dead += int64(ol.size)
+	}
+	return nil
+}
+
+func checkKey(k string, max int64) error {
+	if len(k) < minKeySizeAllowed {
+		return ErrBadKey
+	}
+	if int64(len(k)) > max {
+		return ErrKeyTooLarge
+	}
+	return nil
+}
+
+func checkValue(v []byte, max int64) error {
+	if v == nil || len(v) < minValueSizeAllowed {
+		return ErrBadValue
+	}
+	if int64(len(v)) > max {
+		return ErrValueTooLarge
+	}
+	return nil
+}
+
+// Has returns a boolean signaling weather or not the key is in
+// the Bitcask. Only the keydir is checked, so it never has to
+// read from disk, and there are no false positives.
+func (b *Bitcask) Has(k string) bool {
+	err := checkKey(k, b.conf.MaxKeySize)
+	if err != nil {
+		return false
+	}
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.closed {
+		return false
+	}
+	_, ok := b.keydir.Get(k)
+	return ok
+}
+
+// Put takes a key and a value and adds them to the Bitcask. If
+// the entry already exists, it overwrites the old entry.
+func (b *Bitcask) Put(k string, v []byte) error {
+	// check entry
+	err := checkKey(k, b.conf.MaxKeySize)
+	if err != nil {
+		return err
+	}
+	err = checkValue(v, b.conf.MaxValueSize)
+	if err != nil {
+		return err
+	}
+	// lock
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+	return b.write(k, v)
+}
+
+// Get takes a key and attempts to find a match in the Bitcask. If
+// a match cannot be found Get returns a nil value and ErrKeyNotFound.
+func (b *Bitcask) Get(k string) ([]byte, error) {
+	// check key
+	err := checkKey(k, b.conf.MaxKeySize)
+	if err != nil {
+		return nil, err
+	}
+	// read lock
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	v, ok := b.keydir.Get(k)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	loc := decodeLocation(v)
+	e, err := readRecordAt(b.files[loc.fid].fd, loc)
+	if err != nil {
+		return nil, err
+	}
+	return e.Value, nil
+}
+
+// Del takes a key and writes a tombstone for it, so it stays deleted
+// when the keydir is rebuilt. Deleting a key that is not in the Bitcask
+// does nothing.
+func (b *Bitcask) Del(k string) error {
+	// check key
+	err := checkKey(k, b.conf.MaxKeySize)
+	if err != nil {
+		return err
+	}
+	// lock
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+	if _, ok := b.keydir.Get(k); !ok {
+		return nil
+	}
+	return b.write(k, nil)
+}
+
+const (
+	ScanOldToNew = 0
+	ScanNewToOld = 1
+)
+
+// Scan takes a scan direction and an iteration function and calls it with
+// every live entry, reading the data files from the oldest to the newest
+// file (or the other way around). Entries are not ordered by key. Writes
+// are blocked during the scan.
+func (b *Bitcask) Scan(direction int, iter func(e *binary.Entry) bool) error {
+	if direction != ScanOldToNew && direction != ScanNewToOld {
+		return ErrBadScan
+	}
+	// read lock
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.closed {
+		return ErrClosed
+	}
+	ids := make([]uint32, 0, len(b.files))
+	for id := range b.files {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if direction == ScanNewToOld {
+			return ids[i] > ids[j]
+		}
+		return ids[i] < ids[j]
+	})
+	for _, id := range ids {
+		df := b.files[id]
+		rr := newRecordReader(io.NewSectionReader(df.fd, 0, df.size))
+		for {
+			loc, e, _, err := rr.next()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return err
+			}
+			if e.Value == nil {
+				continue
+			}
+			// only the latest record of a key is live
+			v, ok := b.keydir.Get(string(e.Key))
+			if !ok {
+				continue
+			}
+			if cur := decodeLocation(v); cur.fid != id || cur.offset != loc.offset {
+				continue
+			}
+			if !iter(e) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// Len returns the number of keys in the Bitcask
+func (b *Bitcask) Len() int {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.closed {
+		return 0
+	}
+	return b.keydir.Len()
+}
+
+// Sync flushes the active data file to disk
+func (b *Bitcask) Sync() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+	return b.active.fd.Sync()
+}
+
+// Close stops any background merges, syncs the active data file, writes
+// its hint file and closes all the files
+func (b *Bitcask) Close() error {
+	// stop background merges, and wait for any other merge
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return ErrClosed
+	}
+	b.closed = true
+	close(b.done)
+	b.lock.Unlock()
+	b.wg.Wait()
+	b.mergeLock.Lock()
+	defer b.mergeLock.Unlock()
+	// lock
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var err error
+	if b.active.size > 0 {
+		err = b.active.fd.Sync()
+		if err == nil {
+			err = writeFile(b.path(HintFileNameFromID(b.active.id)), b.hints)
+		}
+	}
+	b.closeFiles()
+	b.keydir.Close()
+	return err
+}
+
+// closeFiles closes all the data files, removing the active
+// data file if nothing was written to it
+func (b *Bitcask) closeFiles() {
+	for id, df := range b.files {
+		_ = df.fd.Close()
+		if df.size == 0 {
+			_ = os.Remove(df.fd.Name())
+		}
+		delete(b.files, id)
+	}
+}
@@ -0,0 +1,275 @@
+package bitcask
+
+import (
+	"fmt"
+	"github.com/scottcagno/storage/pkg/lsmt/binary"
+	"github.com/scottcagno/storage/pkg/util"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	thousand = 1000
+	n        = 1
+)
+
+func makeKey(i int) string {
+	return fmt.Sprintf("key-%06d", i)
+}
+
+func makeVal(i, gen int) []byte {
+	return []byte(fmt.Sprintf("value-%06d-%d", i, gen))
+}
+
+func testConfig(name string) *Config {
+	return &Config{
+		BaseDir:     "bitcask-testing-" + name,
+		MaxFileSize: 16 * SizeKB,
+	}
+}
+
+func openOrFail(t *testing.T, conf *Config) *Bitcask {
+	b, err := Open(conf)
+	if err != nil {
+		t.Fatalf("open: %v\n", err)
+	}
+	return b
+}
+
+// check makes sure every key holds the value of the provided
+// generation, except the deleted keys which must be missing
+func check(t *testing.T, b *Bitcask, count, gen int, deleted func(i int) bool) {
+	for i := 0; i < count; i++ {
+		v, err := b.Get(makeKey(i))
+		if deleted != nil && deleted(i) {
+			util.AssertEqual(t, ErrKeyNotFound, err)
+			util.AssertEqual(t, false, b.Has(makeKey(i)))
+			continue
+		}
+		if err != nil {
+			t.Fatalf("get(%q): %v\n", makeKey(i), err)
+		}
+		util.AssertEqual(t, string(makeVal(i, gen)), string(v))
+		util.AssertEqual(t, true, b.Has(makeKey(i)))
+	}
+}
+
+func TestBitcask(t *testing.T) {
+	conf := testConfig("basic")
+	defer os.RemoveAll(conf.BaseDir)
+	b := openOrFail(t, conf)
+	count := 2 * thousand * n
+	for i := 0; i < count; i++ {
+		err := b.Put(makeKey(i), makeVal(i, 0))
+		util.AssertNoError(t, err)
+	}
+	for i := 0; i < count; i += 3 {
+		err := b.Del(makeKey(i))
+		util.AssertNoError(t, err)
+	}
+	deleted := func(i int) bool { return i%3 == 0 }
+	check(t, b, count, 0, deleted)
+	util.AssertEqual(t, ErrBadValue, b.Put("key", nil))
+	util.AssertEqual(t, ErrBadKey, b.Put("", []byte("value")))
+	util.AssertEqual(t, count-(count+2)/3, b.Len())
+	util.AssertNoError(t, b.Close())
+	util.AssertEqual(t, ErrClosed, b.Close())
+
+	// reopen using the hint files
+	b = openOrFail(t, conf)
+	check(t, b, count, 0, deleted)
+	util.AssertNoError(t, b.Close())
+
+	// and again without them
+	hints, err := filepath.Glob(filepath.Join(conf.BaseDir, "*"+hintFileSuffix))
+	util.AssertNoError(t, err)
+	for _, hint := range hints {
+		util.AssertNoError(t, os.Remove(hint))
+	}
+	b = openOrFail(t, conf)
+	check(t, b, count, 0, deleted)
+	util.AssertNoError(t, b.Close())
+}
+
+func TestBitcask_Recovery(t *testing.T) {
+	conf := testConfig("recovery")
+	defer os.RemoveAll(conf.BaseDir)
+	b := openOrFail(t, conf)
+	count := thousand * n
+	for i := 0; i < count; i++ {
+		err := b.Put(makeKey(i), makeVal(i, 0))
+		util.AssertNoError(t, err)
+	}
+	err := b.Del(makeKey(0))
+	util.AssertNoError(t, err)
+	// crash without writing the hint file of the active file,
+	// and leave a partially written record at the end of it
+	path := b.active.fd.Name()
+	size := b.active.size
+	b.closeFiles()
+	fd, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+	util.AssertNoError(t, err)
+	rec := appendRecord(nil, 1<<40, &binary.Entry{Key: []byte("torn"), Value: []byte("write")})
+	_, err = fd.Write(rec[:len(rec)-3])
+	util.AssertNoError(t, err)
+	util.AssertNoError(t, fd.Close())
+
+	b = openOrFail(t, conf)
+	check(t, b, count, 0, func(i int) bool { return i == 0 })
+	util.AssertEqual(t, false, b.Has("torn"))
+	fi, err := os.Stat(path)
+	util.AssertNoError(t, err)
+	util.AssertEqual(t, size, fi.Size())
+	// writes carry on with newer sequence numbers
+	util.AssertNoError(t, b.Put(makeKey(1), makeVal(1, 1)))
+	util.AssertNoError(t, b.Close())
+	b = openOrFail(t, conf)
+	v, err := b.Get(makeKey(1))
+	util.AssertNoError(t, err)
+	util.AssertEqual(t, string(makeVal(1, 1)), string(v))
+	util.AssertNoError(t, b.Close())
+}
+
+func TestBitcask_Merge(t *testing.T) {
+	conf := testConfig("merge")
+	defer os.RemoveAll(conf.BaseDir)
+	b := openOrFail(t, conf)
+	count := thousand * n
+	gens := 5
+	for gen := 0; gen < gens; gen++ {
+		for i := 0; i < count; i++ {
+			err := b.Put(makeKey(i), makeVal(i, gen))
+			util.AssertNoError(t, err)
+		}
+	}
+	for i := 0; i < count; i += 2 {
+		util.AssertNoError(t, b.Del(makeKey(i)))
+	}
+	deleted := func(i int) bool { return i%2 == 0 }
+	before, err := b.Stats()
+	util.AssertNoError(t, err)
+	util.AssertEqual(t, true, b.needsMerge())
+
+	util.AssertNoError(t, b.Merge())
+	after, err := b.Stats()
+	util.AssertNoError(t, err)
+	util.AssertEqual(t, int64(0), after.DeadBytes)
+	util.AssertEqual(t, true, after.Size < before.Size/(2*int64(gens)-2))
+	util.AssertEqual(t, true, after.DataFiles < before.DataFiles)
+	util.AssertEqual(t, false, b.needsMerge())
+	check(t, b, count, gens-1, deleted)
+	util.AssertNoError(t, b.Close())
+
+	// the deleted keys must stay deleted
+	b = openOrFail(t, conf)
+	check(t, b, count, gens-1, deleted)
+	st, err := b.Stats()
+	util.AssertNoError(t, err)
+	util.AssertEqual(t, after.Size, st.Size)
+	util.AssertNoError(t, b.Close())
+	_, err = os.Stat(filepath.Join(conf.BaseDir, mergeFileName))
+	util.AssertEqual(t, true, os.IsNotExist(err))
+}
+
+func TestBitcask_MergeFailed(t *testing.T) {
+	conf := testConfig("merge-failed")
+	defer os.RemoveAll(conf.BaseDir)
+	b := openOrFail(t, conf)
+	count := thousand * n
+	for gen := 0; gen < 3; gen++ {
+		for i := 0; i < count; i++ {
+			err := b.Put(makeKey(i), makeVal(i, gen))
+			util.AssertNoError(t, err)
+		}
+	}
+	// the MERGE file can not be written if its temp file is a directory
+	err := os.Mkdir(filepath.Join(conf.BaseDir, mergeFileName+".tmp"), 0755)
+	util.AssertNoError(t, err)
+	util.AssertEqual(t, true, b.Merge() != nil)
+
+	// the files written by the merge are removed
+	st, err := b.Stats()
+	util.AssertNoError(t, err)
+	data, err := filepath.Glob(filepath.Join(conf.BaseDir, "*"+dataFileSuffix))
+	util.AssertNoError(t, err)
+	util.AssertEqual(t, st.DataFiles, len(data))
+	hints, err := filepath.Glob(filepath.Join(conf.BaseDir, "*"+hintFileSuffix))
+	util.AssertNoError(t, err)
+	util.AssertEqual(t, true, len(hints) < len(data))
+	_, err = os.Stat(filepath.Join(conf.BaseDir, mergeFileName))
+	util.AssertEqual(t, true, os.IsNotExist(err))
+	check(t, b, count, 2, nil)
+	util.AssertNoError(t, b.Close())
+}
+
+func TestBitcask_MergeConcurrent(t *testing.T) {
+	conf := testConfig("merge-concurrent")
+	conf.MergeInterval = 5 * time.Millisecond
+	conf.MergeRatio = 0.3
+	defer os.RemoveAll(conf.BaseDir)
+	b := openOrFail(t, conf)
+	count := thousand * n
+	gens := 10
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for gen := 0; gen < gens; gen++ {
+				for i := w; i < count; i += 4 {
+					err := b.Put(makeKey(i), makeVal(i, gen))
+					if err != nil {
+						t.Errorf("put: %v\n", err)
+						return
+					}
+				}
+				if w == 0 && gen%3 == 0 {
+					err := b.Merge()
+					if err != nil {
+						t.Errorf("merge: %v\n", err)
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	check(t, b, count, gens-1, nil)
+	util.AssertNoError(t, b.Close())
+	b = openOrFail(t, conf)
+	check(t, b, count, gens-1, nil)
+	util.AssertNoError(t, b.Close())
+}
+
+func TestBitcask_Scan(t *testing.T) {
+	conf := testConfig("scan")
+	defer os.RemoveAll(conf.BaseDir)
+	b := openOrFail(t, conf)
+	count := thousand * n
+	for gen := 0; gen < 2; gen++ {
+		for i := 0; i < count; i++ {
+			util.AssertNoError(t, b.Put(makeKey(i), makeVal(i, gen)))
+		}
+	}
+	util.AssertNoError(t, b.Del(makeKey(7)))
+	for _, dir := range []int{ScanOldToNew, ScanNewToOld} {
+		seen := make(map[string]bool)
+		err := b.Scan(dir, func(e *binary.Entry) bool {
+			var i, gen int
+			_, err := fmt.Sscanf(string(e.Value), "value-%06d-%d", &i, &gen)
+			util.AssertNoError(t, err)
+			util.AssertEqual(t, 1, gen)
+			util.AssertEqual(t, false, seen[string(e.Key)])
+			seen[string(e.Key)] = true
+			return true
+		})
+		util.AssertNoError(t, err)
+		util.AssertLen(t, count-1, len(seen))
+		util.AssertEqual(t, false, seen[makeKey(7)])
+	}
+	util.AssertEqual(t, ErrBadScan, b.Scan(2, nil))
+	util.AssertNoError(t, b.Close())
+}
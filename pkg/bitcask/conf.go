@@ -0,0 +1,108 @@
+package bitcask
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+const (
+	SizeKB = 1 << 10
+	SizeMB = 1 << 20
+)
+
+const (
+	// path defaults
+	defaultBaseDir = "data"
+
+	// default sizes
+	defaultMaxFileSize  = 64 * SizeMB
+	defaultMaxKeySize   = math.MaxUint8 // 255 B
+	defaultMaxValueSize = SizeMB
+
+	// merging
+	defaultMergeRatio = 0.5
+
+	// minimum size bounds
+	minFileSizeAllowed  = 4 * SizeKB
+	minKeySizeAllowed   = 1
+	minValueSizeAllowed = 1
+
+	// maximum size bounds
+	maxFileSizeAllowed  = math.MaxUint32
+	maxKeySizeAllowed   = math.MaxUint16 // 64 KB
+	maxValueSizeAllowed = 1 << 30        // 1 GB
+)
+
+// Config holds the configuration options for a Bitcask
+type Config struct {
+	BaseDir       string        // base directory of the data and hint files
+	MaxFileSize   int64         // size at which the active data file is rotated
+	SyncOnWrite   bool          // sync the active data file after every write
+	MaxKeySize    int64         // the maximum allowed key size
+	MaxValueSize  int64         // the maximum allowed value size
+	MergeInterval time.Duration // how often to check if a merge is needed (0 disables background merges)
+	MergeRatio    float64       // merge when this fraction of the data on disk is dead
+}
+
+var defaultConfig = &Config{
+	BaseDir:      defaultBaseDir,
+	MaxFileSize:  defaultMaxFileSize,
+	MaxKeySize:   defaultMaxKeySize,
+	MaxValueSize: defaultMaxValueSize,
+	MergeRatio:   defaultMergeRatio,
+}
+
+func (conf *Config) String() string {
+	data, err := json.MarshalIndent(conf, "", "\t")
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+// checkConfig is a helper to make sure the configuration
+// options are correct and handles and missing options
+func checkConfig(conf *Config) *Config {
+	if conf == nil {
+		c := *defaultConfig
+		return &c
+	}
+	if conf.BaseDir == "" {
+		conf.BaseDir = defaultBaseDir
+	}
+	if conf.MaxFileSize <= 0 {
+		conf.MaxFileSize = defaultMaxFileSize
+	}
+	if conf.MaxFileSize < minFileSizeAllowed {
+		conf.MaxFileSize = minFileSizeAllowed
+	}
+	if conf.MaxFileSize > maxFileSizeAllowed {
+		conf.MaxFileSize = maxFileSizeAllowed
+	}
+	if conf.MaxKeySize <= 0 {
+		conf.MaxKeySize = defaultMaxKeySize
+	}
+	if conf.MaxKeySize < minKeySizeAllowed {
+		conf.MaxKeySize = minKeySizeAllowed
+	}
+	if conf.MaxKeySize > maxKeySizeAllowed {
+		conf.MaxKeySize = maxKeySizeAllowed
+	}
+	if conf.MaxValueSize <= 0 {
+		conf.MaxValueSize = defaultMaxValueSize
+	}
+	if conf.MaxValueSize < minValueSizeAllowed {
+		conf.MaxValueSize = minValueSizeAllowed
+	}
+	if conf.MaxValueSize > maxValueSizeAllowed {
+		conf.MaxValueSize = maxValueSizeAllowed
+	}
+	if conf.MergeInterval < 0 {
+		conf.MergeInterval = 0
+	}
+	if conf.MergeRatio <= 0 || conf.MergeRatio > 1 {
+		conf.MergeRatio = defaultMergeRatio
+	}
+	return conf
+}
@@ -0,0 +1,19 @@
+package bitcask
+
+import (
+	"errors"
+)
+
+var (
+	ErrKeyNotFound = errors.New("bitcask: key not found")
+	ErrClosed      = errors.New("bitcask: closed")
+
+	ErrBadKey        = errors.New("bitcask: bad key")
+	ErrKeyTooLarge   = errors.New("bitcask: key too large")
+	ErrBadValue      = errors.New("bitcask: bad value")
+	ErrValueTooLarge = errors.New("bitcask: value too large")
+
+	ErrBadChecksum = errors.New("bitcask: bad checksum")
+	ErrCorrupted   = errors.New("bitcask: corrupted record")
+	ErrBadScan     = errors.New("bitcask: bad scan direction")
+)
@@ -0,0 +1,268 @@
+package bitcask
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mergeFileName is the name of the file listing the data files that a
+// merge has replaced. Once it is written the merge is complete, and the
+// files it lists are removed (again, if needed) when the Bitcask is opened.
+const mergeFileName = "MERGE"
+
+// moved is a record copied by a merge
+type moved struct {
+	key      string
+	from, to location
+}
+
+// mergeOutput is a data file written by a merge
+type mergeOutput struct {
+	df    *dataFile
+	bw    *bufio.Writer
+	hints []byte
+}
+
+// Merge rewrites the live records of all the data files except the active
+// one into new data files (with hint files), and then removes the old files.
+// Tombstones and overwritten records are dropped. The active data file is
+// rotated first, so everything written before the merge started is merged.
+// Reads and writes carry on while the merge is running.
+func (b *Bitcask) Merge() error {
+	b.mergeLock.Lock()
+	defer b.mergeLock.Unlock()
+	// rotate the active file, and take all the others as the input
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return ErrClosed
+	}
+	if b.active.size > 0 {
+		err := b.rotate()
+		if err != nil {
+			b.lock.Unlock()
+			return err
+		}
+	}
+	var inputs []*dataFile
+	for _, df := range b.files {
+		if df != b.active {
+			inputs = append(inputs, df)
+		}
+	}
+	b.lock.Unlock()
+	if len(inputs) == 0 {
+		return nil
+	}
+	sort.Slice(inputs, func(i, j int) bool {
+		return inputs[i].id < inputs[j].id
+	})
+	// copy the live records
+	var outputs []*mergeOutput
+	var moves []moved
+	err := b.copyLive(inputs, &outputs, &moves)
+	if err != nil {
+		b.removeOutputs(outputs)
+		return err
+	}
+	// record which files have been replaced; from now on
+	// the merge is complete, even if we were to crash
+	var list strings.Builder
+	for _, df := range inputs {
+		fmt.Fprintf(&list, "%d\n", df.id)
+	}
+	err = writeFile(b.path(mergeFileName), []byte(list.String()))
+	if err != nil {
+		b.removeOutputs(outputs)
+		return err
+	}
+	// point the keydir at the new files, unless a key was written while
+	// the merge was running, and remove the old files
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, out := range outputs {
+		b.files[out.df.id] = out.df
+	}
+	for _, m := range moves {
+		v, ok := b.keydir.Get(m.key)
+		if ok {
+			if cur := decodeLocation(v); cur.fid == m.from.fid && cur.offset == m.from.offset {
+				b.keydir.Put(m.key, m.to.encode())
+				continue
+			}
+		}
+		b.files[m.to.fid].dead += int64(m.to.size)
+	}
+	for _, df := range inputs {
+		_ = df.fd.Close()
+		delete(b.files, df.id)
+	}
+	return b.finishMerge()
+}
+
+// removeOutputs closes and removes the files written by a merge that failed
+func (b *Bitcask) removeOutputs(outputs []*mergeOutput) {
+	for _, out := range outputs {
+		_ = out.df.fd.Close()
+		_ = os.Remove(out.df.fd.Name())
+		_ = os.Remove(b.path(HintFileNameFromID(out.df.id)))
+	}
+}
+
+// copyLive copies the live records of the input files to new data files
+func (b *Bitcask) copyLive(inputs []*dataFile, outputs *[]*mergeOutput, moves *[]moved) error {
+	var out *mergeOutput
+	for _, df := range inputs {
+		rr := newRecordReader(io.NewSectionReader(df.fd, 0, df.size))
+		for {
+			loc, e, raw, err := rr.next()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return err
+			}
+			if e.Value == nil {
+				continue
+			}
+			v, ok := b.keydir.Get(string(e.Key))
+			if !ok {
+				continue
+			}
+			if cur := decodeLocation(v); cur.fid != df.id || cur.offset != loc.offset {
+				continue
+			}
+			// start a new output file if needed
+			if out == nil || out.df.size+int64(len(raw)) > b.conf.MaxFileSize {
+				if out != nil {
+					err = b.finishOutput(out)
+					if err != nil {
+						return err
+					}
+				}
+				out, err = b.newOutput()
+				if err != nil {
+					return err
+				}
+				*outputs = append(*outputs, out)
+			}
+			// copy the record as it is, keeping its sequence number
+			_, err = out.bw.Write(raw)
+			if err != nil {
+				return err
+			}
+			to := location{
+				fid:    out.df.id,
+				size:   loc.size,
+				offset: out.df.size,
+				seq:    loc.seq,
+			}
+			out.df.size += int64(len(raw))
+			out.hints = appendHint(out.hints, e.Key, to, false)
+			loc.fid = df.id
+			*moves = append(*moves, moved{key: string(e.Key), from: loc, to: to})
+		}
+	}
+	if out != nil {
+		return b.finishOutput(out)
+	}
+	return nil
+}
+
+// newOutput creates a new data file for a merge to write to
+func (b *Bitcask) newOutput() (*mergeOutput, error) {
+	b.lock.Lock()
+	id := b.nextID
+	b.nextID++
+	b.lock.Unlock()
+	fd, err := os.OpenFile(b.path(DataFileNameFromID(id)), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &mergeOutput{
+		df: &dataFile{id: id, fd: fd},
+		bw: bufio.NewWriterSize(fd, 64*SizeKB),
+	}, nil
+}
+
+// finishOutput flushes and syncs a data file written by
+// a merge, and writes its hint file
+func (b *Bitcask) finishOutput(out *mergeOutput) error {
+	err := out.bw.Flush()
+	if err != nil {
+		return err
+	}
+	err = out.df.fd.Sync()
+	if err != nil {
+		return err
+	}
+	return writeFile(b.path(HintFileNameFromID(out.df.id)), out.hints)
+}
+
+// finishMerge removes the data and hint files listed in the merge
+// file (if there is one), and then the merge file itself
+func (b *Bitcask) finishMerge() error {
+	path := b.path(mergeFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, line := range strings.Fields(string(data)) {
+		var id uint32
+		_, err = fmt.Sscanf(line, "%d", &id)
+		if err != nil {
+			continue
+		}
+		err = os.Remove(b.path(HintFileNameFromID(id)))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		err = os.Remove(b.path(DataFileNameFromID(id)))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Remove(path)
+}
+
+// needsMerge reports whether enough of the data on disk is dead
+func (b *Bitcask) needsMerge() bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.closed {
+		return false
+	}
+	var size, dead int64
+	for _, df := range b.files {
+		size += df.size
+		dead += df.dead
+	}
+	return size > 0 && float64(dead)/float64(size) >= b.conf.MergeRatio
+}
+
+// mergeLoop merges in the background whenever enough of the data is dead
+func (b *Bitcask) mergeLoop() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.conf.MergeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			if b.needsMerge() {
+				// errors are not fatal, the merge is
+				// simply tried again on the next tick
+				_ = b.Merge()
+			}
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package bitcask
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	lsmtbinary "github.com/scottcagno/storage/pkg/lsmt/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+/*
+	Data files are append-only logs of records. Every record is the
+	binary entry encoding used by the lsm-tree (see lsmt/binary) with
+	a checksum and a sequence number in front of it:
+
+	+----------+----------+----------+----------+-----+-------+
+	| crc32    | seq      | key len  | val len  | key | value |
+	| 4 bytes  | 8 bytes  | 8 bytes  | 8 bytes  |     |       |
+	+----------+----------+----------+----------+-----+-------+
+
+	The checksum covers everything after it. A record with an empty value
+	is a tombstone. Sequence numbers grow with every write, and they are
+	what decides which record of a key is the latest one when the keydir
+	is rebuilt, so the records of a key can be in any of the files.
+
+	Hint files hold one hint for every record of a data file, so the
+	keydir can be rebuilt without reading any values. Every hint is an
+	entry with the key of the record and a value holding the sequence
+	number, offset and size of the record (the top bit of the size marks
+	a tombstone), again with a checksum in front of it.
+*/
+
+const (
+	dataFileSuffix = ".data"
+	hintFileSuffix = ".hint"
+
+	crcSize          = 4
+	entryHeaderSize  = 16
+	recordHeaderSize = crcSize + 8 + entryHeaderSize
+	hintHeaderSize   = crcSize + entryHeaderSize
+	hintValueSize    = 8 + 8 + 4
+	locationSize     = 4 + 4 + 8 + 8
+
+	// the key length also holds the entry type in its top byte
+	entryKeyMask = 1<<56 - 1
+
+	// marks the hint of a tombstone
+	hintTombstone = 1 << 31
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// DataFileNameFromID returns the data file name of the provided file id
+func DataFileNameFromID(id uint32) string {
+	return fmt.Sprintf("%010d%s", id, dataFileSuffix)
+}
+
+// HintFileNameFromID returns the hint file name of the provided file id
+func HintFileNameFromID(id uint32) string {
+	return fmt.Sprintf("%010d%s", id, hintFileSuffix)
+}
+
+// IDFromFileName returns the file id of a data or hint file name
+func IDFromFileName(name string) (uint32, error) {
+	var id uint32
+	_, err := fmt.Sscanf(filepath.Base(name), "%010d", &id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// location is where the latest record of a key is found
+type location struct {
+	fid    uint32 // id of the data file
+	size   uint32 // size of the whole record
+	offset int64  // offset of the record in the data file
+	seq    uint64 // sequence number of the record
+}
+
+// encode returns the location encoded for the keydir
+func (l location) encode() []byte {
+	b := make([]byte, locationSize)
+	binary.LittleEndian.PutUint32(b[0:4], l.fid)
+	binary.LittleEndian.PutUint32(b[4:8], l.size)
+	binary.LittleEndian.PutUint64(b[8:16], uint64(l.offset))
+	binary.LittleEndian.PutUint64(b[16:24], l.seq)
+	return b
+}
+
+// decodeLocation decodes a location from the keydir
+func decodeLocation(b []byte) location {
+	return location{
+		fid:    binary.LittleEndian.Uint32(b[0:4]),
+		size:   binary.LittleEndian.Uint32(b[4:8]),
+		offset: int64(binary.LittleEndian.Uint64(b[8:16])),
+		seq:    binary.LittleEndian.Uint64(b[16:24]),
+	}
+}
+
+// recordSize returns the size of the record for the provided entry
+func recordSize(e *lsmtbinary.Entry) int64 {
+	return int64(recordHeaderSize + len(e.Key) + len(e.Value))
+}
+
+// appendRecord appends the encoded record to the provided buffer
+func appendRecord(buf []byte, seq uint64, e *lsmtbinary.Entry) []byte {
+	start := len(buf)
+	var hdr [crcSize + 8]byte
+	binary.LittleEndian.PutUint64(hdr[crcSize:], seq)
+	buf = append(buf, hdr[:]...)
+	buf = lsmtbinary.AppendEntry(buf, e)
+	crc := crc32.Checksum(buf[start+crcSize:], crcTable)
+	binary.LittleEndian.PutUint32(buf[start:], crc)
+	return buf
+}
+
+// decodeRecord decodes a whole record, verifying its checksum
+func decodeRecord(b []byte) (uint64, *lsmtbinary.Entry, error) {
+	if len(b) < recordHeaderSize {
+		return 0, nil, ErrCorrupted
+	}
+	if binary.LittleEndian.Uint32(b) != crc32.Checksum(b[crcSize:], crcTable) {
+		return 0, nil, ErrBadChecksum
+	}
+	seq := binary.LittleEndian.Uint64(b[crcSize:])
+	e, err := lsmtbinary.DecodeEntry(bytes.NewReader(b[crcSize+8:]))
+	if err != nil {
+		return 0, nil, ErrCorrupted
+	}
+	return seq, e, nil
+}
+
+// readRecordAt reads and decodes the record at the provided location
+func readRecordAt(r io.ReaderAt, loc location) (*lsmtbinary.Entry, error) {
+	b := make([]byte, loc.size)
+	_, err := r.ReadAt(b, loc.offset)
+	if err != nil {
+		return nil, err
+	}
+	_, e, err := decodeRecord(b)
+	return e, err
+}
+
+// recordReader reads the records of a data file in order
+type recordReader struct {
+	br     *bufio.Reader
+	offset int64
+	buf    []byte
+}
+
+func newRecordReader(r io.Reader) *recordReader {
+	return &recordReader{
+		br: bufio.NewReaderSize(r, 64*SizeKB),
+	}
+}
+
+// next returns the next record along with its location (the file id is
+// not set) and its raw bytes, which are only valid until the next call.
+// It returns io.EOF at the end of the file, and ErrCorrupted or
+// ErrBadChecksum if the rest of the file can't be read.
+func (rr *recordReader) next() (location, *lsmtbinary.Entry, []byte, error) {
+	var hdr [recordHeaderSize]byte
+	_, err := io.ReadFull(rr.br, hdr[:])
+	if err != nil {
+		if err == io.EOF {
+			return location{}, nil, nil, io.EOF
+		}
+		// partially written record
+		return location{}, nil, nil, ErrCorrupted
+	}
+	klen := binary.LittleEndian.Uint64(hdr[crcSize+8:]) & entryKeyMask
+	vlen := binary.LittleEndian.Uint64(hdr[crcSize+16:])
+	if klen < minKeySizeAllowed || klen > maxKeySizeAllowed || vlen > maxValueSizeAllowed {
+		return location{}, nil, nil, ErrCorrupted
+	}
+	size := recordHeaderSize + int(klen) + int(vlen)
+	if cap(rr.buf) < size {
+		rr.buf = make([]byte, size)
+	}
+	b := rr.buf[:size]
+	copy(b, hdr[:])
+	_, err = io.ReadFull(rr.br, b[recordHeaderSize:])
+	if err != nil {
+		return location{}, nil, nil, ErrCorrupted
+	}
+	seq, e, err := decodeRecord(b)
+	if err != nil {
+		return location{}, nil, nil, err
+	}
+	loc := location{
+		size:   uint32(size),
+		offset: rr.offset,
+		seq:    seq,
+	}
+	rr.offset += int64(size)
+	return loc, e, b, nil
+}
+
+// appendHint appends the encoded hint for the record of key at the
+// provided location to buf
+func appendHint(buf []byte, key []byte, loc location, tombstone bool) []byte {
+	start := len(buf)
+	size := loc.size
+	if tombstone {
+		size |= hintTombstone
+	}
+	var val [hintValueSize]byte
+	binary.LittleEndian.PutUint64(val[0:8], loc.seq)
+	binary.LittleEndian.PutUint64(val[8:16], uint64(loc.offset))
+	binary.LittleEndian.PutUint32(val[16:20], size)
+	buf = append(buf, 0, 0, 0, 0)
+	buf = lsmtbinary.AppendEntry(buf, &lsmtbinary.Entry{Key: key, Value: val[:]})
+	crc := crc32.Checksum(buf[start+crcSize:], crcTable)
+	binary.LittleEndian.PutUint32(buf[start:], crc)
+	return buf
+}
+
+// readHints calls fn for every hint in the hint file at path
+func readHints(path string, fn func(key string, loc location, tombstone bool)) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	br := bufio.NewReaderSize(fd, 64*SizeKB)
+	var hdr [hintHeaderSize]byte
+	var buf []byte
+	for {
+		_, err = io.ReadFull(br, hdr[:])
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return ErrCorrupted
+		}
+		klen := binary.LittleEndian.Uint64(hdr[crcSize:]) & entryKeyMask
+		vlen := binary.LittleEndian.Uint64(hdr[crcSize+8:])
+		if klen < minKeySizeAllowed || klen > maxKeySizeAllowed || vlen != hintValueSize {
+			return ErrCorrupted
+		}
+		size := hintHeaderSize + int(klen) + int(vlen)
+		if cap(buf) < size {
+			buf = make([]byte, size)
+		}
+		b := buf[:size]
+		copy(b, hdr[:])
+		_, err = io.ReadFull(br, b[hintHeaderSize:])
+		if err != nil {
+			return ErrCorrupted
+		}
+		if binary.LittleEndian.Uint32(b) != crc32.Checksum(b[crcSize:], crcTable) {
+			return ErrBadChecksum
+		}
+		key := b[hintHeaderSize : hintHeaderSize+klen]
+		val := b[hintHeaderSize+klen:]
+		rsize := binary.LittleEndian.Uint32(val[16:20])
+		fn(string(key), location{
+			seq:    binary.LittleEndian.Uint64(val[0:8]),
+			offset: int64(binary.LittleEndian.Uint64(val[8:16])),
+			size:   rsize &^ hintTombstone,
+		}, rsize&hintTombstone != 0)
+	}
+}
+
+// writeFile writes the data to the file at path. It is used for the hint
+// files and the MERGE file. The file is written under a temporary name
+// first, so the file is either complete or missing.
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	fd, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = fd.Write(data)
+	if err != nil {
+		fd.Close()
+		os.Remove(tmp)
+		return err
+	}
+	err = fd.Sync()
+	if err != nil {
+		fd.Close()
+		os.Remove(tmp)
+		return err
+	}
+	err = fd.Close()
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package bitcask
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Stats holds some statistics about a Bitcask
+type Stats struct {
+	BaseDir   string `json:"base_dir"`
+	Keys      int    `json:"keys"`
+	DataFiles int    `json:"data_files"`
+	Size      int64  `json:"size"`       // total size of the data files
+	DeadBytes int64  `json:"dead_bytes"` // bytes taken by overwritten or deleted records
+}
+
+func (s *Stats) String() string {
+	var ss []string
+	ss = append(ss, fmt.Sprintf("%T", s))
+	ss = append(ss, fmt.Sprintf("\tBaseDir: %v", s.BaseDir))
+	ss = append(ss, fmt.Sprintf("\tKeys: %v", s.Keys))
+	ss = append(ss, fmt.Sprintf("\tDataFiles: %v", s.DataFiles))
+	ss = append(ss, fmt.Sprintf("\tSize: %v", s.Size))
+	ss = append(ss, fmt.Sprintf("\tDeadBytes: %v", s.DeadBytes))
+	return strings.Join(ss, "\n")
+}
+
+func (s *Stats) JSON() (string, error) {
+	dat, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	return string(dat), nil
+}
+
+// Stats returns statistics about the Bitcask
+func (b *Bitcask) Stats() (*Stats, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	st := &Stats{
+		BaseDir:   b.base,
+		Keys:      b.keydir.Len(),
+		DataFiles: len(b.files),
+	}
+	for _, df := range b.files {
+		st.Size += df.size
+		st.DeadBytes += df.dead
+	}
+	return st, nil
+}
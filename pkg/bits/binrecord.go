@@ -1,41 +1,65 @@
 package bits
 
+import (
+	"fmt"
+	"strconv"
+)
+
+// BinaryRecord is a growable set of bits backed by words
 type BinaryRecord struct {
-	data []byte
+	length uint
+	data   []sliceType
 }
 
 func NewBinaryRecord(hint uint) *BinaryRecord {
 	br := &BinaryRecord{
 		data: nil,
 	}
-	checkResize(&br.data, hint)
+	br.Resize(hint)
 	return br
 }
 
+// Resize grows the record so it holds i bits
 func (br *BinaryRecord) Resize(i uint) {
-	checkResize(&br.data, i)
+	if i <= br.length {
+		return
+	}
+	checkResizeWords(&br.data, i)
+	br.length = i
 }
 
 func (br *BinaryRecord) Set(i uint) {
-	RawBytesSetBit(&br.data, i)
+	br.Resize(i + 1)
+	br.data[i>>log2WordBits] |= 1 << (i & (wordBits - 1))
 }
 
 func (br *BinaryRecord) Unset(i uint) {
-	RawBytesUnsetBit(&br.data, i)
+	if i >= br.length {
+		return
+	}
+	br.data[i>>log2WordBits] &^= 1 << (i & (wordBits - 1))
 }
 
 func (br *BinaryRecord) IsSet(i uint) bool {
-	return RawBytesHasBit(&br.data, i)
+	if i >= br.length {
+		return false
+	}
+	return br.data[i>>log2WordBits]&(1<<(i&(wordBits-1))) != 0
 }
 
 func (br *BinaryRecord) Get(i uint) uint {
-	return RawBytesGetBit(&br.data, i)
+	if i >= br.length {
+		return 0
+	}
+	return uint(br.data[i>>log2WordBits] & (1 << (i & (wordBits - 1))))
 }
 
 func (br *BinaryRecord) Len() uint {
-	return uint(len(br.data) * 8)
+	return br.length
 }
 
 func (br *BinaryRecord) String() string {
-	return RawBytesStringer(&br.data)
+	// print binary value of the record
+	var res = strconv.Itoa(int(br.length))
+	return fmt.Sprintf("%."+res+"b (%s bits)", br.data, res)
 }
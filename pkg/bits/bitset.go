@@ -1,23 +1,28 @@
 package bits
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
+	mathbits "math/bits"
 	"strconv"
 )
 
 const (
-	ws    uint = 64                 // try tp match arch, if 32bit, change to 32
-	lg2ws uint = 6                  // this should be the log2(ws), so 6 for 64, and 5 for 32
-	all   uint = 0xffffffffffffffff // aka, (1<<64)-1, 1 left shift 64-1
-	max        = ^uint(0)
+	ws    uint   = 64                 // the bitset is always backed by 64-bit words
+	lg2ws uint   = 6                  // this should be the log2(ws), so 6 for 64
+	all   uint64 = 0xffffffffffffffff // aka, (1<<64)-1, 1 left shift 64-1
+	max          = ^uint(0)
 )
 
+var ErrBadFormat = errors.New("bits: bad bitset format")
+
 // random note: lgws can also be found using bitwise operations (x >> 1)
 
 // BitSet is a bit set data type
 type BitSet struct {
 	length uint
-	bits   []uint
+	bits   []uint64
 }
 
 // AlignedSize is an exported version of alignedSize
@@ -40,11 +45,16 @@ func (b *BitSet) resize(i uint) {
 	}
 	nsize := int(alignedSize(i + 1))
 	if b.bits == nil {
-		b.bits = make([]uint, nsize)
+		b.bits = make([]uint64, nsize)
 	} else if cap(b.bits) >= nsize {
+		old := len(b.bits)
 		b.bits = b.bits[:nsize] // fast resize
+		// the words past the old length may hold stale bits
+		for j := old; j < nsize; j++ {
+			b.bits[j] = 0
+		}
 	} else if len(b.bits) < nsize {
-		newset := make([]uint, nsize, 2*nsize) // increase capacity 2x
+		newset := make([]uint64, nsize, 2*nsize) // increase capacity 2x
 		copy(newset, b.bits)
 		b.bits = newset
 	}
@@ -56,10 +66,31 @@ func NewBitSet(length uint) *BitSet {
 	alignedLen := alignedSize(length)
 	return &BitSet{
 		length: length,
-		bits:   make([]uint, alignedLen),
+		bits:   make([]uint64, alignedLen),
 	}
 }
 
+// NewBitSetFromWords returns a BitSet of the provided length that uses
+// the provided words as its storage. The words are not copied.
+func NewBitSetFromWords(length uint, words []uint64) *BitSet {
+	n := int(alignedSize(length))
+	if len(words) < n {
+		words = append(words, make([]uint64, n-len(words))...)
+	}
+	b := &BitSet{
+		length: length,
+		bits:   words[:n],
+	}
+	b.clearTail()
+	return b
+}
+
+// Words returns the words backing the bitset. The words are not copied,
+// so changing them will change the bitset.
+func (b *BitSet) Words() []uint64 {
+	return b.bits
+}
+
 // SetMany is identical to calling Set repeatedly
 func (b *BitSet) SetMany(ii ...uint) *BitSet {
 	for _, i := range ii {
@@ -100,7 +131,7 @@ func (b *BitSet) Value(i uint) uint {
 	if i >= b.length {
 		return 0
 	}
-	return b.bits[i>>lg2ws] & (1 << (i & (ws - 1)))
+	return uint(b.bits[i>>lg2ws] & (1 << (i & (ws - 1))))
 }
 
 // Len returns the number of bits in the bitset
@@ -116,11 +147,233 @@ func (b *BitSet) String() string {
 }
 
 func (b *BitSet) PercentageFull() (int, float64) {
-	var isset int
-	for i := uint(0); i < b.length; i++ {
-		if b.bits[i>>lg2ws]&(1<<(i&(ws-1))) != 0 {
-			isset++
+	isset := int(b.Count())
+	return isset, float64(isset) / float64(b.length)
+}
+
+// clearTail clears any bits in the last word that are past the length
+func (b *BitSet) clearTail() {
+	if n := b.length & (ws - 1); n != 0 && len(b.bits) > 0 {
+		b.bits[len(b.bits)-1] &= (1 << n) - 1
+	}
+}
+
+// grow makes sure the bitset is at least length bits long
+func (b *BitSet) grow(length uint) {
+	if length > b.length {
+		b.resize(length - 1)
+	}
+}
+
+// Clone returns a copy of the bitset
+func (b *BitSet) Clone() *BitSet {
+	words := make([]uint64, len(b.bits))
+	copy(words, b.bits)
+	return &BitSet{
+		length: b.length,
+		bits:   words,
+	}
+}
+
+// Equal returns true if both bitsets have the same length and bits
+func (b *BitSet) Equal(o *BitSet) bool {
+	if b.length != o.length {
+		return false
+	}
+	for i := range b.bits {
+		if b.bits[i] != o.bits[i] {
+			return false
 		}
 	}
-	return isset, float64(isset) / float64(b.length)
+	return true
+}
+
+// InPlaceAnd keeps only the bits that are set in both bitsets. The
+// length of the bitset does not change.
+func (b *BitSet) InPlaceAnd(o *BitSet) *BitSet {
+	for i := range b.bits {
+		if i < len(o.bits) {
+			b.bits[i] &= o.bits[i]
+		} else {
+			b.bits[i] = 0
+		}
+	}
+	return b
+}
+
+// InPlaceOr sets every bit that is set in the other bitset. If the other
+// bitset is longer, the bitset grows to the same length.
+func (b *BitSet) InPlaceOr(o *BitSet) *BitSet {
+	b.grow(o.length)
+	for i := range o.bits {
+		b.bits[i] |= o.bits[i]
+	}
+	return b
+}
+
+// InPlaceXor keeps only the bits that are set in exactly one of the
+// bitsets. If the other bitset is longer, the bitset grows to the same
+// length.
+func (b *BitSet) InPlaceXor(o *BitSet) *BitSet {
+	b.grow(o.length)
+	for i := range o.bits {
+		b.bits[i] ^= o.bits[i]
+	}
+	return b
+}
+
+// InPlaceAndNot clears every bit that is set in the other bitset. The
+// length of the bitset does not change.
+func (b *BitSet) InPlaceAndNot(o *BitSet) *BitSet {
+	for i := 0; i < len(b.bits) && i < len(o.bits); i++ {
+		b.bits[i] &^= o.bits[i]
+	}
+	return b
+}
+
+// And returns a new bitset (with the same length as b) holding
+// the bits that are set in both bitsets
+func (b *BitSet) And(o *BitSet) *BitSet {
+	return b.Clone().InPlaceAnd(o)
+}
+
+// Or returns a new bitset (with the length of the longer bitset)
+// holding the bits that are set in either bitset
+func (b *BitSet) Or(o *BitSet) *BitSet {
+	return b.Clone().InPlaceOr(o)
+}
+
+// Xor returns a new bitset (with the length of the longer bitset)
+// holding the bits that are set in exactly one of the bitsets
+func (b *BitSet) Xor(o *BitSet) *BitSet {
+	return b.Clone().InPlaceXor(o)
+}
+
+// AndNot returns a new bitset (with the same length as b) holding
+// the bits that are set in b but not in the other bitset
+func (b *BitSet) AndNot(o *BitSet) *BitSet {
+	return b.Clone().InPlaceAndNot(o)
+}
+
+// Count returns the number of bits that are set
+func (b *BitSet) Count() uint {
+	var n int
+	for _, w := range b.bits {
+		n += mathbits.OnesCount64(w)
+	}
+	return uint(n)
+}
+
+// NextSet returns the index of the first set bit starting at (and
+// including) bit i. If there are no more set bits, it returns false.
+//
+//	for i, ok := b.NextSet(0); ok; i, ok = b.NextSet(i + 1) {
+//		// do something with i
+//	}
+func (b *BitSet) NextSet(i uint) (uint, bool) {
+	if i >= b.length {
+		return 0, false
+	}
+	x := i >> lg2ws
+	w := b.bits[x] >> (i & (ws - 1))
+	if w != 0 {
+		return i + uint(mathbits.TrailingZeros64(w)), true
+	}
+	for x++; x < uint(len(b.bits)); x++ {
+		if b.bits[x] != 0 {
+			return x<<lg2ws + uint(mathbits.TrailingZeros64(b.bits[x])), true
+		}
+	}
+	return 0, false
+}
+
+// NextClear returns the index of the first clear bit starting at (and
+// including) bit i. If there are no more clear bits, it returns false.
+func (b *BitSet) NextClear(i uint) (uint, bool) {
+	if i >= b.length {
+		return 0, false
+	}
+	x := i >> lg2ws
+	w := ^b.bits[x] >> (i & (ws - 1))
+	if w != 0 {
+		if n := i + uint(mathbits.TrailingZeros64(w)); n < b.length {
+			return n, true
+		}
+		return 0, false
+	}
+	for x++; x < uint(len(b.bits)); x++ {
+		if b.bits[x] != all {
+			if n := x<<lg2ws + uint(mathbits.TrailingZeros64(^b.bits[x])); n < b.length {
+				return n, true
+			}
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// Rank returns the number of set bits at indexes less than i
+func (b *BitSet) Rank(i uint) uint {
+	if i > b.length {
+		i = b.length
+	}
+	var n int
+	x := i >> lg2ws
+	for _, w := range b.bits[:x] {
+		n += mathbits.OnesCount64(w)
+	}
+	if r := i & (ws - 1); r != 0 {
+		n += mathbits.OnesCount64(b.bits[x] & ((1 << r) - 1))
+	}
+	return uint(n)
+}
+
+// Select returns the index of the jth set bit (counting from zero), so
+// that Rank(Select(j)) == j. If there are not enough set bits, it
+// returns false.
+func (b *BitSet) Select(j uint) (uint, bool) {
+	for x, w := range b.bits {
+		c := uint(mathbits.OnesCount64(w))
+		if j >= c {
+			j -= c
+			continue
+		}
+		// clear the lowest j set bits of the word
+		for ; j > 0; j-- {
+			w &= w - 1
+		}
+		return uint(x)<<lg2ws + uint(mathbits.TrailingZeros64(w)), true
+	}
+	return 0, false
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface. The
+// length of the bitset is encoded first, followed by the words, all of
+// them 8 bytes and little endian.
+func (b *BitSet) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 8+len(b.bits)*8)
+	binary.LittleEndian.PutUint64(data[0:8], uint64(b.length))
+	for i, w := range b.bits {
+		binary.LittleEndian.PutUint64(data[8+i*8:], w)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface
+func (b *BitSet) UnmarshalBinary(data []byte) error {
+	if len(data) < 8 {
+		return ErrBadFormat
+	}
+	length := uint(binary.LittleEndian.Uint64(data[0:8]))
+	n := alignedSize(length)
+	if uint(len(data)-8)/8 != n || (len(data)-8)%8 != 0 {
+		return ErrBadFormat
+	}
+	words := make([]uint64, n)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint64(data[8+i*8:])
+	}
+	b.length, b.bits = length, words
+	b.clearTail()
+	return nil
 }
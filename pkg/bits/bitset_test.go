@@ -86,6 +86,13 @@ func TestBitSet_resize(t *testing.T) {
 	AssertExpected(t, uint(16), bs.Len())
 	bs.resize(32)
 	AssertExpected(t, uint(32), bs.Len())
+	// words exposed again by a fast resize start out empty
+	bs = &BitSet{bits: make([]uint64, 1, 4)}
+	bs.bits[:4][2] = ^uint64(0)
+	bs.resize(200)
+	for i := uint(64); i <= 200; i++ {
+		AssertExpected(t, false, bs.IsSet(i))
+	}
 	bs = nil
 }
 
@@ -118,6 +125,155 @@ func TestBitSetTestMany(t *testing.T) {
 	bs = nil
 }
 
+// naiveBitSet is a bool slice used to check the results of the bitset
+func naiveBitSet(length uint, step int) (*BitSet, []bool) {
+	bs := NewBitSet(length)
+	bools := make([]bool, length)
+	for i := 0; i < int(length); i += step {
+		bs.Set(uint(i))
+		bools[i] = true
+	}
+	return bs, bools
+}
+
+func checkBitSet(t *testing.T, bs *BitSet, bools []bool) {
+	AssertExpected(t, uint(len(bools)), bs.Len())
+	var count uint
+	for i, ok := range bools {
+		if bs.IsSet(uint(i)) != ok {
+			t.Fatalf("bit %d: expected=%v, got=%v\n", i, ok, !ok)
+		}
+		if ok {
+			count++
+		}
+	}
+	AssertExpected(t, count, bs.Count())
+}
+
+func TestBitSet_SetAlgebra(t *testing.T) {
+	a, aa := naiveBitSet(1000, 3)
+	b, bb := naiveBitSet(300, 5)
+	op := func(x, y []bool, fn func(p, q bool) bool, length int) []bool {
+		res := make([]bool, length)
+		for i := range res {
+			var p, q bool
+			if i < len(x) {
+				p = x[i]
+			}
+			if i < len(y) {
+				q = y[i]
+			}
+			res[i] = fn(p, q)
+		}
+		return res
+	}
+	and := func(p, q bool) bool { return p && q }
+	or := func(p, q bool) bool { return p || q }
+	xor := func(p, q bool) bool { return p != q }
+	andNot := func(p, q bool) bool { return p && !q }
+	// copies
+	checkBitSet(t, a.And(b), op(aa, bb, and, 1000))
+	checkBitSet(t, b.And(a), op(bb, aa, and, 300))
+	checkBitSet(t, a.Or(b), op(aa, bb, or, 1000))
+	checkBitSet(t, b.Or(a), op(bb, aa, or, 1000))
+	checkBitSet(t, a.Xor(b), op(aa, bb, xor, 1000))
+	checkBitSet(t, b.Xor(a), op(bb, aa, xor, 1000))
+	checkBitSet(t, a.AndNot(b), op(aa, bb, andNot, 1000))
+	checkBitSet(t, b.AndNot(a), op(bb, aa, andNot, 300))
+	// the originals are unchanged
+	checkBitSet(t, a, aa)
+	checkBitSet(t, b, bb)
+	// in place
+	c := b.Clone()
+	AssertExpected(t, true, c.Equal(b))
+	c.InPlaceOr(a)
+	checkBitSet(t, c, op(bb, aa, or, 1000))
+	AssertExpected(t, false, c.Equal(b))
+	c.InPlaceAndNot(b)
+	checkBitSet(t, c, op(op(bb, aa, or, 1000), bb, andNot, 1000))
+	c.InPlaceXor(a)
+	checkBitSet(t, c, op(op(op(bb, aa, or, 1000), bb, andNot, 1000), aa, xor, 1000))
+	// ((b | a) &^ b) ^ a is the same as a & b
+	c.InPlaceAnd(b)
+	checkBitSet(t, c, op(aa, bb, and, 1000))
+}
+
+func TestBitSet_NextSetAndNextClear(t *testing.T) {
+	bs, bools := naiveBitSet(1000, 7)
+	var set, clear []uint
+	for i, ok := bs.NextSet(0); ok; i, ok = bs.NextSet(i + 1) {
+		set = append(set, i)
+	}
+	for i, ok := bs.NextClear(0); ok; i, ok = bs.NextClear(i + 1) {
+		clear = append(clear, i)
+	}
+	AssertExpected(t, bs.Count(), uint(len(set)))
+	AssertExpected(t, bs.Len()-bs.Count(), uint(len(clear)))
+	for _, i := range set {
+		AssertExpected(t, true, bools[i])
+	}
+	for _, i := range clear {
+		AssertExpected(t, false, bools[i])
+	}
+	// a full bitset has no clear bits, and an empty one no set bits
+	full := NewBitSet(130)
+	for i := uint(0); i < 130; i++ {
+		full.Set(i)
+	}
+	_, ok := full.NextClear(0)
+	AssertExpected(t, false, ok)
+	_, ok = NewBitSet(130).NextSet(0)
+	AssertExpected(t, false, ok)
+	i, ok := NewBitSet(130).NextClear(129)
+	AssertExpected(t, true, ok)
+	AssertExpected(t, uint(129), i)
+}
+
+func TestBitSet_RankAndSelect(t *testing.T) {
+	bs, bools := naiveBitSet(1000, 3)
+	var rank uint
+	for i, ok := range bools {
+		AssertExpected(t, rank, bs.Rank(uint(i)))
+		if ok {
+			at, found := bs.Select(rank)
+			AssertExpected(t, true, found)
+			AssertExpected(t, uint(i), at)
+			rank++
+		}
+	}
+	AssertExpected(t, bs.Count(), bs.Rank(bs.Len()))
+	AssertExpected(t, bs.Count(), bs.Rank(bs.Len()+100))
+	_, found := bs.Select(bs.Count())
+	AssertExpected(t, false, found)
+}
+
+func TestBitSet_Marshal(t *testing.T) {
+	bs, bools := naiveBitSet(1000, 3)
+	data, err := bs.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal: %v\n", err)
+	}
+	cp := new(BitSet)
+	if err = cp.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal: %v\n", err)
+	}
+	checkBitSet(t, cp, bools)
+	AssertExpected(t, true, cp.Equal(bs))
+	AssertExpected(t, ErrBadFormat, cp.UnmarshalBinary(data[:len(data)-1]))
+	AssertExpected(t, ErrBadFormat, cp.UnmarshalBinary(data[:4]))
+	// bits past the length are ignored
+	words := []uint64{all, all}
+	checkBitSet(t, NewBitSetFromWords(70, words), naiveBools(70))
+}
+
+func naiveBools(n int) []bool {
+	bools := make([]bool, n)
+	for i := range bools {
+		bools[i] = true
+	}
+	return bools
+}
+
 func Benchmark_Log2_Version1(b *testing.B) {
 
 	var result uint
@@ -6,11 +6,14 @@ import (
 	"unsafe"
 )
 
-type sliceType = byte
+// sliceType is the word type used by the binary record
+type sliceType = uint64
 
 var (
 	wordSize     uint = uint(unsafe.Sizeof(sliceType(0)))
 	log2WordSize uint = log2(wordSize)
+	wordBits     uint = wordSize * 8
+	log2WordBits uint = log2(wordBits)
 )
 
 func log2(i uint) uint {
@@ -38,6 +41,21 @@ func checkResize(bs *[]byte, i uint) {
 	return
 }
 
+// checkResizeWords makes sure the words can hold n bits
+func checkResizeWords(ws *[]sliceType, n uint) {
+	size := int((n + wordBits - 1) >> log2WordBits)
+	if len(*ws) >= size {
+		return
+	}
+	if cap(*ws) >= size {
+		*ws = (*ws)[:size]
+		return
+	}
+	newws := make([]sliceType, size, 2*size)
+	copy(newws, *ws)
+	*ws = newws
+}
+
 func RawBytesHasBit(bs *[]byte, i uint) bool {
 	checkResize(bs, i)
 	//_ = (*bs)[i>>3]
@@ -8,6 +8,7 @@
 package bloom
 
 import (
+	"errors"
 	"fmt"
 	"github.com/scottcagno/storage/pkg/bits"
 	"github.com/scottcagno/storage/pkg/hash/cityhash"
@@ -37,12 +38,23 @@ type BloomFilter struct {
 	n     uint // n is the number of items "in" the filter
 	b     *bits.BitSet
 	count int
-	mask  uint64
 }
 
 // minimum item count, aka default
 const minItemCount = math.MaxUint8
 
+// maximum number of hash functions, anything more than this is
+// only going to slow things down without improving the filter
+const maxHashCount = 32
+
+var (
+	ErrBadFPRate   = errors.New("bloom: false positive rate must be between 0 and 1")
+	ErrBadFormat   = errors.New("bloom: bad filter format")
+	ErrBadVersion  = errors.New("bloom: unsupported filter version")
+	ErrFilterFull  = errors.New("bloom: filter is full")
+	ErrBuildFailed = errors.New("bloom: could not build filter from keys")
+)
+
 // NewBloomFilter returns a new filter with m number of bits available and hints to use k hash functions
 func NewBloomFilter(n uint) *BloomFilter {
 	if n < minItemCount {
@@ -51,14 +63,46 @@ func NewBloomFilter(n uint) *BloomFilter {
 	// using k=8 and maintaining a bitset m=n*24 provides a fairly
 	// constant p=0.00004 (1 in 25,000) false positive ratio which
 	// is probably acceptable in almost all cases I can think of
+	return newBloomFilter(n*24, 8)
+}
+
+// NewBloomFilterFP returns a new filter that is sized to hold n items
+// while keeping the false positive rate at (or just below) p. The number
+// of bits and the number of hash functions are derived from n and p.
+func NewBloomFilterFP(n uint, p float64) (*BloomFilter, error) {
+	if p <= 0 || p >= 1 {
+		return nil, ErrBadFPRate
+	}
+	if n < minItemCount {
+		n = minItemCount
+	}
+	m, k := optimalSize(n, p)
+	return newBloomFilter(m, k), nil
+}
+
+// newBloomFilter allocates all m bits of the filter up front
+func newBloomFilter(m, k uint) *BloomFilter {
 	return &BloomFilter{
-		m:    n * 24,
-		k:    8,
-		b:    bits.NewBitSet(n),
-		mask: uint64(n - 1),
+		m: m,
+		k: k,
+		b: bits.NewBitSet(m),
 	}
 }
 
+// optimalSize returns the number of bits (m) and the number of hash
+// functions (k) required to hold n items with a false positive rate of p
+func optimalSize(n uint, p float64) (uint, uint) {
+	m := uint(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := uint(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	if k > maxHashCount {
+		k = maxHashCount
+	}
+	return m, k
+}
+
 // -> n = ceil(m / (-k / log(1 - exp(log(p) / k))))
 // -> p = pow(1 - exp(-k / (m / n)), k)
 // -> m = ceil((n * log(p)) / log(1 / pow(2, log(2))))
@@ -127,6 +171,20 @@ func (f *BloomFilter) Size() int {
 	return int(f.m)
 }
 
+// HashCount returns the number of hash functions used by the filter
+func (f *BloomFilter) HashCount() int {
+	return int(f.k)
+}
+
+// EstimatedFPRate returns the current false positive rate of the filter.
+// It is calculated using the ratio of bits that are actually set, so it
+// reflects how full the filter really is rather than how full it should
+// be according to the number of items that have been added.
+func (f *BloomFilter) EstimatedFPRate() float64 {
+	ratio := float64(f.b.Count()) / float64(f.m)
+	return math.Pow(ratio, float64(f.k))
+}
+
 func (f *BloomFilter) MayHave(data []byte) bool {
 	return f.Has(data)
 }
@@ -135,7 +193,10 @@ func (f *BloomFilter) MayHave(data []byte) bool {
 // If true, the result might be a false positive. If false, the data
 // is definitely not in the set.
 func (f *BloomFilter) Has(data []byte) bool {
-	h := hashes(data)
+	return f.has(hashes(data))
+}
+
+func (f *BloomFilter) has(h [8]uint64) bool {
 	for i := uint(0); i < f.k; i++ {
 		if !f.b.IsSet(f.hashAndMask(h, i)) {
 			return false
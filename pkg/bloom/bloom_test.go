@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"github.com/scottcagno/storage/pkg/hashmap/openaddr"
 	"github.com/scottcagno/storage/pkg/util"
+	"io"
 	"log"
 	"runtime"
 	"strconv"
@@ -20,6 +21,8 @@ import (
 	"time"
 )
 
+const thousand = 1000
+
 var data = [11][]byte{
 	[]byte("key-000000"),
 	[]byte("Hendrix Avalos"),
@@ -170,3 +173,166 @@ func hashMaptest(data ...[]byte) {
 	hm = nil
 	runtime.GC()
 }
+
+// falsePositiveRate adds n keys to the filter and returns the
+// observed rate of false positives for n keys that were not added
+func falsePositiveRate(bf *BloomFilter, n int) float64 {
+	for i := 0; i < n; i++ {
+		bf.Set([]byte("key-" + strconv.Itoa(i)))
+	}
+	var fp int
+	for i := n; i < 2*n; i++ {
+		if bf.Has([]byte("key-" + strconv.Itoa(i))) {
+			fp++
+		}
+	}
+	return float64(fp) / float64(n)
+}
+
+func TestNewBloomFilterFP(t *testing.T) {
+	for _, p := range []float64{0.1, 0.01, 0.001} {
+		bf, err := NewBloomFilterFP(10*thousand, p)
+		if err != nil {
+			t.Fatalf("new bloom filter: %v\n", err)
+		}
+		rate := falsePositiveRate(bf, 10*thousand)
+		fmt.Printf("p=%v, m=%d, k=%d, actual=%v, estimated=%v\n",
+			p, bf.Size(), bf.HashCount(), rate, bf.EstimatedFPRate())
+		if rate > p*1.5 {
+			t.Errorf("false positive rate: expected<=%v, got=%v\n", p, rate)
+		}
+		if est := bf.EstimatedFPRate(); est > p*1.5 || est < p/1.5 {
+			t.Errorf("estimated false positive rate: expected~%v, got=%v\n", p, est)
+		}
+	}
+	_, err := NewBloomFilterFP(10*thousand, 0)
+	util.AssertEqual(t, ErrBadFPRate, err)
+	_, err = NewBloomFilterFP(10*thousand, 1)
+	util.AssertEqual(t, ErrBadFPRate, err)
+}
+
+func TestNewBloomFilter_FPRate(t *testing.T) {
+	// m=n*24 and k=8 should be close to 1 in 25,000
+	bf := NewBloomFilter(10 * thousand)
+	util.AssertEqual(t, 10*thousand*24, bf.Size())
+	rate := falsePositiveRate(bf, 10*thousand)
+	if rate > 0.0005 {
+		t.Errorf("false positive rate: expected<=%v, got=%v\n", 0.0005, rate)
+	}
+	if est := bf.EstimatedFPRate(); est > 0.0001 {
+		t.Errorf("estimated false positive rate: expected<=%v, got=%v\n", 0.0001, est)
+	}
+}
+
+func TestBloomFilter_Marshal(t *testing.T) {
+	bf, err := NewBloomFilterFP(thousand, 0.01)
+	if err != nil {
+		t.Fatalf("new bloom filter: %v\n", err)
+	}
+	for i := 0; i < thousand; i++ {
+		bf.Set([]byte("key-" + strconv.Itoa(i)))
+	}
+	check := func(cp *BloomFilter) {
+		util.AssertEqual(t, bf.Size(), cp.Size())
+		util.AssertEqual(t, bf.HashCount(), cp.HashCount())
+		util.AssertEqual(t, bf.Count(), cp.Count())
+		for i := 0; i < 2*thousand; i++ {
+			key := []byte("key-" + strconv.Itoa(i))
+			util.AssertEqual(t, bf.Has(key), cp.Has(key))
+		}
+	}
+	// marshal and unmarshal
+	data, err := bf.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal: %v\n", err)
+	}
+	cp := new(BloomFilter)
+	if err = cp.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal: %v\n", err)
+	}
+	check(cp)
+	// write to and read from
+	var buf bytes.Buffer
+	n, err := bf.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("write to: %v\n", err)
+	}
+	util.AssertEqual(t, int64(len(data)), n)
+	util.AssertEqual(t, data, buf.Bytes())
+	cp = new(BloomFilter)
+	n, err = cp.ReadFrom(&buf)
+	if err != nil {
+		t.Fatalf("read from: %v\n", err)
+	}
+	util.AssertEqual(t, int64(len(data)), n)
+	check(cp)
+	// bad data
+	util.AssertEqual(t, ErrBadFormat, cp.UnmarshalBinary(data[:len(data)-1]))
+	util.AssertEqual(t, ErrBadFormat, cp.UnmarshalBinary([]byte("not a filter")))
+	_, err = cp.ReadFrom(bytes.NewReader(data[:len(data)-1]))
+	util.AssertEqual(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestScalableBloomFilter(t *testing.T) {
+	const p = 0.01
+	f, err := NewScalableBloomFilter(thousand, p)
+	if err != nil {
+		t.Fatalf("new scalable bloom filter: %v\n", err)
+	}
+	// add far more items than the first stage was sized for
+	count := 50 * thousand
+	for i := 0; i < count; i++ {
+		f.Set([]byte("key-" + strconv.Itoa(i)))
+	}
+	fmt.Printf("stages=%d, size=%d, count=%d, estimated=%v\n",
+		f.Stages(), f.Size(), f.Count(), f.EstimatedFPRate())
+	if f.Stages() < 5 {
+		t.Errorf("stages: expected>=%d, got=%d\n", 5, f.Stages())
+	}
+	// no false negatives
+	for i := 0; i < count; i++ {
+		if !f.Has([]byte("key-" + strconv.Itoa(i))) {
+			t.Fatalf("false negative for key-%d\n", i)
+		}
+	}
+	// and the false positive rate is still bounded
+	var fp int
+	for i := count; i < 2*count; i++ {
+		if f.Has([]byte("key-" + strconv.Itoa(i))) {
+			fp++
+		}
+	}
+	rate := float64(fp) / float64(count)
+	fmt.Printf("actual=%v\n", rate)
+	if rate > p || f.EstimatedFPRate() > p {
+		t.Errorf("false positive rate: expected<=%v, got=%v (estimated=%v)\n", p, rate, f.EstimatedFPRate())
+	}
+	// adding the same data again does not use up capacity
+	n := f.Count()
+	f.Set([]byte("key-0"))
+	util.AssertEqual(t, n, f.Count())
+	// serialize all the stages
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal: %v\n", err)
+	}
+	cp := new(ScalableBloomFilter)
+	if err = cp.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal: %v\n", err)
+	}
+	util.AssertEqual(t, f.Stages(), cp.Stages())
+	util.AssertEqual(t, f.Count(), cp.Count())
+	util.AssertEqual(t, f.Size(), cp.Size())
+	for i := 0; i < 2*count; i += 7 {
+		key := []byte("key-" + strconv.Itoa(i))
+		util.AssertEqual(t, f.Has(key), cp.Has(key))
+	}
+	// the copy keeps growing the same way
+	for i := count; i < 2*count; i++ {
+		f.Set([]byte("key-" + strconv.Itoa(i)))
+		cp.Set([]byte("key-" + strconv.Itoa(i)))
+	}
+	util.AssertEqual(t, f.Stages(), cp.Stages())
+	util.AssertEqual(t, ErrBadFormat, cp.UnmarshalBinary(data[:len(data)-1]))
+	util.AssertEqual(t, ErrBadFormat, cp.UnmarshalBinary(append(data, 0)))
+}
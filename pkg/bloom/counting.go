@@ -0,0 +1,184 @@
+/*
+ *
+ *  * // Copyright (c) 2021 Scott Cagno. All rights reserved.
+ *  * // The license can be found in the root of this project; see LICENSE.
+ *
+ */
+
+package bloom
+
+import (
+	"io"
+	"math"
+)
+
+const (
+	counterBits  = 4                   // number of bits per counter
+	counterMax   = 1<<counterBits - 1  // counters saturate at this value
+	countersLog2 = 4                   // log2 of the number of counters in a word
+	counterMask  = 1<<countersLog2 - 1 // mask for the counter within a word
+	counterWords = 1 << countersLog2   // number of counters in a word
+)
+
+// CountingBloomFilter is a bloom filter that uses a 4-bit counter in
+// place of every bit, which makes it possible to remove items. Once a
+// counter reaches its max value it is never decremented again, so a
+// saturated counter can only cause false positives and never false
+// negatives.
+type CountingBloomFilter struct {
+	m     uint     // m is the number of counters allocated for the filter
+	k     uint     // k is the number of hash functions for the filter
+	c     []uint64 // c holds the counters, 16 in every word
+	count int
+}
+
+// NewCountingBloomFilter returns a new counting filter that is sized to
+// hold n items while keeping the false positive rate at (or just below) p
+func NewCountingBloomFilter(n uint, p float64) (*CountingBloomFilter, error) {
+	if p <= 0 || p >= 1 {
+		return nil, ErrBadFPRate
+	}
+	if n < minItemCount {
+		n = minItemCount
+	}
+	m, k := optimalSize(n, p)
+	return &CountingBloomFilter{
+		m: m,
+		k: k,
+		c: make([]uint64, countingWords(m)),
+	}, nil
+}
+
+// countingWords returns the number of words needed for m counters
+func countingWords(m uint) int {
+	return int((m + counterWords - 1) / counterWords)
+}
+
+// get returns the value of the ith counter
+func (f *CountingBloomFilter) get(i uint) uint64 {
+	return (f.c[i>>countersLog2] >> ((i & counterMask) * counterBits)) & counterMax
+}
+
+// incr increments the ith counter, unless it is saturated
+func (f *CountingBloomFilter) incr(i uint) {
+	if f.get(i) < counterMax {
+		f.c[i>>countersLog2] += 1 << ((i & counterMask) * counterBits)
+	}
+}
+
+// decr decrements the ith counter, unless it is saturated or empty
+func (f *CountingBloomFilter) decr(i uint) {
+	if v := f.get(i); v > 0 && v < counterMax {
+		f.c[i>>countersLog2] -= 1 << ((i & counterMask) * counterBits)
+	}
+}
+
+// location returns the ith hashed location
+func (f *CountingBloomFilter) location(h [8]uint64, i uint) uint {
+	return uint(hashAndMask(h, i) % uint64(f.m))
+}
+
+// Add adds the data to the filter. It never fails.
+func (f *CountingBloomFilter) Add(data []byte) error {
+	h := hashes(data)
+	for i := uint(0); i < f.k; i++ {
+		f.incr(f.location(h, i))
+	}
+	f.count++
+	return nil
+}
+
+// Delete removes the data from the filter. If the data is definitely
+// not in the filter, nothing is removed and false is returned.
+func (f *CountingBloomFilter) Delete(data []byte) bool {
+	h := hashes(data)
+	if !f.has(h) {
+		return false
+	}
+	for i := uint(0); i < f.k; i++ {
+		f.decr(f.location(h, i))
+	}
+	f.count--
+	return true
+}
+
+// MayHave returns true if the data may be in the filter. If false,
+// the data is definitely not in the filter.
+func (f *CountingBloomFilter) MayHave(data []byte) bool {
+	return f.has(hashes(data))
+}
+
+func (f *CountingBloomFilter) has(h [8]uint64) bool {
+	for i := uint(0); i < f.k; i++ {
+		if f.get(f.location(h, i)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *CountingBloomFilter) Count() int {
+	return f.count
+}
+
+func (f *CountingBloomFilter) Size() int {
+	return int(f.m)
+}
+
+// EstimatedFPRate returns the current false positive rate of the
+// filter using the ratio of counters that are not zero
+func (f *CountingBloomFilter) EstimatedFPRate() float64 {
+	var used uint
+	for i := uint(0); i < f.m; i++ {
+		if f.get(i) != 0 {
+			used++
+		}
+	}
+	return math.Pow(float64(used)/float64(f.m), float64(f.k))
+}
+
+// countingFilterWords returns the number of words used by a counting filter
+func countingFilterWords(h header) int {
+	if h.k > maxHashCount {
+		return -1
+	}
+	return countingWords(h.m)
+}
+
+func (f *CountingBloomFilter) header() header {
+	return header{magic: magicCounting, k: f.k, m: f.m, count: f.count}
+}
+
+func (f *CountingBloomFilter) load(h header, words []uint64) {
+	f.m, f.k, f.count, f.c = h.m, h.k, h.count, words
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface
+func (f *CountingBloomFilter) MarshalBinary() ([]byte, error) {
+	return marshalWords(f.header(), f.c), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface
+func (f *CountingBloomFilter) UnmarshalBinary(data []byte) error {
+	h, words, err := unmarshalWords(data, magicCounting, countingFilterWords)
+	if err != nil {
+		return err
+	}
+	f.load(h, words)
+	return nil
+}
+
+// WriteTo implements the io.WriterTo interface
+func (f *CountingBloomFilter) WriteTo(w io.Writer) (int64, error) {
+	return writeWords(w, f.header(), f.c)
+}
+
+// ReadFrom implements the io.ReaderFrom interface
+func (f *CountingBloomFilter) ReadFrom(r io.Reader) (int64, error) {
+	h, words, n, err := readWords(r, magicCounting, countingFilterWords)
+	if err != nil {
+		return n, err
+	}
+	f.load(h, words)
+	return n, nil
+}
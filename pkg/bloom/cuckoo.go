@@ -0,0 +1,232 @@
+/*
+ *
+ *  * // Copyright (c) 2021 Scott Cagno. All rights reserved.
+ *  * // The license can be found in the root of this project; see LICENSE.
+ *
+ */
+
+package bloom
+
+import (
+	"github.com/scottcagno/storage/pkg/hash/cityhash"
+	"io"
+	"math/rand"
+)
+
+const (
+	bucketSize      = 4      // number of fingerprints in a bucket
+	fingerprintBits = 16     // number of bits in a fingerprint
+	fingerprintMask = 0xffff // mask for a fingerprint within a bucket
+	maxKicks        = 500    // max number of relocations when adding
+	maxLoadFactor   = 0.95   // the fraction of slots expected to be used
+)
+
+// CuckooFilter is a cuckoo filter using buckets of four 16-bit
+// fingerprints. Every bucket fits in a single word. An item can live in
+// one of two buckets, and the second bucket can be derived from the
+// first bucket and the fingerprint, so fingerprints can be relocated
+// when both buckets are full. With these parameters the false positive
+// rate is roughly 2*4/2^16, or about 1 in 8,000.
+type CuckooFilter struct {
+	buckets []uint64 // buckets holds four fingerprints in every word
+	mask    uint64   // mask is the number of buckets minus one
+	count   int
+}
+
+// NewCuckooFilter returns a new cuckoo filter that is sized to hold n items
+func NewCuckooFilter(n uint) *CuckooFilter {
+	if n < minItemCount {
+		n = minItemCount
+	}
+	nb := uint64(1)
+	for float64(nb*bucketSize)*maxLoadFactor < float64(n) {
+		nb <<= 1
+	}
+	return &CuckooFilter{
+		buckets: make([]uint64, nb),
+		mask:    nb - 1,
+	}
+}
+
+// fingerprint returns the fingerprint and the first bucket index for the data
+func (f *CuckooFilter) fingerprint(data []byte) (uint64, uint64) {
+	h := cityhash.Hash64(data)
+	fp := h >> (64 - fingerprintBits)
+	if fp == 0 {
+		// zero marks an empty slot
+		fp = 1
+	}
+	return fp, h & f.mask
+}
+
+// altIndex returns the other bucket index for a fingerprint. Calling it
+// with either of the two bucket indexes returns the other one.
+func (f *CuckooFilter) altIndex(i, fp uint64) uint64 {
+	return (i ^ (fp * 0x5bd1e995)) & f.mask
+}
+
+// slot returns the fingerprint in slot s of bucket i
+func (f *CuckooFilter) slot(i uint64, s int) uint64 {
+	return (f.buckets[i] >> (s * fingerprintBits)) & fingerprintMask
+}
+
+// setSlot puts the fingerprint in slot s of bucket i
+func (f *CuckooFilter) setSlot(i uint64, s int, fp uint64) {
+	shift := s * fingerprintBits
+	f.buckets[i] = f.buckets[i]&^(fingerprintMask<<shift) | fp<<shift
+}
+
+// insert puts the fingerprint in an empty slot of bucket i
+func (f *CuckooFilter) insert(i, fp uint64) bool {
+	for s := 0; s < bucketSize; s++ {
+		if f.slot(i, s) == 0 {
+			f.setSlot(i, s, fp)
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether bucket i holds the fingerprint
+func (f *CuckooFilter) contains(i, fp uint64) bool {
+	for s := 0; s < bucketSize; s++ {
+		if f.slot(i, s) == fp {
+			return true
+		}
+	}
+	return false
+}
+
+// remove removes one copy of the fingerprint from bucket i
+func (f *CuckooFilter) remove(i, fp uint64) bool {
+	for s := 0; s < bucketSize; s++ {
+		if f.slot(i, s) == fp {
+			f.setSlot(i, s, 0)
+			return true
+		}
+	}
+	return false
+}
+
+// kick is a relocation made while adding a fingerprint
+type kick struct {
+	bucket uint64
+	slot   int
+}
+
+// Add adds the data to the filter. If there is no room for the data, the
+// filter is left unchanged and ErrFilterFull is returned. Adding the same
+// data more than once stores more than one copy of the fingerprint.
+func (f *CuckooFilter) Add(data []byte) error {
+	fp, i1 := f.fingerprint(data)
+	i2 := f.altIndex(i1, fp)
+	if f.insert(i1, fp) || f.insert(i2, fp) {
+		f.count++
+		return nil
+	}
+	// both buckets are full, so relocate fingerprints until one
+	// of them finds an empty slot in its other bucket
+	i := i1
+	if rand.Intn(2) == 1 {
+		i = i2
+	}
+	path := make([]kick, 0, maxKicks)
+	cur := fp
+	for n := 0; n < maxKicks; n++ {
+		s := rand.Intn(bucketSize)
+		old := f.slot(i, s)
+		f.setSlot(i, s, cur)
+		path = append(path, kick{bucket: i, slot: s})
+		cur = old
+		i = f.altIndex(i, cur)
+		if f.insert(i, cur) {
+			f.count++
+			return nil
+		}
+	}
+	// undo the relocations, so no fingerprint is lost
+	for n := len(path) - 1; n >= 0; n-- {
+		old := f.slot(path[n].bucket, path[n].slot)
+		f.setSlot(path[n].bucket, path[n].slot, cur)
+		cur = old
+	}
+	return ErrFilterFull
+}
+
+// Delete removes one copy of the data from the filter. If the data is
+// definitely not in the filter, nothing is removed and false is returned.
+func (f *CuckooFilter) Delete(data []byte) bool {
+	fp, i1 := f.fingerprint(data)
+	if f.remove(i1, fp) || f.remove(f.altIndex(i1, fp), fp) {
+		f.count--
+		return true
+	}
+	return false
+}
+
+// MayHave returns true if the data may be in the filter. If false,
+// the data is definitely not in the filter.
+func (f *CuckooFilter) MayHave(data []byte) bool {
+	fp, i1 := f.fingerprint(data)
+	return f.contains(i1, fp) || f.contains(f.altIndex(i1, fp), fp)
+}
+
+func (f *CuckooFilter) Count() int {
+	return f.count
+}
+
+// Size returns the number of slots in the filter
+func (f *CuckooFilter) Size() int {
+	return len(f.buckets) * bucketSize
+}
+
+// LoadFactor returns the fraction of slots that are used
+func (f *CuckooFilter) LoadFactor() float64 {
+	return float64(f.count) / float64(f.Size())
+}
+
+// cuckooWords returns the number of words used by a cuckoo filter
+func cuckooWords(h header) int {
+	if h.k != bucketSize || h.m&(h.m-1) != 0 {
+		return -1
+	}
+	return int(h.m)
+}
+
+func (f *CuckooFilter) header() header {
+	return header{magic: magicCuckoo, k: bucketSize, m: uint(len(f.buckets)), count: f.count}
+}
+
+func (f *CuckooFilter) load(h header, words []uint64) {
+	f.buckets, f.mask, f.count = words, uint64(h.m-1), h.count
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface
+func (f *CuckooFilter) MarshalBinary() ([]byte, error) {
+	return marshalWords(f.header(), f.buckets), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface
+func (f *CuckooFilter) UnmarshalBinary(data []byte) error {
+	h, words, err := unmarshalWords(data, magicCuckoo, cuckooWords)
+	if err != nil {
+		return err
+	}
+	f.load(h, words)
+	return nil
+}
+
+// WriteTo implements the io.WriterTo interface
+func (f *CuckooFilter) WriteTo(w io.Writer) (int64, error) {
+	return writeWords(w, f.header(), f.buckets)
+}
+
+// ReadFrom implements the io.ReaderFrom interface
+func (f *CuckooFilter) ReadFrom(r io.Reader) (int64, error) {
+	h, words, n, err := readWords(r, magicCuckoo, cuckooWords)
+	if err != nil {
+		return n, err
+	}
+	f.load(h, words)
+	return n, nil
+}
@@ -0,0 +1,243 @@
+/*
+ *
+ *  * // Copyright (c) 2021 Scott Cagno. All rights reserved.
+ *  * // The license can be found in the root of this project; see LICENSE.
+ *
+ */
+
+package bloom
+
+import (
+	"encoding/binary"
+	"github.com/scottcagno/storage/pkg/bits"
+	"io"
+)
+
+// Every encoded filter is laid out as a fixed size header followed by
+// the words that back the filter. Every word is 8 bytes (little endian)
+// and the header is a multiple of 8 bytes, so the words stay aligned
+// when the encoded filter is written to a file and mapped into memory.
+//
+//	+-------+---------+---+---+-------+----------------+
+//	| magic | version | k | m | count | words          |
+//	+-------+---------+---+---+-------+----------------+
+//	   4B       2B     2B  8B    8B      8B * len(words)
+//
+// The meaning of k and m depends on the filter. For the bloom filters
+// they are the number of hash functions and the number of bits (or
+// counters) and for the cuckoo filter they are the number of slots
+// per bucket and the number of buckets.
+const (
+	version       = uint16(1)
+	headerSize    = 24
+	wordSize      = 8
+	wordsPerChunk = 512
+)
+
+// magic numbers for each type of encoded filter
+const (
+	magicBloom    = uint32(0x464d4c42) // "BLMF"
+	magicCounting = uint32(0x464c4243) // "CBLF"
+	magicCuckoo   = uint32(0x464f4b43) // "CKOF"
+	magicScalable = uint32(0x464c4253) // "SBLF"
+	magicXor      = uint32(0x46524f58) // "XORF"
+)
+
+// header is the decoded header of an encoded filter
+type header struct {
+	magic uint32
+	k     uint
+	m     uint
+	count int
+}
+
+// encode writes the header into b
+func (h header) encode(b []byte) {
+	binary.LittleEndian.PutUint32(b[0:4], h.magic)
+	binary.LittleEndian.PutUint16(b[4:6], version)
+	binary.LittleEndian.PutUint16(b[6:8], uint16(h.k))
+	binary.LittleEndian.PutUint64(b[8:16], uint64(h.m))
+	binary.LittleEndian.PutUint64(b[16:24], uint64(int64(h.count)))
+}
+
+// decodeHeader reads and validates the header in b
+func decodeHeader(b []byte, magic uint32) (header, error) {
+	if len(b) < headerSize {
+		return header{}, ErrBadFormat
+	}
+	if binary.LittleEndian.Uint32(b[0:4]) != magic {
+		return header{}, ErrBadFormat
+	}
+	if binary.LittleEndian.Uint16(b[4:6]) != version {
+		return header{}, ErrBadVersion
+	}
+	h := header{
+		magic: magic,
+		k:     uint(binary.LittleEndian.Uint16(b[6:8])),
+		m:     uint(binary.LittleEndian.Uint64(b[8:16])),
+		count: int(int64(binary.LittleEndian.Uint64(b[16:24]))),
+	}
+	if h.k < 1 || h.m < 1 {
+		return header{}, ErrBadFormat
+	}
+	return h, nil
+}
+
+// marshalWords returns the encoded header followed by the encoded words
+func marshalWords(h header, words []uint64) []byte {
+	data := make([]byte, headerSize+len(words)*wordSize)
+	h.encode(data)
+	for i, w := range words {
+		off := headerSize + i*wordSize
+		binary.LittleEndian.PutUint64(data[off:off+wordSize], uint64(w))
+	}
+	return data
+}
+
+// unmarshalWords decodes the header and the words in data. The number
+// of words that is expected is calculated from the header using nwords.
+// The words are copied, so it is safe to unmap or reuse data afterwards.
+func unmarshalWords(data []byte, magic uint32, nwords func(h header) int) (header, []uint64, error) {
+	h, err := decodeHeader(data, magic)
+	if err != nil {
+		return header{}, nil, err
+	}
+	n := nwords(h)
+	if n < 0 || len(data) != headerSize+n*wordSize {
+		return header{}, nil, ErrBadFormat
+	}
+	words := make([]uint64, n)
+	for i := range words {
+		off := headerSize + i*wordSize
+		words[i] = binary.LittleEndian.Uint64(data[off : off+wordSize])
+	}
+	return h, words, nil
+}
+
+// writeWords writes the encoded header followed by the encoded words
+// to w. The words are written in chunks so they are never all copied.
+func writeWords(w io.Writer, h header, words []uint64) (int64, error) {
+	buf := make([]byte, wordsPerChunk*wordSize)
+	// write header
+	h.encode(buf[:headerSize])
+	n, err := w.Write(buf[:headerSize])
+	total := int64(n)
+	if err != nil {
+		return total, err
+	}
+	// write words
+	for len(words) > 0 {
+		chunk := words
+		if len(chunk) > wordsPerChunk {
+			chunk = chunk[:wordsPerChunk]
+		}
+		for i, word := range chunk {
+			binary.LittleEndian.PutUint64(buf[i*wordSize:], word)
+		}
+		n, err = w.Write(buf[:len(chunk)*wordSize])
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+		words = words[len(chunk):]
+	}
+	return total, nil
+}
+
+// readWords reads exactly one encoded header and the words that follow
+// it from r. The number of words to read is calculated using nwords.
+func readWords(r io.Reader, magic uint32, nwords func(h header) int) (header, []uint64, int64, error) {
+	buf := make([]byte, wordsPerChunk*wordSize)
+	// read header
+	n, err := io.ReadFull(r, buf[:headerSize])
+	total := int64(n)
+	if err != nil {
+		return header{}, nil, total, err
+	}
+	h, err := decodeHeader(buf[:headerSize], magic)
+	if err != nil {
+		return header{}, nil, total, err
+	}
+	nw := nwords(h)
+	if nw < 0 {
+		return header{}, nil, total, ErrBadFormat
+	}
+	// read words
+	words := make([]uint64, nw)
+	for off := 0; off < len(words); {
+		size := len(words) - off
+		if size > wordsPerChunk {
+			size = wordsPerChunk
+		}
+		n, err = io.ReadFull(r, buf[:size*wordSize])
+		total += int64(n)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return header{}, nil, total, err
+		}
+		for i := 0; i < size; i++ {
+			words[off+i] = binary.LittleEndian.Uint64(buf[i*wordSize:])
+		}
+		off += size
+	}
+	return h, words, total, nil
+}
+
+// bloomWords returns the number of words used by a bloom filter
+func bloomWords(h header) int {
+	if h.k > maxHashCount {
+		return -1
+	}
+	return int(bits.AlignedSize(h.m))
+}
+
+// header returns the header of the filter
+func (f *BloomFilter) header() header {
+	return header{magic: magicBloom, k: f.k, m: f.m, count: f.count}
+}
+
+// words returns the words backing the filter
+func (f *BloomFilter) words() []uint64 {
+	return f.b.Words()[:bits.AlignedSize(f.m)]
+}
+
+// load replaces the contents of the filter
+func (f *BloomFilter) load(h header, words []uint64) {
+	f.m, f.k, f.count = h.m, h.k, h.count
+	f.b = bits.NewBitSetFromWords(h.m, words)
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface
+func (f *BloomFilter) MarshalBinary() ([]byte, error) {
+	return marshalWords(f.header(), f.words()), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+// The data is copied, so it is safe to unmap or reuse it afterwards.
+func (f *BloomFilter) UnmarshalBinary(data []byte) error {
+	h, words, err := unmarshalWords(data, magicBloom, bloomWords)
+	if err != nil {
+		return err
+	}
+	f.load(h, words)
+	return nil
+}
+
+// WriteTo implements the io.WriterTo interface. The words of the
+// filter are written in chunks so the whole filter is never copied.
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	return writeWords(w, f.header(), f.words())
+}
+
+// ReadFrom implements the io.ReaderFrom interface. It reads exactly
+// one encoded filter from r, replacing the contents of the filter.
+func (f *BloomFilter) ReadFrom(r io.Reader) (int64, error) {
+	h, words, n, err := readWords(r, magicBloom, bloomWords)
+	if err != nil {
+		return n, err
+	}
+	f.load(h, words)
+	return n, nil
+}
@@ -0,0 +1,46 @@
+/*
+ *
+ *  * // Copyright (c) 2021 Scott Cagno. All rights reserved.
+ *  * // The license can be found in the root of this project; see LICENSE.
+ *
+ */
+
+package bloom
+
+import (
+	"encoding"
+	"io"
+)
+
+// Filter is a probabilistic set membership filter that supports
+// removing items. MayHave never returns false for an item that was
+// added and has not been deleted, but it may return true for an item
+// that was never added. Only items that were added should be deleted,
+// deleting an item that was never added can cause false negatives.
+type Filter interface {
+
+	// Add adds the data to the filter
+	Add(data []byte) error
+
+	// Delete removes the data from the filter and reports whether
+	// the data may have been in the filter
+	Delete(data []byte) bool
+
+	// MayHave reports whether the data may be in the filter. If false,
+	// the data is definitely not in the filter.
+	MayHave(data []byte) bool
+
+	// Count returns the number of items in the filter
+	Count() int
+
+	// filters can be persisted
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+	io.WriterTo
+	io.ReaderFrom
+}
+
+var (
+	_ Filter = (*CountingBloomFilter)(nil)
+	_ Filter = (*CuckooFilter)(nil)
+)
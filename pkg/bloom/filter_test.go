@@ -0,0 +1,223 @@
+/*
+ *
+ *  * // Copyright (c) 2021 Scott Cagno. All rights reserved.
+ *  * // The license can be found in the root of this project; see LICENSE.
+ *
+ */
+
+package bloom
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/scottcagno/storage/pkg/util"
+	"strconv"
+	"testing"
+)
+
+func filterKey(i int) []byte {
+	return []byte("key-" + strconv.Itoa(i))
+}
+
+func newFilters(t *testing.T, n uint) map[string]Filter {
+	cbf, err := NewCountingBloomFilter(n, 0.001)
+	if err != nil {
+		t.Fatalf("new counting bloom filter: %v\n", err)
+	}
+	return map[string]Filter{
+		"counting": cbf,
+		"cuckoo":   NewCuckooFilter(n),
+	}
+}
+
+func TestFilter_NoFalseNegativesAfterDelete(t *testing.T) {
+	for name, f := range newFilters(t, 10*thousand) {
+		// add every key
+		for i := 0; i < 10*thousand; i++ {
+			if err := f.Add(filterKey(i)); err != nil {
+				t.Fatalf("%s: add: %v\n", name, err)
+			}
+		}
+		util.AssertEqual(t, 10*thousand, f.Count())
+		// delete every other key
+		for i := 0; i < 10*thousand; i += 2 {
+			if !f.Delete(filterKey(i)) {
+				t.Fatalf("%s: delete: expected=%v, got=%v\n", name, true, false)
+			}
+		}
+		util.AssertEqual(t, 5*thousand, f.Count())
+		// the keys that are left must all be found
+		for i := 1; i < 10*thousand; i += 2 {
+			if !f.MayHave(filterKey(i)) {
+				t.Fatalf("%s: false negative for %q\n", name, filterKey(i))
+			}
+		}
+		// and most of the deleted keys should be gone
+		var fp int
+		for i := 0; i < 10*thousand; i += 2 {
+			if f.MayHave(filterKey(i)) {
+				fp++
+			}
+		}
+		fmt.Printf("%s: deleted keys still reported: %d\n", name, fp)
+		if fp > 50 {
+			t.Errorf("%s: deleted keys still reported: expected<=%d, got=%d\n", name, 50, fp)
+		}
+		// a key that was added twice must survive one delete
+		key := []byte("twice")
+		_ = f.Add(key)
+		_ = f.Add(key)
+		f.Delete(key)
+		util.AssertEqual(t, true, f.MayHave(key))
+	}
+}
+
+func TestFilter_Marshal(t *testing.T) {
+	for name, f := range newFilters(t, thousand) {
+		for i := 0; i < thousand; i++ {
+			_ = f.Add(filterKey(i))
+		}
+		data, err := f.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: marshal: %v\n", name, err)
+		}
+		var buf bytes.Buffer
+		n, err := f.WriteTo(&buf)
+		if err != nil {
+			t.Fatalf("%s: write to: %v\n", name, err)
+		}
+		util.AssertEqual(t, int64(len(data)), n)
+		util.AssertEqual(t, data, buf.Bytes())
+		for _, cp := range newFilters(t, 1) {
+			// the filters use different formats
+			if err = cp.UnmarshalBinary(data); err != nil {
+				util.AssertEqual(t, ErrBadFormat, err)
+				continue
+			}
+			for i := 0; i < 2*thousand; i++ {
+				util.AssertEqual(t, f.MayHave(filterKey(i)), cp.MayHave(filterKey(i)))
+			}
+			util.AssertEqual(t, f.Count(), cp.Count())
+			// read the copy from the buffer too, and make sure
+			// it is still usable after a delete
+			n, err = cp.ReadFrom(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("%s: read from: %v\n", name, err)
+			}
+			util.AssertEqual(t, int64(len(data)), n)
+			util.AssertEqual(t, true, cp.Delete(filterKey(0)))
+			util.AssertEqual(t, true, cp.MayHave(filterKey(1)))
+		}
+	}
+}
+
+func TestCountingBloomFilter_Saturation(t *testing.T) {
+	f, err := NewCountingBloomFilter(minItemCount, 0.01)
+	if err != nil {
+		t.Fatalf("new counting bloom filter: %v\n", err)
+	}
+	// push the counters for the key past their max value
+	key := []byte("saturated")
+	for i := 0; i < counterMax+5; i++ {
+		_ = f.Add(key)
+	}
+	for i := 0; i < counterMax+5; i++ {
+		f.Delete(key)
+	}
+	// saturated counters are never decremented
+	util.AssertEqual(t, true, f.MayHave(key))
+}
+
+func TestCuckooFilter_Full(t *testing.T) {
+	f := NewCuckooFilter(minItemCount)
+	var added []int
+	for i := 0; ; i++ {
+		if err := f.Add(filterKey(i)); err != nil {
+			util.AssertEqual(t, ErrFilterFull, err)
+			break
+		}
+		added = append(added, i)
+	}
+	fmt.Printf("cuckoo: added %d items to %d slots (load=%.2f)\n", len(added), f.Size(), f.LoadFactor())
+	util.AssertEqual(t, len(added), f.Count())
+	// a failed add must not lose any of the fingerprints
+	for _, i := range added {
+		if !f.MayHave(filterKey(i)) {
+			t.Fatalf("false negative for %q\n", filterKey(i))
+		}
+	}
+}
+
+func testXorFilter[T Fingerprint](t *testing.T, f *XorFilter[T], keys int, p float64) {
+	util.AssertEqual(t, keys, f.Count())
+	// no false negatives
+	for i := 0; i < keys; i++ {
+		if !f.Contains(filterKey(i)) {
+			t.Fatalf("false negative for %q\n", filterKey(i))
+		}
+	}
+	// false positives are bounded by the fingerprint size
+	var fp int
+	for i := keys; i < 2*keys; i++ {
+		if f.Contains(filterKey(i)) {
+			fp++
+		}
+	}
+	rate := float64(fp) / float64(keys)
+	fmt.Printf("xor-%d: bits/key=%.2f, actual=%v, estimated=%v\n",
+		fingerprintBitsOf[T](), float64(f.Size())/float64(keys), rate, f.EstimatedFPRate())
+	if rate > p {
+		t.Errorf("false positive rate: expected<=%v, got=%v\n", p, rate)
+	}
+	// serialization
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal: %v\n", err)
+	}
+	var buf bytes.Buffer
+	n, err := f.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("write to: %v\n", err)
+	}
+	util.AssertEqual(t, int64(len(data)), n)
+	util.AssertEqual(t, data, buf.Bytes())
+	cp := new(XorFilter[T])
+	if err = cp.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal: %v\n", err)
+	}
+	util.AssertEqual(t, f, cp)
+	cp = new(XorFilter[T])
+	if _, err = cp.ReadFrom(&buf); err != nil {
+		t.Fatalf("read from: %v\n", err)
+	}
+	util.AssertEqual(t, f, cp)
+}
+
+func TestXorFilter(t *testing.T) {
+	const keys = 50 * thousand
+	var data [][]byte
+	for i := 0; i < keys; i++ {
+		data = append(data, filterKey(i))
+	}
+	// duplicates are only added once
+	data = append(data, filterKey(0), filterKey(1))
+	f8, err := NewXorFilter8(data)
+	if err != nil {
+		t.Fatalf("new xor filter: %v\n", err)
+	}
+	testXorFilter(t, f8, keys, 0.006)
+	f16, err := NewXorFilter16(data)
+	if err != nil {
+		t.Fatalf("new xor filter: %v\n", err)
+	}
+	testXorFilter(t, f16, keys, 0.0001)
+	// the fingerprint size is part of the format
+	b, _ := f8.MarshalBinary()
+	util.AssertEqual(t, ErrBadFormat, f16.UnmarshalBinary(b))
+	// and an empty set of keys works too
+	empty, err := NewXorFilter8(nil)
+	if err != nil {
+		t.Fatalf("new xor filter: %v\n", err)
+	}
+	util.AssertEqual(t, 0, empty.Count())
+}
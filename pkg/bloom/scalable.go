@@ -0,0 +1,226 @@
+/*
+ *
+ *  * // Copyright (c) 2021 Scott Cagno. All rights reserved.
+ *  * // The license can be found in the root of this project; see LICENSE.
+ *
+ */
+
+package bloom
+
+import (
+	"bytes"
+	"io"
+	"math"
+)
+
+const (
+	// defaultGrowth is the factor by which the capacity of every new
+	// stage grows. Growing by 2 keeps the number of stages logarithmic.
+	defaultGrowth = 2
+
+	// defaultTightening is the factor by which the false positive rate
+	// of every new stage is tightened. The rate of stage i is p0 * r^i.
+	defaultTightening = 0.8
+)
+
+// ScalableBloomFilter is a bloom filter that grows with the data. It is
+// made up of stages, where every stage is a regular bloom filter. Once the
+// current stage holds as many items as it was sized for, a new stage with
+// a larger capacity and a tighter false positive rate is added. Because the
+// rates of the stages form a geometric series, the overall false positive
+// rate stays below the rate the filter was created with, no matter how many
+// items are added.
+type ScalableBloomFilter struct {
+	n      uint           // n is the capacity of the first stage
+	p      float64        // p is the overall false positive rate
+	r      float64        // r is the tightening ratio
+	growth uint           // growth is the capacity growth factor
+	stages []*BloomFilter // stages are the filters, the last one is current
+	count  int
+}
+
+// NewScalableBloomFilter returns a new filter whose first stage is sized to
+// hold n items. The overall false positive rate is kept at (or below) p.
+func NewScalableBloomFilter(n uint, p float64) (*ScalableBloomFilter, error) {
+	if p <= 0 || p >= 1 {
+		return nil, ErrBadFPRate
+	}
+	if n < minItemCount {
+		n = minItemCount
+	}
+	f := &ScalableBloomFilter{
+		n:      n,
+		p:      p,
+		r:      defaultTightening,
+		growth: defaultGrowth,
+	}
+	f.addStage()
+	return f, nil
+}
+
+// stageCapacity returns the number of items stage i is sized for
+func (f *ScalableBloomFilter) stageCapacity(i int) uint {
+	return f.n * uint(math.Pow(float64(f.growth), float64(i)))
+}
+
+// stageFPRate returns the false positive rate of stage i. The sum of
+// the rates of all the stages is p0/(1-r) which is equal to p.
+func (f *ScalableBloomFilter) stageFPRate(i int) float64 {
+	return f.p * (1 - f.r) * math.Pow(f.r, float64(i))
+}
+
+// addStage adds a new stage to the filter
+func (f *ScalableBloomFilter) addStage() {
+	i := len(f.stages)
+	m, k := optimalSize(f.stageCapacity(i), f.stageFPRate(i))
+	f.stages = append(f.stages, newBloomFilter(m, k))
+}
+
+// Set adds the data to the filter. Data that may already be in the
+// filter is not added again, so it does not use up any capacity.
+func (f *ScalableBloomFilter) Set(data []byte) {
+	if f.Has(data) {
+		return
+	}
+	last := len(f.stages) - 1
+	if uint(f.stages[last].Count()) >= f.stageCapacity(last) {
+		f.addStage()
+		last++
+	}
+	f.stages[last].Set(data)
+	f.count++
+}
+
+func (f *ScalableBloomFilter) MayHave(data []byte) bool {
+	return f.Has(data)
+}
+
+// Has returns true if the data is in any of the stages, false otherwise.
+// If true, the result might be a false positive. If false, the data
+// is definitely not in the set.
+func (f *ScalableBloomFilter) Has(data []byte) bool {
+	h := hashes(data)
+	for i := len(f.stages) - 1; i >= 0; i-- {
+		if f.stages[i].has(h) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *ScalableBloomFilter) Count() int {
+	return f.count
+}
+
+// Size returns the total number of bits used by all the stages
+func (f *ScalableBloomFilter) Size() int {
+	var size int
+	for _, stage := range f.stages {
+		size += stage.Size()
+	}
+	return size
+}
+
+// Stages returns the number of stages in the filter
+func (f *ScalableBloomFilter) Stages() int {
+	return len(f.stages)
+}
+
+// EstimatedFPRate returns the current false positive rate of the filter,
+// which is the chance of any of the stages reporting a false positive
+func (f *ScalableBloomFilter) EstimatedFPRate() float64 {
+	none := 1.0
+	for _, stage := range f.stages {
+		none *= 1 - stage.EstimatedFPRate()
+	}
+	return 1 - none
+}
+
+// The encoded filter starts with a header, where k is the number of
+// stages and m is the capacity of the first stage, followed by three
+// words holding p, r and the growth factor. Every stage follows, each
+// one encoded as a regular bloom filter.
+const scalableParams = 3
+
+func scalableWords(h header) int {
+	return scalableParams
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface
+func (f *ScalableBloomFilter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface
+func (f *ScalableBloomFilter) UnmarshalBinary(data []byte) error {
+	n, err := f.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return ErrBadFormat
+		}
+		return err
+	}
+	if n != int64(len(data)) {
+		return ErrBadFormat
+	}
+	return nil
+}
+
+// WriteTo implements the io.WriterTo interface
+func (f *ScalableBloomFilter) WriteTo(w io.Writer) (int64, error) {
+	h := header{
+		magic: magicScalable,
+		k:     uint(len(f.stages)),
+		m:     f.n,
+		count: f.count,
+	}
+	params := []uint64{
+		math.Float64bits(f.p),
+		math.Float64bits(f.r),
+		uint64(f.growth),
+	}
+	total, err := writeWords(w, h, params)
+	if err != nil {
+		return total, err
+	}
+	for _, stage := range f.stages {
+		n, err := stage.WriteTo(w)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// ReadFrom implements the io.ReaderFrom interface. It reads exactly
+// one encoded filter from r, replacing the contents of the filter.
+func (f *ScalableBloomFilter) ReadFrom(r io.Reader) (int64, error) {
+	h, params, total, err := readWords(r, magicScalable, scalableWords)
+	if err != nil {
+		return total, err
+	}
+	p, ratio, growth := math.Float64frombits(params[0]), math.Float64frombits(params[1]), uint(params[2])
+	if p <= 0 || p >= 1 || ratio <= 0 || ratio >= 1 || growth < 1 {
+		return total, ErrBadFormat
+	}
+	stages := make([]*BloomFilter, h.k)
+	for i := range stages {
+		stages[i] = new(BloomFilter)
+		n, err := stages[i].ReadFrom(r)
+		total += n
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return total, err
+		}
+	}
+	f.n, f.p, f.r, f.growth = h.m, p, ratio, growth
+	f.stages, f.count = stages, h.count
+	return total, nil
+}
@@ -0,0 +1,301 @@
+/*
+ *
+ *  * // Copyright (c) 2021 Scott Cagno. All rights reserved.
+ *  * // The license can be found in the root of this project; see LICENSE.
+ *
+ */
+
+package bloom
+
+import (
+	"github.com/scottcagno/storage/pkg/hash/cityhash"
+	"io"
+	"math"
+	"sort"
+	"unsafe"
+)
+
+// maxXorAttempts is the number of seeds tried before giving up on
+// building an xor filter, which only happens with duplicate hashes
+const maxXorAttempts = 100
+
+// Fingerprint is the type of the fingerprints stored in an xor filter
+type Fingerprint interface {
+	~uint8 | ~uint16
+}
+
+// XorFilter is a static filter that is built once from a full set of
+// keys and can not be changed afterwards. It uses about 1.23 fingerprints
+// per key, which makes it roughly 30% smaller than a bloom filter with the
+// same false positive rate. An 8-bit fingerprint gives a false positive
+// rate of about 1 in 256 and a 16-bit fingerprint about 1 in 65,536.
+type XorFilter[T Fingerprint] struct {
+	seed  uint64 // seed is mixed into the hash of every key
+	block uint   // block is the number of fingerprints in each of the three blocks
+	fp    []T    // fp holds the fingerprints
+	count int
+}
+
+// NewXorFilter8 returns a new xor filter with 8-bit fingerprints
+// holding the provided keys
+func NewXorFilter8(keys [][]byte) (*XorFilter[uint8], error) {
+	return NewXorFilter[uint8](keys)
+}
+
+// NewXorFilter16 returns a new xor filter with 16-bit fingerprints
+// holding the provided keys
+func NewXorFilter16(keys [][]byte) (*XorFilter[uint16], error) {
+	return NewXorFilter[uint16](keys)
+}
+
+// NewXorFilter returns a new xor filter holding the provided keys.
+// Duplicate keys are allowed, they are only added once.
+func NewXorFilter[T Fingerprint](keys [][]byte) (*XorFilter[T], error) {
+	hashes := make([]uint64, len(keys))
+	for i, key := range keys {
+		hashes[i] = cityhash.Hash64(key)
+	}
+	// remove duplicates, otherwise construction can never succeed
+	sort.Slice(hashes, func(i, j int) bool {
+		return hashes[i] < hashes[j]
+	})
+	uniq := hashes[:0]
+	for i, h := range hashes {
+		if i == 0 || h != hashes[i-1] {
+			uniq = append(uniq, h)
+		}
+	}
+	hashes = uniq
+	// allocate
+	size := 32 + uint(math.Ceil(1.23*float64(len(hashes))))
+	f := &XorFilter[T]{
+		block: size / 3,
+		count: len(hashes),
+	}
+	f.fp = make([]T, 3*f.block)
+	// try seeds until the keys can be peeled
+	seed := kp00
+	for i := 0; i < maxXorAttempts; i++ {
+		f.seed = splitmix64(&seed)
+		if f.populate(hashes) {
+			return f, nil
+		}
+	}
+	return nil, ErrBuildFailed
+}
+
+// splitmix64 returns the next value of the splitmix64 generator
+func splitmix64(seed *uint64) uint64 {
+	*seed += 0x9e3779b97f4a7c15
+	z := *seed
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// mix64 is the murmur3 finalizer
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// reduce maps a 32-bit hash onto [0, n) without a division
+func reduce(h uint32, n uint32) uint32 {
+	return uint32((uint64(h) * uint64(n)) >> 32)
+}
+
+func rotl64(h uint64, n uint) uint64 {
+	return (h << n) | (h >> (64 - n))
+}
+
+// hash returns the hash of a key hash using the seed of the filter
+func (f *XorFilter[T]) hash(h uint64) uint64 {
+	return mix64(h + f.seed)
+}
+
+// locations returns the three fingerprint locations for a hash,
+// one in each block
+func (f *XorFilter[T]) locations(h uint64) (uint32, uint32, uint32) {
+	b := uint32(f.block)
+	return reduce(uint32(h), b),
+		reduce(uint32(rotl64(h, 21)), b) + b,
+		reduce(uint32(rotl64(h, 42)), b) + 2*b
+}
+
+// fingerprint returns the fingerprint for a hash
+func fingerprint[T Fingerprint](h uint64) T {
+	return T(h ^ (h >> 32))
+}
+
+// populate attempts to assign the fingerprints for every hash
+func (f *XorFilter[T]) populate(hashes []uint64) bool {
+	size := len(f.fp)
+	xormask := make([]uint64, size)
+	counts := make([]uint32, size)
+	for _, h := range hashes {
+		h = f.hash(h)
+		h0, h1, h2 := f.locations(h)
+		xormask[h0] ^= h
+		counts[h0]++
+		xormask[h1] ^= h
+		counts[h1]++
+		xormask[h2] ^= h
+		counts[h2]++
+	}
+	// find the locations that only a single hash maps to
+	queue := make([]uint32, 0, size)
+	for i, c := range counts {
+		if c == 1 {
+			queue = append(queue, uint32(i))
+		}
+	}
+	// peel the hashes off, one location at a time
+	type peeled struct {
+		hash uint64
+		at   uint32
+	}
+	stack := make([]peeled, 0, len(hashes))
+	for len(queue) > 0 {
+		i := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if counts[i] != 1 {
+			continue
+		}
+		h := xormask[i]
+		stack = append(stack, peeled{hash: h, at: i})
+		h0, h1, h2 := f.locations(h)
+		for _, j := range [3]uint32{h0, h1, h2} {
+			xormask[j] ^= h
+			counts[j]--
+			if counts[j] == 1 {
+				queue = append(queue, j)
+			}
+		}
+	}
+	if len(stack) != len(hashes) {
+		return false
+	}
+	// assign the fingerprints in reverse order
+	for i := range f.fp {
+		f.fp[i] = 0
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		p := stack[i]
+		h0, h1, h2 := f.locations(p.hash)
+		f.fp[p.at] = fingerprint[T](p.hash) ^ f.fp[h0] ^ f.fp[h1] ^ f.fp[h2]
+	}
+	return true
+}
+
+// Contains returns true if the key may be in the filter. If false,
+// the key is definitely not in the filter.
+func (f *XorFilter[T]) Contains(key []byte) bool {
+	h := f.hash(cityhash.Hash64(key))
+	h0, h1, h2 := f.locations(h)
+	return fingerprint[T](h) == f.fp[h0]^f.fp[h1]^f.fp[h2]
+}
+
+func (f *XorFilter[T]) MayHave(key []byte) bool {
+	return f.Contains(key)
+}
+
+func (f *XorFilter[T]) Has(key []byte) bool {
+	return f.Contains(key)
+}
+
+func (f *XorFilter[T]) Count() int {
+	return f.count
+}
+
+// Size returns the number of bits used by the fingerprints
+func (f *XorFilter[T]) Size() int {
+	return len(f.fp) * fingerprintBitsOf[T]()
+}
+
+// EstimatedFPRate returns the false positive rate of the filter,
+// which only depends on the size of the fingerprints
+func (f *XorFilter[T]) EstimatedFPRate() float64 {
+	return 1 / math.Pow(2, float64(fingerprintBitsOf[T]()))
+}
+
+// fingerprintBitsOf returns the number of bits in a fingerprint
+func fingerprintBitsOf[T Fingerprint]() int {
+	var fp T
+	return int(unsafe.Sizeof(fp)) * 8
+}
+
+// The encoded filter uses the regular header, where k is the number of
+// bits in a fingerprint and m is the number of fingerprints in a block.
+// The header is followed by a word holding the seed, followed by the
+// fingerprints, which are packed into words.
+func (f *XorFilter[T]) header() header {
+	return header{magic: magicXor, k: uint(fingerprintBitsOf[T]()), m: f.block, count: f.count}
+}
+
+// xorWords returns the number of words used by an xor
+// filter with fingerprints of type T
+func xorWords[T Fingerprint](h header) int {
+	bits := fingerprintBitsOf[T]()
+	if h.k != uint(bits) {
+		return -1
+	}
+	per := 64 / bits
+	return 1 + (3*int(h.m)+per-1)/per
+}
+
+// words packs the seed and the fingerprints into words
+func (f *XorFilter[T]) words() []uint64 {
+	bits := fingerprintBitsOf[T]()
+	per := 64 / bits
+	words := make([]uint64, 1+(len(f.fp)+per-1)/per)
+	words[0] = f.seed
+	for i, fp := range f.fp {
+		words[1+i/per] |= uint64(fp) << ((i % per) * bits)
+	}
+	return words
+}
+
+// load unpacks the seed and the fingerprints from the words
+func (f *XorFilter[T]) load(h header, words []uint64) {
+	bits := fingerprintBitsOf[T]()
+	per := 64 / bits
+	f.seed, f.block, f.count = words[0], h.m, h.count
+	f.fp = make([]T, 3*h.m)
+	for i := range f.fp {
+		f.fp[i] = T(words[1+i/per] >> ((i % per) * bits))
+	}
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface
+func (f *XorFilter[T]) MarshalBinary() ([]byte, error) {
+	return marshalWords(f.header(), f.words()), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface
+func (f *XorFilter[T]) UnmarshalBinary(data []byte) error {
+	h, words, err := unmarshalWords(data, magicXor, xorWords[T])
+	if err != nil {
+		return err
+	}
+	f.load(h, words)
+	return nil
+}
+
+// WriteTo implements the io.WriterTo interface
+func (f *XorFilter[T]) WriteTo(w io.Writer) (int64, error) {
+	return writeWords(w, f.header(), f.words())
+}
+
+// ReadFrom implements the io.ReaderFrom interface
+func (f *XorFilter[T]) ReadFrom(r io.Reader) (int64, error) {
+	h, words, n, err := readWords(r, magicXor, xorWords[T])
+	if err != nil {
+		return n, err
+	}
+	f.load(h, words)
+	return n, nil
+}
@@ -0,0 +1,239 @@
+package cdb
+
+import (
+	"fmt"
+	"github.com/scottcagno/storage/pkg/hash"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+const (
+	thousand = 1000
+	n        = 50
+)
+
+func makeKey(i int) []byte {
+	return []byte(fmt.Sprintf("key-%06d", i))
+}
+
+func makeVal(i int) []byte {
+	return []byte(fmt.Sprintf("value-%06d-%s", i, make([]byte, i%64)))
+}
+
+// build writes a cdb file holding count keys
+func build(t *testing.T, path string, conf *Config, count int) {
+	w, err := NewWriter(path, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < count; i++ {
+		err = w.Put(makeKey(i), makeVal(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w.Len() != count {
+		t.Fatalf("Len() got = %d, want %d", w.Len(), count)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReader_Get(t *testing.T) {
+	for _, name := range hash.Names() {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.cdb")
+			build(t, path, &Config{Hash: name, Seed: 42}, n*thousand)
+			r, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			if r.Len() != n*thousand {
+				t.Errorf("Len() got = %d, want %d", r.Len(), n*thousand)
+			}
+			for i := 0; i < n*thousand; i++ {
+				v, err := r.Get(makeKey(i))
+				if err != nil || string(v) != string(makeVal(i)) {
+					t.Fatalf("Get(%s) got = %q, %v", makeKey(i), v, err)
+				}
+			}
+			for i := n * thousand; i < (n+1)*thousand; i++ {
+				if _, err = r.Get(makeKey(i)); err != ErrKeyNotFound {
+					t.Fatalf("Get(%s) got error %v, want %v", makeKey(i), err, ErrKeyNotFound)
+				}
+			}
+			if err = r.Verify(); err != nil {
+				t.Errorf("Verify() got error %v", err)
+			}
+		})
+	}
+}
+
+func TestReader_Range(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cdb")
+	build(t, path, nil, thousand)
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var i int
+	err = r.Range(func(key, value []byte) bool {
+		if string(key) != string(makeKey(i)) || string(value) != string(makeVal(i)) {
+			t.Fatalf("Range() got %s=%s at %d", key, value, i)
+		}
+		i++
+		return true
+	})
+	if err != nil || i != thousand {
+		t.Errorf("Range() got %d records, error %v", i, err)
+	}
+	i = 0
+	_ = r.Range(func(key, value []byte) bool {
+		i++
+		return i < 10
+	})
+	if i != 10 {
+		t.Errorf("Range() did not stop, got %d records", i)
+	}
+}
+
+func TestReader_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cdb")
+	build(t, path, nil, 10*thousand)
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < 10*thousand; i += 3 {
+				v, err := r.Get(makeKey(i))
+				if err != nil || string(v) != string(makeVal(i)) {
+					t.Errorf("Get(%s) got = %q, %v", makeKey(i), v, err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestReader_Empty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cdb")
+	build(t, path, nil, 0)
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.Get([]byte("key")); err != ErrKeyNotFound {
+		t.Errorf("Get() got error %v, want %v", err, ErrKeyNotFound)
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.Get([]byte("key")); err != ErrClosed {
+		t.Errorf("Get() got error %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestReader_Corrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cdb")
+	build(t, path, nil, thousand)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a flipped bit in the header is found by Open
+	bad := append([]byte(nil), data...)
+	bad[offRecords] ^= 1
+	err = os.WriteFile(path, bad, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Open(path); err != ErrBadChecksum {
+		t.Errorf("Open() got error %v, want %v", err, ErrBadChecksum)
+	}
+	// a flipped bit in a value is found by Verify
+	bad = append([]byte(nil), data...)
+	bad[HeaderSize+recHeaderSize+1] ^= 1
+	err = os.WriteFile(path, bad, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err = r.Verify(); err != ErrBadChecksum {
+		t.Errorf("Verify() got error %v, want %v", err, ErrBadChecksum)
+	}
+	err = os.WriteFile(path, []byte("not a cdb file"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Open(path); err != ErrBadMagic {
+		t.Errorf("Open() got error %v, want %v", err, ErrBadMagic)
+	}
+}
+
+func TestWriter_Abort(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cdb")
+	w, err := NewWriter(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Put([]byte("key"), []byte("value"))
+	w.Abort()
+	if err = w.Put([]byte("key"), []byte("value")); err != ErrClosed {
+		t.Errorf("Put() got error %v, want %v", err, ErrClosed)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file exists after Abort()")
+	}
+	if _, err = os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file exists after Abort()")
+	}
+}
+
+func BenchmarkReader_Get(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "bench.cdb")
+	w, err := NewWriter(path, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < 100*thousand; i++ {
+		_ = w.Put(makeKey(i), makeVal(i))
+	}
+	if err = w.Close(); err != nil {
+		b.Fatal(err)
+	}
+	r, err := Open(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+	keys := make([][]byte, 1024)
+	for i := range keys {
+		keys[i] = makeKey(i * 97)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			_, _ = r.Get(keys[i&1023])
+			i++
+		}
+	})
+}
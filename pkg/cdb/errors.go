@@ -0,0 +1,18 @@
+package cdb
+
+import (
+	"errors"
+)
+
+var (
+	ErrKeyNotFound = errors.New("cdb: key not found")
+	ErrClosed      = errors.New("cdb: closed")
+
+	ErrKeyTooLarge   = errors.New("cdb: key too large")
+	ErrValueTooLarge = errors.New("cdb: value too large")
+
+	ErrBadMagic    = errors.New("cdb: not a cdb file")
+	ErrBadVersion  = errors.New("cdb: unsupported version")
+	ErrBadChecksum = errors.New("cdb: bad checksum")
+	ErrCorrupted   = errors.New("cdb: corrupted file")
+)
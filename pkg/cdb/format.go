@@ -0,0 +1,138 @@
+package cdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+)
+
+/*
+	A cdb file is an immutable two-level hash table. It is made up of a
+	header, the records in the order they were added, and 256 hash tables:
+
+	+--------+---------+---------+-----+---------+----------+-----+----------+
+	| header | record0 | record1 | ... | recordN | table0   | ... | table255 |
+	+--------+---------+---------+-----+---------+----------+-----+----------+
+
+	The header holds the name and seed of the hash function, the number of
+	records, where the records end, a checksum of everything after the
+	header, and the offset and number of slots of every table, followed by
+	a checksum of the header itself:
+
+	+-------+---------+-------+-----------+------+---------+----------+----------+----------+------------+-------+
+	| magic | version | flags | hash name | seed | records | data end | body crc | reserved | tables     | crc32 |
+	| 8 B   | 4 B     | 4 B   | 16 B      | 8 B  | 8 B     | 8 B      | 4 B      | 4 B      | 256 * 16 B | 4 B   |
+	+-------+---------+-------+-----------+------+---------+----------+----------+----------+------------+-------+
+
+	A record is the length of the key and the value, followed by both:
+
+	+---------+---------+-----+-------+
+	| key len | val len | key | value |
+	| 4 B     | 4 B     |     |       |
+	+---------+---------+-----+-------+
+
+	The low byte of the hash of a key picks the table, and the rest of the
+	hash picks the slot in that table where the search for the key starts,
+	moving on to the next slot (linear probing) until it finds the key or
+	an empty slot. A slot is the hash of the key and the offset of its
+	record; an empty slot has an offset of zero. Every table has twice as
+	many slots as keys, so the searches are short.
+*/
+
+const (
+	magic   = "SCCDB\x00\x00\x00"
+	version = 1
+
+	numTables     = 256
+	hashNameSize  = 16
+	tableRefSize  = 16
+	slotSize      = 16
+	recHeaderSize = 8
+
+	offMagic    = 0
+	offVersion  = 8
+	offFlags    = 12
+	offHashName = 16
+	offSeed     = 32
+	offRecords  = 40
+	offDataEnd  = 48
+	offBodyCRC  = 56
+	offTables   = 64
+	offCRC      = offTables + numTables*tableRefSize
+
+	// HeaderSize is the size of the header of a cdb file
+	HeaderSize = offCRC + 4
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// table is the location of one of the second level hash tables
+type table struct {
+	offset uint64 // offset of the first slot
+	slots  uint64 // number of slots
+}
+
+// header is the decoded header of a cdb file
+type header struct {
+	hashName string
+	seed     uint64
+	records  uint64
+	dataEnd  uint64
+	bodyCRC  uint32
+	tables   [numTables]table
+}
+
+// encode returns the encoded header, including its checksum
+func (h *header) encode() []byte {
+	b := make([]byte, HeaderSize)
+	copy(b[offMagic:], magic)
+	binary.LittleEndian.PutUint32(b[offVersion:], version)
+	copy(b[offHashName:offHashName+hashNameSize], h.hashName)
+	binary.LittleEndian.PutUint64(b[offSeed:], h.seed)
+	binary.LittleEndian.PutUint64(b[offRecords:], h.records)
+	binary.LittleEndian.PutUint64(b[offDataEnd:], h.dataEnd)
+	binary.LittleEndian.PutUint32(b[offBodyCRC:], h.bodyCRC)
+	for i, t := range h.tables {
+		off := offTables + i*tableRefSize
+		binary.LittleEndian.PutUint64(b[off:], t.offset)
+		binary.LittleEndian.PutUint64(b[off+8:], t.slots)
+	}
+	binary.LittleEndian.PutUint32(b[offCRC:], crc32.Checksum(b[:offCRC], crcTable))
+	return b
+}
+
+// decodeHeader decodes and checks the header of a cdb file of size bytes
+func decodeHeader(b []byte, size uint64) (*header, error) {
+	if len(b) < HeaderSize || string(b[offMagic:offMagic+len(magic)]) != magic {
+		return nil, ErrBadMagic
+	}
+	if binary.LittleEndian.Uint32(b[offCRC:]) != crc32.Checksum(b[:offCRC], crcTable) {
+		return nil, ErrBadChecksum
+	}
+	if binary.LittleEndian.Uint32(b[offVersion:]) != version {
+		return nil, ErrBadVersion
+	}
+	h := &header{
+		hashName: string(bytes.TrimRight(b[offHashName:offHashName+hashNameSize], "\x00")),
+		seed:     binary.LittleEndian.Uint64(b[offSeed:]),
+		records:  binary.LittleEndian.Uint64(b[offRecords:]),
+		dataEnd:  binary.LittleEndian.Uint64(b[offDataEnd:]),
+		bodyCRC:  binary.LittleEndian.Uint32(b[offBodyCRC:]),
+	}
+	if h.dataEnd < HeaderSize || h.dataEnd > size {
+		return nil, ErrCorrupted
+	}
+	for i := range h.tables {
+		off := offTables + i*tableRefSize
+		t := table{
+			offset: binary.LittleEndian.Uint64(b[off:]),
+			slots:  binary.LittleEndian.Uint64(b[off+8:]),
+		}
+		// the tables must lie between the records and the end of the file
+		if t.slots > 0 && (t.offset < h.dataEnd || t.offset > size || t.slots > (size-t.offset)/slotSize) {
+			return nil, ErrCorrupted
+		}
+		h.tables[i] = t
+	}
+	return h, nil
+}
@@ -0,0 +1,165 @@
+package cdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/scottcagno/storage/pkg/hash"
+	"github.com/scottcagno/storage/pkg/mmap"
+	"hash/crc32"
+	"os"
+)
+
+// Reader looks up keys in a cdb file mapped into memory. The file never
+// changes, so any number of goroutines can call Get, Has and Range at the
+// same time without any locking. The keys and values they return point
+// into the mapped file: they must not be modified, and they are only valid
+// until the reader is closed. Close must not be called while any other
+// method is still running.
+type Reader struct {
+	mm   *mmap.Mapping
+	data []byte
+	hash func(b []byte) uint64
+	hdr  *header
+}
+
+// Open maps the cdb file at path into memory, and checks its header
+func Open(path string) (*Reader, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	// the mapping stays valid after the file has been closed
+	defer fd.Close()
+	fi, err := fd.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < HeaderSize {
+		return nil, ErrBadMagic
+	}
+	mm, err := mmap.Open(fd.Fd(), 0, uintptr(fi.Size()), mmap.ModeReadOnly, 0)
+	if err != nil {
+		return nil, err
+	}
+	data := mm.Memory()
+	hdr, err := decodeHeader(data, uint64(len(data)))
+	if err != nil {
+		_ = mm.Close()
+		return nil, err
+	}
+	fn, err := hash.Func64(hdr.hashName, hdr.seed)
+	if err != nil {
+		_ = mm.Close()
+		return nil, err
+	}
+	return &Reader{
+		mm:   mm,
+		data: data,
+		hash: fn,
+		hdr:  hdr,
+	}, nil
+}
+
+// record returns the key and value of the record at offset
+func (r *Reader) record(offset uint64) ([]byte, []byte, error) {
+	if offset < HeaderSize || offset > r.hdr.dataEnd-recHeaderSize {
+		return nil, nil, ErrCorrupted
+	}
+	klen := uint64(binary.LittleEndian.Uint32(r.data[offset:]))
+	vlen := uint64(binary.LittleEndian.Uint32(r.data[offset+4:]))
+	start := offset + recHeaderSize
+	if klen+vlen > r.hdr.dataEnd-start {
+		return nil, nil, ErrCorrupted
+	}
+	return r.data[start : start+klen : start+klen], r.data[start+klen : start+klen+vlen : start+klen+vlen], nil
+}
+
+// Get returns the value of the key. The value points into the mapped
+// file; it must not be modified, and it is only valid until Close.
+func (r *Reader) Get(key []byte) ([]byte, error) {
+	if r.data == nil {
+		return nil, ErrClosed
+	}
+	h := r.hash(key)
+	t := r.hdr.tables[h&0xff]
+	if t.slots == 0 {
+		return nil, ErrKeyNotFound
+	}
+	j := (h >> 8) % t.slots
+	for n := uint64(0); n < t.slots; n++ {
+		s := r.data[t.offset+j*slotSize:]
+		offset := binary.LittleEndian.Uint64(s[8:])
+		if offset == 0 {
+			break
+		}
+		if binary.LittleEndian.Uint64(s) == h {
+			k, v, err := r.record(offset)
+			if err != nil {
+				return nil, err
+			}
+			if bytes.Equal(k, key) {
+				return v, nil
+			}
+		}
+		if j++; j == t.slots {
+			j = 0
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+// Has reports whether the key is in the file
+func (r *Reader) Has(key []byte) bool {
+	_, err := r.Get(key)
+	return err == nil
+}
+
+// Range calls iter for every key and value, in the order they were added,
+// until iter returns false. The keys and values point into the mapped
+// file; they must not be modified, and they are only valid until Close.
+func (r *Reader) Range(iter func(key, value []byte) bool) error {
+	if r.data == nil {
+		return ErrClosed
+	}
+	offset := uint64(HeaderSize)
+	for i := uint64(0); i < r.hdr.records; i++ {
+		k, v, err := r.record(offset)
+		if err != nil {
+			return err
+		}
+		if !iter(k, v) {
+			return nil
+		}
+		offset += recHeaderSize + uint64(len(k)) + uint64(len(v))
+	}
+	if offset != r.hdr.dataEnd {
+		return ErrCorrupted
+	}
+	return nil
+}
+
+// Len returns the number of records in the file
+func (r *Reader) Len() int {
+	return int(r.hdr.records)
+}
+
+// Verify checks the whole file against the checksum in the header. Open
+// only checks the header, so that opening a large file is cheap.
+func (r *Reader) Verify() error {
+	if r.data == nil {
+		return ErrClosed
+	}
+	if crc32.Checksum(r.data[HeaderSize:], crcTable) != r.hdr.bodyCRC {
+		return ErrBadChecksum
+	}
+	return nil
+}
+
+// Close unmaps the file
+func (r *Reader) Close() error {
+	if r.data == nil {
+		return ErrClosed
+	}
+	r.data = nil
+	return r.mm.Close()
+}
@@ -0,0 +1,209 @@
+package cdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"github.com/scottcagno/storage/pkg/hash"
+	"hash/crc32"
+	"math"
+	"os"
+)
+
+// Config holds the configuration options for writing a cdb file
+type Config struct {
+	Hash string // name of the hash function (see the hash package)
+	Seed uint64 // seed of the hash function
+}
+
+var defaultConfig = &Config{
+	Hash: hash.XXHash,
+}
+
+func checkConfig(conf *Config) *Config {
+	if conf == nil {
+		return defaultConfig
+	}
+	c := *conf
+	if c.Hash == "" {
+		c.Hash = defaultConfig.Hash
+	}
+	return &c
+}
+
+// slot is the hash of a key and the offset of its record
+type slot struct {
+	hash   uint64
+	offset uint64
+}
+
+// Writer builds a cdb file from a stream of keys and values. The file is
+// written under a temporary name, and only appears under its own name
+// once the writer has been closed successfully. A Writer is not safe for
+// concurrent use.
+type Writer struct {
+	path    string
+	fd      *os.File
+	bw      *bufio.Writer
+	hash    func(b []byte) uint64
+	hdr     header
+	offset  uint64
+	crc     uint32
+	buckets [numTables][]slot
+}
+
+// NewWriter returns a writer for a new cdb file at path, hashing the keys
+// with the configured hash function. A nil config uses xxhash.
+func NewWriter(path string, conf *Config) (*Writer, error) {
+	conf = checkConfig(conf)
+	if len(conf.Hash) > hashNameSize {
+		return nil, hash.ErrUnknownHash
+	}
+	fn, err := hash.Func64(conf.Hash, conf.Seed)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{
+		path:   path,
+		fd:     fd,
+		bw:     bufio.NewWriterSize(fd, 64<<10),
+		hash:   fn,
+		offset: HeaderSize,
+	}
+	w.hdr.hashName = conf.Hash
+	w.hdr.seed = conf.Seed
+	// leave room for the header, it is written last
+	_, err = w.bw.Write(make([]byte, HeaderSize))
+	if err != nil {
+		w.Abort()
+		return nil, err
+	}
+	return w, nil
+}
+
+// write writes b after the header, adding it to the body checksum
+func (w *Writer) write(b []byte) error {
+	_, err := w.bw.Write(b)
+	if err != nil {
+		return err
+	}
+	w.crc = crc32.Update(w.crc, crcTable, b)
+	w.offset += uint64(len(b))
+	return nil
+}
+
+// Put adds a key and its value. Keys are not checked for duplicates;
+// if a key is added more than once, Get returns the first value.
+func (w *Writer) Put(key, value []byte) error {
+	if w.fd == nil {
+		return ErrClosed
+	}
+	if uint64(len(key)) > math.MaxUint32 {
+		return ErrKeyTooLarge
+	}
+	if uint64(len(value)) > math.MaxUint32 {
+		return ErrValueTooLarge
+	}
+	h := w.hash(key)
+	w.buckets[h&0xff] = append(w.buckets[h&0xff], slot{hash: h, offset: w.offset})
+	var hdr [recHeaderSize]byte
+	binary.LittleEndian.PutUint32(hdr[0:4], uint32(len(key)))
+	binary.LittleEndian.PutUint32(hdr[4:8], uint32(len(value)))
+	err := w.write(hdr[:])
+	if err != nil {
+		return err
+	}
+	err = w.write(key)
+	if err != nil {
+		return err
+	}
+	err = w.write(value)
+	if err != nil {
+		return err
+	}
+	w.hdr.records++
+	return nil
+}
+
+// Close writes the hash tables and the header, syncs the file and moves
+// it to its own name. The file is removed if anything goes wrong.
+func (w *Writer) Close() error {
+	if w.fd == nil {
+		return ErrClosed
+	}
+	err := w.finish()
+	if err != nil {
+		w.Abort()
+		return err
+	}
+	err = w.fd.Close()
+	w.fd = nil
+	if err != nil {
+		_ = os.Remove(w.path + ".tmp")
+		return err
+	}
+	return os.Rename(w.path+".tmp", w.path)
+}
+
+// finish writes the hash tables and the header
+func (w *Writer) finish() error {
+	w.hdr.dataEnd = w.offset
+	var buf []byte
+	for i, bucket := range w.buckets {
+		if len(bucket) == 0 {
+			continue
+		}
+		n := uint64(len(bucket)) * 2
+		slots := make([]slot, n)
+		for _, s := range bucket {
+			j := (s.hash >> 8) % n
+			for slots[j].offset != 0 {
+				j = (j + 1) % n
+			}
+			slots[j] = s
+		}
+		w.hdr.tables[i] = table{offset: w.offset, slots: n}
+		if uint64(cap(buf)) < n*slotSize {
+			buf = make([]byte, n*slotSize)
+		}
+		buf = buf[:n*slotSize]
+		for j, s := range slots {
+			binary.LittleEndian.PutUint64(buf[j*slotSize:], s.hash)
+			binary.LittleEndian.PutUint64(buf[j*slotSize+8:], s.offset)
+		}
+		err := w.write(buf)
+		if err != nil {
+			return err
+		}
+		// the slots are no longer needed
+		w.buckets[i] = nil
+	}
+	err := w.bw.Flush()
+	if err != nil {
+		return err
+	}
+	w.hdr.bodyCRC = w.crc
+	_, err = w.fd.WriteAt(w.hdr.encode(), 0)
+	if err != nil {
+		return err
+	}
+	return w.fd.Sync()
+}
+
+// Abort stops writing and removes the unfinished file
+func (w *Writer) Abort() {
+	if w.fd == nil {
+		return
+	}
+	_ = w.fd.Close()
+	_ = os.Remove(w.path + ".tmp")
+	w.fd = nil
+}
+
+// Len returns the number of records added so far
+func (w *Writer) Len() int {
+	return int(w.hdr.records)
+}
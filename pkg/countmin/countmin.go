@@ -0,0 +1,180 @@
+package countmin
+
+import (
+	"errors"
+	"github.com/scottcagno/storage/pkg/hash/xxhash"
+	"math"
+)
+
+var (
+	ErrBadParameters = errors.New("countmin: bad sketch parameters")
+	ErrSizeMismatch  = errors.New("countmin: sketch sizes do not match")
+)
+
+// CountMinSketch estimates how many times each value has been added. The
+// estimates are never too low, and with a width of w and a depth of d they
+// are too high by at most e/w times the total count with a probability of
+// 1-(1/2)^d. Updates are conservative, meaning that only the counters that
+// hold the current minimum are incremented, which lowers the error a lot
+// for skewed data. Counters saturate instead of overflowing.
+//
+// Optionally, all the counters can be halved every time a fixed number of
+// values has been added (see SetDecay) so that the sketch tracks recent
+// frequencies instead of frequencies since the beginning of time.
+//
+// A CountMinSketch is not safe for concurrent use.
+type CountMinSketch struct {
+	width      uint64   // counters per row
+	depth      uint64   // number of rows
+	counters   []uint32 // depth rows of width counters
+	total      uint64   // total count added since the last decay
+	decayEvery uint64   // decay after this many additions (0 means never)
+	additions  uint64   // additions since the last decay
+	decays     uint64   // number of times the counters have been decayed
+}
+
+// NewCountMinSketch returns a new count-min sketch with depth rows of width
+// counters each. Width and depth must both be at least one.
+func NewCountMinSketch(width, depth uint) (*CountMinSketch, error) {
+	if width < 1 || depth < 1 {
+		return nil, ErrBadParameters
+	}
+	return &CountMinSketch{
+		width:    uint64(width),
+		depth:    uint64(depth),
+		counters: make([]uint32, width*depth),
+	}, nil
+}
+
+// NewCountMinSketchEP returns a new count-min sketch that overestimates a
+// count by at most epsilon times the total count, with a probability of
+// at least 1-delta. Both must be between zero and one.
+func NewCountMinSketchEP(epsilon, delta float64) (*CountMinSketch, error) {
+	if epsilon <= 0 || epsilon >= 1 || delta <= 0 || delta >= 1 {
+		return nil, ErrBadParameters
+	}
+	width := uint(math.Ceil(math.E / epsilon))
+	depth := uint(math.Ceil(math.Log(1 / delta)))
+	return NewCountMinSketch(width, depth)
+}
+
+// Width returns the number of counters in every row
+func (s *CountMinSketch) Width() uint {
+	return uint(s.width)
+}
+
+// Depth returns the number of rows
+func (s *CountMinSketch) Depth() uint {
+	return uint(s.depth)
+}
+
+// SetDecay makes the sketch halve all of its counters every time the
+// provided number of values has been added. Zero disables decaying.
+func (s *CountMinSketch) SetDecay(every uint64) {
+	s.decayEvery = every
+}
+
+// Total returns the total count added since the counters were last
+// decayed (or halved along with them)
+func (s *CountMinSketch) Total() uint64 {
+	return s.total
+}
+
+// Decays returns the number of times the counters have been halved
+func (s *CountMinSketch) Decays() uint64 {
+	return s.decays
+}
+
+// index returns the index of the counter for row i using double hashing
+func (s *CountMinSketch) index(h1, h2, i uint64) uint64 {
+	return i*s.width + (h1+i*h2)%s.width
+}
+
+// hashes returns the two hashes used to locate the counters of data
+func hashes(data []byte) (uint64, uint64) {
+	h := xxhash.Sum64(data)
+	// the second hash is odd, so it is never zero
+	return h, h>>32 | h<<32 | 1
+}
+
+// Add adds count occurrences of data, and returns the new estimated
+// count of data.
+func (s *CountMinSketch) Add(data []byte, count uint32) uint32 {
+	h1, h2 := hashes(data)
+	// find the current estimate
+	min := uint32(math.MaxUint32)
+	for i := uint64(0); i < s.depth; i++ {
+		if c := s.counters[s.index(h1, h2, i)]; c < min {
+			min = c
+		}
+	}
+	est := min + count
+	if est < min {
+		// saturate
+		est = math.MaxUint32
+	}
+	// conservative update; only raise the counters that are
+	// lower than the new estimate
+	for i := uint64(0); i < s.depth; i++ {
+		j := s.index(h1, h2, i)
+		if s.counters[j] < est {
+			s.counters[j] = est
+		}
+	}
+	s.total += uint64(count)
+	s.additions++
+	if s.decayEvery > 0 && s.additions >= s.decayEvery {
+		s.Decay()
+		est >>= 1
+	}
+	return est
+}
+
+// Count returns the estimated count of data
+func (s *CountMinSketch) Count(data []byte) uint32 {
+	h1, h2 := hashes(data)
+	min := uint32(math.MaxUint32)
+	for i := uint64(0); i < s.depth; i++ {
+		if c := s.counters[s.index(h1, h2, i)]; c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+// Decay halves all the counters
+func (s *CountMinSketch) Decay() {
+	for i := range s.counters {
+		s.counters[i] >>= 1
+	}
+	s.total >>= 1
+	s.additions = 0
+	s.decays++
+}
+
+// Merge adds the counts of other to the sketch. Both sketches must have
+// the same width and depth. Note that the result is not the same as adding
+// all of the values to one sketch when conservative updates are used, but
+// the estimates are still never too low.
+func (s *CountMinSketch) Merge(other *CountMinSketch) error {
+	if s.width != other.width || s.depth != other.depth {
+		return ErrSizeMismatch
+	}
+	for i, c := range other.counters {
+		sum := s.counters[i] + c
+		if sum < c {
+			sum = math.MaxUint32
+		}
+		s.counters[i] = sum
+	}
+	s.total += other.total
+	return nil
+}
+
+// Reset sets every counter back to zero
+func (s *CountMinSketch) Reset() {
+	for i := range s.counters {
+		s.counters[i] = 0
+	}
+	s.total, s.additions = 0, 0
+}
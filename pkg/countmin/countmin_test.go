@@ -0,0 +1,161 @@
+package countmin
+
+import (
+	"github.com/scottcagno/storage/pkg/util"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+const (
+	thousand = 1000
+	n        = 1
+)
+
+func key(i uint64) []byte {
+	return []byte("key-" + strconv.FormatUint(i, 10))
+}
+
+// zipfStream returns a skewed stream of keys along with the exact counts
+func zipfStream(size int) ([][]byte, map[string]uint32) {
+	r := rand.New(rand.NewSource(1))
+	z := rand.NewZipf(r, 1.1, 1, 100*thousand)
+	stream := make([][]byte, size)
+	counts := make(map[string]uint32)
+	for i := range stream {
+		stream[i] = key(z.Uint64())
+		counts[string(stream[i])]++
+	}
+	return stream, counts
+}
+
+func TestNewCountMinSketch(t *testing.T) {
+	_, err := NewCountMinSketch(0, 4)
+	util.AssertEqual(t, ErrBadParameters, err)
+	_, err = NewCountMinSketchEP(0, 0.01)
+	util.AssertEqual(t, ErrBadParameters, err)
+	s, err := NewCountMinSketchEP(0.001, 0.01)
+	util.AssertNoError(t, err)
+	util.AssertEqual(t, uint(2719), s.Width())
+	util.AssertEqual(t, uint(5), s.Depth())
+}
+
+func TestCountMinSketch_Count(t *testing.T) {
+	stream, counts := zipfStream(200 * thousand * n)
+	s, err := NewCountMinSketchEP(0.001, 0.01)
+	util.AssertNoError(t, err)
+	for _, k := range stream {
+		s.Add(k, 1)
+	}
+	util.AssertEqual(t, uint64(len(stream)), s.Total())
+	// the estimates are never too low, and (with high probability)
+	// never too high by more than epsilon times the total count
+	bound := uint32(0.001 * float64(len(stream)))
+	over := 0
+	for k, c := range counts {
+		est := s.Count([]byte(k))
+		if est < c {
+			t.Fatalf("count(%q): estimated %d, less than actual %d\n", k, est, c)
+		}
+		if est-c > bound {
+			over++
+		}
+	}
+	if float64(over) > 0.01*float64(len(counts)) {
+		t.Errorf("%d of %d estimates exceeded the error bound\n", over, len(counts))
+	}
+	// values that were never added have small estimates
+	util.AssertEqual(t, true, s.Count([]byte("never added")) <= bound)
+}
+
+func TestCountMinSketch_Decay(t *testing.T) {
+	s, _ := NewCountMinSketch(1024, 4)
+	s.SetDecay(100)
+	for i := 0; i < 99; i++ {
+		s.Add([]byte("hot"), 1)
+	}
+	util.AssertEqual(t, uint32(99), s.Count([]byte("hot")))
+	// the hundredth addition halves everything
+	util.AssertEqual(t, uint32(50), s.Add([]byte("hot"), 1))
+	util.AssertEqual(t, uint32(50), s.Count([]byte("hot")))
+	util.AssertEqual(t, uint64(50), s.Total())
+	util.AssertEqual(t, uint64(1), s.Decays())
+}
+
+func TestCountMinSketch_Merge(t *testing.T) {
+	a, _ := NewCountMinSketch(1024, 4)
+	b, _ := NewCountMinSketch(1024, 4)
+	a.Add([]byte("x"), 3)
+	b.Add([]byte("x"), 4)
+	b.Add([]byte("y"), 5)
+	util.AssertNoError(t, a.Merge(b))
+	util.AssertEqual(t, true, a.Count([]byte("x")) >= 7)
+	util.AssertEqual(t, true, a.Count([]byte("y")) >= 5)
+	util.AssertEqual(t, uint64(12), a.Total())
+	c, _ := NewCountMinSketch(512, 4)
+	util.AssertEqual(t, ErrSizeMismatch, a.Merge(c))
+}
+
+func TestTopK(t *testing.T) {
+	stream, counts := zipfStream(200 * thousand * n)
+	s, _ := NewCountMinSketchEP(0.0005, 0.01)
+	top := NewTopK(10, s)
+	// add the stream concurrently
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(stream); i += 4 {
+				top.Add(stream[i])
+			}
+		}(w)
+	}
+	wg.Wait()
+	// find the actual top 10
+	var actual []Item
+	for k, c := range counts {
+		actual = append(actual, Item{Key: k, Count: c})
+	}
+	sort.Slice(actual, func(i, j int) bool {
+		return actual[i].Count > actual[j].Count
+	})
+	items := top.Items()
+	util.AssertLen(t, 10, len(items))
+	found := make(map[string]bool)
+	for _, item := range items {
+		found[item.Key] = true
+	}
+	// the heaviest hitters must all be found
+	for _, item := range actual[:5] {
+		if !found[item.Key] {
+			t.Errorf("top item %q (count %d) not found in %v\n", item.Key, item.Count, items)
+		}
+	}
+	// items are ordered by count
+	for i := 1; i < len(items); i++ {
+		util.AssertEqual(t, true, items[i-1].Count >= items[i].Count)
+	}
+}
+
+func TestTopK_Decay(t *testing.T) {
+	s, _ := NewCountMinSketch(1024, 4)
+	s.SetDecay(1000)
+	top := NewTopK(2, s)
+	// "old" is hot at first...
+	for i := 0; i < 900; i++ {
+		top.Add([]byte("old"))
+	}
+	// ...and then "new" takes over
+	for i := 0; i < 3000; i++ {
+		top.Add([]byte("new"))
+		if i%10 == 0 {
+			top.Add(key(uint64(i)))
+		}
+	}
+	items := top.Items()
+	util.AssertEqual(t, "new", items[0].Key)
+	util.AssertEqual(t, true, top.Count([]byte("old")) < 900/4)
+}
@@ -0,0 +1,154 @@
+package countmin
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+// Item is a value tracked by a TopK along with its estimated count
+type Item struct {
+	Key   string `json:"key"`
+	Count uint32 `json:"count"`
+}
+
+// TopK tracks the k most frequently added values (the heavy hitters) in a
+// stream. The frequencies are estimated by a count-min sketch, and the k
+// values with the highest estimates are kept in a min-heap, so only the k
+// keys have to be stored. When the sketch decays, the counts of the kept
+// values are halved along with it.
+//
+// A TopK is safe for concurrent use.
+type TopK struct {
+	lock   sync.Mutex
+	k      int
+	sketch *CountMinSketch
+	decays uint64   // decays of the sketch seen so far
+	items  itemHeap // min-heap of the tracked items
+}
+
+// NewTopK returns a new TopK that tracks the k most frequent values using
+// the provided sketch to estimate their frequencies. The sketch should not
+// be used by anything else.
+func NewTopK(k int, sketch *CountMinSketch) *TopK {
+	if k < 1 {
+		k = 1
+	}
+	return &TopK{
+		k:      k,
+		sketch: sketch,
+		decays: sketch.Decays(),
+		items:  newItemHeap(k),
+	}
+}
+
+// Add adds an occurrence of key, and returns its new estimated count
+func (t *TopK) Add(key []byte) uint32 {
+	return t.AddN(key, 1)
+}
+
+// AddN adds count occurrences of key, and returns its new estimated count
+func (t *TopK) AddN(key []byte, count uint32) uint32 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	est := t.sketch.Add(key, count)
+	if d := t.sketch.Decays(); d != t.decays {
+		// the sketch decayed, so decay the items the same
+		// way; this does not change their order in the heap
+		shift := d - t.decays
+		for i := range t.items.items {
+			if shift >= 32 {
+				t.items.items[i].Count = 0
+			} else {
+				t.items.items[i].Count >>= shift
+			}
+		}
+		t.decays = d
+	}
+	if i, ok := t.items.index[string(key)]; ok {
+		// already tracked, update the count
+		t.items.items[i].Count = est
+		heap.Fix(&t.items, i)
+		return est
+	}
+	if t.items.Len() < t.k {
+		heap.Push(&t.items, Item{Key: string(key), Count: est})
+		return est
+	}
+	if est > t.items.items[0].Count {
+		// replace the least frequent tracked item
+		delete(t.items.index, t.items.items[0].Key)
+		t.items.items[0] = Item{Key: string(key), Count: est}
+		t.items.index[string(key)] = 0
+		heap.Fix(&t.items, 0)
+	}
+	return est
+}
+
+// Count returns the estimated count of key
+func (t *TopK) Count(key []byte) uint32 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.sketch.Count(key)
+}
+
+// Items returns the tracked items, ordered from the most to the least
+// frequent
+func (t *TopK) Items() []Item {
+	t.lock.Lock()
+	items := make([]Item, t.items.Len())
+	copy(items, t.items.items)
+	t.lock.Unlock()
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Key < items[j].Key
+	})
+	return items
+}
+
+// Reset removes all the items and resets the sketch
+func (t *TopK) Reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.sketch.Reset()
+	t.items = newItemHeap(t.k)
+}
+
+// itemHeap is a min-heap of items ordered by their counts, which keeps
+// track of the position of every key in the heap
+type itemHeap struct {
+	items []Item
+	index map[string]int
+}
+
+func newItemHeap(k int) itemHeap {
+	return itemHeap{
+		items: make([]Item, 0, k),
+		index: make(map[string]int, k),
+	}
+}
+
+func (h itemHeap) Len() int           { return len(h.items) }
+func (h itemHeap) Less(i, j int) bool { return h.items[i].Count < h.items[j].Count }
+
+func (h itemHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.index[h.items[i].Key] = i
+	h.index[h.items[j].Key] = j
+}
+
+func (h *itemHeap) Push(x interface{}) {
+	item := x.(Item)
+	h.index[item.Key] = len(h.items)
+	h.items = append(h.items, item)
+}
+
+func (h *itemHeap) Pop() interface{} {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items = h.items[:n-1]
+	delete(h.index, item.Key)
+	return item
+}
@@ -0,0 +1,219 @@
+package cache
+
+import (
+	"sync"
+)
+
+// lists of the ARC cache
+const (
+	arcT1 = iota // items seen once recently
+	arcT2        // items seen at least twice recently
+	arcB1        // keys recently evicted from T1
+	arcB2        // keys recently evicted from T2
+)
+
+// ARC is an adaptive replacement cache (Megiddo and Modha). It keeps the
+// items that were used once recently (T1) apart from the ones that were
+// used more than once (T2), and remembers the keys recently evicted from
+// both (B1 and B2). A hit on a remembered key moves the target size of T1
+// towards the list it was evicted from, so the cache adapts itself to
+// favour recency or frequency, depending on the workload.
+type ARC[K comparable, V any] struct {
+	size  int // max num of items
+	p     int // target size of T1
+	items map[K]*item[K, V]
+	t1    list[K, V]
+	t2    list[K, V]
+	b1    list[K, V]
+	b2    list[K, V]
+	stats Stats
+	mu    sync.Mutex
+}
+
+// NewARC returns a new ARC cache holding at most size items
+func NewARC[K comparable, V any](size int) *ARC[K, V] {
+	if size < 1 {
+		size = DefaultSize
+	}
+	c := &ARC[K, V]{
+		size:  size,
+		items: make(map[K]*item[K, V], size),
+	}
+	c.t1.init()
+	c.t2.init()
+	c.b1.init()
+	c.b2.init()
+	return c
+}
+
+// listOf returns the list holding the item
+func (c *ARC[K, V]) listOf(i *item[K, V]) *list[K, V] {
+	switch i.where {
+	case arcT1:
+		return &c.t1
+	case arcT2:
+		return &c.t2
+	case arcB1:
+		return &c.b1
+	}
+	return &c.b2
+}
+
+// resident reports whether the value of the item is in the cache
+func resident[K comparable, V any](i *item[K, V]) bool {
+	return i.where == arcT1 || i.where == arcT2
+}
+
+// Get returns a value for the given key (if it exists)
+func (c *ARC[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.items[key]
+	if i == nil || !resident(i) {
+		c.stats.Misses++
+		return *new(V), false
+	}
+	c.stats.Hits++
+	c.listOf(i).remove(i)
+	i.where = arcT2
+	c.t2.pushFront(i)
+	return i.value, true
+}
+
+// Peek returns a value for the given key (if it exists) without
+// counting it as a use of the item or updating the counters
+func (c *ARC[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.items[key]
+	if i == nil || !resident(i) {
+		return *new(V), false
+	}
+	return i.value, true
+}
+
+// Set inserts or replaces a value for the given key
+func (c *ARC[K, V]) Set(key K, value V) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.items[key]
+	if i != nil {
+		switch i.where {
+		case arcT1, arcT2:
+			prev := i.value
+			c.listOf(i).remove(i)
+			i.value, i.where = value, arcT2
+			c.t2.pushFront(i)
+			return prev, true
+		case arcB1:
+			// recency would have helped; grow T1
+			c.p = min(c.size, c.p+max(c.b2.len/c.b1.len, 1))
+			c.b1.remove(i)
+			c.replace(false)
+		case arcB2:
+			// frequency would have helped; shrink T1
+			c.p = max(0, c.p-max(c.b1.len/c.b2.len, 1))
+			c.b2.remove(i)
+			c.replace(true)
+		}
+		i.value, i.where = value, arcT2
+		c.t2.pushFront(i)
+		return *new(V), false
+	}
+	// a new key
+	l1 := c.t1.len + c.b1.len
+	total := l1 + c.t2.len + c.b2.len
+	if l1 >= c.size {
+		if c.t1.len < c.size {
+			c.drop(&c.b1)
+			c.replace(false)
+		} else {
+			c.stats.Evictions++
+			c.drop(&c.t1)
+		}
+	} else if total >= c.size {
+		if total >= 2*c.size {
+			c.drop(&c.b2)
+		}
+		c.replace(false)
+	}
+	i = &item[K, V]{key: key, value: value, where: arcT1}
+	c.t1.pushFront(i)
+	c.items[key] = i
+	return *new(V), false
+}
+
+// replace evicts an item from T1 or T2 to make room for
+// one more item, if the cache is full
+func (c *ARC[K, V]) replace(inB2 bool) {
+	if c.t1.len+c.t2.len < c.size {
+		return
+	}
+	c.stats.Evictions++
+	if c.t1.len > 0 && (c.t1.len > c.p || (inB2 && c.t1.len == c.p)) {
+		i := c.t1.back()
+		c.t1.remove(i)
+		i.value, i.where = *new(V), arcB1
+		c.b1.pushFront(i)
+		return
+	}
+	i := c.t2.back()
+	c.t2.remove(i)
+	i.value, i.where = *new(V), arcB2
+	c.b2.pushFront(i)
+}
+
+// drop removes the last item of a list from the cache
+func (c *ARC[K, V]) drop(l *list[K, V]) {
+	if i := l.back(); i != nil {
+		l.remove(i)
+		delete(c.items, i.key)
+	}
+}
+
+// Del removes a value for the given key (if it exists)
+func (c *ARC[K, V]) Del(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.items[key]
+	if i == nil {
+		return *new(V), false
+	}
+	c.listOf(i).remove(i)
+	delete(c.items, key)
+	if !resident(i) {
+		return *new(V), false
+	}
+	return i.value, true
+}
+
+// Len returns the current length of the cache
+func (c *ARC[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t1.len + c.t2.len
+}
+
+// Stats returns the counters of the cache
+func (c *ARC[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.stats
+	st.Items = c.t1.len + c.t2.len
+	st.Cost = int64(st.Items)
+	return st
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
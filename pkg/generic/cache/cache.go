@@ -0,0 +1,87 @@
+package cache
+
+// Cache is a cache with a bounded number of items. The policies differ
+// in which items they keep: LRU keeps the most recently used ones, while
+// TwoQueue, ARC and TinyLFU also take into account how often items are
+// used, so a single scan over many keys does not wipe out the cache.
+type Cache[K comparable, V any] interface {
+
+	// Get returns a value for the given key (if it exists)
+	Get(key K) (V, bool)
+
+	// Peek returns a value for the given key (if it exists) without
+	// counting it as a use of the item or updating the counters
+	Peek(key K) (V, bool)
+
+	// Set inserts or replaces a value for the given key, and returns
+	// the value it replaced (if any)
+	Set(key K, value V) (V, bool)
+
+	// Del removes a value for the given key (if it exists)
+	Del(key K) (V, bool)
+
+	// Len returns the current length of the cache
+	Len() int
+
+	// Stats returns the counters of the cache
+	Stats() Stats
+}
+
+var (
+	_ Cache[string, []byte] = (*LRU[string, []byte])(nil)
+	_ Cache[string, []byte] = (*ShardedLRU[string, []byte])(nil)
+	_ Cache[string, []byte] = (*TwoQueue[string, []byte])(nil)
+	_ Cache[string, []byte] = (*ARC[string, []byte])(nil)
+	_ Cache[string, []byte] = (*TinyLFU[string, []byte])(nil)
+)
+
+// list is a doubly linked list of items, used by the policies that
+// keep more than one list
+type list[K comparable, V any] struct {
+	root item[K, V] // sentinel; root.next is the front, root.prev the back
+	len  int
+}
+
+func (l *list[K, V]) init() {
+	l.root.next = &l.root
+	l.root.prev = &l.root
+	l.len = 0
+}
+
+// back returns the last (least recently used) item, or nil
+func (l *list[K, V]) back() *item[K, V] {
+	if l.len == 0 {
+		return nil
+	}
+	return l.root.prev
+}
+
+// pushFront inserts an item at the front of the list
+func (l *list[K, V]) pushFront(i *item[K, V]) {
+	i.prev = &l.root
+	i.next = l.root.next
+	l.root.next.prev = i
+	l.root.next = i
+	l.len++
+}
+
+// remove removes an item from the list
+func (l *list[K, V]) remove(i *item[K, V]) {
+	i.prev.next = i.next
+	i.next.prev = i.prev
+	i.prev, i.next = nil, nil
+	l.len--
+}
+
+// moveToFront moves an item of the list to the front
+func (l *list[K, V]) moveToFront(i *item[K, V]) {
+	if l.root.next == i {
+		return
+	}
+	i.prev.next = i.next
+	i.next.prev = i.prev
+	i.prev = &l.root
+	i.next = l.root.next
+	l.root.next.prev = i
+	l.root.next = i
+}
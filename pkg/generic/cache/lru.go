@@ -1,19 +1,85 @@
 package cache
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
+	"time"
 )
 
 // DefaultSize is the max size of the cache before
 // the older items automatically get evicted
 const DefaultSize = 256
 
+// EvictReason is the reason an item was removed from the cache
+type EvictReason int
+
+const (
+	EvictCapacity EvictReason = iota // evicted to make room for other items
+	EvictExpired                     // its time to live ran out
+	EvictDeleted                     // removed by a call to Del
+	EvictRejected                    // its cost (or that of the value replacing it) is larger than the max cost
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictExpired:
+		return "expired"
+	case EvictDeleted:
+		return "deleted"
+	case EvictRejected:
+		return "rejected"
+	}
+	return fmt.Sprintf("EvictReason(%d)", int(r))
+}
+
+// Config is the configuration of an LRU cache
+type Config[K comparable, V any] struct {
+	// MaxItems is the max number of items. If it is zero and a
+	// MaxCost is set, the number of items is not limited.
+	MaxItems int
+
+	// MaxCost is the max total cost of the items (zero for no limit)
+	MaxCost int64
+
+	// Cost returns the cost of an item, for example its size in bytes.
+	// Every item costs one if it is nil.
+	Cost func(key K, value V) int64
+
+	// TTL is the default time to live of the items (zero for none)
+	TTL time.Duration
+
+	// ExpireInterval is how often the expired items are removed in the
+	// background. If it is zero, expired items are only removed when
+	// they are found, or to make room for other items.
+	ExpireInterval time.Duration
+
+	// OnEvict is called (without any locks held) for every item that
+	// is removed from the cache, except for replaced values. A value
+	// replaced by one that is rejected is passed to it before the
+	// rejected value, both with EvictRejected.
+	OnEvict func(key K, value V, reason EvictReason)
+
+	// Shards is the number of shards of a ShardedLRU. It is rounded up
+	// to a power of two. The max items and max cost are split between
+	// the shards.
+	Shards int
+
+	// Hash is used by a ShardedLRU to pick the shard of a key
+	Hash func(key K) uint64
+}
+
 // item is an item in the cache (doubly linked)
 type item[K comparable, V any] struct {
 	key        K
 	value      V
+	cost       int64
+	expires    int64 // unix nano, zero if the item never expires
+	where      uint8 // which list holds the item (for policies with more than one)
 	prev, next *item[K, V]
 }
 
@@ -22,12 +88,70 @@ func (i *item[K, V]) String() string {
 	return ss
 }
 
+// eviction is an item that was removed and has yet to be passed to OnEvict
+type eviction[K comparable, V any] struct {
+	key    K
+	value  V
+	reason EvictReason
+}
+
+// Stats holds the counters of a cache
+type Stats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+	Items       int    `json:"items"`
+	Cost        int64  `json:"cost"`
+}
+
+// HitRatio returns the ratio of hits to lookups
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+func (s Stats) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%T:\n", s)
+	fmt.Fprintf(&sb, "\thits=%d\n", s.Hits)
+	fmt.Fprintf(&sb, "\tmisses=%d\n", s.Misses)
+	fmt.Fprintf(&sb, "\thit_ratio=%.4f\n", s.HitRatio())
+	fmt.Fprintf(&sb, "\tevictions=%d\n", s.Evictions)
+	fmt.Fprintf(&sb, "\texpirations=%d\n", s.Expirations)
+	fmt.Fprintf(&sb, "\titems=%d\n", s.Items)
+	fmt.Fprintf(&sb, "\tcost=%d\n", s.Cost)
+	return sb.String()
+}
+
+func (s Stats) JSON() string {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
 // LRU is an LRU cache
 type LRU[K comparable, V any] struct {
 	size       int               // max num of items
 	items      map[K]*item[K, V] // actives items
 	head, tail *item[K, V]       // head and tail of list
 	mu         sync.RWMutex
+
+	maxCost int64 // max total cost of the items
+	cost    int64 // total cost of the items
+	costFn  func(key K, value V) int64
+	ttl     time.Duration
+	onEvict func(key K, value V, reason EvictReason)
+	now     func() int64 // clock, in unix nano
+	stats   Stats
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
 }
 
 func NewLRU[K comparable, V any](size int) *LRU[K, V] {
@@ -45,8 +169,70 @@ func NewLRU[K comparable, V any](size int) *LRU[K, V] {
 	return lru
 }
 
+// checkConfig fills in the defaults of a config
+func checkConfig[K comparable, V any](conf *Config[K, V]) *Config[K, V] {
+	if conf == nil {
+		conf = &Config[K, V]{}
+	}
+	c := *conf
+	if c.MaxItems < 0 {
+		c.MaxItems = 0
+	}
+	if c.MaxCost < 0 {
+		c.MaxCost = 0
+	}
+	if c.MaxItems == 0 && c.MaxCost == 0 {
+		c.MaxItems = DefaultSize
+	}
+	if c.TTL < 0 {
+		c.TTL = 0
+	}
+	if c.ExpireInterval < 0 {
+		c.ExpireInterval = 0
+	}
+	if c.Shards < 1 {
+		c.Shards = 1
+	}
+	return &c
+}
+
+// NewLRUWithConfig returns a new LRU cache using the provided config. If
+// an expire interval is set, Close must be called to stop removing the
+// expired items in the background.
+func NewLRUWithConfig[K comparable, V any](conf *Config[K, V]) *LRU[K, V] {
+	conf = checkConfig(conf)
+	lru := newLRU(conf)
+	if conf.ExpireInterval > 0 {
+		lru.done = make(chan struct{})
+		lru.wg.Add(1)
+		go lru.expireLoop(conf.ExpireInterval)
+	}
+	return lru
+}
+
+// newLRU returns a new LRU cache without a background expiry goroutine
+func newLRU[K comparable, V any](conf *Config[K, V]) *LRU[K, V] {
+	hint := conf.MaxItems
+	if hint == 0 || hint > DefaultSize {
+		hint = DefaultSize
+	}
+	lru := &LRU[K, V]{
+		size:    conf.MaxItems,
+		items:   make(map[K]*item[K, V], hint),
+		head:    new(item[K, V]),
+		tail:    new(item[K, V]),
+		maxCost: conf.MaxCost,
+		costFn:  conf.Cost,
+		ttl:     conf.TTL,
+		onEvict: conf.OnEvict,
+	}
+	lru.head.next = lru.tail
+	lru.tail.prev = lru.head
+	return lru
+}
+
 func (l *LRU[K, V]) init(size int) {
-	if l.size < 1 {
+	if l.size < 1 && l.maxCost < 1 {
 		size = DefaultSize
 	}
 	l.size = size
@@ -62,6 +248,7 @@ func (l *LRU[K, V]) evict() *item[K, V] {
 	i := l.tail.prev
 	l.pop(i)
 	delete(l.items, i.key)
+	l.cost -= i.cost
 	return i
 }
 
@@ -79,103 +266,294 @@ func (l *LRU[K, V]) push(i *item[K, V]) {
 	l.head.next = i
 }
 
+// clock returns the current time in unix nano
+func (l *LRU[K, V]) clock() int64 {
+	if l.now != nil {
+		return l.now()
+	}
+	return time.Now().UnixNano()
+}
+
+// expired reports whether the time to live of an item has run out
+func (l *LRU[K, V]) expired(i *item[K, V]) bool {
+	return i.expires != 0 && l.clock() >= i.expires
+}
+
+// costOf returns the cost of an item
+func (l *LRU[K, V]) costOf(key K, value V) int64 {
+	if l.costFn == nil {
+		return 1
+	}
+	return l.costFn(key, value)
+}
+
+// full reports whether there are too many items, or they cost too much
+func (l *LRU[K, V]) full() bool {
+	return (l.size > 0 && len(l.items) > l.size) || (l.maxCost > 0 && l.cost > l.maxCost)
+}
+
+// remove removes an item, updates the counters and (if there is an
+// OnEvict callback) appends the item to the evictions
+func (l *LRU[K, V]) remove(i *item[K, V], reason EvictReason, ev []eviction[K, V]) []eviction[K, V] {
+	l.pop(i)
+	delete(l.items, i.key)
+	l.cost -= i.cost
+	switch reason {
+	case EvictCapacity:
+		l.stats.Evictions++
+	case EvictExpired:
+		l.stats.Expirations++
+	}
+	if l.onEvict != nil {
+		ev = append(ev, eviction[K, V]{key: i.key, value: i.value, reason: reason})
+	}
+	return ev
+}
+
+// notify passes the evictions to the OnEvict callback. It
+// must be called after the lock has been released.
+func (l *LRU[K, V]) notify(ev []eviction[K, V]) {
+	for _, e := range ev {
+		l.onEvict(e.key, e.value, e.reason)
+	}
+}
+
 // Resize sets the max size of the LRU cache and returns the evicted items. It will panic
 // if the size is less than one item. I the value is less than the number of items in the
 // cache, then items will be evicted.
 func (l *LRU[K, V]) Resize(size int) (ekeys, evals []interface{}) {
 	l.mu.Lock()
-	defer l.mu.Unlock()
 	if size < 1 {
+		l.mu.Unlock()
 		log.Panicln("invalid size")
 	}
+	var ev []eviction[K, V]
 	for size < len(l.items) {
-		i := l.evict()
+		i := l.tail.prev
 		ekeys, evals = append(ekeys, i.key), append(evals, i.value)
+		ev = l.remove(i, EvictCapacity, ev)
 	}
 	l.size = size
+	l.mu.Unlock()
+	l.notify(ev)
 	return ekeys, evals
 }
 
-// Len returns the current length of the cache
+// Len returns the current length of the cache. Expired items
+// are counted until they have been removed.
 func (l *LRU[K, V]) Len() int {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	return len(l.items)
 }
 
-// SetEvicted inserts or replaces a value for a given key.
-// The item is returned if this operation causes an eviction.
-func (l *LRU[K, V]) SetEvicted(key K, value V) (prev V, replaced bool, ekey K, eval V, evicted bool) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+// Cost returns the total cost of the items in the cache
+func (l *LRU[K, V]) Cost() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.cost
+}
+
+// set inserts or replaces a value for the given key. It returns the
+// first item that was evicted to make room for it (if any).
+func (l *LRU[K, V]) set(key K, value V, cost int64, ttl time.Duration) (prev V, replaced bool, first *item[K, V], ev []eviction[K, V]) {
 	if l.items == nil {
 		l.init(l.size)
 	}
 	i := l.items[key]
-	if i == nil {
-		if len(l.items) == l.size {
-			i = l.evict()
-			ekey, eval, evicted = i.key, i.value, true
-		} else {
-			i = new(item[K, V])
+	if i != nil {
+		prev, replaced = i.value, true
+	}
+	// an item that can never fit is not added, and
+	// the value it would have replaced is removed
+	if l.maxCost > 0 && cost > l.maxCost {
+		if i != nil {
+			ev = l.remove(i, EvictRejected, ev)
+		}
+		if l.onEvict != nil {
+			ev = append(ev, eviction[K, V]{key: key, value: value, reason: EvictRejected})
 		}
-		i.key, i.value = key, value
+		return prev, replaced, nil, ev
+	}
+	if i == nil {
+		i = &item[K, V]{key: key}
 		l.push(i)
 		l.items[key] = i
-	} else {
-		prev, replaced = i.value, true
-		i.value = value
-		if l.head.next != i {
-			l.pop(i)
-			l.push(i)
+	} else if l.head.next != i {
+		l.pop(i)
+		l.push(i)
+	}
+	l.cost += cost - i.cost
+	i.value, i.cost, i.expires = value, cost, 0
+	if ttl > 0 {
+		i.expires = l.clock() + int64(ttl)
+	}
+	for l.full() {
+		t := l.tail.prev
+		reason := EvictCapacity
+		if l.expired(t) {
+			reason = EvictExpired
+		}
+		if first == nil {
+			first = &item[K, V]{key: t.key, value: t.value}
 		}
+		ev = l.remove(t, reason, ev)
+	}
+	return prev, replaced, first, ev
+}
+
+// SetEvicted inserts or replaces a value for a given key.
+// The item is returned if this operation causes an eviction. If
+// more than one item was evicted, the least recently used is returned.
+func (l *LRU[K, V]) SetEvicted(key K, value V) (prev V, replaced bool, ekey K, eval V, evicted bool) {
+	cost := l.costOf(key, value)
+	l.mu.Lock()
+	prev, replaced, first, ev := l.set(key, value, cost, l.ttl)
+	l.mu.Unlock()
+	l.notify(ev)
+	if first != nil {
+		ekey, eval, evicted = first.key, first.value, true
 	}
 	return prev, replaced, ekey, eval, evicted
 }
 
 // Set inserts or replaces a value for the given key
 func (l *LRU[K, V]) Set(key K, value V) (V, bool) {
-	prev, replaced, _, _, _ := l.SetEvicted(key, value)
+	return l.SetWithTTL(key, value, l.ttl)
+}
+
+// SetWithTTL inserts or replaces a value for the given key, which
+// expires after the provided time to live (zero for never)
+func (l *LRU[K, V]) SetWithTTL(key K, value V, ttl time.Duration) (V, bool) {
+	cost := l.costOf(key, value)
+	l.mu.Lock()
+	prev, replaced, _, ev := l.set(key, value, cost, ttl)
+	l.mu.Unlock()
+	l.notify(ev)
 	return prev, replaced
 }
 
 // Get returns a value for the given key (if it exists)
 func (l *LRU[K, V]) Get(key K) (V, bool) {
 	l.mu.Lock()
-	defer l.mu.Unlock()
 	i := l.items[key]
 	if i == nil {
+		l.stats.Misses++
+		l.mu.Unlock()
+		return *new(V), false
+	}
+	if l.expired(i) {
+		ev := l.remove(i, EvictExpired, nil)
+		l.stats.Misses++
+		l.mu.Unlock()
+		l.notify(ev)
 		return *new(V), false
 	}
+	l.stats.Hits++
 	if l.head.next != i {
 		l.pop(i)
 		l.push(i)
 	}
+	value := i.value
+	l.mu.Unlock()
+	return value, true
+}
+
+// Peek returns a value for the given key (if it exists) without
+// making it the most recently used item or updating the counters
+func (l *LRU[K, V]) Peek(key K) (V, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	i := l.items[key]
+	if i == nil || l.expired(i) {
+		return *new(V), false
+	}
 	return i.value, true
 }
 
 // Del removes and value for the given key (if it exists)
 func (l *LRU[K, V]) Del(key K) (V, bool) {
 	l.mu.Lock()
-	defer l.mu.Unlock()
 	i := l.items[key]
 	if i == nil {
+		l.mu.Unlock()
 		return *new(V), false
 	}
-	delete(l.items, key)
-	l.pop(i)
+	ev := l.remove(i, EvictDeleted, nil)
+	l.mu.Unlock()
+	l.notify(ev)
 	return i.value, true
 }
 
+// RemoveExpired removes all the expired items and
+// returns the number of items that were removed
+func (l *LRU[K, V]) RemoveExpired() int {
+	l.mu.Lock()
+	if l.head == nil {
+		l.mu.Unlock()
+		return 0
+	}
+	var n int
+	var ev []eviction[K, V]
+	now := l.clock()
+	for i := l.tail.prev; i != l.head; {
+		prev := i.prev
+		if i.expires != 0 && now >= i.expires {
+			ev = l.remove(i, EvictExpired, ev)
+			n++
+		}
+		i = prev
+	}
+	l.mu.Unlock()
+	l.notify(ev)
+	return n
+}
+
+// expireLoop removes the expired items at every interval
+func (l *LRU[K, V]) expireLoop(interval time.Duration) {
+	defer l.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			l.RemoveExpired()
+		}
+	}
+}
+
+// Close stops removing the expired items in the background. The
+// cache can still be used after it has been closed.
+func (l *LRU[K, V]) Close() {
+	l.closeOnce.Do(func() {
+		if l.done != nil {
+			close(l.done)
+			l.wg.Wait()
+		}
+	})
+}
+
+// Stats returns the counters of the cache
+func (l *LRU[K, V]) Stats() Stats {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	st := l.stats
+	st.Items = len(l.items)
+	st.Cost = l.cost
+	return st
+}
+
 // Range iterates over all keys and values in the order of most
-// recently used to least recently used items.
+// recently used to least recently used items. Expired items are skipped.
 func (l *LRU[K, V]) Range(iter func(key K, value V) bool) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	if head := l.head; head != nil {
 		i := head.next
 		for i != l.tail {
-			if !iter(i.key, i.value) {
+			if !l.expired(i) && !iter(i.key, i.value) {
 				return
 			}
 			i = i.next
@@ -184,14 +562,14 @@ func (l *LRU[K, V]) Range(iter func(key K, value V) bool) {
 }
 
 // Reverse iterates over all keys and values in the order of least
-// recently used to most recently used items.
+// recently used to most recently used items. Expired items are skipped.
 func (l *LRU[K, V]) Reverse(iter func(key K, value V) bool) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	if tail := l.tail; tail != nil {
 		i := tail.prev
 		for i != l.head {
-			if !iter(i.key, i.value) {
+			if !l.expired(i) && !iter(i.key, i.value) {
 				return
 			}
 			i = i.prev
@@ -202,6 +580,8 @@ func (l *LRU[K, V]) Reverse(iter func(key K, value V) bool) {
 func (l *LRU[K, V]) String() string {
 	ss := fmt.Sprintf("lur:\n")
 	ss += fmt.Sprintf("\tsize=%d\n", l.size)
+	ss += fmt.Sprintf("\tmax_cost=%d\n", l.maxCost)
+	ss += fmt.Sprintf("\tcost=%d\n", l.cost)
 	ss += fmt.Sprintf("\thead=%s\n", l.head)
 	ss += fmt.Sprintf("\ttail=%s\n", l.tail)
 	return ss
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type t_key int
@@ -33,50 +34,244 @@ func makeNEntries(n int) []tentry {
 
 func TestLRU_Set(t *testing.T) {
 	tests := makeNEntries(64)
-	for n, tt := range tests {
-		t.Run("LRU_Set", func(t *testing.T) {
-			l := NewLRU[t_key, t_val](128)
-			got, got1 := l.Set(tt.key, tt.val)
-			if n > 0 {
-				if !reflect.DeepEqual(got, tt.want) {
-					t.Errorf("Del() got = %v, want %v", got, tt.want)
-				}
-				if got1 != tt.isok {
-					t.Errorf("Del() got1 = %v, want %v", got1, tt.isok)
-				}
-			}
-		})
+	l := NewLRUWithConfig(&Config[t_key, t_val]{
+		MaxItems: 128,
+		Cost: func(key t_key, value t_val) int64 {
+			return int64(len(value))
+		},
+	})
+	for _, tt := range tests {
+		got, got1 := l.Set(tt.key, tt.val)
+		if got != "" || got1 {
+			t.Errorf("Set() got = %v, %v, want \"\", false", got, got1)
+		}
+	}
+	if l.Len() != len(tests) || l.Cost() != int64(len(tests)*len(tests[0].val)) {
+		t.Errorf("got len=%d, cost=%d", l.Len(), l.Cost())
+	}
+	// setting the keys again replaces the values
+	for _, tt := range tests {
+		got, got1 := l.Set(tt.key, tt.val+"-2")
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Set() got = %v, want %v", got, tt.want)
+		}
+		if got1 != tt.isok {
+			t.Errorf("Set() got1 = %v, want %v", got1, tt.isok)
+		}
+	}
+	if l.Len() != len(tests) || l.Cost() != int64(len(tests)*(len(tests[0].val)+2)) {
+		t.Errorf("got len=%d, cost=%d", l.Len(), l.Cost())
 	}
 }
 
 func TestLRU_Get(t *testing.T) {
 	tests := makeNEntries(64)
+	l := NewLRUWithConfig(&Config[t_key, t_val]{
+		MaxItems: 128,
+		TTL:      time.Minute,
+	})
+	clock := &fakeClock{now: 1}
+	l.now = clock.Now
 	for _, tt := range tests {
-		t.Run("LRU_Get", func(t *testing.T) {
-			l := NewLRU[t_key, t_val](128)
-			got, got1 := l.Get(tt.key)
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("Del() got = %v, want %v", got, tt.want)
-			}
-			if got1 != tt.isok {
-				t.Errorf("Del() got1 = %v, want %v", got1, tt.isok)
-			}
-		})
+		l.Set(tt.key, tt.val)
+	}
+	for _, tt := range tests {
+		got, got1 := l.Get(tt.key)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Get() got = %v, want %v", got, tt.want)
+		}
+		if got1 != tt.isok {
+			t.Errorf("Get() got1 = %v, want %v", got1, tt.isok)
+		}
+	}
+	if _, ok := l.Get(t_key(len(tests))); ok {
+		t.Errorf("Get() found a key that was never set")
+	}
+	// once the time to live has run out, nothing is found
+	clock.Add(time.Minute)
+	for _, tt := range tests {
+		if _, ok := l.Get(tt.key); ok {
+			t.Errorf("Get() found expired key %v", tt.key)
+		}
+	}
+	st := l.Stats()
+	if st.Hits != uint64(len(tests)) || st.Misses != uint64(len(tests)+1) || st.Items != 0 {
+		t.Errorf("Stats() got = %+v", st)
 	}
 }
 
 func TestLRU_Del(t *testing.T) {
 	tests := makeNEntries(64)
-	for _, tt := range tests {
-		t.Run("LRU_Del", func(t *testing.T) {
-			l := NewLRU[t_key, t_val](128)
-			got, got1 := l.Del(tt.key)
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("Del() got = %v, want %v", got, tt.want)
+	deleted := make(map[t_key]t_val)
+	l := NewLRUWithConfig(&Config[t_key, t_val]{
+		MaxItems: 128,
+		OnEvict: func(key t_key, value t_val, reason EvictReason) {
+			if reason == EvictDeleted {
+				deleted[key] = value
 			}
-			if got1 != tt.isok {
-				t.Errorf("Del() got1 = %v, want %v", got1, tt.isok)
+		},
+	})
+	for _, tt := range tests {
+		l.Set(tt.key, tt.val)
+	}
+	for _, tt := range tests {
+		got, got1 := l.Del(tt.key)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Del() got = %v, want %v", got, tt.want)
+		}
+		if got1 != tt.isok {
+			t.Errorf("Del() got1 = %v, want %v", got1, tt.isok)
+		}
+		if deleted[tt.key] != tt.want {
+			t.Errorf("OnEvict() got = %v, want %v", deleted[tt.key], tt.want)
+		}
+		// it is gone now
+		if _, ok := l.Del(tt.key); ok {
+			t.Errorf("Del() removed key %v twice", tt.key)
+		}
+	}
+	if l.Len() != 0 || len(deleted) != len(tests) {
+		t.Errorf("got len=%d, deleted=%d", l.Len(), len(deleted))
+	}
+}
+
+// fakeClock is a clock for testing expiry
+type fakeClock struct {
+	now int64
+}
+
+func (c *fakeClock) Now() int64 {
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.now += int64(d)
+}
+
+func TestLRU_TTL(t *testing.T) {
+	var ev []EvictReason
+	l := NewLRUWithConfig(&Config[t_key, t_val]{
+		MaxItems: 16,
+		TTL:      time.Minute,
+		OnEvict: func(key t_key, value t_val, reason EvictReason) {
+			ev = append(ev, reason)
+		},
+	})
+	clock := &fakeClock{now: 1}
+	l.now = clock.Now
+	l.Set(1, "one")
+	l.SetWithTTL(2, "two", time.Hour)
+	l.SetWithTTL(3, "three", 0)
+	clock.Add(time.Minute)
+	if _, ok := l.Get(1); ok {
+		t.Errorf("Get() expired item was found")
+	}
+	if _, ok := l.Peek(1); ok {
+		t.Errorf("Peek() expired item was found")
+	}
+	if v, ok := l.Get(2); !ok || v != "two" {
+		t.Errorf("Get() got = %v, %v, want two, true", v, ok)
+	}
+	clock.Add(time.Hour)
+	if n := l.RemoveExpired(); n != 1 {
+		t.Errorf("RemoveExpired() got = %d, want 1", n)
+	}
+	if v, ok := l.Get(3); !ok || v != "three" {
+		t.Errorf("Get() got = %v, %v, want three, true", v, ok)
+	}
+	if !reflect.DeepEqual(ev, []EvictReason{EvictExpired, EvictExpired}) {
+		t.Errorf("OnEvict() got = %v", ev)
+	}
+	st := l.Stats()
+	if st.Hits != 2 || st.Misses != 1 || st.Expirations != 2 || st.Items != 1 {
+		t.Errorf("Stats() got = %+v", st)
+	}
+}
+
+func TestLRU_Cost(t *testing.T) {
+	evicted := make(map[t_key]EvictReason)
+	var rejected []t_val
+	l := NewLRUWithConfig(&Config[t_key, t_val]{
+		MaxCost: 100,
+		Cost: func(key t_key, value t_val) int64 {
+			return int64(len(value))
+		},
+		OnEvict: func(key t_key, value t_val, reason EvictReason) {
+			evicted[key] = reason
+			if reason == EvictRejected {
+				rejected = append(rejected, value)
 			}
-		})
+		},
+	})
+	for i := 0; i < 10; i++ {
+		l.Set(t_key(i), t_val(fmt.Sprintf("%020d", i)))
+	}
+	if l.Len() != 5 || l.Cost() != 100 {
+		t.Errorf("got len=%d, cost=%d, want len=5, cost=100", l.Len(), l.Cost())
+	}
+	for i := 0; i < 5; i++ {
+		if evicted[t_key(i)] != EvictCapacity {
+			t.Errorf("item %d was not evicted", i)
+		}
+	}
+	// replacing a value with a bigger one evicts the oldest items
+	l.Set(9, t_val(fmt.Sprintf("%060d", 9)))
+	if l.Len() != 3 || l.Cost() != 100 {
+		t.Errorf("got len=%d, cost=%d, want len=3, cost=100", l.Len(), l.Cost())
+	}
+	// an item that can never fit is rejected
+	l.Set(42, t_val(fmt.Sprintf("%0101d", 42)))
+	if _, ok := l.Peek(42); ok || evicted[42] != EvictRejected {
+		t.Errorf("item larger than the max cost was not rejected")
+	}
+	// and so is one replacing a value, which is removed
+	rejected = nil
+	l.Set(8, t_val(fmt.Sprintf("%0101d", 8)))
+	if _, ok := l.Peek(8); ok || len(rejected) != 2 || rejected[0] != t_val(fmt.Sprintf("%020d", 8)) {
+		t.Errorf("value replaced by an item larger than the max cost was not removed, got %v", rejected)
+	}
+	if _, ok := l.Del(9); !ok || evicted[9] != EvictDeleted {
+		t.Errorf("Del() did not report the deleted item")
+	}
+	if l.Cost() != 20 {
+		t.Errorf("Cost() got = %d, want 20", l.Cost())
+	}
+	if l.Stats().Evictions != 7 {
+		t.Errorf("Stats() got %d evictions, want 7", l.Stats().Evictions)
+	}
+}
+
+func TestLRU_Peek(t *testing.T) {
+	l := NewLRU[t_key, t_val](2)
+	l.Set(1, "one")
+	l.Set(2, "two")
+	if v, ok := l.Peek(1); !ok || v != "one" {
+		t.Errorf("Peek() got = %v, %v, want one, true", v, ok)
+	}
+	// peeking does not promote the item, so it is the one evicted
+	_, _, ekey, _, evicted := l.SetEvicted(3, "three")
+	if !evicted || ekey != 1 {
+		t.Errorf("SetEvicted() got = %v, %v, want 1, true", ekey, evicted)
+	}
+	if st := l.Stats(); st.Hits != 0 || st.Misses != 0 {
+		t.Errorf("Peek() updated the counters: %+v", st)
+	}
+}
+
+func TestLRU_ExpireInterval(t *testing.T) {
+	l := NewLRUWithConfig(&Config[t_key, t_val]{
+		TTL:            time.Millisecond,
+		ExpireInterval: time.Millisecond,
+	})
+	defer l.Close()
+	for i := 0; i < 64; i++ {
+		l.Set(t_key(i), "value")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for l.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if l.Len() != 0 {
+		t.Errorf("Len() got = %d, want 0", l.Len())
 	}
 }
@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+const thousand = 1000
+
+// policies are the caches under test, by name
+var policies = []struct {
+	name string
+	new  func(size int) Cache[uint64, uint64]
+}{
+	{"lru", func(size int) Cache[uint64, uint64] { return NewLRU[uint64, uint64](size) }},
+	{"2q", func(size int) Cache[uint64, uint64] { return NewTwoQueue[uint64, uint64](size) }},
+	{"arc", func(size int) Cache[uint64, uint64] { return NewARC[uint64, uint64](size) }},
+	{"tinylfu", func(size int) Cache[uint64, uint64] { return NewTinyLFU[uint64, uint64](size) }},
+}
+
+// zipfTrace returns n keys drawn from a zipfian distribution over keys keys
+func zipfTrace(n, keys int, seed int64) []uint64 {
+	r := rand.New(rand.NewSource(seed))
+	z := rand.NewZipf(r, 1.1, 1, uint64(keys-1))
+	trace := make([]uint64, n)
+	for i := range trace {
+		trace[i] = z.Uint64()
+	}
+	return trace
+}
+
+// scanTrace returns a zipfian trace that is interrupted by a scan
+// over scan keys that are never used again, every every keys
+func scanTrace(n, keys, every, scan int, seed int64) []uint64 {
+	trace := zipfTrace(n, keys, seed)
+	next := uint64(keys)
+	for i := every; i+scan < len(trace); i += every + scan {
+		for j := 0; j < scan; j++ {
+			trace[i+j] = next
+			next++
+		}
+	}
+	return trace
+}
+
+// replay runs the trace on the cache, setting every key that misses,
+// and returns the hit ratio
+func replay(c Cache[uint64, uint64], trace []uint64) float64 {
+	var hits int
+	for _, k := range trace {
+		if _, ok := c.Get(k); ok {
+			hits++
+			continue
+		}
+		c.Set(k, k)
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+func TestCache_Policies(t *testing.T) {
+	const size = 100
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			c := p.new(size)
+			ref := make(map[uint64]uint64)
+			r := rand.New(rand.NewSource(1))
+			for i := 0; i < 100*thousand; i++ {
+				k := uint64(r.Intn(4 * size))
+				switch r.Intn(4) {
+				case 0:
+					c.Set(k, k+uint64(i))
+					ref[k] = k + uint64(i)
+				case 1:
+					if v, ok := c.Del(k); ok && v != ref[k] {
+						t.Fatalf("Del(%d) got = %d, want %d", k, v, ref[k])
+					}
+					delete(ref, k)
+				default:
+					if v, ok := c.Get(k); ok && v != ref[k] {
+						t.Fatalf("Get(%d) got = %d, want %d", k, v, ref[k])
+					}
+				}
+				if c.Len() > size {
+					t.Fatalf("Len() got = %d, want <= %d", c.Len(), size)
+				}
+			}
+			// replacing a value returns the old one, and peeking at it
+			// does not count as a use
+			c.Set(1, 1)
+			if v, ok := c.Set(1, 2); !ok || v != 1 {
+				t.Errorf("Set() got = %d, %v, want 1, true", v, ok)
+			}
+			st := c.Stats()
+			if v, ok := c.Peek(1); !ok || v != 2 {
+				t.Errorf("Peek() got = %d, %v, want 2, true", v, ok)
+			}
+			if c.Stats() != st {
+				t.Errorf("Peek() updated the counters")
+			}
+			if st.Items != c.Len() || st.Hits == 0 || st.Misses == 0 || st.Evictions == 0 {
+				t.Errorf("Stats() got = %+v", st)
+			}
+		})
+	}
+}
+
+func TestCache_ScanResistance(t *testing.T) {
+	const size = 1000
+	trace := scanTrace(200*thousand, 100*thousand, 5*thousand, 2*size, 1)
+	ratios := make(map[string]float64)
+	for _, p := range policies {
+		ratios[p.name] = replay(p.new(size), trace)
+	}
+	for _, p := range policies[1:] {
+		if ratios[p.name] <= ratios["lru"] {
+			t.Errorf("%s hit ratio %.4f is not better than lru %.4f", p.name, ratios[p.name], ratios["lru"])
+		}
+	}
+}
+
+// BenchmarkCache_HitRatio replays zipfian and scan-polluted traces on every
+// policy and reports their hit ratios. Run it with -benchtime=1x to see the
+// hit ratios of the whole traces.
+func BenchmarkCache_HitRatio(b *testing.B) {
+	const size = 1000
+	traces := []struct {
+		name  string
+		trace []uint64
+	}{
+		{"zipf", zipfTrace(1000*thousand, 100*thousand, 1)},
+		{"scan", scanTrace(1000*thousand, 100*thousand, 5*thousand, 2*size, 1)},
+	}
+	for _, tr := range traces {
+		for _, p := range policies {
+			b.Run(fmt.Sprintf("%s/%s", tr.name, p.name), func(b *testing.B) {
+				var ratio float64
+				for i := 0; i < b.N; i++ {
+					ratio = replay(p.new(size), tr.trace)
+				}
+				b.ReportMetric(ratio*100, "hit%")
+			})
+		}
+	}
+}
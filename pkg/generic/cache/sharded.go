@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"github.com/scottcagno/storage/pkg/hashmap/openaddr"
+	"sync"
+	"time"
+)
+
+// ShardedLRU is an LRU cache split into shards, each with its own lock, so
+// that it can be used by many goroutines at once. Items are only evicted
+// in LRU order within their own shard.
+type ShardedLRU[K comparable, V any] struct {
+	shards []*LRU[K, V]
+	mask   uint64
+	hash   func(key K) uint64
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewShardedLRU returns a new sharded LRU cache using the provided config.
+// The max items and max cost are split evenly between the shards. If an
+// expire interval is set, Close must be called to stop removing the
+// expired items in the background.
+func NewShardedLRU[K comparable, V any](conf *Config[K, V]) *ShardedLRU[K, V] {
+	conf = checkConfig(conf)
+	n := 1
+	for n < conf.Shards {
+		n <<= 1
+	}
+	s := &ShardedLRU[K, V]{
+		shards: make([]*LRU[K, V], n),
+		mask:   uint64(n - 1),
+		hash:   conf.Hash,
+	}
+	if s.hash == nil {
+		s.hash = openaddr.DefaultHasher[K]()
+	}
+	sc := *conf
+	sc.MaxItems = (conf.MaxItems + n - 1) / n
+	sc.MaxCost = (conf.MaxCost + int64(n) - 1) / int64(n)
+	for i := range s.shards {
+		s.shards[i] = newLRU(&sc)
+	}
+	if conf.ExpireInterval > 0 {
+		s.done = make(chan struct{})
+		s.wg.Add(1)
+		go s.expireLoop(conf.ExpireInterval)
+	}
+	return s
+}
+
+// shard returns the shard of the provided key
+func (s *ShardedLRU[K, V]) shard(key K) *LRU[K, V] {
+	return s.shards[s.hash(key)&s.mask]
+}
+
+// Set inserts or replaces a value for the given key
+func (s *ShardedLRU[K, V]) Set(key K, value V) (V, bool) {
+	return s.shard(key).Set(key, value)
+}
+
+// SetWithTTL inserts or replaces a value for the given key, which
+// expires after the provided time to live (zero for never)
+func (s *ShardedLRU[K, V]) SetWithTTL(key K, value V, ttl time.Duration) (V, bool) {
+	return s.shard(key).SetWithTTL(key, value, ttl)
+}
+
+// Get returns a value for the given key (if it exists)
+func (s *ShardedLRU[K, V]) Get(key K) (V, bool) {
+	return s.shard(key).Get(key)
+}
+
+// Peek returns a value for the given key (if it exists) without
+// making it the most recently used item or updating the counters
+func (s *ShardedLRU[K, V]) Peek(key K) (V, bool) {
+	return s.shard(key).Peek(key)
+}
+
+// Del removes and value for the given key (if it exists)
+func (s *ShardedLRU[K, V]) Del(key K) (V, bool) {
+	return s.shard(key).Del(key)
+}
+
+// Len returns the current length of the cache. Expired items
+// are counted until they have been removed.
+func (s *ShardedLRU[K, V]) Len() int {
+	var n int
+	for _, l := range s.shards {
+		n += l.Len()
+	}
+	return n
+}
+
+// Cost returns the total cost of the items in the cache
+func (s *ShardedLRU[K, V]) Cost() int64 {
+	var n int64
+	for _, l := range s.shards {
+		n += l.Cost()
+	}
+	return n
+}
+
+// RemoveExpired removes all the expired items and
+// returns the number of items that were removed
+func (s *ShardedLRU[K, V]) RemoveExpired() int {
+	var n int
+	for _, l := range s.shards {
+		n += l.RemoveExpired()
+	}
+	return n
+}
+
+// Range iterates over all keys and values, one shard at a time. Within
+// a shard the items are in the order of most to least recently used.
+func (s *ShardedLRU[K, V]) Range(iter func(key K, value V) bool) {
+	ok := true
+	for _, l := range s.shards {
+		l.Range(func(key K, value V) bool {
+			ok = iter(key, value)
+			return ok
+		})
+		if !ok {
+			return
+		}
+	}
+}
+
+// Stats returns the counters of all the shards added together
+func (s *ShardedLRU[K, V]) Stats() Stats {
+	var st Stats
+	for _, l := range s.shards {
+		ls := l.Stats()
+		st.Hits += ls.Hits
+		st.Misses += ls.Misses
+		st.Evictions += ls.Evictions
+		st.Expirations += ls.Expirations
+		st.Items += ls.Items
+		st.Cost += ls.Cost
+	}
+	return st
+}
+
+// expireLoop removes the expired items at every interval
+func (s *ShardedLRU[K, V]) expireLoop(interval time.Duration) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.RemoveExpired()
+		}
+	}
+}
+
+// Close stops removing the expired items in the background. The
+// cache can still be used after it has been closed.
+func (s *ShardedLRU[K, V]) Close() {
+	s.closeOnce.Do(func() {
+		if s.done != nil {
+			close(s.done)
+			s.wg.Wait()
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestShardedLRU(t *testing.T) {
+	s := NewShardedLRU(&Config[string, []byte]{
+		MaxCost: 64 << 10,
+		Cost: func(key string, value []byte) int64 {
+			return int64(len(key) + len(value))
+		},
+		Shards: 8,
+	})
+	defer s.Close()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("key-%d-%d", g, i)
+				s.Set(key, make([]byte, 10+(i%64)*100))
+				s.Get(key)
+				s.Peek(fmt.Sprintf("key-%d-%d", g, i/2))
+			}
+		}(g)
+	}
+	wg.Wait()
+	if cost := s.Cost(); cost > 64<<10 {
+		t.Errorf("Cost() got = %d, want <= %d", cost, 64<<10)
+	}
+	// items can be evicted by other goroutines between a Set and a Get,
+	// so only the counters that do not depend on the timing are checked
+	st := s.Stats()
+	if st.Hits+st.Misses != 8000 || st.Evictions == 0 || st.Items != s.Len() {
+		t.Errorf("Stats() got = %+v", st)
+	}
+	var n int
+	s.Range(func(key string, value []byte) bool {
+		n++
+		return true
+	})
+	if n != s.Len() {
+		t.Errorf("Range() got %d items, want %d", n, s.Len())
+	}
+}
+
+func BenchmarkShardedLRU_Get(b *testing.B) {
+	s := NewShardedLRU(&Config[int, int]{MaxItems: 1 << 16, Shards: 16})
+	for i := 0; i < 1<<16; i++ {
+		s.Set(i, i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			s.Get(i & (1<<16 - 1))
+			i++
+		}
+	})
+}
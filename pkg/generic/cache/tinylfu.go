@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"encoding/binary"
+	"github.com/scottcagno/storage/pkg/countmin"
+	"github.com/scottcagno/storage/pkg/hashmap/openaddr"
+	"sync"
+)
+
+// lists of the W-TinyLFU cache
+const (
+	tinyLFUWindow    = iota // new items
+	tinyLFUProbation        // items admitted to the main cache
+	tinyLFUProtected        // items used again while in the main cache
+)
+
+const (
+	tinyLFUWindowRatio    = 0.01 // share of the size that goes to the window
+	tinyLFUProtectedRatio = 0.80 // share of the main cache that is protected
+	tinyLFUSketchDepth    = 4    // rows of the frequency sketch
+	tinyLFUSketchWidth    = 4    // counters per row, for every item
+	tinyLFUSampleSize     = 10   // additions per item before the counts are halved
+)
+
+// TinyLFU is a W-TinyLFU cache (Einziger, Friedman and Manes). New items
+// go into a small LRU window. An item pushed out of the window is only
+// admitted into the main cache, which is a segmented LRU, if it has been
+// used more often than the item it would evict from there. How often the
+// keys are used is estimated by a count-min sketch that is halved every
+// so often, so it follows the recent frequencies.
+type TinyLFU[K comparable, V any] struct {
+	windowSize    int // max num of items in the window
+	mainSize      int // max num of items in the main cache
+	protectedSize int // max num of items in the protected segment
+	items         map[K]*item[K, V]
+	window        list[K, V]
+	probation     list[K, V]
+	protected     list[K, V]
+	sketch        *countmin.CountMinSketch
+	hash          openaddr.Hasher[K]
+	stats         Stats
+	mu            sync.Mutex
+}
+
+// NewTinyLFU returns a new W-TinyLFU cache holding at most size items
+func NewTinyLFU[K comparable, V any](size int) *TinyLFU[K, V] {
+	if size < 1 {
+		size = DefaultSize
+	}
+	c := &TinyLFU[K, V]{
+		windowSize: int(float64(size) * tinyLFUWindowRatio),
+		items:      make(map[K]*item[K, V], size),
+		hash:       openaddr.DefaultHasher[K](),
+	}
+	if c.windowSize < 1 {
+		c.windowSize = 1
+	}
+	c.mainSize = size - c.windowSize
+	c.protectedSize = int(float64(c.mainSize) * tinyLFUProtectedRatio)
+	// the width and depth are always valid
+	c.sketch, _ = countmin.NewCountMinSketch(uint(size*tinyLFUSketchWidth), tinyLFUSketchDepth)
+	c.sketch.SetDecay(uint64(size * tinyLFUSampleSize))
+	c.window.init()
+	c.probation.init()
+	c.protected.init()
+	return c
+}
+
+// listOf returns the list holding the item
+func (c *TinyLFU[K, V]) listOf(i *item[K, V]) *list[K, V] {
+	switch i.where {
+	case tinyLFUWindow:
+		return &c.window
+	case tinyLFUProbation:
+		return &c.probation
+	}
+	return &c.protected
+}
+
+// sketchKey returns the key as it is added to the frequency sketch
+func (c *TinyLFU[K, V]) sketchKey(key K) [8]byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], c.hash(key))
+	return b
+}
+
+// touch counts a use of the key
+func (c *TinyLFU[K, V]) touch(key K) {
+	b := c.sketchKey(key)
+	c.sketch.Add(b[:], 1)
+}
+
+// frequency returns the estimated number of uses of the key
+func (c *TinyLFU[K, V]) frequency(key K) uint32 {
+	b := c.sketchKey(key)
+	return c.sketch.Count(b[:])
+}
+
+// promote moves an item that was used again to the front of its segment
+func (c *TinyLFU[K, V]) promote(i *item[K, V]) {
+	switch i.where {
+	case tinyLFUWindow:
+		c.window.moveToFront(i)
+	case tinyLFUProtected:
+		c.protected.moveToFront(i)
+	case tinyLFUProbation:
+		c.probation.remove(i)
+		i.where = tinyLFUProtected
+		c.protected.pushFront(i)
+		// demote the least recently used protected item
+		if c.protected.len > c.protectedSize {
+			d := c.protected.back()
+			c.protected.remove(d)
+			d.where = tinyLFUProbation
+			c.probation.pushFront(d)
+		}
+	}
+}
+
+// Get returns a value for the given key (if it exists)
+func (c *TinyLFU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.touch(key)
+	i := c.items[key]
+	if i == nil {
+		c.stats.Misses++
+		return *new(V), false
+	}
+	c.stats.Hits++
+	c.promote(i)
+	return i.value, true
+}
+
+// Peek returns a value for the given key (if it exists) without
+// counting it as a use of the item or updating the counters
+func (c *TinyLFU[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.items[key]
+	if i == nil {
+		return *new(V), false
+	}
+	return i.value, true
+}
+
+// Set inserts or replaces a value for the given key
+func (c *TinyLFU[K, V]) Set(key K, value V) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.items[key]
+	if i != nil {
+		prev := i.value
+		i.value = value
+		c.promote(i)
+		return prev, true
+	}
+	c.touch(key)
+	i = &item[K, V]{key: key, value: value, where: tinyLFUWindow}
+	c.window.pushFront(i)
+	c.items[key] = i
+	if c.window.len > c.windowSize {
+		c.admit(c.window.back())
+	}
+	return *new(V), false
+}
+
+// admit moves the candidate pushed out of the window into the main cache,
+// if there is room for it or it is used more often than the item it would
+// evict. Otherwise the candidate is evicted.
+func (c *TinyLFU[K, V]) admit(candidate *item[K, V]) {
+	c.window.remove(candidate)
+	if c.probation.len+c.protected.len >= c.mainSize {
+		victim := c.probation.back()
+		if victim == nil {
+			victim = c.protected.back()
+		}
+		c.stats.Evictions++
+		if victim == nil || c.frequency(candidate.key) <= c.frequency(victim.key) {
+			delete(c.items, candidate.key)
+			return
+		}
+		c.listOf(victim).remove(victim)
+		delete(c.items, victim.key)
+	}
+	candidate.where = tinyLFUProbation
+	c.probation.pushFront(candidate)
+}
+
+// Del removes a value for the given key (if it exists)
+func (c *TinyLFU[K, V]) Del(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.items[key]
+	if i == nil {
+		return *new(V), false
+	}
+	c.listOf(i).remove(i)
+	delete(c.items, key)
+	return i.value, true
+}
+
+// Len returns the current length of the cache
+func (c *TinyLFU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// Stats returns the counters of the cache
+func (c *TinyLFU[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.stats
+	st.Items = len(c.items)
+	st.Cost = int64(st.Items)
+	return st
+}
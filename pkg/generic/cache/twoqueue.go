@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"sync"
+)
+
+// lists of the 2Q cache
+const (
+	twoQueueIn   = iota // A1in, items seen once
+	twoQueueOut         // A1out, keys recently evicted from A1in
+	twoQueueMain        // Am, items seen more than once
+)
+
+const (
+	twoQueueInRatio  = 0.25 // share of the size that goes to A1in
+	twoQueueOutRatio = 0.50 // share of the size kept as keys in A1out
+)
+
+// TwoQueue is a 2Q cache (Johnson and Shasha). New items go into a FIFO
+// queue (A1in) and are only promoted to the main LRU list (Am) when they
+// are set again after being evicted from it, while their keys are still
+// remembered in a ghost queue (A1out). Items that are only used once, as
+// in a scan, therefore never push the frequently used items out of Am.
+type TwoQueue[K comparable, V any] struct {
+	size    int // max num of items
+	inSize  int // max num of items in A1in
+	outSize int // max num of keys in A1out
+	items   map[K]*item[K, V]
+	in      list[K, V]
+	out     list[K, V]
+	main    list[K, V]
+	stats   Stats
+	mu      sync.Mutex
+}
+
+// NewTwoQueue returns a new 2Q cache holding at most size items
+func NewTwoQueue[K comparable, V any](size int) *TwoQueue[K, V] {
+	if size < 1 {
+		size = DefaultSize
+	}
+	c := &TwoQueue[K, V]{
+		size:    size,
+		inSize:  int(float64(size) * twoQueueInRatio),
+		outSize: int(float64(size) * twoQueueOutRatio),
+		items:   make(map[K]*item[K, V], size),
+	}
+	if c.inSize < 1 {
+		c.inSize = 1
+	}
+	if c.outSize < 1 {
+		c.outSize = 1
+	}
+	c.in.init()
+	c.out.init()
+	c.main.init()
+	return c
+}
+
+// listOf returns the list holding the item
+func (c *TwoQueue[K, V]) listOf(i *item[K, V]) *list[K, V] {
+	switch i.where {
+	case twoQueueIn:
+		return &c.in
+	case twoQueueOut:
+		return &c.out
+	}
+	return &c.main
+}
+
+// Get returns a value for the given key (if it exists)
+func (c *TwoQueue[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.items[key]
+	if i == nil || i.where == twoQueueOut {
+		c.stats.Misses++
+		return *new(V), false
+	}
+	c.stats.Hits++
+	if i.where == twoQueueMain {
+		c.main.moveToFront(i)
+	}
+	return i.value, true
+}
+
+// Peek returns a value for the given key (if it exists) without
+// counting it as a use of the item or updating the counters
+func (c *TwoQueue[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.items[key]
+	if i == nil || i.where == twoQueueOut {
+		return *new(V), false
+	}
+	return i.value, true
+}
+
+// Set inserts or replaces a value for the given key
+func (c *TwoQueue[K, V]) Set(key K, value V) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.items[key]
+	if i != nil {
+		switch i.where {
+		case twoQueueMain:
+			prev := i.value
+			i.value = value
+			c.main.moveToFront(i)
+			return prev, true
+		case twoQueueIn:
+			prev := i.value
+			i.value = value
+			return prev, true
+		}
+		// the key was evicted from A1in not long ago,
+		// so it is used often enough to go into Am
+		c.out.remove(i)
+		i.value, i.where = value, twoQueueMain
+		c.reclaim()
+		c.main.pushFront(i)
+		return *new(V), false
+	}
+	c.reclaim()
+	i = &item[K, V]{key: key, value: value, where: twoQueueIn}
+	c.in.pushFront(i)
+	c.items[key] = i
+	return *new(V), false
+}
+
+// reclaim makes room for one more item if the cache is full
+func (c *TwoQueue[K, V]) reclaim() {
+	if c.in.len+c.main.len < c.size {
+		return
+	}
+	c.stats.Evictions++
+	if c.in.len > c.inSize || c.main.len == 0 {
+		// keep the key of the evicted item in A1out
+		i := c.in.back()
+		c.in.remove(i)
+		i.value, i.where = *new(V), twoQueueOut
+		c.out.pushFront(i)
+		if c.out.len > c.outSize {
+			o := c.out.back()
+			c.out.remove(o)
+			delete(c.items, o.key)
+		}
+		return
+	}
+	i := c.main.back()
+	c.main.remove(i)
+	delete(c.items, i.key)
+}
+
+// Del removes a value for the given key (if it exists)
+func (c *TwoQueue[K, V]) Del(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.items[key]
+	if i == nil {
+		return *new(V), false
+	}
+	c.listOf(i).remove(i)
+	delete(c.items, key)
+	if i.where == twoQueueOut {
+		return *new(V), false
+	}
+	return i.value, true
+}
+
+// Len returns the current length of the cache
+func (c *TwoQueue[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.in.len + c.main.len
+}
+
+// Stats returns the counters of the cache
+func (c *TwoQueue[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.stats
+	st.Items = c.in.len + c.main.len
+	st.Cost = int64(st.Items)
+	return st
+}
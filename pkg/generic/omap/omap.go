@@ -1,6 +1,346 @@
 package omap
 
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+var (
+	ErrBadKeyType = errors.New("omap: key type can not be used as a json object key")
+	ErrBadJSON    = errors.New("omap: json value is not an object")
+)
+
+// entry is an entry in the map (doubly linked, in insertion order)
+type entry[K comparable, V any] struct {
+	key        K
+	value      V
+	prev, next *entry[K, V]
+}
+
+// OrderedMap is a map that remembers the order in which its keys were
+// inserted. Set, Get and Del are all O(1); the order is kept in a doubly
+// linked list of the entries. Setting a key that is already in the map
+// does not change its position. The zero value is an empty map ready to
+// use. An OrderedMap must not be copied after first use, and it is not
+// safe for concurrent use.
 type OrderedMap[K comparable, V any] struct {
-	data map[K]V
-	keys []K
+	data map[K]*entry[K, V]
+	root entry[K, V] // sentinel; root.next is the first entry, root.prev the last
+}
+
+// New returns a new, empty ordered map
+func New[K comparable, V any]() *OrderedMap[K, V] {
+	m := new(OrderedMap[K, V])
+	m.init()
+	return m
+}
+
+func (m *OrderedMap[K, V]) init() {
+	m.data = make(map[K]*entry[K, V])
+	m.root.next = &m.root
+	m.root.prev = &m.root
+}
+
+// unlink removes an entry from the list
+func (m *OrderedMap[K, V]) unlink(e *entry[K, V]) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+}
+
+// insertAfter inserts an entry after at in the list
+func (m *OrderedMap[K, V]) insertAfter(e, at *entry[K, V]) {
+	e.prev = at
+	e.next = at.next
+	at.next.prev = e
+	at.next = e
+}
+
+// Len returns the number of entries in the map
+func (m *OrderedMap[K, V]) Len() int {
+	return len(m.data)
+}
+
+// Set inserts or replaces the value for the given key. A new key is
+// added at the back. It returns the previous value, if there was one.
+func (m *OrderedMap[K, V]) Set(key K, value V) (V, bool) {
+	if m.data == nil {
+		m.init()
+	}
+	if e, ok := m.data[key]; ok {
+		prev := e.value
+		e.value = value
+		return prev, true
+	}
+	e := &entry[K, V]{key: key, value: value}
+	m.insertAfter(e, m.root.prev)
+	m.data[key] = e
+	return *new(V), false
+}
+
+// Get returns the value for the given key (if it exists)
+func (m *OrderedMap[K, V]) Get(key K) (V, bool) {
+	if e, ok := m.data[key]; ok {
+		return e.value, true
+	}
+	return *new(V), false
+}
+
+// Has reports whether the given key is in the map
+func (m *OrderedMap[K, V]) Has(key K) bool {
+	_, ok := m.data[key]
+	return ok
+}
+
+// Del removes the given key and returns its value (if it existed)
+func (m *OrderedMap[K, V]) Del(key K) (V, bool) {
+	e, ok := m.data[key]
+	if !ok {
+		return *new(V), false
+	}
+	m.unlink(e)
+	delete(m.data, key)
+	return e.value, true
+}
+
+// Front returns the first key and value in the map (if there are any)
+func (m *OrderedMap[K, V]) Front() (K, V, bool) {
+	if len(m.data) == 0 {
+		return *new(K), *new(V), false
+	}
+	return m.root.next.key, m.root.next.value, true
+}
+
+// Back returns the last key and value in the map (if there are any)
+func (m *OrderedMap[K, V]) Back() (K, V, bool) {
+	if len(m.data) == 0 {
+		return *new(K), *new(V), false
+	}
+	return m.root.prev.key, m.root.prev.value, true
+}
+
+// MoveToFront moves the given key to the front of the map. It
+// returns false if the key is not in the map.
+func (m *OrderedMap[K, V]) MoveToFront(key K) bool {
+	e, ok := m.data[key]
+	if !ok {
+		return false
+	}
+	if m.root.next != e {
+		m.unlink(e)
+		m.insertAfter(e, &m.root)
+	}
+	return true
+}
+
+// MoveToBack moves the given key to the back of the map. It
+// returns false if the key is not in the map.
+func (m *OrderedMap[K, V]) MoveToBack(key K) bool {
+	e, ok := m.data[key]
+	if !ok {
+		return false
+	}
+	if m.root.prev != e {
+		m.unlink(e)
+		m.insertAfter(e, m.root.prev)
+	}
+	return true
+}
+
+// Range iterates over all the keys and values in order, from front to
+// back, until iter returns false. The map must not be modified by iter,
+// except for deleting the current key.
+func (m *OrderedMap[K, V]) Range(iter func(key K, value V) bool) {
+	if m.data == nil {
+		return
+	}
+	for e := m.root.next; e != &m.root; {
+		next := e.next
+		if !iter(e.key, e.value) {
+			return
+		}
+		e = next
+	}
+}
+
+// Reverse iterates over all the keys and values in reverse order, from
+// back to front, until iter returns false. The map must not be modified
+// by iter, except for deleting the current key.
+func (m *OrderedMap[K, V]) Reverse(iter func(key K, value V) bool) {
+	if m.data == nil {
+		return
+	}
+	for e := m.root.prev; e != &m.root; {
+		prev := e.prev
+		if !iter(e.key, e.value) {
+			return
+		}
+		e = prev
+	}
+}
+
+// Keys returns all the keys in order
+func (m *OrderedMap[K, V]) Keys() []K {
+	keys := make([]K, 0, len(m.data))
+	m.Range(func(key K, _ V) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Values returns all the values in order
+func (m *OrderedMap[K, V]) Values() []V {
+	vals := make([]V, 0, len(m.data))
+	m.Range(func(_ K, value V) bool {
+		vals = append(vals, value)
+		return true
+	})
+	return vals
+}
+
+// MarshalJSON encodes the map as a json object with its members in order.
+// Keys are encoded the way encoding/json encodes map keys: the key type
+// must be a string, an integer, or implement encoding.TextMarshaler.
+func (m *OrderedMap[K, V]) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	var err error
+	m.Range(func(key K, value V) bool {
+		var ks string
+		ks, err = encodeKey(key)
+		if err != nil {
+			return false
+		}
+		var kb, vb []byte
+		kb, err = json.Marshal(ks)
+		if err != nil {
+			return false
+		}
+		vb, err = json.Marshal(value)
+		if err != nil {
+			return false
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.Write(kb)
+		buf.WriteByte(':')
+		buf.Write(vb)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a json object into the map, adding its members in
+// the order they appear. Members are added to whatever is already in the
+// map, and a key that is already in the map keeps its position.
+func (m *OrderedMap[K, V]) UnmarshalJSON(data []byte) error {
+	if m.data == nil {
+		m.init()
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		// null leaves the map as it is
+		return nil
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return ErrBadJSON
+	}
+	for dec.More() {
+		tok, err = dec.Token()
+		if err != nil {
+			return err
+		}
+		ks, ok := tok.(string)
+		if !ok {
+			return ErrBadJSON
+		}
+		key, err := decodeKey[K](ks)
+		if err != nil {
+			return err
+		}
+		var value V
+		err = dec.Decode(&value)
+		if err != nil {
+			return err
+		}
+		m.Set(key, value)
+	}
+	// the closing brace
+	_, err = dec.Token()
+	return err
+}
+
+// encodeKey returns the key as the string used for it in a json object.
+// Like encoding/json, string keys are used as they are, even if they
+// implement encoding.TextMarshaler.
+func encodeKey[K comparable](key K) (string, error) {
+	v := reflect.ValueOf(key)
+	if v.Kind() == reflect.String {
+		return v.String(), nil
+	}
+	if tm, ok := any(key).(encoding.TextMarshaler); ok {
+		b, err := tm.MarshalText()
+		return string(b), err
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("%w: %T", ErrBadKeyType, key)
+}
+
+// decodeKey returns the key for the string used for it in a json object.
+// It checks the same way as encodeKey, so string keys are set directly.
+func decodeKey[K comparable](s string) (K, error) {
+	var key K
+	v := reflect.ValueOf(&key).Elem()
+	if v.Kind() == reflect.String {
+		v.SetString(s)
+		return key, nil
+	}
+	if tu, ok := any(&key).(encoding.TextUnmarshaler); ok {
+		err := tu.UnmarshalText([]byte(s))
+		return key, err
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return key, err
+		}
+		v.SetInt(n)
+		return key, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return key, err
+		}
+		v.SetUint(n)
+		return key, nil
+	}
+	return key, fmt.Errorf("%w: %T", ErrBadKeyType, key)
+}
+
+func (m *OrderedMap[K, V]) String() string {
+	b, err := m.MarshalJSON()
+	if err != nil {
+		return fmt.Sprintf("%T{len=%d}", m, m.Len())
+	}
+	return string(b)
 }
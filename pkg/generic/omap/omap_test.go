@@ -0,0 +1,184 @@
+package omap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	thousand = 1000
+)
+
+func TestOrderedMap_SetGetDel(t *testing.T) {
+	var m OrderedMap[string, int]
+	for i := 0; i < thousand; i++ {
+		if _, ok := m.Set(fmt.Sprintf("key-%04d", i), i); ok {
+			t.Fatalf("Set() replaced a value of a new key")
+		}
+	}
+	if prev, ok := m.Set("key-0500", -1); !ok || prev != 500 {
+		t.Errorf("Set() got = %d, %v, want 500, true", prev, ok)
+	}
+	for i := 0; i < thousand; i += 2 {
+		if v, ok := m.Del(fmt.Sprintf("key-%04d", i)); !ok || (v != i && i != 500) {
+			t.Errorf("Del() got = %d, %v, want %d, true", v, ok, i)
+		}
+	}
+	if m.Len() != thousand/2 {
+		t.Errorf("Len() got = %d, want %d", m.Len(), thousand/2)
+	}
+	if _, ok := m.Get("key-0002"); ok {
+		t.Errorf("Get() found a deleted key")
+	}
+	if v, ok := m.Get("key-0003"); !ok || v != 3 {
+		t.Errorf("Get() got = %d, %v, want 3, true", v, ok)
+	}
+	keys := m.Keys()
+	for i, k := range keys {
+		if want := fmt.Sprintf("key-%04d", 2*i+1); k != want {
+			t.Fatalf("Keys()[%d] got = %s, want %s", i, k, want)
+		}
+	}
+}
+
+func TestOrderedMap_Order(t *testing.T) {
+	m := New[int, string]()
+	for i := 1; i <= 5; i++ {
+		m.Set(i, fmt.Sprint(i))
+	}
+	// setting an existing key keeps its position
+	m.Set(3, "three")
+	if !m.MoveToFront(4) || !m.MoveToBack(1) || m.MoveToFront(42) {
+		t.Fatalf("MoveToFront/MoveToBack got unexpected results")
+	}
+	if got, want := m.Keys(), []int{4, 2, 3, 5, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() got = %v, want %v", got, want)
+	}
+	if got, want := m.Values(), []string{"4", "2", "three", "5", "1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Values() got = %v, want %v", got, want)
+	}
+	var rev []int
+	m.Reverse(func(key int, value string) bool {
+		rev = append(rev, key)
+		return true
+	})
+	if want := []int{1, 5, 3, 2, 4}; !reflect.DeepEqual(rev, want) {
+		t.Errorf("Reverse() got = %v, want %v", rev, want)
+	}
+	// deleting the current key while ranging is allowed
+	var fwd []int
+	m.Range(func(key int, value string) bool {
+		fwd = append(fwd, key)
+		m.Del(key)
+		return key != 3
+	})
+	if want := []int{4, 2, 3}; !reflect.DeepEqual(fwd, want) {
+		t.Errorf("Range() got = %v, want %v", fwd, want)
+	}
+	if k, v, ok := m.Front(); !ok || k != 5 || v != "5" {
+		t.Errorf("Front() got = %d, %s, %v", k, v, ok)
+	}
+	if k, v, ok := m.Back(); !ok || k != 1 || v != "1" {
+		t.Errorf("Back() got = %d, %s, %v", k, v, ok)
+	}
+}
+
+type point struct {
+	X, Y int
+}
+
+// upper is a string key with a text form that is not used for it
+// in a json object, because the key is a string
+type upper string
+
+func (u upper) MarshalText() ([]byte, error) {
+	return []byte(strings.ToUpper(string(u))), nil
+}
+
+func (u *upper) UnmarshalText(b []byte) error {
+	*u = upper(strings.ToLower(string(b)))
+	return nil
+}
+
+func TestOrderedMap_JSON(t *testing.T) {
+	m := New[string, point]()
+	m.Set("zulu", point{1, 2})
+	m.Set("alpha", point{3, 4})
+	m.Set("mike", point{5, 6})
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"zulu":{"X":1,"Y":2},"alpha":{"X":3,"Y":4},"mike":{"X":5,"Y":6}}`
+	if string(b) != want {
+		t.Errorf("Marshal() got = %s, want %s", b, want)
+	}
+	var got OrderedMap[string, point]
+	err = json.Unmarshal(b, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Keys(), m.Keys()) || !reflect.DeepEqual(got.Values(), m.Values()) {
+		t.Errorf("Unmarshal() got = %s, want %s", &got, m)
+	}
+	// integer keys, nested in a struct
+	type doc struct {
+		Counts *OrderedMap[int64, int] `json:"counts"`
+	}
+	d := doc{Counts: New[int64, int]()}
+	err = json.Unmarshal([]byte(`{"counts":{"30":3,"-10":1,"20":2}}`), &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.Counts.Keys(); !reflect.DeepEqual(got, []int64{30, -10, 20}) {
+		t.Errorf("Unmarshal() got keys %v", got)
+	}
+	b, _ = json.Marshal(d)
+	if string(b) != `{"counts":{"30":3,"-10":1,"20":2}}` {
+		t.Errorf("Marshal() got = %s", b)
+	}
+	if err = json.Unmarshal([]byte(`[1,2]`), d.Counts); err != ErrBadJSON {
+		t.Errorf("Unmarshal() got error %v, want %v", err, ErrBadJSON)
+	}
+	_, err = json.Marshal(New[point, int]())
+	if err != nil {
+		t.Errorf("Marshal() of an empty map got error %v", err)
+	}
+	// string keys are used as they are, like encoding/json does
+	um := New[upper, int]()
+	um.Set("MiXed", 1)
+	b, _ = json.Marshal(um)
+	if string(b) != `{"MiXed":1}` {
+		t.Errorf("Marshal() got = %s", b)
+	}
+	um = New[upper, int]()
+	err = json.Unmarshal(b, um)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := um.Keys(); !reflect.DeepEqual(got, []upper{"MiXed"}) {
+		t.Errorf("Unmarshal() got keys %v", got)
+	}
+	bad := New[point, int]()
+	bad.Set(point{}, 1)
+	if _, err = json.Marshal(bad); !errors.Is(err, ErrBadKeyType) {
+		t.Errorf("Marshal() got error %v, want %v", err, ErrBadKeyType)
+	}
+}
+
+func BenchmarkOrderedMap_SetDel(b *testing.B) {
+	m := New[int, int]()
+	for i := 0; i < thousand; i++ {
+		m.Set(i, i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Del(i % thousand)
+		m.Set(i%thousand, i)
+	}
+}
@@ -0,0 +1,72 @@
+package rbtree
+
+// Cursor is used to move back and forth over the entries of a tree,
+// in order. A cursor stays valid while entries are added to (or
+// removed from) the tree, as long as the entry the cursor is
+// positioned on is not itself removed.
+type Cursor[K any, V any] struct {
+	tree *RBTree[K, V]
+	node *rbNode[K, V]
+}
+
+// Cursor returns a new cursor for the tree. The cursor is not
+// positioned until First, Last or Seek is called
+func (t *RBTree[K, V]) Cursor() *Cursor[K, V] {
+	return &Cursor[K, V]{
+		tree: t,
+		node: t.NIL,
+	}
+}
+
+// First moves the cursor to the first (smallest) key
+func (c *Cursor[K, V]) First() bool {
+	c.node = c.tree.min(c.tree.root)
+	return c.Valid()
+}
+
+// Last moves the cursor to the last (largest) key
+func (c *Cursor[K, V]) Last() bool {
+	c.node = c.tree.max(c.tree.root)
+	return c.Valid()
+}
+
+// Seek moves the cursor to the first key that is greater
+// than or equal to the provided key
+func (c *Cursor[K, V]) Seek(key K) bool {
+	c.node = c.tree.ceil(key)
+	return c.Valid()
+}
+
+// SeekLE moves the cursor to the last key that is less
+// than or equal to the provided key
+func (c *Cursor[K, V]) SeekLE(key K) bool {
+	c.node = c.tree.floor(key)
+	return c.Valid()
+}
+
+// Next moves the cursor to the next key
+func (c *Cursor[K, V]) Next() bool {
+	c.node = c.tree.successor(c.node)
+	return c.Valid()
+}
+
+// Prev moves the cursor to the previous key
+func (c *Cursor[K, V]) Prev() bool {
+	c.node = c.tree.predecessor(c.node)
+	return c.Valid()
+}
+
+// Valid reports true if the cursor is positioned at a key
+func (c *Cursor[K, V]) Valid() bool {
+	return c.node != nil && c.node != c.tree.NIL
+}
+
+// Key returns the key at the current position of the cursor
+func (c *Cursor[K, V]) Key() K {
+	return c.node.key
+}
+
+// Value returns the value at the current position of the cursor
+func (c *Cursor[K, V]) Value() V {
+	return c.node.value
+}
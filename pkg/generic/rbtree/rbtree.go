@@ -0,0 +1,576 @@
+package rbtree
+
+// Ordered is a constraint that permits any ordered type
+type Ordered interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64 | ~string
+}
+
+// Compare is a comparator for any ordered type. It returns -1 if
+// a is less than b, 1 if a is greater than b, and 0 otherwise
+func Compare[K Ordered](a, b K) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+const (
+	RED   = 0
+	BLACK = 1
+)
+
+type rbNode[K any, V any] struct {
+	left   *rbNode[K, V]
+	right  *rbNode[K, V]
+	parent *rbNode[K, V]
+	color  uint
+	count  int // count is the number of nodes in the subtree
+	key    K
+	value  V
+}
+
+// RBTree is a generic red-black tree. The keys are ordered using the
+// comparator function supplied when the tree is created. An RBTree
+// is not safe for concurrent use; callers must synchronize access.
+type RBTree[K any, V any] struct {
+	compare func(a, b K) int
+	NIL     *rbNode[K, V]
+	root    *rbNode[K, V]
+	count   int
+}
+
+// NewRBTree creates and returns a new RBTree that orders the keys
+// using the provided comparator. The comparator must return a
+// negative number if a < b, a positive number if a > b and
+// zero if a == b
+func NewRBTree[K any, V any](compare func(a, b K) int) *RBTree[K, V] {
+	n := &rbNode[K, V]{
+		color: BLACK,
+	}
+	return &RBTree[K, V]{
+		compare: compare,
+		NIL:     n,
+		root:    n,
+	}
+}
+
+// NewOrderedRBTree creates and returns a new RBTree for any ordered key type
+func NewOrderedRBTree[K Ordered, V any]() *RBTree[K, V] {
+	return NewRBTree[K, V](Compare[K])
+}
+
+// Has tests and returns a boolean value if the
+// provided key exists in the tree
+func (t *RBTree[K, V]) Has(key K) bool {
+	return t.search(key) != t.NIL
+}
+
+// Get returns the value stored for the provided key, along with
+// a boolean reporting true if the key was found
+func (t *RBTree[K, V]) Get(key K) (V, bool) {
+	x := t.search(key)
+	if x == t.NIL {
+		return *new(V), false
+	}
+	return x.value, true
+}
+
+// Put inserts or updates the value for the provided key. If an
+// existing value was updated, it is returned along with true
+func (t *RBTree[K, V]) Put(key K, value V) (V, bool) {
+	return t.insert(key, value)
+}
+
+// Del removes the provided key. If the key was found the
+// value is returned along with true
+func (t *RBTree[K, V]) Del(key K) (V, bool) {
+	z := t.search(key)
+	if z == t.NIL {
+		return *new(V), false
+	}
+	t.delete(z)
+	return z.value, true
+}
+
+// Len returns the number of entries in the tree
+func (t *RBTree[K, V]) Len() int {
+	return t.count
+}
+
+// Min returns the smallest key (and its value), along with
+// a boolean reporting false if the tree is empty
+func (t *RBTree[K, V]) Min() (K, V, bool) {
+	x := t.min(t.root)
+	if x == t.NIL {
+		return *new(K), *new(V), false
+	}
+	return x.key, x.value, true
+}
+
+// Max returns the largest key (and its value), along with
+// a boolean reporting false if the tree is empty
+func (t *RBTree[K, V]) Max() (K, V, bool) {
+	x := t.max(t.root)
+	if x == t.NIL {
+		return *new(K), *new(V), false
+	}
+	return x.key, x.value, true
+}
+
+// Rank returns the number of keys in the tree that are less than
+// the provided key. If the key exists, this is its (zero based)
+// index in sorted order
+func (t *RBTree[K, V]) Rank(key K) int {
+	var r int
+	x := t.root
+	for x != t.NIL {
+		if t.compare(x.key, key) < 0 {
+			// everything in the left subtree, along
+			// with x itself, comes before the key
+			r += x.left.count + 1
+			x = x.right
+		} else {
+			x = x.left
+		}
+	}
+	return r
+}
+
+// Select returns the key (and its value) at the provided (zero based)
+// index in sorted order, along with a boolean reporting false if the
+// index is out of range
+func (t *RBTree[K, V]) Select(i int) (K, V, bool) {
+	if i < 0 || i >= t.count {
+		return *new(K), *new(V), false
+	}
+	x := t.root
+	for x != t.NIL {
+		l := x.left.count
+		if i < l {
+			x = x.left
+		} else if i > l {
+			i -= l + 1
+			x = x.right
+		} else {
+			return x.key, x.value, true
+		}
+	}
+	return *new(K), *new(V), false
+}
+
+// Iterator is called for every entry when iterating the
+// tree. Returning false stops the iteration
+type Iterator[K any, V any] func(key K, value V) bool
+
+// Ascend iterates all the entries in ascending order
+func (t *RBTree[K, V]) Ascend(iter Iterator[K, V]) {
+	for x := t.min(t.root); x != t.NIL; x = t.successor(x) {
+		if !iter(x.key, x.value) {
+			return
+		}
+	}
+}
+
+// Descend iterates all the entries in descending order
+func (t *RBTree[K, V]) Descend(iter Iterator[K, V]) {
+	for x := t.max(t.root); x != t.NIL; x = t.predecessor(x) {
+		if !iter(x.key, x.value) {
+			return
+		}
+	}
+}
+
+// AscendRange iterates the entries in ascending order starting
+// with the start key (inclusive) and ending before the end key
+func (t *RBTree[K, V]) AscendRange(start, end K, iter Iterator[K, V]) {
+	for x := t.ceil(start); x != t.NIL; x = t.successor(x) {
+		if t.compare(x.key, end) >= 0 {
+			return
+		}
+		if !iter(x.key, x.value) {
+			return
+		}
+	}
+}
+
+// DescendRange iterates the entries in descending order starting
+// with the start key (inclusive) and ending before (above) the end
+// key, so the start key should be greater than the end key
+func (t *RBTree[K, V]) DescendRange(start, end K, iter Iterator[K, V]) {
+	for x := t.floor(start); x != t.NIL; x = t.predecessor(x) {
+		if t.compare(x.key, end) <= 0 {
+			return
+		}
+		if !iter(x.key, x.value) {
+			return
+		}
+	}
+}
+
+// Reset removes all the entries
+func (t *RBTree[K, V]) Reset() {
+	t.root = t.NIL
+	t.count = 0
+}
+
+func (t *RBTree[K, V]) newNode(key K, value V) *rbNode[K, V] {
+	return &rbNode[K, V]{
+		left:   t.NIL,
+		right:  t.NIL,
+		parent: t.NIL,
+		color:  RED,
+		count:  1,
+		key:    key,
+		value:  value,
+	}
+}
+
+func (t *RBTree[K, V]) insert(key K, value V) (V, bool) {
+	x := t.root
+	y := t.NIL
+	for x != t.NIL {
+		y = x
+		cmp := t.compare(key, x.key)
+		if cmp < 0 {
+			x = x.left
+		} else if cmp > 0 {
+			x = x.right
+		} else {
+			// update the existing value, the keys are
+			// not changing so there is no need to
+			// re-balance the tree
+			old := x.value
+			x.value = value
+			return old, true
+		}
+	}
+	z := t.newNode(key, value)
+	z.parent = y
+	if y == t.NIL {
+		t.root = z
+	} else if t.compare(z.key, y.key) < 0 {
+		y.left = z
+	} else {
+		y.right = z
+	}
+	// the new node is in every subtree on the path to the root
+	for p := z.parent; p != t.NIL; p = p.parent {
+		p.count++
+	}
+	t.count++
+	t.insertFixup(z)
+	return *new(V), false
+}
+
+func (t *RBTree[K, V]) leftRotate(x *rbNode[K, V]) {
+	if x.right == t.NIL {
+		return
+	}
+	y := x.right
+	x.right = y.left
+	if y.left != t.NIL {
+		y.left.parent = x
+	}
+	y.parent = x.parent
+	if x.parent == t.NIL {
+		t.root = y
+	} else if x == x.parent.left {
+		x.parent.left = y
+	} else {
+		x.parent.right = y
+	}
+	y.left = x
+	x.parent = y
+	y.count = x.count
+	x.count = x.left.count + x.right.count + 1
+}
+
+func (t *RBTree[K, V]) rightRotate(x *rbNode[K, V]) {
+	if x.left == t.NIL {
+		return
+	}
+	y := x.left
+	x.left = y.right
+	if y.right != t.NIL {
+		y.right.parent = x
+	}
+	y.parent = x.parent
+	if x.parent == t.NIL {
+		t.root = y
+	} else if x == x.parent.left {
+		x.parent.left = y
+	} else {
+		x.parent.right = y
+	}
+	y.right = x
+	x.parent = y
+	y.count = x.count
+	x.count = x.left.count + x.right.count + 1
+}
+
+func (t *RBTree[K, V]) insertFixup(z *rbNode[K, V]) {
+	for z.parent.color == RED {
+		if z.parent == z.parent.parent.left {
+			y := z.parent.parent.right
+			if y.color == RED {
+				z.parent.color = BLACK
+				y.color = BLACK
+				z.parent.parent.color = RED
+				z = z.parent.parent
+			} else {
+				if z == z.parent.right {
+					z = z.parent
+					t.leftRotate(z)
+				}
+				z.parent.color = BLACK
+				z.parent.parent.color = RED
+				t.rightRotate(z.parent.parent)
+			}
+		} else {
+			y := z.parent.parent.left
+			if y.color == RED {
+				z.parent.color = BLACK
+				y.color = BLACK
+				z.parent.parent.color = RED
+				z = z.parent.parent
+			} else {
+				if z == z.parent.left {
+					z = z.parent
+					t.rightRotate(z)
+				}
+				z.parent.color = BLACK
+				z.parent.parent.color = RED
+				t.leftRotate(z.parent.parent)
+			}
+		}
+	}
+	t.root.color = BLACK
+}
+
+// search returns the node matching the key, or NIL
+func (t *RBTree[K, V]) search(key K) *rbNode[K, V] {
+	p := t.root
+	for p != t.NIL {
+		cmp := t.compare(key, p.key)
+		if cmp < 0 {
+			p = p.left
+		} else if cmp > 0 {
+			p = p.right
+		} else {
+			break
+		}
+	}
+	return p
+}
+
+// ceil returns the node with the smallest key that is
+// greater than or equal to the provided key, or NIL
+func (t *RBTree[K, V]) ceil(key K) *rbNode[K, V] {
+	ret := t.NIL
+	p := t.root
+	for p != t.NIL {
+		cmp := t.compare(key, p.key)
+		if cmp == 0 {
+			return p
+		}
+		if cmp < 0 {
+			ret = p
+			p = p.left
+		} else {
+			p = p.right
+		}
+	}
+	return ret
+}
+
+// floor returns the node with the largest key that is
+// less than or equal to the provided key, or NIL
+func (t *RBTree[K, V]) floor(key K) *rbNode[K, V] {
+	ret := t.NIL
+	p := t.root
+	for p != t.NIL {
+		cmp := t.compare(key, p.key)
+		if cmp == 0 {
+			return p
+		}
+		if cmp > 0 {
+			ret = p
+			p = p.right
+		} else {
+			p = p.left
+		}
+	}
+	return ret
+}
+
+// min traverses from root to left recursively until left is NIL
+func (t *RBTree[K, V]) min(x *rbNode[K, V]) *rbNode[K, V] {
+	if x == t.NIL {
+		return t.NIL
+	}
+	for x.left != t.NIL {
+		x = x.left
+	}
+	return x
+}
+
+// max traverses from root to right recursively until right is NIL
+func (t *RBTree[K, V]) max(x *rbNode[K, V]) *rbNode[K, V] {
+	if x == t.NIL {
+		return t.NIL
+	}
+	for x.right != t.NIL {
+		x = x.right
+	}
+	return x
+}
+
+func (t *RBTree[K, V]) predecessor(x *rbNode[K, V]) *rbNode[K, V] {
+	if x == t.NIL {
+		return t.NIL
+	}
+	if x.left != t.NIL {
+		return t.max(x.left)
+	}
+	y := x.parent
+	for y != t.NIL && x == y.left {
+		x = y
+		y = y.parent
+	}
+	return y
+}
+
+func (t *RBTree[K, V]) successor(x *rbNode[K, V]) *rbNode[K, V] {
+	if x == t.NIL {
+		return t.NIL
+	}
+	if x.right != t.NIL {
+		return t.min(x.right)
+	}
+	y := x.parent
+	for y != t.NIL && x == y.right {
+		x = y
+		y = y.parent
+	}
+	return y
+}
+
+// transplant replaces the subtree rooted at u with the subtree rooted at v
+func (t *RBTree[K, V]) transplant(u, v *rbNode[K, V]) {
+	if u.parent == t.NIL {
+		t.root = v
+	} else if u == u.parent.left {
+		u.parent.left = v
+	} else {
+		u.parent.right = v
+	}
+	v.parent = u.parent
+}
+
+// delete removes the node z from the tree. Nodes are moved rather than
+// having their keys and values swapped, so any other node (and any
+// cursor positioned on it) stays valid
+func (t *RBTree[K, V]) delete(z *rbNode[K, V]) {
+	var x *rbNode[K, V]
+	y := z
+	color := y.color
+	// the node that is spliced out of its position is z itself, or
+	// the successor of z (which takes the place of z) if z has two
+	// children. either way, it is no longer in any of the subtrees
+	// on the path from its position to the root
+	p := z.parent
+	if z.left != t.NIL && z.right != t.NIL {
+		p = t.min(z.right).parent
+	}
+	for ; p != t.NIL; p = p.parent {
+		p.count--
+	}
+	if z.left == t.NIL {
+		x = z.right
+		t.transplant(z, z.right)
+	} else if z.right == t.NIL {
+		x = z.left
+		t.transplant(z, z.left)
+	} else {
+		y = t.min(z.right)
+		color = y.color
+		x = y.right
+		if y.parent == z {
+			x.parent = y
+		} else {
+			t.transplant(y, y.right)
+			y.right = z.right
+			y.right.parent = y
+		}
+		t.transplant(z, y)
+		y.left = z.left
+		y.left.parent = y
+		y.color = z.color
+		y.count = z.count
+	}
+	if color == BLACK {
+		t.deleteFixup(x)
+	}
+	t.count--
+}
+
+func (t *RBTree[K, V]) deleteFixup(x *rbNode[K, V]) {
+	for x != t.root && x.color == BLACK {
+		if x == x.parent.left {
+			w := x.parent.right
+			if w.color == RED {
+				w.color = BLACK
+				x.parent.color = RED
+				t.leftRotate(x.parent)
+				w = x.parent.right
+			}
+			if w.left.color == BLACK && w.right.color == BLACK {
+				w.color = RED
+				x = x.parent
+			} else {
+				if w.right.color == BLACK {
+					w.left.color = BLACK
+					w.color = RED
+					t.rightRotate(w)
+					w = x.parent.right
+				}
+				w.color = x.parent.color
+				x.parent.color = BLACK
+				w.right.color = BLACK
+				t.leftRotate(x.parent)
+				// this is to exit while loop
+				x = t.root
+			}
+		} else {
+			w := x.parent.left
+			if w.color == RED {
+				w.color = BLACK
+				x.parent.color = RED
+				t.rightRotate(x.parent)
+				w = x.parent.left
+			}
+			if w.left.color == BLACK && w.right.color == BLACK {
+				w.color = RED
+				x = x.parent
+			} else {
+				if w.left.color == BLACK {
+					w.right.color = BLACK
+					w.color = RED
+					t.leftRotate(w)
+					w = x.parent.left
+				}
+				w.color = x.parent.color
+				x.parent.color = BLACK
+				w.left.color = BLACK
+				t.rightRotate(x.parent)
+				x = t.root
+			}
+		}
+	}
+	x.color = BLACK
+}
@@ -0,0 +1,225 @@
+package rbtree
+
+import (
+	"fmt"
+	"github.com/scottcagno/storage/pkg/util"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const (
+	thousand = 1000
+	n        = 10
+)
+
+func makeKey(i int) string {
+	return fmt.Sprintf("key-%06d", i)
+}
+
+// checkTree makes sure the red-black properties hold, and
+// that the subtree counts are correct
+func checkTree[K any, V any](t *testing.T, tree *RBTree[K, V]) {
+	var blackHeight func(x *rbNode[K, V]) int
+	blackHeight = func(x *rbNode[K, V]) int {
+		if x == tree.NIL {
+			return 1
+		}
+		if x.count != x.left.count+x.right.count+1 {
+			t.Fatalf("subtree count mismatch: %d != %d\n", x.count, x.left.count+x.right.count+1)
+		}
+		if x.color == RED && (x.left.color == RED || x.right.color == RED) {
+			t.Fatalf("red node has a red child\n")
+		}
+		l, r := blackHeight(x.left), blackHeight(x.right)
+		if l != r {
+			t.Fatalf("black height mismatch: %d != %d\n", l, r)
+		}
+		if x.color == BLACK {
+			return l + 1
+		}
+		return l
+	}
+	if tree.root.color != BLACK {
+		t.Fatalf("root is not black\n")
+	}
+	blackHeight(tree.root)
+	if tree.root.count != tree.count || tree.NIL.count != 0 {
+		t.Fatalf("tree count mismatch: %d != %d\n", tree.root.count, tree.count)
+	}
+}
+
+func TestRBTree_PutGetDel(t *testing.T) {
+	tree := NewOrderedRBTree[string, int]()
+	for _, i := range rand.Perm(n * thousand) {
+		_, ok := tree.Put(makeKey(i), i)
+		util.AssertEqual(t, false, ok)
+	}
+	checkTree(t, tree)
+	util.AssertLen(t, n*thousand, tree.Len())
+	// update
+	old, ok := tree.Put(makeKey(42), -42)
+	util.AssertEqual(t, true, ok)
+	util.AssertEqual(t, 42, old)
+	util.AssertLen(t, n*thousand, tree.Len())
+	for i := 0; i < n*thousand; i++ {
+		v, ok := tree.Get(makeKey(i))
+		if !ok {
+			t.Fatalf("get(%d): not found\n", i)
+		}
+		if i != 42 {
+			util.AssertEqual(t, i, v)
+		}
+	}
+	// delete half
+	for _, i := range rand.Perm(n * thousand) {
+		if i%2 == 0 {
+			v, ok := tree.Del(makeKey(i))
+			util.AssertEqual(t, true, ok)
+			if i != 42 {
+				util.AssertEqual(t, i, v)
+			}
+		}
+	}
+	checkTree(t, tree)
+	util.AssertLen(t, n*thousand/2, tree.Len())
+	for i := 0; i < n*thousand; i++ {
+		util.AssertEqual(t, i%2 == 1, tree.Has(makeKey(i)))
+	}
+	_, ok = tree.Del(makeKey(0))
+	util.AssertEqual(t, false, ok)
+	k, _, ok := tree.Min()
+	util.AssertEqual(t, makeKey(1), k)
+	k, _, ok = tree.Max()
+	util.AssertEqual(t, makeKey(n*thousand-1), k)
+}
+
+func TestRBTree_Comparator(t *testing.T) {
+	// order the keys in reverse, ignoring case
+	tree := NewRBTree[string, int](func(a, b string) int {
+		return strings.Compare(strings.ToLower(b), strings.ToLower(a))
+	})
+	tree.Put("a", 1)
+	tree.Put("B", 2)
+	tree.Put("c", 3)
+	tree.Put("A", 4)
+	util.AssertLen(t, 3, tree.Len())
+	var keys []string
+	tree.Ascend(func(k string, v int) bool {
+		keys = append(keys, k)
+		return true
+	})
+	util.AssertEqual(t, []string{"c", "B", "a"}, keys)
+	v, _ := tree.Get("a")
+	util.AssertEqual(t, 4, v)
+}
+
+func TestRBTree_Cursor(t *testing.T) {
+	tree := NewOrderedRBTree[int, int]()
+	for _, i := range rand.Perm(thousand) {
+		tree.Put(i*2, i)
+	}
+	c := tree.Cursor()
+	util.AssertEqual(t, false, c.Valid())
+	// forward
+	var i int
+	for ok := c.First(); ok; ok = c.Next() {
+		util.AssertEqual(t, i*2, c.Key())
+		util.AssertEqual(t, i, c.Value())
+		i++
+	}
+	util.AssertLen(t, thousand, i)
+	// reverse
+	for ok := c.Last(); ok; ok = c.Prev() {
+		i--
+		util.AssertEqual(t, i*2, c.Key())
+	}
+	util.AssertLen(t, 0, i)
+	// seek
+	util.AssertEqual(t, true, c.Seek(500))
+	util.AssertEqual(t, 500, c.Key())
+	util.AssertEqual(t, true, c.Seek(501))
+	util.AssertEqual(t, 502, c.Key())
+	util.AssertEqual(t, true, c.SeekLE(501))
+	util.AssertEqual(t, 500, c.Key())
+	util.AssertEqual(t, false, c.Seek(thousand*2))
+	util.AssertEqual(t, false, c.SeekLE(-1))
+	// the cursor stays valid when other entries are removed
+	c.Seek(500)
+	for k := 0; k < thousand*2; k += 4 {
+		if k != 500 {
+			tree.Del(k)
+		}
+	}
+	util.AssertEqual(t, 500, c.Key())
+	util.AssertEqual(t, true, c.Next())
+	util.AssertEqual(t, 502, c.Key())
+	util.AssertEqual(t, true, c.Prev())
+	util.AssertEqual(t, true, c.Prev())
+	util.AssertEqual(t, 498, c.Key())
+	checkTree(t, tree)
+}
+
+func TestRBTree_Ranges(t *testing.T) {
+	tree := NewOrderedRBTree[int, int]()
+	var want []int
+	for _, i := range rand.Perm(thousand) {
+		tree.Put(i*2, i)
+		want = append(want, i*2)
+	}
+	sort.Ints(want)
+	var got []int
+	tree.AscendRange(101, 201, func(k, v int) bool {
+		got = append(got, k)
+		return true
+	})
+	util.AssertEqual(t, want[51:101], got)
+	got = got[:0]
+	tree.DescendRange(200, 100, func(k, v int) bool {
+		got = append(got, k)
+		return true
+	})
+	util.AssertLen(t, 50, len(got))
+	util.AssertEqual(t, 200, got[0])
+	util.AssertEqual(t, 102, got[len(got)-1])
+	// stop early
+	got = got[:0]
+	tree.Descend(func(k, v int) bool {
+		got = append(got, k)
+		return len(got) < 3
+	})
+	util.AssertEqual(t, []int{1998, 1996, 1994}, got)
+}
+
+func TestRBTree_RankSelect(t *testing.T) {
+	tree := NewOrderedRBTree[int, int]()
+	// only the even numbers
+	for _, i := range rand.Perm(thousand) {
+		tree.Put(i*2, i)
+	}
+	for _, i := range rand.Perm(thousand / 2) {
+		tree.Del(i * 4)
+	}
+	checkTree(t, tree)
+	// the keys left are 2, 6, 10, ...
+	for i := 0; i < thousand/2; i++ {
+		k := i*4 + 2
+		util.AssertEqual(t, i, tree.Rank(k))
+		util.AssertEqual(t, i+1, tree.Rank(k+1))
+		key, _, ok := tree.Select(i)
+		util.AssertEqual(t, true, ok)
+		util.AssertEqual(t, k, key)
+	}
+	_, _, ok := tree.Select(thousand / 2)
+	util.AssertEqual(t, false, ok)
+	util.AssertEqual(t, thousand/2, tree.Rank(thousand*4))
+}
+
+func BenchmarkRBTree_Put(b *testing.B) {
+	tree := NewOrderedRBTree[string, int]()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.Put(makeKey(i), i)
+	}
+}
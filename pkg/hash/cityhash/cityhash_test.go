@@ -0,0 +1,89 @@
+/*
+ * // Copyright (c) 2021. Scott Cagno. All rights reserved.
+ * // The license can be found in the root of this project; see LICENSE.
+ */
+
+package cityhash
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// seeds used by the reference implementation's tests
+const (
+	seed0 = uint64(1234567)
+	seed1 = k0
+)
+
+// TestKnownAnswers checks the first row of the test data in the
+// reference city-test.cc, which hashes an empty input.
+func TestKnownAnswers(t *testing.T) {
+	var s []byte
+	if h := Hash64(s); h != 0x9ae16a3b2f90404f {
+		t.Errorf("Hash64 = 0x%016x", h)
+	}
+	if h := Hash64WithSeed(s, seed0); h != 0x75106db890237a4a {
+		t.Errorf("Hash64WithSeed = 0x%016x", h)
+	}
+	if h := Hash64WithSeeds(s, seed0, seed1); h != 0x3feac5f636039766 {
+		t.Errorf("Hash64WithSeeds = 0x%016x", h)
+	}
+	if lo, hi := Hash128(s); lo != 0x3df09dfc64c09a2b || hi != 0x3cb540c392e51e29 {
+		t.Errorf("Hash128 = 0x%016x 0x%016x", lo, hi)
+	}
+	if lo, hi := Hash128WithSeed(s, seed0, seed1); lo != 0x6b56343feac0663 || hi != 0x5b7bc50fd8e8ad92 {
+		t.Errorf("Hash128WithSeed = 0x%016x 0x%016x", lo, hi)
+	}
+	if h := Hash32(s); h != 0xdc56d17a {
+		t.Errorf("Hash32 = 0x%08x", h)
+	}
+}
+
+func TestDigests(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	for n := 0; n <= len(data); n += 37 {
+		h32, h64, h64s := New32(), New64(), New64WithSeeds(seed0, seed1)
+		h128, h128s := New128(), New128WithSeed(seed0, seed1)
+		for p := data[:n]; len(p) > 0; {
+			c := 13
+			if c > len(p) {
+				c = len(p)
+			}
+			for _, h := range []interface{ Write([]byte) (int, error) }{h32, h64, h64s, h128, h128s} {
+				h.Write(p[:c])
+			}
+			p = p[c:]
+		}
+		if got, want := h32.Sum32(), Hash32(data[:n]); got != want {
+			t.Fatalf("len %d: Sum32 = 0x%08x, want 0x%08x", n, got, want)
+		}
+		if got, want := h64.Sum64(), Hash64(data[:n]); got != want {
+			t.Fatalf("len %d: Sum64 = 0x%016x, want 0x%016x", n, got, want)
+		}
+		if got, want := h64s.Sum64(), Hash64WithSeeds(data[:n], seed0, seed1); got != want {
+			t.Fatalf("len %d: seeded Sum64 = 0x%016x, want 0x%016x", n, got, want)
+		}
+		lo, hi := h128.Sum128()
+		if wlo, whi := Hash128(data[:n]); lo != wlo || hi != whi {
+			t.Fatalf("len %d: Sum128 mismatch", n)
+		}
+		lo, hi = h128s.Sum128()
+		if wlo, whi := Hash128WithSeed(data[:n], seed0, seed1); lo != wlo || hi != whi {
+			t.Fatalf("len %d: seeded Sum128 mismatch", n)
+		}
+	}
+}
+
+func TestSumAndReset(t *testing.T) {
+	h := New64WithSeed(seed0)
+	h.Write([]byte("some data"))
+	h.Reset()
+	sum := h.Sum(nil)
+	if len(sum) != 8 || binary.BigEndian.Uint64(sum) != 0x75106db890237a4a {
+		t.Errorf("Sum after Reset appended %x, want 75106db890237a4a", sum)
+	}
+}
@@ -0,0 +1,149 @@
+/*
+ * // Copyright (c) 2021. Scott Cagno. All rights reserved.
+ * // The license can be found in the root of this project; see LICENSE.
+ */
+
+package cityhash
+
+import (
+	"hash"
+)
+
+// CityHash is not an incremental hash; the result for long inputs
+// depends on the last 64 bytes as well as the first ones, so it cannot
+// be computed block by block. The digests in this file implement the
+// hash interfaces by buffering everything that is written to them and
+// hashing the buffered input when a sum is requested. They are handy
+// for plugging CityHash in wherever a hash.Hash is expected, but for
+// large inputs the one-shot functions should be preferred.
+
+// Make sure interfaces are correctly implemented.
+var (
+	_ hash.Hash32 = new(digest32)
+	_ hash.Hash64 = new(digest64)
+	_ Digest128   = new(digest128)
+)
+
+// Digest128 is the interface implemented by the 128 bit digests. The
+// standard library does not define one.
+type Digest128 interface {
+	hash.Hash
+	Sum128() (lo, hi uint64)
+}
+
+// digest buffers the written input
+type digest struct {
+	buf []byte
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	d.buf = append(d.buf, p...)
+	return len(p), nil
+}
+
+func (d *digest) Reset() { d.buf = d.buf[:0] }
+
+func (d *digest) BlockSize() int { return 64 }
+
+// digest32 is a buffered CityHash32
+type digest32 struct {
+	digest
+}
+
+// New32 returns a new hash.Hash32 computing CityHash32. It buffers
+// the written input until a sum is requested.
+func New32() hash.Hash32 {
+	return new(digest32)
+}
+
+func (d *digest32) Size() int { return 4 }
+
+func (d *digest32) Sum32() uint32 { return Hash32(d.buf) }
+
+func (d *digest32) Sum(b []byte) []byte {
+	h := d.Sum32()
+	return append(b, byte(h>>24), byte(h>>16), byte(h>>8), byte(h))
+}
+
+// digest64 is a buffered CityHash64, optionally seeded
+type digest64 struct {
+	digest
+	seeds int // number of seeds in use (0, 1 or 2)
+	seed0 uint64
+	seed1 uint64
+}
+
+// New64 returns a new hash.Hash64 computing CityHash64. It buffers
+// the written input until a sum is requested.
+func New64() hash.Hash64 {
+	return new(digest64)
+}
+
+// New64WithSeed returns a new hash.Hash64 computing CityHash64WithSeed.
+func New64WithSeed(seed uint64) hash.Hash64 {
+	return &digest64{seeds: 1, seed0: seed}
+}
+
+// New64WithSeeds returns a new hash.Hash64 computing CityHash64WithSeeds.
+func New64WithSeeds(seed0, seed1 uint64) hash.Hash64 {
+	return &digest64{seeds: 2, seed0: seed0, seed1: seed1}
+}
+
+func (d *digest64) Size() int { return 8 }
+
+func (d *digest64) Sum64() uint64 {
+	switch d.seeds {
+	case 1:
+		return Hash64WithSeed(d.buf, d.seed0)
+	case 2:
+		return Hash64WithSeeds(d.buf, d.seed0, d.seed1)
+	}
+	return Hash64(d.buf)
+}
+
+func (d *digest64) Sum(b []byte) []byte {
+	h := d.Sum64()
+	return append(b,
+		byte(h>>56), byte(h>>48), byte(h>>40), byte(h>>32),
+		byte(h>>24), byte(h>>16), byte(h>>8), byte(h))
+}
+
+// digest128 is a buffered CityHash128, optionally seeded
+type digest128 struct {
+	digest
+	seeded bool
+	seed0  uint64
+	seed1  uint64
+}
+
+// New128 returns a new Digest128 computing CityHash128. It buffers
+// the written input until a sum is requested.
+func New128() Digest128 {
+	return new(digest128)
+}
+
+// New128WithSeed returns a new Digest128 computing CityHash128WithSeed
+// using the 128 bit seed made up of seed0 (low) and seed1 (high).
+func New128WithSeed(seed0, seed1 uint64) Digest128 {
+	return &digest128{seeded: true, seed0: seed0, seed1: seed1}
+}
+
+func (d *digest128) Size() int { return 16 }
+
+func (d *digest128) Sum128() (lo, hi uint64) {
+	if d.seeded {
+		return Hash128WithSeed(d.buf, d.seed0, d.seed1)
+	}
+	return Hash128(d.buf)
+}
+
+func (d *digest128) Sum(b []byte) []byte {
+	lo, hi := d.Sum128()
+	return append(b,
+		byte(hi>>56), byte(hi>>48), byte(hi>>40), byte(hi>>32),
+		byte(hi>>24), byte(hi>>16), byte(hi>>8), byte(hi),
+
+		byte(lo>>56), byte(lo>>48), byte(lo>>40), byte(lo>>32),
+		byte(lo>>24), byte(lo>>16), byte(lo>>8), byte(lo),
+	)
+}
@@ -0,0 +1,142 @@
+/*
+ * // Copyright (c) 2021. Scott Cagno. All rights reserved.
+ * // The license can be found in the root of this project; see LICENSE.
+ */
+
+// Package hash selects one of the hash functions in the sub packages by
+// name, so the function used by a filter, map or checksum can be chosen
+// through configuration. Every streaming hash returned by this package
+// implements the matching interface from the standard library's hash
+// package, and appends its sum in big endian byte order.
+//
+// CityHash can not be computed incrementally (the result for long inputs
+// depends on the end of the input as well as the start), so its streaming
+// hashes buffer everything written to them until a sum is requested. Use
+// Func64 to hash large inputs with CityHash.
+package hash
+
+import (
+	"errors"
+	"github.com/scottcagno/storage/pkg/hash/cityhash"
+	"github.com/scottcagno/storage/pkg/hash/murmur3"
+	"github.com/scottcagno/storage/pkg/hash/spooky"
+	"github.com/scottcagno/storage/pkg/hash/xxhash"
+	stdhash "hash"
+)
+
+// Names of the supported hash functions
+const (
+	CityHash = "cityhash"
+	Murmur3  = "murmur3"
+	Spooky   = "spooky"
+	XXHash   = "xxhash"
+)
+
+var (
+	ErrUnknownHash  = errors.New("hash: unknown hash function")
+	ErrNotSupported = errors.New("hash: size or seed not supported by hash function")
+)
+
+// Hash128 is the common interface implemented by all of the 128 bit
+// hashes. The standard library does not define one.
+type Hash128 interface {
+	stdhash.Hash
+	Sum128() (uint64, uint64)
+}
+
+// Names returns the names of the supported hash functions
+func Names() []string {
+	return []string{CityHash, Murmur3, Spooky, XXHash}
+}
+
+// New32 returns a new streaming 32 bit hash using the named function
+// and seed. CityHash32 does not take a seed, so it requires a seed of
+// zero, and it buffers the written input.
+func New32(name string, seed uint32) (stdhash.Hash32, error) {
+	switch name {
+	case CityHash:
+		if seed != 0 {
+			return nil, ErrNotSupported
+		}
+		return cityhash.New32(), nil
+	case Murmur3:
+		return murmur3.New32Seed(seed), nil
+	case Spooky:
+		return spooky.New32(seed), nil
+	case XXHash:
+		return xxhash.New32Seed(seed), nil
+	}
+	return nil, ErrUnknownHash
+}
+
+// New64 returns a new streaming 64 bit hash using the named function
+// and seed. MurmurHash3 only takes a 32 bit seed, so larger seeds are
+// not supported. A seed of zero selects the unseeded CityHash64, which
+// (like the seeded one) buffers the written input.
+func New64(name string, seed uint64) (stdhash.Hash64, error) {
+	switch name {
+	case CityHash:
+		if seed == 0 {
+			return cityhash.New64(), nil
+		}
+		return cityhash.New64WithSeed(seed), nil
+	case Murmur3:
+		if seed > 0xffffffff {
+			return nil, ErrNotSupported
+		}
+		return murmur3.New64Seed(uint32(seed)), nil
+	case Spooky:
+		return spooky.New64(seed), nil
+	case XXHash:
+		return xxhash.New64Seed(seed), nil
+	}
+	return nil, ErrUnknownHash
+}
+
+// New128 returns a new streaming 128 bit hash using the named function
+// and seed. There is no 128 bit xxhash. A seed of zero selects the
+// unseeded CityHash128, any other seed is used as both seed words. The
+// CityHash128 hashes buffer the written input.
+func New128(name string, seed uint64) (Hash128, error) {
+	switch name {
+	case CityHash:
+		if seed == 0 {
+			return cityhash.New128(), nil
+		}
+		return cityhash.New128WithSeed(seed, seed), nil
+	case Murmur3:
+		if seed > 0xffffffff {
+			return nil, ErrNotSupported
+		}
+		return murmur3.New128Seed(uint32(seed)), nil
+	case Spooky:
+		return spooky.New128(seed), nil
+	case XXHash:
+		return nil, ErrNotSupported
+	}
+	return nil, ErrUnknownHash
+}
+
+// Func64 returns the one-shot 64 bit form of the named hash function.
+// It computes the same values as the hash returned by New64, without
+// the state and allocations, which makes it the better choice for hot
+// paths such as hash maps and filters.
+func Func64(name string, seed uint64) (func(b []byte) uint64, error) {
+	switch name {
+	case CityHash:
+		if seed == 0 {
+			return cityhash.Hash64, nil
+		}
+		return func(b []byte) uint64 { return cityhash.Hash64WithSeed(b, seed) }, nil
+	case Murmur3:
+		if seed > 0xffffffff {
+			return nil, ErrNotSupported
+		}
+		return func(b []byte) uint64 { return murmur3.Sum64WithSeed(b, uint32(seed)) }, nil
+	case Spooky:
+		return func(b []byte) uint64 { return spooky.Hash64(b, seed) }, nil
+	case XXHash:
+		return func(b []byte) uint64 { return xxhash.Checksum(b, seed) }, nil
+	}
+	return nil, ErrUnknownHash
+}
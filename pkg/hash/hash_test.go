@@ -0,0 +1,47 @@
+/*
+ * // Copyright (c) 2021. Scott Cagno. All rights reserved.
+ * // The license can be found in the root of this project; see LICENSE.
+ */
+
+package hash
+
+import (
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	data := []byte("The quick brown fox jumps over the lazy dog.")
+	for _, name := range Names() {
+		h64, err := New64(name, 42)
+		if err != nil {
+			t.Fatalf("New64(%q): %v", name, err)
+		}
+		h64.Write(data)
+		fn, err := Func64(name, 42)
+		if err != nil {
+			t.Fatalf("Func64(%q): %v", name, err)
+		}
+		if got, want := h64.Sum64(), fn(data); got != want {
+			t.Errorf("%s: New64 and Func64 disagree: 0x%016x != 0x%016x", name, got, want)
+		}
+		if h, err := New32(name, 0); err != nil || h.Size() != 4 {
+			t.Errorf("New32(%q): %v", name, err)
+		}
+		h128, err := New128(name, 0)
+		if name == XXHash {
+			if err != ErrNotSupported {
+				t.Errorf("New128(%q) error = %v, want %v", name, err, ErrNotSupported)
+			}
+			continue
+		}
+		if err != nil || h128.Size() != 16 {
+			t.Errorf("New128(%q): %v", name, err)
+		}
+	}
+	if _, err := New64("md5", 0); err != ErrUnknownHash {
+		t.Errorf("New64(md5) error = %v, want %v", err, ErrUnknownHash)
+	}
+	if _, err := New32(CityHash, 1); err != ErrNotSupported {
+		t.Errorf("New32(cityhash, 1) error = %v, want %v", err, ErrNotSupported)
+	}
+}
@@ -31,12 +31,17 @@ type Hash128 interface {
 // digest128 represents a partial evaluation of a 128 bites hash.
 type digest128 struct {
 	digest
-	h1 uint64 // Unfinalized running hash part 1.
-	h2 uint64 // Unfinalized running hash part 2.
+	h1   uint64 // Unfinalized running hash part 1.
+	h2   uint64 // Unfinalized running hash part 2.
+	seed uint32 // Seed both running hash parts start with.
 }
 
 func New128() Hash128 {
-	d := new(digest128)
+	return New128Seed(0)
+}
+
+func New128Seed(seed uint32) Hash128 {
+	d := &digest128{seed: seed}
 	d.bmixer = d
 	d.Reset()
 	return d
@@ -44,10 +49,10 @@ func New128() Hash128 {
 
 func (d *digest128) Size() int { return 16 }
 
-func (d *digest128) reset() { d.h1, d.h2 = 0, 0 }
+func (d *digest128) reset() { d.h1, d.h2 = uint64(d.seed), uint64(d.seed) }
 
 func (d *digest128) Sum(b []byte) []byte {
-	h1, h2 := d.h1, d.h2
+	h1, h2 := d.Sum128()
 	return append(b,
 		byte(h1>>56), byte(h1>>48), byte(h1>>40), byte(h1>>32),
 		byte(h1>>24), byte(h1>>16), byte(h1>>8), byte(h1),
@@ -186,7 +191,12 @@ func rotl64(x uint64, r byte) uint64 {
 //     hasher.WriteType(data)
 //     return hasher.Sum128()
 func Sum128(data []byte) (h1 uint64, h2 uint64) {
-	d := &digest128{h1: 0, h2: 0}
+	return Sum128WithSeed(data, 0)
+}
+
+// Sum128WithSeed returns the MurmurHash3 sum of data using the seed.
+func Sum128WithSeed(data []byte, seed uint32) (h1 uint64, h2 uint64) {
+	d := &digest128{h1: uint64(seed), h2: uint64(seed)}
 	d.tail = d.bmix(data)
 	d.clen = len(data)
 	return d.Sum128()
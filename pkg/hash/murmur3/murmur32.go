@@ -24,18 +24,16 @@ const (
 // digest32 represents a partial evaluation of a 32 bites hash.
 type digest32 struct {
 	digest
-	h1 uint32 // Unfinalized running hash.
+	h1   uint32 // Unfinalized running hash.
+	seed uint32 // Seed the running hash starts with.
 }
 
 func New32() hash.Hash32 {
-	d := new(digest32)
-	d.bmixer = d
-	d.Reset()
-	return d
+	return New32Seed(0)
 }
 
 func New32Seed(seed uint32) hash.Hash32 {
-	d := new(digest32)
+	d := &digest32{seed: seed}
 	d.bmixer = d
 	d.Reset()
 	return d
@@ -43,10 +41,10 @@ func New32Seed(seed uint32) hash.Hash32 {
 
 func (d *digest32) Size() int { return 4 }
 
-func (d *digest32) reset() { d.h1 = 0 }
+func (d *digest32) reset() { d.h1 = d.seed }
 
 func (d *digest32) Sum(b []byte) []byte {
-	h := d.h1
+	h := d.Sum32()
 	return append(b, byte(h>>24), byte(h>>16), byte(h>>8), byte(h))
 }
 
@@ -113,17 +111,17 @@ func rotl32(x uint32, r byte) uint32 {
 //     hasher.WriteType(data)
 //     return hasher.Sum32()
 func Sum32(data []byte) uint32 {
+	return Sum32WithSeed(data, 0)
+}
 
-	var h1 uint32 = 0
+// Sum32WithSeed returns the MurmurHash3 sum of data using the seed.
+func Sum32WithSeed(data []byte, seed uint32) uint32 {
+
+	var h1 = seed
 
 	nblocks := len(data) / 4
-	var p uintptr
-	if len(data) > 0 {
-		p = uintptr(unsafe.Pointer(&data[0]))
-	}
-	p1 := p + uintptr(4*nblocks)
-	for ; p < p1; p += 4 {
-		k1 := *(*uint32)(unsafe.Pointer(p))
+	for i := 0; i < nblocks; i++ {
+		k1 := *(*uint32)(unsafe.Pointer(&data[i*4]))
 
 		k1 *= c1_32
 		k1 = (k1 << 15) | (k1 >> 17) // rotl32(k1, 15)
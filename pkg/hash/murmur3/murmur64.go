@@ -20,12 +20,16 @@ var (
 type digest64 digest128
 
 func New64() hash.Hash64 {
-	d := (*digest64)(New128().(*digest128))
+	return New64Seed(0)
+}
+
+func New64Seed(seed uint32) hash.Hash64 {
+	d := (*digest64)(New128Seed(seed).(*digest128))
 	return d
 }
 
 func (d *digest64) Sum(b []byte) []byte {
-	h1 := d.h1
+	h1 := d.Sum64()
 	return append(b,
 		byte(h1>>56), byte(h1>>48), byte(h1>>40), byte(h1>>32),
 		byte(h1>>24), byte(h1>>16), byte(h1>>8), byte(h1))
@@ -42,7 +46,12 @@ func (d *digest64) Sum64() uint64 {
 //     hasher.WriteType(data)
 //     return hasher.Sum64()
 func Sum64(data []byte) uint64 {
-	d := &digest128{h1: 0, h2: 0}
+	return Sum64WithSeed(data, 0)
+}
+
+// Sum64WithSeed returns the MurmurHash3 sum of data using the seed.
+func Sum64WithSeed(data []byte, seed uint32) uint64 {
+	d := &digest128{h1: uint64(seed), h2: uint64(seed)}
 	d.tail = d.bmix(data)
 	d.clen = len(data)
 	h1, _ := d.Sum128()
@@ -0,0 +1,123 @@
+/*
+ * // Copyright (c) 2021. Scott Cagno. All rights reserved.
+ * // The license can be found in the root of this project; see LICENSE.
+ */
+
+package murmur3
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// known answers computed with the reference MurmurHash3_x86_32 and
+// MurmurHash3_x64_128 implementations
+var vectors = []struct {
+	seed   uint32
+	h32    uint32
+	h1, h2 uint64
+	s      string
+}{
+	{0x00, 0x00000000, 0x0000000000000000, 0x0000000000000000, ""},
+	{0x01, 0x514e28b7, 0x4610abe56eff5cb5, 0x51622daa78f83583, ""},
+	{0x00, 0x248bfa47, 0xcbd8a7b341bd9b02, 0x5b1e906a48ae1d19, "hello"},
+	{0x00, 0x149bbb7f, 0x342fac623a5ebc8e, 0x4cdcbc079642414d, "hello, world"},
+	{0x00, 0xe31e8a70, 0xb89e5988b737affc, 0x664fc2950231b2cb, "19 Jan 2038 at 3:14:07 AM"},
+	{0x00, 0xd5c48bfc, 0xcd99481f9ee902c9, 0x695da1a38987b6e7, "The quick brown fox jumps over the lazy dog."},
+}
+
+func TestKnownAnswers(t *testing.T) {
+	for _, v := range vectors {
+		if h := Sum32WithSeed([]byte(v.s), v.seed); h != v.h32 {
+			t.Errorf("Sum32WithSeed(%q, %d) = 0x%08x, want 0x%08x", v.s, v.seed, h, v.h32)
+		}
+		if h1, h2 := Sum128WithSeed([]byte(v.s), v.seed); h1 != v.h1 || h2 != v.h2 {
+			t.Errorf("Sum128WithSeed(%q, %d) = 0x%016x 0x%016x, want 0x%016x 0x%016x", v.s, v.seed, h1, h2, v.h1, v.h2)
+		}
+		if h := Sum64WithSeed([]byte(v.s), v.seed); h != v.h1 {
+			t.Errorf("Sum64WithSeed(%q, %d) = 0x%016x, want 0x%016x", v.s, v.seed, h, v.h1)
+		}
+		h32 := New32Seed(v.seed)
+		h32.Write([]byte(v.s))
+		if h := h32.Sum32(); h != v.h32 {
+			t.Errorf("New32Seed(%d).Sum32(%q) = 0x%08x, want 0x%08x", v.seed, v.s, h, v.h32)
+		}
+		h128 := New128Seed(v.seed)
+		h128.Write([]byte(v.s))
+		if h1, h2 := h128.Sum128(); h1 != v.h1 || h2 != v.h2 {
+			t.Errorf("New128Seed(%d).Sum128(%q) = 0x%016x 0x%016x, want 0x%016x 0x%016x", v.seed, v.s, h1, h2, v.h1, v.h2)
+		}
+	}
+}
+
+// TestVerification runs the SMHasher verification test. It hashes keys of
+// the form {0, 1, 2, ..., i-1} with a seed of 256-i, hashes the result
+// and compares the first four bytes with the published value.
+func TestVerification(t *testing.T) {
+	key := make([]byte, 256)
+	sums32 := make([]byte, 256*4)
+	sums128 := make([]byte, 256*16)
+	for i := 0; i < 256; i++ {
+		key[i] = byte(i)
+		binary.LittleEndian.PutUint32(sums32[i*4:], Sum32WithSeed(key[:i], uint32(256-i)))
+		h1, h2 := Sum128WithSeed(key[:i], uint32(256-i))
+		binary.LittleEndian.PutUint64(sums128[i*16:], h1)
+		binary.LittleEndian.PutUint64(sums128[i*16+8:], h2)
+	}
+	if h := Sum32(sums32); h != 0xb0f57ee3 {
+		t.Errorf("x86_32 verification = 0x%08x, want 0xb0f57ee3", h)
+	}
+	if h1, _ := Sum128(sums128); uint32(h1) != 0x6384ba69 {
+		t.Errorf("x64_128 verification = 0x%08x, want 0x6384ba69", uint32(h1))
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	for n := 0; n <= len(data); n += 37 {
+		for _, chunk := range []int{1, 3, 16, 17, 100} {
+			h32, h64, h128 := New32Seed(42), New64Seed(42), New128Seed(42)
+			for p := data[:n]; len(p) > 0; {
+				c := chunk
+				if c > len(p) {
+					c = len(p)
+				}
+				h32.Write(p[:c])
+				h64.Write(p[:c])
+				h128.Write(p[:c])
+				// asking for a sum must not disturb the running hash
+				h32.Sum32()
+				h128.Sum128()
+				p = p[c:]
+			}
+			if got, want := h32.Sum32(), Sum32WithSeed(data[:n], 42); got != want {
+				t.Fatalf("len %d, chunk %d: Sum32 = 0x%08x, want 0x%08x", n, chunk, got, want)
+			}
+			if got, want := h64.Sum64(), Sum64WithSeed(data[:n], 42); got != want {
+				t.Fatalf("len %d, chunk %d: Sum64 = 0x%016x, want 0x%016x", n, chunk, got, want)
+			}
+			got1, got2 := h128.Sum128()
+			want1, want2 := Sum128WithSeed(data[:n], 42)
+			if got1 != want1 || got2 != want2 {
+				t.Fatalf("len %d, chunk %d: Sum128 mismatch", n, chunk)
+			}
+		}
+	}
+}
+
+func TestSumAndReset(t *testing.T) {
+	h := New32()
+	h.Write([]byte("hello"))
+	sum := h.Sum([]byte{0xff})
+	if len(sum) != 5 || sum[0] != 0xff || binary.BigEndian.Uint32(sum[1:]) != 0x248bfa47 {
+		t.Errorf("Sum appended %x, want ff248bfa47", sum)
+	}
+	h.Reset()
+	h.Write([]byte("hello, world"))
+	if got := h.Sum32(); got != 0x149bbb7f {
+		t.Errorf("Sum32 after Reset = 0x%08x, want 0x149bbb7f", got)
+	}
+}
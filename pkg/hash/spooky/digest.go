@@ -0,0 +1,218 @@
+/*
+ * // Copyright (c) 2021. Scott Cagno. All rights reserved.
+ * // The license can be found in the root of this project; see LICENSE.
+ */
+
+package spooky
+
+import (
+	"hash"
+	"unsafe"
+)
+
+// Make sure interfaces are correctly implemented.
+var (
+	_ hash.Hash32 = new(digest32)
+	_ hash.Hash64 = new(digest64)
+	_ Digest128   = new(digest128)
+)
+
+// Digest128 is the interface implemented by the 128 bit digest. The
+// standard library does not define one.
+type Digest128 interface {
+	hash.Hash
+	Sum128() (uint64, uint64)
+}
+
+// digest is the incremental form of SpookyHash128 (Init, Update and
+// Final in the reference implementation). Messages shorter than
+// sc_bufSize are kept in the buffer and hashed with SpookyHashShort,
+// longer ones are mixed one block at a time.
+type digest struct {
+	data      [2 * sc_numVars]uint64 // unhashed data, for partial messages
+	state     [sc_numVars]uint64     // internal state of the hash
+	length    int                    // total length of the input so far
+	remainder int                    // length of unhashed data stashed in data
+	seed1     uint64
+	seed2     uint64
+}
+
+func newDigest(seed1, seed2 uint64) digest {
+	d := digest{seed1: seed1, seed2: seed2}
+	d.Reset()
+	return d
+}
+
+// bytes returns the buffer of unhashed data as a byte slice
+func (d *digest) bytes() []byte {
+	return (*[sc_bufSize]byte)(unsafe.Pointer(&d.data))[:]
+}
+
+func (d *digest) BlockSize() int { return sc_blockSize }
+
+func (d *digest) Reset() {
+	d.length, d.remainder = 0, 0
+	d.state[0], d.state[1] = d.seed1, d.seed2
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	n := len(p)
+	newLength := n + d.remainder
+
+	// not enough data for a full buffer yet, just stash it
+	if newLength < sc_bufSize {
+		copy(d.bytes()[d.remainder:], p)
+		d.length += n
+		d.remainder = newLength
+		return n, nil
+	}
+
+	var h0, h1, h2, h3, h4, h5, h6, h7, h8, h9, h10, h11 uint64
+	if d.length < sc_bufSize {
+		h0, h3, h6, h9 = d.state[0], d.state[0], d.state[0], d.state[0]
+		h1, h4, h7, h10 = d.state[1], d.state[1], d.state[1], d.state[1]
+		h2, h5, h8, h11 = sc_const, sc_const, sc_const, sc_const
+	} else {
+		h0, h1, h2, h3 = d.state[0], d.state[1], d.state[2], d.state[3]
+		h4, h5, h6, h7 = d.state[4], d.state[5], d.state[6], d.state[7]
+		h8, h9, h10, h11 = d.state[8], d.state[9], d.state[10], d.state[11]
+	}
+	d.length += n
+
+	// if we've got anything stashed away, use it now
+	if d.remainder > 0 {
+		prefix := sc_bufSize - d.remainder
+		copy(d.bytes()[d.remainder:], p[:prefix])
+		h0, h1, h2, h3, h4, h5, h6, h7, h8, h9, h10, h11 = Mix(d.data[:sc_numVars], h0, h1, h2, h3, h4, h5, h6, h7, h8, h9, h10, h11)
+		h0, h1, h2, h3, h4, h5, h6, h7, h8, h9, h10, h11 = Mix(d.data[sc_numVars:], h0, h1, h2, h3, h4, h5, h6, h7, h8, h9, h10, h11)
+		p = p[prefix:]
+	}
+
+	// handle all whole blocks of sc_blockSize bytes
+	var block [sc_numVars]uint64
+	for len(p) >= sc_blockSize {
+		for i := range block {
+			block[i] = U8tou64le(p[i*8:])
+		}
+		h0, h1, h2, h3, h4, h5, h6, h7, h8, h9, h10, h11 = Mix(block[:], h0, h1, h2, h3, h4, h5, h6, h7, h8, h9, h10, h11)
+		p = p[sc_blockSize:]
+	}
+
+	// stuff away the last few bytes
+	d.remainder = copy(d.bytes(), p)
+
+	d.state = [sc_numVars]uint64{h0, h1, h2, h3, h4, h5, h6, h7, h8, h9, h10, h11}
+	return n, nil
+}
+
+// Sum128 returns the hash of everything written so far. It does not
+// change the state of the digest, so more data may be written later.
+func (d *digest) Sum128() (uint64, uint64) {
+	// init the variables
+	if d.length < sc_bufSize {
+		return SpookyHashShort(d.bytes()[:d.length], d.state[0], d.state[1])
+	}
+
+	data := d.data
+	h0, h1, h2, h3 := d.state[0], d.state[1], d.state[2], d.state[3]
+	h4, h5, h6, h7 := d.state[4], d.state[5], d.state[6], d.state[7]
+	h8, h9, h10, h11 := d.state[8], d.state[9], d.state[10], d.state[11]
+
+	last := data[:]
+	remainder := d.remainder
+	if remainder >= sc_blockSize {
+		// data can contain two blocks; handle any whole first block
+		h0, h1, h2, h3, h4, h5, h6, h7, h8, h9, h10, h11 = Mix(last, h0, h1, h2, h3, h4, h5, h6, h7, h8, h9, h10, h11)
+		last = last[sc_numVars:]
+		remainder -= sc_blockSize
+	}
+
+	// mix in the last partial block, and the length mod sc_blockSize
+	b := (*[sc_blockSize]byte)(unsafe.Pointer(&last[0]))
+	for i := remainder; i < sc_blockSize; i++ {
+		b[i] = 0
+	}
+	b[sc_blockSize-1] = byte(remainder)
+
+	// do some final mixing
+	h0, h1, _, _, _, _, _, _, _, _, _, _ = End(last, h0, h1, h2, h3, h4, h5, h6, h7, h8, h9, h10, h11)
+	return h0, h1
+}
+
+// digest32 is a streaming SpookyHash with a 32 bit result
+type digest32 struct {
+	digest
+}
+
+// New32 returns a new streaming hash.Hash32 computing Hash32 with
+// the provided seed.
+func New32(seed uint32) hash.Hash32 {
+	return &digest32{newDigest(uint64(seed), uint64(seed))}
+}
+
+func (d *digest32) Size() int { return 4 }
+
+func (d *digest32) Sum32() uint32 {
+	h, _ := d.Sum128()
+	return uint32(h)
+}
+
+func (d *digest32) Sum(b []byte) []byte {
+	h := d.Sum32()
+	return append(b, byte(h>>24), byte(h>>16), byte(h>>8), byte(h))
+}
+
+// digest64 is a streaming SpookyHash with a 64 bit result
+type digest64 struct {
+	digest
+}
+
+// New64 returns a new streaming hash.Hash64 computing Hash64 with
+// the provided seed.
+func New64(seed uint64) hash.Hash64 {
+	return &digest64{newDigest(seed, seed)}
+}
+
+func (d *digest64) Size() int { return 8 }
+
+func (d *digest64) Sum64() uint64 {
+	h, _ := d.Sum128()
+	return h
+}
+
+func (d *digest64) Sum(b []byte) []byte {
+	h := d.Sum64()
+	return append(b,
+		byte(h>>56), byte(h>>48), byte(h>>40), byte(h>>32),
+		byte(h>>24), byte(h>>16), byte(h>>8), byte(h))
+}
+
+// digest128 is a streaming SpookyHash with a 128 bit result
+type digest128 struct {
+	digest
+}
+
+// New128 returns a new streaming Digest128 computing Hash128 with
+// the provided seed.
+func New128(seed uint64) Digest128 {
+	return &digest128{newDigest(seed, seed)}
+}
+
+// New128WithSeeds returns a new streaming Digest128 computing
+// SpookyHash128 with the two provided seeds.
+func New128WithSeeds(seed1, seed2 uint64) Digest128 {
+	return &digest128{newDigest(seed1, seed2)}
+}
+
+func (d *digest128) Size() int { return 16 }
+
+func (d *digest128) Sum(b []byte) []byte {
+	h1, h2 := d.Sum128()
+	return append(b,
+		byte(h1>>56), byte(h1>>48), byte(h1>>40), byte(h1>>32),
+		byte(h1>>24), byte(h1>>16), byte(h1>>8), byte(h1),
+
+		byte(h2>>56), byte(h2>>48), byte(h2>>40), byte(h2>>32),
+		byte(h2>>24), byte(h2>>16), byte(h2>>8), byte(h2),
+	)
+}
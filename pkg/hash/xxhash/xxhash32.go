@@ -15,6 +15,12 @@ const (
 	prime32_5 = 374761393
 )
 
+// Make sure interfaces are correctly implemented.
+var (
+	_ hash.Hash32 = new(xxHash32)
+	_ hash.Hash32 = new(legacyHash32)
+)
+
 type xxHash32 struct {
 	seed     uint32
 	v1       uint32
@@ -26,22 +32,54 @@ type xxHash32 struct {
 	bufused  int
 }
 
-// New returns a new Hash32 instance.
-func NewHash32(seed uint32) hash.Hash32 {
+// New32 returns a new streaming XXH32 hash using a seed of zero.
+func New32() hash.Hash32 {
+	return New32Seed(0)
+}
+
+// New32Seed returns a new streaming XXH32 hash using the provided seed.
+func New32Seed(seed uint32) hash.Hash32 {
 	xxh := &xxHash32{seed: seed}
 	xxh.Reset()
 	return xxh
 }
 
+// NewHash32 returns a new Hash32 instance using the provided seed. Unlike
+// the hash returned by New32Seed, its Sum appends the hash in little
+// endian byte order.
+//
+// Deprecated: use New32Seed, which appends the sum in big endian byte
+// order like the hashes in the standard library.
+func NewHash32(seed uint32) hash.Hash32 {
+	xxh := &legacyHash32{xxHash32{seed: seed}}
+	xxh.Reset()
+	return xxh
+}
+
+// legacyHash32 is the hash returned by NewHash32. It only differs
+// from xxHash32 in the byte order of the sum.
+type legacyHash32 struct {
+	xxHash32
+}
+
+// Sum32 returns the XXH32 hash of b using a seed of 0xCAFE. Use
+// Checksum32 for the hash using any other seed.
 func Sum32(b []byte) uint32 {
-	h := NewHash32(0xCAFE)
-	h.Write(b)
-	return h.Sum32()
+	return Checksum32(b, 0xCAFE)
+}
+
+// Sum appends the current hash to b (in big endian byte order, like the
+// hashes in the standard library) and returns the resulting slice. It
+// does not change the underlying hash state.
+func (xxh *xxHash32) Sum(b []byte) []byte {
+	h32 := xxh.Sum32()
+	return append(b, byte(h32>>24), byte(h32>>16), byte(h32>>8), byte(h32))
 }
 
-// Sum appends the current hash to b and returns the resulting slice.
-// It does not change the underlying hash state.
-func (xxh xxHash32) Sum(b []byte) []byte {
+// Sum appends the current hash to b (in little endian byte order) and
+// returns the resulting slice. It does not change the underlying hash
+// state.
+func (xxh *legacyHash32) Sum(b []byte) []byte {
 	h32 := xxh.Sum32()
 	return append(b, byte(h32), byte(h32>>8), byte(h32>>16), byte(h32>>24))
 }
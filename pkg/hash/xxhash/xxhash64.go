@@ -15,6 +15,12 @@ const (
 	prime64_5 = 2870177450012600261
 )
 
+// Make sure interfaces are correctly implemented.
+var (
+	_ hash.Hash64 = new(xxHash64)
+	_ hash.Hash64 = new(legacyHash64)
+)
+
 type xxHash64 struct {
 	seed     uint64
 	v1       uint64
@@ -26,22 +32,54 @@ type xxHash64 struct {
 	bufused  int
 }
 
-// New returns a new Hash64 instance.
-func NewHash64(seed uint64) hash.Hash64 {
+// New64 returns a new streaming XXH64 hash using a seed of zero.
+func New64() hash.Hash64 {
+	return New64Seed(0)
+}
+
+// New64Seed returns a new streaming XXH64 hash using the provided seed.
+func New64Seed(seed uint64) hash.Hash64 {
 	xxh := &xxHash64{seed: seed}
 	xxh.Reset()
 	return xxh
 }
 
+// NewHash64 returns a new Hash64 instance using the provided seed. Unlike
+// the hash returned by New64Seed, its Sum appends the hash in little
+// endian byte order.
+//
+// Deprecated: use New64Seed, which appends the sum in big endian byte
+// order like the hashes in the standard library.
+func NewHash64(seed uint64) hash.Hash64 {
+	xxh := &legacyHash64{xxHash64{seed: seed}}
+	xxh.Reset()
+	return xxh
+}
+
+// legacyHash64 is the hash returned by NewHash64. It only differs
+// from xxHash64 in the byte order of the sum.
+type legacyHash64 struct {
+	xxHash64
+}
+
+// Sum64 returns the XXH64 hash of b using a seed of 0xCAFE. Use
+// Checksum for the hash using any other seed.
 func Sum64(b []byte) uint64 {
-	h := NewHash64(0xCAFE)
-	h.Write(b)
-	return h.Sum64()
+	return Checksum(b, 0xCAFE)
 }
 
-// Sum appends the current hash to b and returns the resulting slice.
-// It does not change the underlying hash state.
-func (xxh xxHash64) Sum(b []byte) []byte {
+// Sum appends the current hash to b (in big endian byte order, like the
+// hashes in the standard library) and returns the resulting slice. It
+// does not change the underlying hash state.
+func (xxh *xxHash64) Sum(b []byte) []byte {
+	h64 := xxh.Sum64()
+	return append(b, byte(h64>>56), byte(h64>>48), byte(h64>>40), byte(h64>>32), byte(h64>>24), byte(h64>>16), byte(h64>>8), byte(h64))
+}
+
+// Sum appends the current hash to b (in little endian byte order) and
+// returns the resulting slice. It does not change the underlying hash
+// state.
+func (xxh *legacyHash64) Sum(b []byte) []byte {
 	h64 := xxh.Sum64()
 	return append(b, byte(h64), byte(h64>>8), byte(h64>>16), byte(h64>>24), byte(h64>>32), byte(h64>>40), byte(h64>>48), byte(h64>>56))
 }
@@ -113,21 +151,23 @@ func (xxh *xxHash64) Write(input []byte) (int, error) {
 	return n, nil
 }
 
-// Sum64 returns the 64bits Hash value.
+// Sum64 returns the 64bits Hash value. It does not change the
+// underlying hash state, so more data may be written afterwards.
 func (xxh *xxHash64) Sum64() uint64 {
 	var h64 uint64
 	if xxh.totalLen >= 32 {
-		h64 = u64_rol1(xxh.v1) + u64_rol7(xxh.v2) + u64_rol12(xxh.v3) + u64_rol18(xxh.v4)
+		v1, v2, v3, v4 := xxh.v1, xxh.v2, xxh.v3, xxh.v4
+		h64 = u64_rol1(v1) + u64_rol7(v2) + u64_rol12(v3) + u64_rol18(v4)
 
-		xxh.v1 *= prime64_2
-		xxh.v2 *= prime64_2
-		xxh.v3 *= prime64_2
-		xxh.v4 *= prime64_2
+		v1 *= prime64_2
+		v2 *= prime64_2
+		v3 *= prime64_2
+		v4 *= prime64_2
 
-		h64 = (h64^(u64_rol31(xxh.v1)*prime64_1))*prime64_1 + prime64_4
-		h64 = (h64^(u64_rol31(xxh.v2)*prime64_1))*prime64_1 + prime64_4
-		h64 = (h64^(u64_rol31(xxh.v3)*prime64_1))*prime64_1 + prime64_4
-		h64 = (h64^(u64_rol31(xxh.v4)*prime64_1))*prime64_1 + prime64_4
+		h64 = (h64^(u64_rol31(v1)*prime64_1))*prime64_1 + prime64_4
+		h64 = (h64^(u64_rol31(v2)*prime64_1))*prime64_1 + prime64_4
+		h64 = (h64^(u64_rol31(v3)*prime64_1))*prime64_1 + prime64_4
+		h64 = (h64^(u64_rol31(v4)*prime64_1))*prime64_1 + prime64_4
 
 		h64 += xxh.totalLen
 	} else {
@@ -0,0 +1,150 @@
+/*
+ * // Copyright (c) 2021. Scott Cagno. All rights reserved.
+ * // The license can be found in the root of this project; see LICENSE.
+ */
+
+package xxhash
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// known answers computed with the reference XXH32 and XXH64 implementations
+var vectors = []struct {
+	h32 uint32
+	h64 uint64
+	s   string
+}{
+	{0x02cc5d05, 0xef46db3751d8e999, ""},
+	{0x550d7456, 0xd24ec4f1a98c6e5b, "a"},
+	{0x32d153ff, 0x44bc2cf5ad770999, "abc"},
+	{0xe2293b2f, 0xfbcea83c8a378bf1, "Nobody inspects the spammish repetition"},
+}
+
+func TestKnownAnswers(t *testing.T) {
+	for _, v := range vectors {
+		if h := Checksum32([]byte(v.s), 0); h != v.h32 {
+			t.Errorf("Checksum32(%q, 0) = 0x%08x, want 0x%08x", v.s, h, v.h32)
+		}
+		if h := Checksum([]byte(v.s), 0); h != v.h64 {
+			t.Errorf("Checksum(%q, 0) = 0x%016x, want 0x%016x", v.s, h, v.h64)
+		}
+		h32, h64 := New32(), New64()
+		h32.Write([]byte(v.s))
+		h64.Write([]byte(v.s))
+		if h := h32.Sum32(); h != v.h32 {
+			t.Errorf("New32().Sum32(%q) = 0x%08x, want 0x%08x", v.s, h, v.h32)
+		}
+		if h := h64.Sum64(); h != v.h64 {
+			t.Errorf("New64().Sum64(%q) = 0x%016x, want 0x%016x", v.s, h, v.h64)
+		}
+	}
+}
+
+// TestSanity runs the sanity checks from the reference implementation,
+// which hash a generated buffer with and without a seed.
+func TestSanity(t *testing.T) {
+	const seed = prime32_1
+	buf := make([]byte, 101)
+	gen := uint32(prime32_1)
+	for i := range buf {
+		buf[i] = byte(gen >> 24)
+		gen *= gen
+	}
+	tests := []struct {
+		n    int
+		seed uint32
+		h32  uint32
+		h64  uint64
+	}{
+		{1, 0, 0xb85cbee5, 0x4fce394cc88952d8},
+		{1, seed, 0xd5845d64, 0x739840cb819fa723},
+		{14, 0, 0xe5aa0ab4, 0xcffa8db881bc3a3d},
+		{14, seed, 0x4481951d, 0x5b9611585efcc9cb},
+		{101, 0, 0x1f1aa412, 0x0eab543384f878ad},
+		{101, seed, 0x498ec8e2, 0xcaa65939306f1e21},
+	}
+	for _, tt := range tests {
+		if h := Checksum32(buf[:tt.n], tt.seed); h != tt.h32 {
+			t.Errorf("Checksum32(len=%d, seed=%d) = 0x%08x, want 0x%08x", tt.n, tt.seed, h, tt.h32)
+		}
+		if h := Checksum(buf[:tt.n], uint64(tt.seed)); h != tt.h64 {
+			t.Errorf("Checksum(len=%d, seed=%d) = 0x%016x, want 0x%016x", tt.n, tt.seed, h, tt.h64)
+		}
+		h32, h64 := New32Seed(tt.seed), New64Seed(uint64(tt.seed))
+		h32.Write(buf[:tt.n])
+		h64.Write(buf[:tt.n])
+		if h := h32.Sum32(); h != tt.h32 {
+			t.Errorf("New32Seed(%d).Sum32(len=%d) = 0x%08x, want 0x%08x", tt.seed, tt.n, h, tt.h32)
+		}
+		if h := h64.Sum64(); h != tt.h64 {
+			t.Errorf("New64Seed(%d).Sum64(len=%d) = 0x%016x, want 0x%016x", tt.seed, tt.n, h, tt.h64)
+		}
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	for n := 0; n <= len(data); n += 37 {
+		for _, chunk := range []int{1, 3, 16, 31, 33, 100} {
+			h32, h64 := New32Seed(42), New64Seed(42)
+			for p := data[:n]; len(p) > 0; {
+				c := chunk
+				if c > len(p) {
+					c = len(p)
+				}
+				h32.Write(p[:c])
+				h64.Write(p[:c])
+				// asking for a sum must not disturb the running hash
+				h32.Sum32()
+				h64.Sum64()
+				p = p[c:]
+			}
+			if got, want := h32.Sum32(), Checksum32(data[:n], 42); got != want {
+				t.Fatalf("len %d, chunk %d: Sum32 = 0x%08x, want 0x%08x", n, chunk, got, want)
+			}
+			if got, want := h64.Sum64(), Checksum(data[:n], 42); got != want {
+				t.Fatalf("len %d, chunk %d: Sum64 = 0x%016x, want 0x%016x", n, chunk, got, want)
+			}
+		}
+	}
+}
+
+func TestSumAndReset(t *testing.T) {
+	h := New64()
+	h.Write([]byte("abc"))
+	sum := h.Sum(nil)
+	if len(sum) != 8 || binary.BigEndian.Uint64(sum) != 0x44bc2cf5ad770999 {
+		t.Errorf("Sum appended %x, want 44bc2cf5ad770999", sum)
+	}
+	h.Reset()
+	h.Write([]byte("a"))
+	if got := h.Sum64(); got != 0xd24ec4f1a98c6e5b {
+		t.Errorf("Sum64 after Reset = 0x%016x, want 0xd24ec4f1a98c6e5b", got)
+	}
+}
+
+// TestCompat makes sure the functions that existed before the hashes
+// implemented the standard library interfaces still behave the same.
+func TestCompat(t *testing.T) {
+	b := []byte("abc")
+	if got, want := Sum32(b), Checksum32(b, 0xCAFE); got != want {
+		t.Errorf("Sum32 = 0x%08x, want 0x%08x", got, want)
+	}
+	if got, want := Sum64(b), Checksum(b, 0xCAFE); got != want {
+		t.Errorf("Sum64 = 0x%016x, want 0x%016x", got, want)
+	}
+	h32, h64 := NewHash32(0), NewHash64(0)
+	h32.Write(b)
+	h64.Write(b)
+	if sum := h32.Sum(nil); binary.LittleEndian.Uint32(sum) != 0x32d153ff {
+		t.Errorf("NewHash32 Sum appended %x, want ff53d132", sum)
+	}
+	if sum := h64.Sum(nil); binary.LittleEndian.Uint64(sum) != 0x44bc2cf5ad770999 {
+		t.Errorf("NewHash64 Sum appended %x, want 990977adf52cbc44", sum)
+	}
+}
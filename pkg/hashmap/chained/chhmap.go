@@ -33,9 +33,13 @@ type bucket struct {
 }
 
 func (b *bucket) insert(key keyType, val valType) (valType, bool) {
-	if val, ok := b.search(key); ok {
-		// already exists
-		return val, true
+	for current := b.head; current != nil; current = current.next {
+		if current.entry.key == key {
+			// already exists, update it and return the previous value
+			old := current.entry.val
+			current.entry.val = val
+			return old, true
+		}
 	}
 	newNode := &entryNode{
 		entry: entry{
@@ -60,18 +64,31 @@ func (b *bucket) search(key keyType) (valType, bool) {
 	return valZeroType, false
 }
 
-func (b *bucket) scan(it Iterator) {
+func (b *bucket) scan(it Iterator) bool {
 	current := b.head
 	for current != nil {
 		if !it(current.entry.key, current.entry.val) {
-			return
+			return false
 		}
 		current = current.next
 	}
+	return true
+}
+
+// length returns the number of entries in the bucket
+func (b *bucket) length() int {
+	var n int
+	for current := b.head; current != nil; current = current.next {
+		n++
+	}
+	return n
 }
 
 func (b *bucket) delete(key keyType) (valType, bool) {
 	var ret valType
+	if b.head == nil {
+		return valZeroType, false
+	}
 	if b.head.entry.key == key {
 		ret = b.head.entry.val
 		b.head = b.head.next
@@ -190,8 +207,9 @@ func (m *HashMap) lookup(hashkey uint64, key keyType) (valType, bool) {
 	return m.buckets[i].search(key)
 }
 
-// Put inserts a key value entry and returns the previous value or false
-// Put can be considered the exported version of the insert call
+// Put inserts or updates a key value entry. If the key already existed, its
+// value is replaced and Put returns the previous value and true; otherwise
+// it returns false. Put can be considered the exported version of the insert call
 func (m *HashMap) Put(key keyType, value valType) (valType, bool) {
 	return m.insert(0, key, value)
 }
@@ -218,8 +236,9 @@ func (m *HashMap) insert(hashkey uint64, key keyType, value valType) (valType, b
 	val, ok := m.buckets[i].insert(key, value)
 	if !ok { // means not updated, aka a new one was inserted
 		m.keys++
+		return valZeroType, false
 	}
-	return val, !ok
+	return val, true
 }
 
 // Del removes a value for a given key and returns the deleted value, or false
@@ -262,9 +281,29 @@ type Iterator func(key keyType, value valType) bool
 // as the iterator function continues to be true. Range is not
 // safe to perform an insert or remove operation while ranging!
 func (m *HashMap) Range(it Iterator) {
+	m.rangeUntil(it)
+}
+
+// rangeUntil is the internal version of Range, which reports
+// false if the iterator function stopped the iteration
+func (m *HashMap) rangeUntil(it Iterator) bool {
+	for i := 0; i < len(m.buckets); i++ {
+		if !m.buckets[i].scan(it) {
+			return false
+		}
+	}
+	return true
+}
+
+// longestPath returns the length of the longest chain in the HashMap
+func (m *HashMap) longestPath() int {
+	var longest int
 	for i := 0; i < len(m.buckets); i++ {
-		m.buckets[i].scan(it)
+		if n := m.buckets[i].length(); n > longest {
+			longest = n
+		}
 	}
+	return longest
 }
 
 // PercentFull returns the current load factor of the HashMap
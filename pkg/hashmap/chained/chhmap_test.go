@@ -105,6 +105,31 @@ func Test_bucket_insert(t *testing.T) {
 	b = nil
 }
 
+func Test_bucket_insert_update(t *testing.T) {
+	b := &bucket{
+		hashkey: 1234567890,
+		head:    nil,
+	}
+	b.insert("1", []byte("1"))
+	b.insert("2", []byte("2"))
+	val, ok := b.insert("1", []byte("one"))
+	util.AssertExpected(t, true, ok)
+	util.AssertExpected(t, []byte("1"), val)
+	val, ok = b.search("1")
+	util.AssertExpected(t, true, ok)
+	util.AssertExpected(t, []byte("one"), val)
+}
+
+func Test_bucket_delete_empty(t *testing.T) {
+	b := &bucket{
+		hashkey: 1234567890,
+		head:    nil,
+	}
+	val, ok := b.delete("1")
+	util.AssertExpected(t, false, ok)
+	util.AssertExpected(t, valZeroType, val)
+}
+
 func Test_bucket_scan(t *testing.T) {
 	b := &bucket{
 		hashkey: 1234567890,
@@ -273,6 +298,21 @@ func Test_HashMap_Put(t *testing.T) {
 	hm.Close()
 }
 
+func Test_HashMap_Put_update(t *testing.T) {
+	hm := NewHashMap(128)
+	val, ok := hm.Put("key", []byte{0x01})
+	util.AssertExpected(t, false, ok)
+	util.AssertExpected(t, valZeroType, val)
+	val, ok = hm.Put("key", []byte{0x02})
+	util.AssertExpected(t, true, ok)
+	util.AssertExpected(t, []byte{0x01}, val)
+	val, ok = hm.Get("key")
+	util.AssertExpected(t, true, ok)
+	util.AssertExpected(t, []byte{0x02}, val)
+	util.AssertExpected(t, 1, hm.Len())
+	hm.Close()
+}
+
 func Test_HashMap_Range(t *testing.T) {
 	hm := NewHashMap(128)
 	for i := 0; i < len(words); i++ {
@@ -1,6 +1,7 @@
 package chained
 
 import (
+	"bytes"
 	"fmt"
 	"log"
 	"math/bits"
@@ -101,31 +102,144 @@ func (s *ShardedHashMap) delete(key keyType) (valType, bool) {
 	return pv, ok
 }
 
+// GetOrSet returns the value for key if it is present. Otherwise, it sets
+// the value for key to val and returns val. The loaded result is true if
+// the value was already present.
+func (s *ShardedHashMap) GetOrSet(key keyType, val valType) (valType, bool) {
+	buk, hashkey := s.getShard(key)
+	s.shards[buk].mu.Lock()
+	defer s.shards[buk].mu.Unlock()
+	if pv, ok := s.shards[buk].hm.lookup(hashkey, key); ok {
+		return pv, true
+	}
+	s.shards[buk].hm.insert(hashkey, key, val)
+	return val, false
+}
+
+// Compute calls fn with the current value for key (and whether it is
+// present), and then sets the value for key to the value returned by fn,
+// or removes key if fn returns false. It returns the new value and whether
+// key is present afterwards. The shard holding key is locked while fn runs,
+// so fn must not use the ShardedHashMap.
+func (s *ShardedHashMap) Compute(key keyType, fn func(old valType, loaded bool) (valType, bool)) (valType, bool) {
+	buk, hashkey := s.getShard(key)
+	s.shards[buk].mu.Lock()
+	defer s.shards[buk].mu.Unlock()
+	old, loaded := s.shards[buk].hm.lookup(hashkey, key)
+	val, keep := fn(old, loaded)
+	if !keep {
+		if loaded {
+			s.shards[buk].hm.delete(hashkey, key)
+		}
+		return valZeroType, false
+	}
+	s.shards[buk].hm.insert(hashkey, key, val)
+	return val, true
+}
+
+// CompareAndSwap sets the value for key to new if key is present and its
+// current value is equal to old. It reports whether the value was swapped.
+func (s *ShardedHashMap) CompareAndSwap(key keyType, old, new valType) bool {
+	buk, hashkey := s.getShard(key)
+	s.shards[buk].mu.Lock()
+	defer s.shards[buk].mu.Unlock()
+	pv, ok := s.shards[buk].hm.lookup(hashkey, key)
+	if !ok || !bytes.Equal(pv, old) {
+		return false
+	}
+	s.shards[buk].hm.insert(hashkey, key, new)
+	return true
+}
+
+// LoadAndDelete removes key, returning the value it had (if any). The
+// loaded result reports whether key was present.
+func (s *ShardedHashMap) LoadAndDelete(key keyType) (valType, bool) {
+	return s.delete(key)
+}
+
 func (s *ShardedHashMap) Len() int {
 	var length int
 	for i := range s.shards {
-		s.shards[i].mu.Lock()
+		s.shards[i].mu.RLock()
 		length += s.shards[i].hm.Len()
-		s.shards[i].mu.Unlock()
+		s.shards[i].mu.RUnlock()
 	}
 	return length
 }
 
+// Range calls it for every entry as long as it returns true. Each shard is
+// read locked while its entries are visited, so it must not modify the
+// ShardedHashMap (use RangeSnapshot for that). Entries of a shard are seen
+// consistently, but other shards may change while ranging.
 func (s *ShardedHashMap) Range(it Iterator) {
 	for i := range s.shards {
-		s.shards[i].mu.Lock()
-		s.shards[i].hm.Range(it)
-		s.shards[i].mu.Unlock()
+		s.shards[i].mu.RLock()
+		ok := s.shards[i].hm.rangeUntil(it)
+		s.shards[i].mu.RUnlock()
+		if !ok {
+			return
+		}
 	}
 }
 
-func (s *ShardedHashMap) Stats() {
+// RangeSnapshot is like Range, except that it copies the entries of each
+// shard (under its read lock) before visiting them, so no lock is held
+// while it runs and it may modify the ShardedHashMap. The values are not
+// copied, only the references to them.
+func (s *ShardedHashMap) RangeSnapshot(it Iterator) {
+	var snapshot []entry
 	for i := range s.shards {
-		s.shards[i].mu.Lock()
-		if pf := s.shards[i].hm.PercentFull(); pf > 0 {
-			fmt.Printf("shard %d, fill percent: %.4f\n", i, pf)
+		snapshot = s.shards[i].snapshot(snapshot[:0])
+		for _, e := range snapshot {
+			if !it(e.key, e.val) {
+				return
+			}
+		}
+	}
+}
+
+// snapshot appends the entries of the shard to entries
+func (sh *shard) snapshot(entries []entry) []entry {
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	sh.hm.Range(func(key keyType, val valType) bool {
+		entries = append(entries, entry{key: key, val: val})
+		return true
+	})
+	return entries
+}
+
+// ShardStats holds the load statistics of a single shard
+type ShardStats struct {
+	Shard       int     `json:"shard"`
+	Entries     int     `json:"entries"`
+	Buckets     int     `json:"buckets"`
+	PercentFull float64 `json:"percent_full"`
+	LongestPath int     `json:"longest_path"` // length of the longest chain
+}
+
+// ShardStats returns the load statistics of every shard
+func (s *ShardedHashMap) ShardStats() []ShardStats {
+	stats := make([]ShardStats, len(s.shards))
+	for i := range s.shards {
+		s.shards[i].mu.RLock()
+		stats[i] = ShardStats{
+			Shard:       i,
+			Entries:     s.shards[i].hm.Len(),
+			Buckets:     len(s.shards[i].hm.buckets),
+			PercentFull: s.shards[i].hm.PercentFull(),
+			LongestPath: s.shards[i].hm.longestPath(),
+		}
+		s.shards[i].mu.RUnlock()
+	}
+	return stats
+}
+
+func (s *ShardedHashMap) Stats() {
+	for _, st := range s.ShardStats() {
+		if st.PercentFull > 0 {
+			fmt.Printf("shard %d, fill percent: %.4f\n", st.Shard, st.PercentFull)
 		}
-		s.shards[i].mu.Unlock()
 	}
 }
 
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/scottcagno/storage/pkg/util"
 	"strconv"
+	"sync"
 	"testing"
 )
 
@@ -35,3 +36,107 @@ func TestShardedHashMap(t *testing.T) {
 	}
 	hm.Close()
 }
+
+func TestShardedHashMap_GetOrSet(t *testing.T) {
+	hm := NewShardedHashMap(16)
+	v, loaded := hm.GetOrSet("foo", []byte("bar"))
+	util.AssertExpected(t, false, loaded)
+	util.AssertExpected(t, []byte("bar"), v)
+	v, loaded = hm.GetOrSet("foo", []byte("baz"))
+	util.AssertExpected(t, true, loaded)
+	util.AssertExpected(t, []byte("bar"), v)
+	util.AssertExpected(t, 1, hm.Len())
+}
+
+func TestShardedHashMap_Compute(t *testing.T) {
+	hm := NewShardedHashMap(16)
+	incr := func(old []byte, loaded bool) ([]byte, bool) {
+		n := 0
+		if loaded {
+			n, _ = strconv.Atoi(string(old))
+		}
+		return []byte(strconv.Itoa(n + 1)), true
+	}
+	// concurrent increments must not be lost
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				hm.Compute(strconv.Itoa(i%10), incr)
+			}
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < 10; i++ {
+		v, ok := hm.Get(strconv.Itoa(i))
+		util.AssertExpected(t, true, ok)
+		util.AssertExpected(t, "800", string(v))
+	}
+	// returning false removes the key
+	v, ok := hm.Compute("0", func(old []byte, loaded bool) ([]byte, bool) {
+		util.AssertExpected(t, true, loaded)
+		return nil, false
+	})
+	util.AssertExpected(t, false, ok)
+	util.AssertExpected(t, 0, len(v))
+	_, ok = hm.Get("0")
+	util.AssertExpected(t, false, ok)
+	util.AssertExpected(t, 9, hm.Len())
+}
+
+func TestShardedHashMap_CompareAndSwap(t *testing.T) {
+	hm := NewShardedHashMap(16)
+	util.AssertExpected(t, false, hm.CompareAndSwap("foo", nil, []byte("bar")))
+	hm.Put("foo", []byte("bar"))
+	util.AssertExpected(t, false, hm.CompareAndSwap("foo", []byte("baz"), []byte("qux")))
+	util.AssertExpected(t, true, hm.CompareAndSwap("foo", []byte("bar"), []byte("qux")))
+	v, _ := hm.Get("foo")
+	util.AssertExpected(t, []byte("qux"), v)
+
+	v, loaded := hm.LoadAndDelete("foo")
+	util.AssertExpected(t, true, loaded)
+	util.AssertExpected(t, []byte("qux"), v)
+	_, loaded = hm.LoadAndDelete("foo")
+	util.AssertExpected(t, false, loaded)
+}
+
+func TestShardedHashMap_Range(t *testing.T) {
+	hm := NewShardedHashMap(16)
+	for i := 0; i < 1000; i++ {
+		hm.Put(strconv.Itoa(i), []byte{byte(i)})
+	}
+	var counted int
+	hm.Range(func(key string, val []byte) bool {
+		counted++
+		return counted < 10
+	})
+	util.AssertExpected(t, 10, counted)
+	// the map may be modified while ranging over a snapshot
+	counted = 0
+	hm.RangeSnapshot(func(key string, val []byte) bool {
+		counted++
+		hm.Del(key)
+		return true
+	})
+	util.AssertExpected(t, 1000, counted)
+	util.AssertExpected(t, 0, hm.Len())
+}
+
+func TestShardedHashMap_ShardStats(t *testing.T) {
+	hm := NewShardedHashMap(16)
+	for i := 0; i < 1000; i++ {
+		hm.Put(strconv.Itoa(i), nil)
+	}
+	stats := hm.ShardStats()
+	util.AssertExpected(t, 16, len(stats))
+	var entries int
+	for i, st := range stats {
+		util.AssertExpected(t, i, st.Shard)
+		util.AssertExpected(t, true, st.LongestPath >= 1)
+		util.AssertExpected(t, float64(st.Entries)/float64(st.Buckets), st.PercentFull)
+		entries += st.Entries
+	}
+	util.AssertExpected(t, 1000, entries)
+}
@@ -1,75 +1,172 @@
 package openaddr
 
-import "github.com/scottcagno/storage/pkg/hash/murmur3"
+import (
+	"fmt"
+	"github.com/scottcagno/storage/pkg/hash/murmur3"
+	"github.com/scottcagno/storage/pkg/hash/xxhash"
+	"math"
+)
+
+// Hasher is a type definition for what a hash function should look like.
+// Keys that are equal must have equal hashes.
+type Hasher[K comparable] func(key K) uint64
 
 // entry is a key value pair that is found in each bucket
-type entry struct {
-	key string
-	val []byte
+type entry[K comparable, V any] struct {
+	key K
+	val V
 }
 
-// bucket represents a single slot in the HashMap table
-type bucket struct {
-	dib     uint8
+// bucket represents a single slot in the HashMap table. A dib of zero
+// means the bucket is empty
+type bucket[K comparable, V any] struct {
+	dib     uint32
 	hashkey uint64
-	entry
+	entry[K, V]
 }
 
 // checkHashAndKey checks if this bucket matches the specified hashkey and key
-func (b *bucket) checkHashAndKey(hashkey uint64, key string) bool {
+func (b *bucket[K, V]) checkHashAndKey(hashkey uint64, key K) bool {
 	return b.hashkey == hashkey && b.entry.key == key
 }
 
-// HashMap represents a closed hashing hashtable implementation
-type HashMap struct {
-	hash    hashFunc
+// HashMap represents a closed hashing hashtable implementation using robin
+// hood hashing. Entries are removed using backward shift deletion, so the
+// table never contains any tombstones. The table doubles in size when the
+// load factor reaches DefaultLoadFactor, and shrinks again when enough
+// entries are removed (but never below the size it was created with). A
+// HashMap is not safe for concurrent use.
+type HashMap[K comparable, V any] struct {
+	hash    Hasher[K]
 	mask    uint64
 	expand  uint
 	shrink  uint
 	keys    uint
 	size    uint
-	buckets []bucket
+	buckets []bucket[K, V]
+}
+
+// New returns a new HashMap instantiated with the specified size or the
+// DefaultMapSize, whichever is larger, which uses the provided hasher. If
+// hash is nil, a default hasher is used; it supports any key whose kind is
+// a string, a number or a bool, and falls back to hashing the formatted
+// key otherwise, so a hasher should be provided for other key types.
+func New[K comparable, V any](size uint, hash Hasher[K]) *HashMap[K, V] {
+	if hash == nil {
+		hash = DefaultHasher[K]()
+	}
+	return newHashMap[K, V](size, hash)
 }
 
-// defaultHashFunc is the default hashFunc used. This is here mainly as
-// a convenience for the sharded hashmap to utilize
+// NewHashMap returns a new HashMap of strings to byte slices instantiated
+// with the specified size or the DefaultMapSize, whichever is larger
+func NewHashMap(size uint) *HashMap[string, []byte] {
+	return newHashMap[string, []byte](size, defaultHashFunc)
+}
+
+// defaultHashFunc is the default hash function used for string keys.
+// This is here mainly as a convenience for the sharded hashmap to utilize
 func defaultHashFunc(key string) uint64 {
 	return murmur3.Sum64([]byte(key))
 }
 
-// hashFunc is a type definition for what a hash function should look like
-type hashFunc func(key string) uint64
+// DefaultHasher returns a hasher for keys of type K. Strings, numbers and
+// bools are hashed directly, and any other key is hashed by formatting it
+func DefaultHasher[K comparable]() Hasher[K] {
+	var h interface{}
+	switch any(*new(K)).(type) {
+	case string:
+		h = Hasher[string](func(k string) uint64 { return xxhash.Sum64([]byte(k)) })
+	case int:
+		h = Hasher[int](func(k int) uint64 { return mix64(uint64(k)) })
+	case int8:
+		h = Hasher[int8](func(k int8) uint64 { return mix64(uint64(k)) })
+	case int16:
+		h = Hasher[int16](func(k int16) uint64 { return mix64(uint64(k)) })
+	case int32:
+		h = Hasher[int32](func(k int32) uint64 { return mix64(uint64(k)) })
+	case int64:
+		h = Hasher[int64](func(k int64) uint64 { return mix64(uint64(k)) })
+	case uint:
+		h = Hasher[uint](func(k uint) uint64 { return mix64(uint64(k)) })
+	case uint8:
+		h = Hasher[uint8](func(k uint8) uint64 { return mix64(uint64(k)) })
+	case uint16:
+		h = Hasher[uint16](func(k uint16) uint64 { return mix64(uint64(k)) })
+	case uint32:
+		h = Hasher[uint32](func(k uint32) uint64 { return mix64(uint64(k)) })
+	case uint64:
+		h = Hasher[uint64](mix64)
+	case uintptr:
+		h = Hasher[uintptr](func(k uintptr) uint64 { return mix64(uint64(k)) })
+	case float32:
+		h = Hasher[float32](func(k float32) uint64 { return mix64(floatBits(float64(k))) })
+	case float64:
+		h = Hasher[float64](func(k float64) uint64 { return mix64(floatBits(k)) })
+	case bool:
+		h = Hasher[bool](func(k bool) uint64 {
+			if k {
+				return mix64(1)
+			}
+			return mix64(0)
+		})
+	default:
+		return func(k K) uint64 {
+			return xxhash.Sum64([]byte(fmt.Sprintf("%T:%v", k, k)))
+		}
+	}
+	return h.(Hasher[K])
+}
+
+// mix64 scrambles the bits of an integer key (this is the finalizer of
+// the 64-bit murmur3 hash)
+func mix64(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
 
-// NewHashMap returns a new HashMap instantiated with the specified size or
-// the DefaultMapSize, whichever is larger
-func NewHashMap(size uint) *HashMap {
-	return newHashMap(size, defaultHashFunc)
+// floatBits returns the bits of f, making sure that zero and negative
+// zero (which are equal) have the same bits
+func floatBits(f float64) uint64 {
+	if f == 0 {
+		return 0
+	}
+	return math.Float64bits(f)
 }
 
-// newHashMap is the internal variant of the previous function
+// newHashMap is the internal variant of the previous functions
 // and is mainly used internally
-func newHashMap(size uint, hash hashFunc) *HashMap {
+func newHashMap[K comparable, V any](size uint, hash Hasher[K]) *HashMap[K, V] {
 	bukCnt := alignBucketCount(size)
-	if hash == nil {
-		hash = defaultHashFunc
-	}
-	m := &HashMap{
+	m := &HashMap[K, V]{
 		hash:    hash,
 		mask:    bukCnt - 1, // this minus one is extremely important for using a mask over modulo
 		expand:  uint(float64(bukCnt) * DefaultLoadFactor),
 		shrink:  uint(float64(bukCnt) * (1 - DefaultLoadFactor)),
 		keys:    0,
 		size:    size,
-		buckets: make([]bucket, bukCnt),
+		buckets: make([]bucket[K, V], bukCnt),
 	}
 	return m
 }
 
+// init makes sure a zero value HashMap can be used
+func (m *HashMap[K, V]) init() {
+	if m.hash == nil {
+		m.hash = DefaultHasher[K]()
+	}
+	*m = *newHashMap[K, V](m.size, m.hash)
+}
+
 // resize grows or shrinks the HashMap by the newSize provided. It makes a
 // new map with the new size, copies everything over, and then frees the old map
-func (m *HashMap) resize(newSize uint) {
-	newHM := newHashMap(newSize, m.hash)
-	var buk bucket
+func (m *HashMap[K, V]) resize(newSize uint) {
+	newHM := newHashMap[K, V](newSize, m.hash)
+	var buk bucket[K, V]
 	for i := 0; i < len(m.buckets); i++ {
 		buk = m.buckets[i]
 		if buk.dib > 0 {
@@ -83,29 +180,30 @@ func (m *HashMap) resize(newSize uint) {
 
 // Get returns a value for a given key, or returns false if none could be found
 // Get can be considered the exported version of the lookup call
-func (m *HashMap) Get(key string) ([]byte, bool) {
-	return m.lookup(0, key)
+func (m *HashMap[K, V]) Get(key K) (V, bool) {
+	if len(m.buckets) == 0 {
+		var zero V
+		return zero, false
+	}
+	return m.lookup(m.hash(key), key)
 }
 
 // lookup returns a value for a given key, or returns false if none could be found
-func (m *HashMap) lookup(hashkey uint64, key string) ([]byte, bool) {
+func (m *HashMap[K, V]) lookup(hashkey uint64, key K) (V, bool) {
+	var zero V
 	// check if map is empty
 	if len(m.buckets) == 0 {
-		// hopefully this should never really happen
-		// do we really need to check this here?
-		*m = *newHashMap(DefaultMapSize, m.hash)
-	}
-	if hashkey == 0 {
-		// calculate the hashkey value
-		hashkey = m.hash(key)
+		return zero, false
 	}
 	// mask the hashkey to get the initial index
 	i := hashkey & m.mask
 	// search the position linearly
-	for {
-		// havent located anything
-		if m.buckets[i].dib == 0 {
-			return nil, false
+	for dib := uint32(1); ; dib++ {
+		// havent located anything; if the entry here is closer to its
+		// initial bucket than we are to ours, our key would have taken
+		// this bucket when it was inserted, so it can't be in the map
+		if m.buckets[i].dib < dib {
+			return zero, false
 		}
 		// check for matching hashes and keys
 		if m.buckets[i].checkHashAndKey(hashkey, key) {
@@ -118,37 +216,36 @@ func (m *HashMap) lookup(hashkey uint64, key string) ([]byte, bool) {
 
 // Set inserts a key value entry and returns the previous value or false
 // Set can be considered the exported version of the insert call
-func (m *HashMap) Set(key string, value []byte) ([]byte, bool) {
-	return m.insert(0, key, value)
+func (m *HashMap[K, V]) Set(key K, value V) (V, bool) {
+	if len(m.buckets) == 0 {
+		m.init()
+	}
+	return m.insert(m.hash(key), key, value)
 }
 
 // insert inserts a key value entry and returns the previous value, or false
-func (m *HashMap) insert(hashkey uint64, key string, value []byte) ([]byte, bool) {
+func (m *HashMap[K, V]) insert(hashkey uint64, key K, value V) (V, bool) {
 	// check if map is empty
 	if len(m.buckets) == 0 {
 		// create a new map with default size
-		*m = *newHashMap(DefaultMapSize, m.hash)
+		m.init()
 	}
 	// check and see if we need to resize
 	if m.keys >= m.expand {
 		// if we do, then double the map size
 		m.resize(uint(len(m.buckets)) * 2)
 	}
-	if hashkey == 0 {
-		// calculate the hashkey value
-		hashkey = m.hash(key)
-	}
 	// call the internal insert to insert the entry
 	return m.insertInternal(hashkey, key, value)
 }
 
 // insertInternal inserts a key value entry and returns the previous value, or false
-func (m *HashMap) insertInternal(hashkey uint64, key string, value []byte) ([]byte, bool) {
+func (m *HashMap[K, V]) insertInternal(hashkey uint64, key K, value V) (V, bool) {
 	// create a new entry to insert
-	newb := bucket{
+	newb := bucket[K, V]{
 		dib:     1,
 		hashkey: hashkey,
-		entry: entry{
+		entry: entry[K, V]{
 			key: key,
 			val: value,
 		},
@@ -162,7 +259,8 @@ func (m *HashMap) insertInternal(hashkey uint64, key string, value []byte) ([]by
 			m.buckets[i] = newb
 			m.keys++
 			// no previous value to return, as this is a new entry
-			return nil, false
+			var zero V
+			return zero, false
 		}
 		// found existing entry, check hashes and keys
 		if m.buckets[i].checkHashAndKey(newb.hashkey, newb.entry.key) {
@@ -187,28 +285,29 @@ func (m *HashMap) insertInternal(hashkey uint64, key string, value []byte) ([]by
 
 // Del removes a value for a given key and returns the deleted value, or false
 // Del can be considered the exported version of the delete call
-func (m *HashMap) Del(key string) ([]byte, bool) {
-	return m.delete(0, key)
+func (m *HashMap[K, V]) Del(key K) (V, bool) {
+	if len(m.buckets) == 0 {
+		var zero V
+		return zero, false
+	}
+	return m.delete(m.hash(key), key)
 }
 
 // delete removes a value for a given key and returns the deleted value, or false
-func (m *HashMap) delete(hashkey uint64, key string) ([]byte, bool) {
+func (m *HashMap[K, V]) delete(hashkey uint64, key K) (V, bool) {
+	var zero V
 	// check if map is empty
 	if len(m.buckets) == 0 {
 		// nothing to see here folks
-		return nil, false
-	}
-	if hashkey == 0 {
-		// calculate the hashkey value
-		hashkey = m.hash(key)
+		return zero, false
 	}
 	// mask the hashkey to get the initial index
 	i := hashkey & m.mask
 	// search the position linearly
-	for {
+	for dib := uint32(1); ; dib++ {
 		// havent located anything
-		if m.buckets[i].dib == 0 {
-			return nil, false
+		if m.buckets[i].dib < dib {
+			return zero, false
 		}
 		// found existing entry, check hashes and keys
 		if m.buckets[i].checkHashAndKey(hashkey, key) {
@@ -218,24 +317,20 @@ func (m *HashMap) delete(hashkey uint64, key string) ([]byte, bool) {
 			return oldval, true
 		}
 		// keep on probing until we find what we're looking for.
-		// increase our search index by one as well as our new
-		// entry's dib, then continue with the linear probe.
 		i = (i + 1) & m.mask
 	}
 }
 
-// delete removes a value for a given key and returns the deleted value, or false
-func (m *HashMap) deleteInternal(i uint64) {
-	// set dib at bucket i
-	m.buckets[i].dib = 0
-	// tombstone index and shift
+// deleteInternal removes the entry at index i by shifting the entries that
+// follow it back by one, until an empty bucket or an entry that is in its
+// initial bucket is found. This way no tombstones are needed.
+func (m *HashMap[K, V]) deleteInternal(i uint64) {
 	for {
 		pi := i
 		i = (i + 1) & m.mask
 		if m.buckets[i].dib <= 1 {
 			// im as free as a bird now!
-			m.buckets[pi].entry = *new(entry)
-			m.buckets[pi] = *new(bucket)
+			m.buckets[pi] = bucket[K, V]{}
 			break
 		}
 		// shift
@@ -245,19 +340,21 @@ func (m *HashMap) deleteInternal(i uint64) {
 	// decrement entry count
 	m.keys--
 	// check and see if we need to resize
-	if m.keys <= m.shrink && uint(len(m.buckets)) > m.size {
-		// if it checks out, then resize down by 25%-ish
-		m.resize(m.keys)
+	if m.keys <= m.shrink && uint64(len(m.buckets)) > alignBucketCount(m.size) {
+		// if it checks out, then resize down to a table that
+		// is about half full (but not below the initial size)
+		newSize := m.keys * 2
+		if newSize < m.size {
+			newSize = m.size
+		}
+		m.resize(newSize)
 	}
 }
 
-// Iterator is an iterator function type
-type Iterator func(key string, value []byte) bool
-
-// Range takes an Iterator and ranges the HashMap as long as long
+// Range takes an iterator function and ranges the HashMap as long as long
 // as the iterator function continues to be true. Range is not
 // safe to perform an insert or remove operation while ranging!
-func (m *HashMap) Range(it Iterator) {
+func (m *HashMap[K, V]) Range(it func(key K, value V) bool) {
 	for i := 0; i < len(m.buckets); i++ {
 		if m.buckets[i].dib < 1 {
 			continue
@@ -269,8 +366,8 @@ func (m *HashMap) Range(it Iterator) {
 }
 
 // GetHighestDIB returns the highest distance to initial bucket value in the table
-func (m *HashMap) GetHighestDIB() uint8 {
-	var hdib uint8
+func (m *HashMap[K, V]) GetHighestDIB() uint32 {
+	var hdib uint32
 	for i := 0; i < len(m.buckets); i++ {
 		if m.buckets[i].dib > hdib {
 			hdib = m.buckets[i].dib
@@ -280,22 +377,25 @@ func (m *HashMap) GetHighestDIB() uint8 {
 }
 
 // PercentFull returns the current load factor of the HashMap
-func (m *HashMap) PercentFull() float64 {
+func (m *HashMap[K, V]) PercentFull() float64 {
+	if len(m.buckets) == 0 {
+		return 0
+	}
 	return float64(m.keys) / float64(len(m.buckets))
 }
 
 // Len returns the number of entries currently in the HashMap
-func (m *HashMap) Len() int {
+func (m *HashMap[K, V]) Len() int {
 	return int(m.keys)
 }
 
 // Close closes and frees the current hashmap. Calling any method
 // on the HashMap after this will most likely result in a panic
-func (m *HashMap) Close() {
+func (m *HashMap[K, V]) Close() {
 	destroyMap(m)
 }
 
 // destroy does exactly what is sounds like it does
-func destroyMap(m *HashMap) {
+func destroyMap[K comparable, V any](m *HashMap[K, V]) {
 	m = nil
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/scottcagno/storage/pkg/bits"
 	"github.com/scottcagno/storage/pkg/util"
+	"math"
 	"math/rand"
 	"strconv"
 	"testing"
@@ -229,3 +230,245 @@ func TestHashMapMillionEntriesSize(t *testing.T) {
 	}
 	hm.Close()
 }
+
+type point struct {
+	x, y int
+}
+
+func hashPoint(p point) uint64 {
+	return uint64(p.x)*0x9e3779b97f4a7c15 ^ uint64(p.y)
+}
+
+func Test_HashMap_Generic(t *testing.T) {
+	hm := New[point, string](0, hashPoint)
+	for i := 0; i < 1000; i++ {
+		_, ok := hm.Set(point{i, -i}, strconv.Itoa(i))
+		util.AssertExpected(t, false, ok)
+	}
+	util.AssertExpected(t, 1000, hm.Len())
+	for i := 0; i < 1000; i++ {
+		v, ok := hm.Get(point{i, -i})
+		util.AssertExpected(t, true, ok)
+		util.AssertExpected(t, strconv.Itoa(i), v)
+	}
+	_, ok := hm.Get(point{-1, 1})
+	util.AssertExpected(t, false, ok)
+	old, ok := hm.Set(point{1, -1}, "one")
+	util.AssertExpected(t, true, ok)
+	util.AssertExpected(t, "1", old)
+	util.AssertExpected(t, 1000, hm.Len())
+	hm.Close()
+}
+
+func Test_HashMap_DefaultHasher(t *testing.T) {
+	hm := New[float64, int](0, nil)
+	hm.Set(0.0, 1)
+	v, ok := hm.Get(math.Copysign(0, -1))
+	util.AssertExpected(t, true, ok)
+	util.AssertExpected(t, 1, v)
+	// a zero value map is ready to use
+	var zm HashMap[int, int]
+	_, ok = zm.Get(1)
+	util.AssertExpected(t, false, ok)
+	zm.Set(1, 2)
+	v, ok = zm.Get(1)
+	util.AssertExpected(t, true, ok)
+	util.AssertExpected(t, 2, v)
+}
+
+func Test_HashMap_BadHasher(t *testing.T) {
+	// every key collides, so this only works if the
+	// probing and backward shift deletion are right
+	hm := New[int, int](0, func(int) uint64 { return 7 })
+	for i := 0; i < 300; i++ {
+		hm.Set(i, i)
+	}
+	util.AssertExpected(t, uint32(300), hm.GetHighestDIB())
+	for i := 0; i < 300; i += 2 {
+		_, ok := hm.Del(i)
+		util.AssertExpected(t, true, ok)
+	}
+	for i := 0; i < 300; i++ {
+		v, ok := hm.Get(i)
+		util.AssertExpected(t, i%2 == 1, ok)
+		if ok {
+			util.AssertExpected(t, i, v)
+		}
+	}
+	util.AssertExpected(t, uint32(150), hm.GetHighestDIB())
+}
+
+func Test_HashMap_Shrink(t *testing.T) {
+	hm := New[int, int](64, nil)
+	for i := 0; i < 10000; i++ {
+		hm.Set(i, i)
+	}
+	util.AssertExpected(t, true, hm.PercentFull() > 0.25)
+	for i := 0; i < 9990; i++ {
+		hm.Del(i)
+	}
+	util.AssertExpected(t, 10, hm.Len())
+	// the table shrinks back to its initial size
+	util.AssertExpected(t, 64, len(hm.buckets))
+	for i := 9990; i < 10000; i++ {
+		v, ok := hm.Get(i)
+		util.AssertExpected(t, true, ok)
+		util.AssertExpected(t, i, v)
+	}
+}
+
+func Test_HashMap_Random(t *testing.T) {
+	// compare against the builtin map
+	hm := New[uint32, int](0, nil)
+	bm := make(map[uint32]int)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200000; i++ {
+		k := uint32(r.Intn(5000))
+		switch r.Intn(3) {
+		case 0, 1:
+			old, ok := hm.Set(k, i)
+			bold, bok := bm[k]
+			bm[k] = i
+			util.AssertExpected(t, bok, ok)
+			util.AssertExpected(t, bold, old)
+		case 2:
+			old, ok := hm.Del(k)
+			bold, bok := bm[k]
+			delete(bm, k)
+			util.AssertExpected(t, bok, ok)
+			util.AssertExpected(t, bold, old)
+		}
+	}
+	util.AssertExpected(t, len(bm), hm.Len())
+	var counted int
+	hm.Range(func(k uint32, v int) bool {
+		util.AssertExpected(t, bm[k], v)
+		counted++
+		return true
+	})
+	util.AssertExpected(t, len(bm), counted)
+}
+
+const benchKeys = 1 << 16
+
+func benchStrings() []string {
+	keys := make([]string, benchKeys)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+func BenchmarkHashMap_SetU64(b *testing.B) {
+	b.ReportAllocs()
+	hm := New[uint64, uint64](0, nil)
+	for n := 0; n < b.N; n++ {
+		hm.Set(uint64(n&(benchKeys-1)), uint64(n))
+	}
+}
+
+func BenchmarkBuiltinMap_SetU64(b *testing.B) {
+	b.ReportAllocs()
+	bm := make(map[uint64]uint64)
+	for n := 0; n < b.N; n++ {
+		bm[uint64(n&(benchKeys-1))] = uint64(n)
+	}
+}
+
+func BenchmarkHashMap_GetU64(b *testing.B) {
+	hm := New[uint64, uint64](0, nil)
+	for i := uint64(0); i < benchKeys; i++ {
+		hm.Set(i, i)
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	var v uint64
+	for n := 0; n < b.N; n++ {
+		v, _ = hm.Get(uint64(n & (benchKeys - 1)))
+	}
+	result = v
+}
+
+func BenchmarkBuiltinMap_GetU64(b *testing.B) {
+	bm := make(map[uint64]uint64)
+	for i := uint64(0); i < benchKeys; i++ {
+		bm[i] = i
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	var v uint64
+	for n := 0; n < b.N; n++ {
+		v = bm[uint64(n&(benchKeys-1))]
+	}
+	result = v
+}
+
+func BenchmarkHashMap_SetString(b *testing.B) {
+	keys := benchStrings()
+	hm := New[string, int](0, nil)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		hm.Set(keys[n&(benchKeys-1)], n)
+	}
+}
+
+func BenchmarkBuiltinMap_SetString(b *testing.B) {
+	keys := benchStrings()
+	bm := make(map[string]int)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		bm[keys[n&(benchKeys-1)]] = n
+	}
+}
+
+func BenchmarkHashMap_GetString(b *testing.B) {
+	keys := benchStrings()
+	hm := New[string, int](0, nil)
+	for i, k := range keys {
+		hm.Set(k, i)
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	var v int
+	for n := 0; n < b.N; n++ {
+		v, _ = hm.Get(keys[n&(benchKeys-1)])
+	}
+	result = v
+}
+
+func BenchmarkBuiltinMap_GetString(b *testing.B) {
+	keys := benchStrings()
+	bm := make(map[string]int)
+	for i, k := range keys {
+		bm[k] = i
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	var v int
+	for n := 0; n < b.N; n++ {
+		v = bm[keys[n&(benchKeys-1)]]
+	}
+	result = v
+}
+
+func BenchmarkHashMap_Del(b *testing.B) {
+	hm := New[uint64, uint64](0, nil)
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		k := uint64(n & (benchKeys - 1))
+		hm.Set(k, k)
+		hm.Del(k ^ (benchKeys >> 1))
+	}
+}
+
+func BenchmarkBuiltinMap_Del(b *testing.B) {
+	bm := make(map[uint64]uint64)
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		k := uint64(n & (benchKeys - 1))
+		bm[k] = k
+		delete(bm, k^(benchKeys>>1))
+	}
+}
@@ -11,12 +11,12 @@ import (
 
 type shard struct {
 	mu sync.RWMutex
-	hm *HashMap // rhh
+	hm *HashMap[string, []byte] // rhh
 }
 
 type ShardedHashMap struct {
 	mask   uint64
-	hash   hashFunc
+	hash   Hasher[string]
 	shards []*shard
 }
 
@@ -26,7 +26,7 @@ func NewShardedHashMap(size uint) *ShardedHashMap {
 	return newShardedHashMap(size, defaultHashFunc)
 }
 
-func newShardedHashMap(size uint, fn hashFunc) *ShardedHashMap {
+func newShardedHashMap(size uint, fn Hasher[string]) *ShardedHashMap {
 	shCount := alignShardCount(size)
 	if fn == nil {
 		fn = defaultHashFunc
@@ -40,7 +40,7 @@ func newShardedHashMap(size uint, fn hashFunc) *ShardedHashMap {
 	//log.Printf("new sharded hashmap with %d shards, each shard init with %d buckets\n", shCount, hmSize)
 	for i := range shm.shards {
 		shm.shards[i] = &shard{
-			hm: newHashMap(hmSize, fn),
+			hm: newHashMap[string, []byte](hmSize, fn),
 		}
 	}
 	return shm
@@ -175,7 +175,7 @@ func (s *ShardedHashMap) Len() int {
 	return length
 }
 
-func (s *ShardedHashMap) Range(it Iterator) {
+func (s *ShardedHashMap) Range(it func(key string, value []byte) bool) {
 	for i := range s.shards {
 		s.shards[i].mu.Lock()
 		s.shards[i].hm.Range(it)
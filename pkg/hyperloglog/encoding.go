@@ -0,0 +1,98 @@
+package hyperloglog
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// The serialized format is a header followed by either the sparse
+// entries (4B each, sorted) or the dense registers (1B each). All
+// values are little endian.
+//
+//	+-------+---------+---+-------+----------+------+
+//	| magic | version | p | flags | reserved | n    |
+//	+-------+---------+---+-------+----------+------+
+//	   4B       1B     1B    1B       1B       4B
+//
+// The flags hold flagSparse if the sparse representation is in use, and
+// n is the number of sparse entries or dense registers that follow.
+const (
+	magic      = uint32(0x504c4c48) // "HLLP"
+	version    = uint8(1)
+	headerSize = 12
+	flagSparse = uint8(1)
+)
+
+var (
+	ErrBadFormat  = errors.New("hyperloglog: bad format")
+	ErrBadVersion = errors.New("hyperloglog: unsupported version")
+)
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface
+func (h *HyperLogLog) MarshalBinary() ([]byte, error) {
+	var data []byte
+	if h.sparse {
+		h.flush()
+	}
+	if h.sparse {
+		data = make([]byte, headerSize+4*len(h.list))
+		data[6] = flagSparse
+		binary.LittleEndian.PutUint32(data[8:12], uint32(len(h.list)))
+		for i, e := range h.list {
+			binary.LittleEndian.PutUint32(data[headerSize+4*i:], e)
+		}
+	} else {
+		data = make([]byte, headerSize+len(h.regs))
+		binary.LittleEndian.PutUint32(data[8:12], uint32(len(h.regs)))
+		copy(data[headerSize:], h.regs)
+	}
+	binary.LittleEndian.PutUint32(data[0:4], magic)
+	data[4] = version
+	data[5] = h.p
+	return data, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+// The data is copied, so it is safe to reuse it afterwards.
+func (h *HyperLogLog) UnmarshalBinary(data []byte) error {
+	if len(data) < headerSize || binary.LittleEndian.Uint32(data[0:4]) != magic {
+		return ErrBadFormat
+	}
+	if data[4] != version {
+		return ErrBadVersion
+	}
+	p, flags := data[5], data[6]
+	if p < MinPrecision || p > MaxPrecision || flags&^flagSparse != 0 {
+		return ErrBadFormat
+	}
+	n := int(binary.LittleEndian.Uint32(data[8:12]))
+	data = data[headerSize:]
+	nh := HyperLogLog{p: p, m: 1 << p, sparse: flags&flagSparse != 0}
+	if nh.sparse {
+		if len(data) != 4*n || uint32(n) > nh.m/4 {
+			return ErrBadFormat
+		}
+		nh.list = make([]uint32, n)
+		for i := range nh.list {
+			e := binary.LittleEndian.Uint32(data[4*i:])
+			// entries must be sorted, with one entry per index
+			if i > 0 && e>>sparseRhoBits <= nh.list[i-1]>>sparseRhoBits {
+				return ErrBadFormat
+			}
+			nh.list[i] = e
+		}
+	} else {
+		if len(data) != n || uint32(n) != nh.m {
+			return ErrBadFormat
+		}
+		nh.regs = make([]uint8, n)
+		copy(nh.regs, data)
+		for _, r := range nh.regs {
+			if int(r) > 65-int(p) {
+				return ErrBadFormat
+			}
+		}
+	}
+	*h = nh
+	return nil
+}
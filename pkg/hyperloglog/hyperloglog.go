@@ -0,0 +1,312 @@
+package hyperloglog
+
+import (
+	"errors"
+	"github.com/scottcagno/storage/pkg/hash/xxhash"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// HyperLogLog is a HyperLogLog++ cardinality estimator. It starts out
+// with a sparse representation, which is a sorted list of the hashes
+// truncated to sparsePrecision bits (plus the number of leading zeros
+// that follow them) and which is very accurate for small cardinalities.
+// Once the sparse list takes up more memory than the dense registers
+// would, it is converted to the dense representation, which holds one
+// register (a byte) per bucket. The cardinality is estimated using the
+// improved estimator by Otmar Ertl, which does not need the empirical
+// bias correction tables of the original HyperLogLog++ paper.
+//
+// A HyperLogLog is not safe for concurrent use.
+type HyperLogLog struct {
+	p      uint8    // precision; the number of index bits
+	m      uint32   // number of dense registers (2^p)
+	sparse bool     // sparse reports the representation in use
+	list   []uint32 // sorted sparse entries, one per sparse index
+	tmp    []uint32 // unsorted sparse entries, not yet merged into list
+	regs   []uint8  // dense registers
+}
+
+const (
+	MinPrecision = 4
+	MaxPrecision = 18
+
+	// sparsePrecision is the number of index bits used by the sparse
+	// representation. Each sparse entry holds the index in the upper bits
+	// and the number of leading zeros of the rest of the hash (plus one)
+	// in the bottom 6 bits.
+	sparsePrecision = 25
+	sparseRhoBits   = 6
+	sparseRhoMask   = 1<<sparseRhoBits - 1
+
+	// tmpSize is the number of entries that are collected in the
+	// temporary list before they are merged in to the sparse list
+	tmpSize = 1024
+)
+
+var (
+	ErrBadPrecision      = errors.New("hyperloglog: precision out of range")
+	ErrPrecisionMismatch = errors.New("hyperloglog: precisions do not match")
+)
+
+// NewHyperLogLog returns a new empty HyperLogLog with the provided precision,
+// which must be between MinPrecision and MaxPrecision. It will use 2^p bytes
+// once it switches to the dense representation, and the standard error of
+// the estimates will be roughly 1.04/sqrt(2^p); a precision of 14 uses 16 KB
+// and has an error of about 0.8%.
+func NewHyperLogLog(p uint8) (*HyperLogLog, error) {
+	if p < MinPrecision || p > MaxPrecision {
+		return nil, ErrBadPrecision
+	}
+	return &HyperLogLog{
+		p:      p,
+		m:      1 << p,
+		sparse: true,
+	}, nil
+}
+
+// Precision returns the precision of the HyperLogLog
+func (h *HyperLogLog) Precision() uint8 {
+	return h.p
+}
+
+// IsSparse reports whether the sparse representation is in use
+func (h *HyperLogLog) IsSparse() bool {
+	return h.sparse
+}
+
+// Add adds the hash of data to the HyperLogLog
+func (h *HyperLogLog) Add(data []byte) {
+	h.AddHash(xxhash.Sum64(data))
+}
+
+// AddHash adds a 64 bit hash value to the HyperLogLog. It can be used
+// to add values hashed with a different hash function than the one Add
+// uses, but the hashes must be well distributed and the same function
+// must be used for every HyperLogLog that is merged together.
+func (h *HyperLogLog) AddHash(x uint64) {
+	if !h.sparse {
+		idx, rho := denseEntry(x, h.p)
+		if rho > h.regs[idx] {
+			h.regs[idx] = rho
+		}
+		return
+	}
+	h.tmp = append(h.tmp, sparseEntry(x))
+	if len(h.tmp) >= tmpSize {
+		h.flush()
+	}
+}
+
+// denseEntry returns the register index and the value (the number of
+// leading zeros plus one) of the hash x in the dense representation
+func denseEntry(x uint64, p uint8) (uint32, uint8) {
+	idx := uint32(x >> (64 - p))
+	// the sentinel bit limits the leading zeros to 64-p
+	w := x<<p | 1<<(p-1)
+	return idx, uint8(bits.LeadingZeros64(w) + 1)
+}
+
+// sparseEntry returns the hash x encoded as a sparse entry
+func sparseEntry(x uint64) uint32 {
+	idx := uint32(x >> (64 - sparsePrecision))
+	w := x<<sparsePrecision | 1<<(sparsePrecision-1)
+	rho := uint32(bits.LeadingZeros64(w) + 1)
+	return idx<<sparseRhoBits | rho
+}
+
+// decodeSparse returns the dense register index and value of a sparse entry
+func decodeSparse(e uint32, p uint8) (uint32, uint8) {
+	sidx := e >> sparseRhoBits
+	idx := sidx >> (sparsePrecision - p)
+	// the bits of the sparse index that are not part of the dense index
+	// are the first bits of the dense value
+	extra := uint32(sparsePrecision - p)
+	rest := sidx & (1<<extra - 1)
+	if rest != 0 {
+		return idx, uint8(bits.LeadingZeros32(rest)-int(32-extra)) + 1
+	}
+	return idx, uint8(extra + e&sparseRhoMask)
+}
+
+// flush merges the temporary entries in to the sparse list, and switches
+// to the dense representation if the sparse list has grown too large
+func (h *HyperLogLog) flush() {
+	if len(h.tmp) == 0 {
+		return
+	}
+	h.list = mergeSparse(h.list, h.tmp)
+	h.tmp = h.tmp[:0]
+	// every sparse entry takes 4 bytes, and every register takes 1
+	if uint32(len(h.list)) > h.m/4 {
+		h.toDense()
+	}
+}
+
+// mergeSparse sorts the entries in b and merges them in to the sorted
+// list a, keeping only the entry with the highest value for each index
+func mergeSparse(a, b []uint32) []uint32 {
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+	out := make([]uint32, 0, len(a)+len(b))
+	add := func(e uint32) {
+		// entries are ordered by index then value, so the last
+		// entry with the same index has the highest value
+		if n := len(out); n > 0 && out[n-1]>>sparseRhoBits == e>>sparseRhoBits {
+			out[n-1] = e
+			return
+		}
+		out = append(out, e)
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] <= b[j] {
+			add(a[i])
+			i++
+		} else {
+			add(b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		add(a[i])
+	}
+	for ; j < len(b); j++ {
+		add(b[j])
+	}
+	return out
+}
+
+// toDense converts the HyperLogLog to the dense representation
+func (h *HyperLogLog) toDense() {
+	h.regs = make([]uint8, h.m)
+	h.addSparseToDense(h.list)
+	h.addSparseToDense(h.tmp)
+	h.list, h.tmp = nil, nil
+	h.sparse = false
+}
+
+// addSparseToDense adds the sparse entries to the dense registers
+func (h *HyperLogLog) addSparseToDense(entries []uint32) {
+	for _, e := range entries {
+		idx, rho := decodeSparse(e, h.p)
+		if rho > h.regs[idx] {
+			h.regs[idx] = rho
+		}
+	}
+}
+
+// Count returns the estimated number of distinct values that were added
+func (h *HyperLogLog) Count() uint64 {
+	if h.sparse {
+		h.flush()
+	}
+	if h.sparse {
+		// linear counting using the sparse precision
+		m := float64(uint64(1) << sparsePrecision)
+		n := float64(len(h.list))
+		return uint64(m*math.Log(m/(m-n)) + 0.5)
+	}
+	return h.estimate()
+}
+
+// estimate returns the estimate of the dense registers using the improved
+// raw estimator from "New cardinality estimation algorithms for
+// HyperLogLog sketches" by Otmar Ertl
+func (h *HyperLogLog) estimate() uint64 {
+	q := 64 - int(h.p)
+	counts := make([]int, q+2)
+	for _, r := range h.regs {
+		counts[r]++
+	}
+	m := float64(h.m)
+	z := m * tau(1-float64(counts[q+1])/m)
+	for k := q; k >= 1; k-- {
+		z = 0.5 * (z + float64(counts[k]))
+	}
+	z += m * sigma(float64(counts[0])/m)
+	alpha := 1 / (2 * math.Ln2)
+	return uint64(alpha*m*m/z + 0.5)
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if z == prev {
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if z == prev {
+			return z / 3
+		}
+	}
+}
+
+// Merge merges other in to h, so that h estimates the number of distinct
+// values added to either of them. Both must have the same precision.
+func (h *HyperLogLog) Merge(other *HyperLogLog) error {
+	if h.p != other.p {
+		return ErrPrecisionMismatch
+	}
+	if other.sparse {
+		if h.sparse {
+			h.tmp = append(h.tmp, other.list...)
+			h.tmp = append(h.tmp, other.tmp...)
+			h.flush()
+			return nil
+		}
+		h.addSparseToDense(other.list)
+		h.addSparseToDense(other.tmp)
+		return nil
+	}
+	if h.sparse {
+		h.toDense()
+	}
+	for i, r := range other.regs {
+		if r > h.regs[i] {
+			h.regs[i] = r
+		}
+	}
+	return nil
+}
+
+// Clone returns a copy of the HyperLogLog
+func (h *HyperLogLog) Clone() *HyperLogLog {
+	c := &HyperLogLog{
+		p:      h.p,
+		m:      h.m,
+		sparse: h.sparse,
+	}
+	if h.sparse {
+		c.list = append([]uint32(nil), h.list...)
+		c.tmp = append([]uint32(nil), h.tmp...)
+	} else {
+		c.regs = append([]uint8(nil), h.regs...)
+	}
+	return c
+}
+
+// Reset removes every value from the HyperLogLog
+func (h *HyperLogLog) Reset() {
+	h.sparse = true
+	h.list, h.tmp, h.regs = nil, nil, nil
+}
@@ -0,0 +1,118 @@
+package hyperloglog
+
+import (
+	"github.com/scottcagno/storage/pkg/util"
+	"math"
+	"strconv"
+	"testing"
+)
+
+const (
+	thousand = 1000
+	n        = 1
+)
+
+func key(i int) []byte {
+	return []byte("key-" + strconv.Itoa(i))
+}
+
+// relErr returns the relative error of the estimate
+func relErr(estimate uint64, actual int) float64 {
+	return math.Abs(float64(estimate)-float64(actual)) / float64(actual)
+}
+
+func TestNewHyperLogLog(t *testing.T) {
+	_, err := NewHyperLogLog(MinPrecision - 1)
+	util.AssertEqual(t, ErrBadPrecision, err)
+	_, err = NewHyperLogLog(MaxPrecision + 1)
+	util.AssertEqual(t, ErrBadPrecision, err)
+	h, err := NewHyperLogLog(14)
+	util.AssertNoError(t, err)
+	util.AssertEqual(t, uint64(0), h.Count())
+	util.AssertEqual(t, true, h.IsSparse())
+}
+
+func TestHyperLogLog_Count(t *testing.T) {
+	h, err := NewHyperLogLog(14)
+	util.AssertNoError(t, err)
+	// 4 standard errors for p=14
+	maxErr := 4 * 1.04 / math.Sqrt(1<<14)
+	count := 0
+	for _, size := range []int{10, 100, thousand, 10 * thousand, 100 * thousand, 1000 * thousand * n} {
+		for ; count < size; count++ {
+			h.Add(key(count))
+			// adding duplicates must not change the estimate
+			h.Add(key(count / 2))
+		}
+		est := h.Count()
+		if e := relErr(est, size); e > maxErr {
+			t.Errorf("size %d: estimated %d (error %.4f > %.4f)\n", size, est, e, maxErr)
+		}
+		// the sparse representation is nearly exact
+		if size <= 1000 && est != uint64(size) {
+			t.Errorf("size %d: sparse estimate %d\n", size, est)
+		}
+	}
+	util.AssertEqual(t, false, h.IsSparse())
+}
+
+func TestHyperLogLog_Merge(t *testing.T) {
+	for _, sizes := range [][2]int{{100, 200}, {100, 50 * thousand}, {50 * thousand, 100}, {50 * thousand, 80 * thousand}} {
+		a, _ := NewHyperLogLog(12)
+		b, _ := NewHyperLogLog(12)
+		// a holds [0, sizes[0]) and b holds [sizes[0]/2, sizes[0]/2+sizes[1])
+		for i := 0; i < sizes[0]; i++ {
+			a.Add(key(i))
+		}
+		for i := sizes[0] / 2; i < sizes[0]/2+sizes[1]; i++ {
+			b.Add(key(i))
+		}
+		err := a.Merge(b)
+		util.AssertNoError(t, err)
+		union := sizes[0]/2 + sizes[1]
+		if sizes[1] < sizes[0]/2 {
+			union = sizes[0]
+		}
+		if e := relErr(a.Count(), union); e > 4*1.04/math.Sqrt(1<<12) {
+			t.Errorf("merge %v: estimated %d, want about %d\n", sizes, a.Count(), union)
+		}
+	}
+	a, _ := NewHyperLogLog(12)
+	b, _ := NewHyperLogLog(13)
+	util.AssertEqual(t, ErrPrecisionMismatch, a.Merge(b))
+}
+
+func TestHyperLogLog_Clone(t *testing.T) {
+	h, _ := NewHyperLogLog(10)
+	for i := 0; i < 100; i++ {
+		h.Add(key(i))
+	}
+	c := h.Clone()
+	for i := 100; i < 10*thousand; i++ {
+		c.Add(key(i))
+	}
+	util.AssertEqual(t, uint64(100), h.Count())
+	util.AssertEqual(t, true, c.Count() > 9*thousand)
+}
+
+func TestHyperLogLog_Marshal(t *testing.T) {
+	for _, size := range []int{0, 100, 100 * thousand} {
+		h, _ := NewHyperLogLog(14)
+		for i := 0; i < size; i++ {
+			h.Add(key(i))
+		}
+		data, err := h.MarshalBinary()
+		util.AssertNoError(t, err)
+		h2 := new(HyperLogLog)
+		err = h2.UnmarshalBinary(data)
+		util.AssertNoError(t, err)
+		util.AssertEqual(t, h.IsSparse(), h2.IsSparse())
+		util.AssertEqual(t, h.Count(), h2.Count())
+		// the copy must keep working
+		h.Add([]byte("one more"))
+		h2.Add([]byte("one more"))
+		util.AssertEqual(t, h.Count(), h2.Count())
+	}
+	h := new(HyperLogLog)
+	util.AssertEqual(t, ErrBadFormat, h.UnmarshalBinary([]byte("not a sketch")))
+}
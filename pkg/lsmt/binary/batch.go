@@ -3,6 +3,7 @@ package binary
 import (
 	"bytes"
 	"fmt"
+	"sort"
 )
 
 type Batch struct {
@@ -45,3 +46,20 @@ func (b *Batch) Less(i, j int) bool {
 func (b *Batch) Swap(i, j int) {
 	b.Entries[i], b.Entries[j] = b.Entries[j], b.Entries[i]
 }
+
+// IsSortedWith reports whether the batch entries are sorted
+// according to the provided comparator
+func (b *Batch) IsSortedWith(cmp Comparator) bool {
+	return sort.SliceIsSorted(b.Entries, func(i, j int) bool {
+		return cmp.Compare(b.Entries[i].Key, b.Entries[j].Key) < 0
+	})
+}
+
+// SortWith sorts the batch entries according to the provided
+// comparator. The sort is stable, so entries with equal keys
+// stay in the order they were written
+func (b *Batch) SortWith(cmp Comparator) {
+	sort.SliceStable(b.Entries, func(i, j int) bool {
+		return cmp.Compare(b.Entries[i].Key, b.Entries[j].Key) < 0
+	})
+}
@@ -0,0 +1,55 @@
+package binary
+
+import "bytes"
+
+// Comparator defines the order of the keys. The name of the comparator
+// is persisted on disk when a store is created, and a store can only be
+// opened using a comparator with the same name, so the name should be
+// unique to the ordering it provides.
+type Comparator interface {
+
+	// Compare returns an integer comparing two keys. The result will
+	// be 0 if a == b, -1 if a < b, and +1 if a > b
+	Compare(a, b []byte) int
+
+	// Name returns the name of the comparator
+	Name() string
+}
+
+// BytewiseComparator orders the keys lexicographically by their
+// bytes. It is the default comparator.
+var BytewiseComparator Comparator = NewComparator("storage.BytewiseComparator", bytes.Compare)
+
+// ReverseBytewiseComparator orders the keys by their bytes, in reverse
+var ReverseBytewiseComparator Comparator = NewComparator("storage.ReverseBytewiseComparator",
+	func(a, b []byte) int {
+		return bytes.Compare(b, a)
+	})
+
+type comparator struct {
+	name    string
+	compare func(a, b []byte) int
+}
+
+// NewComparator returns a Comparator with the provided name which
+// uses the provided compare function to order the keys
+func NewComparator(name string, compare func(a, b []byte) int) Comparator {
+	return &comparator{
+		name:    name,
+		compare: compare,
+	}
+}
+
+func (c *comparator) Compare(a, b []byte) int {
+	return c.compare(a, b)
+}
+
+func (c *comparator) Name() string {
+	return c.name
+}
+
+// CompareKeys is a helper for comparing string
+// keys using the provided comparator
+func CompareKeys(cmp Comparator, a, b string) int {
+	return cmp.Compare([]byte(a), []byte(b))
+}
@@ -7,10 +7,59 @@ import (
 	"math"
 )
 
+// EntryType is the type of data entry
+type EntryType uint8
+
+const (
+	// EntryTypeValue is a regular entry. An entry of this
+	// type with a nil value is a tombstone (a deleted entry)
+	EntryTypeValue EntryType = iota
+
+	// EntryTypeMerge is a merge operand. Its value is combined
+	// with the older entries for the same key using a merge
+	// operator when the entry is read or compacted
+	EntryTypeMerge
+)
+
+// the entry type is encoded in the top byte of the key length
+const (
+	entryTypeShift = 56
+	entryKeyMask   = 1<<entryTypeShift - 1
+)
+
 // Entry is a key-value data entry
 type Entry struct {
 	Key   []byte
 	Value []byte
+	Type  EntryType
+}
+
+// IsMerge reports true if the entry is a merge operand
+func (de *Entry) IsMerge() bool {
+	return de.Type == EntryTypeMerge
+}
+
+// encodeKeyLength returns the key length with the entry type
+func encodeKeyLength(e *Entry) uint64 {
+	return uint64(len(e.Key)) | uint64(e.Type)<<entryTypeShift
+}
+
+// decodeKeyLength returns the key length and entry type
+func decodeKeyLength(n uint64) (uint64, EntryType) {
+	return n & entryKeyMask, EntryType(n >> entryTypeShift)
+}
+
+// makeEntry returns an entry to decode data into. A
+// zero length value is a tombstone, and decodes as nil
+func makeEntry(klen, vlen uint64, typ EntryType) *Entry {
+	e := &Entry{
+		Key:  make([]byte, klen),
+		Type: typ,
+	}
+	if vlen > 0 {
+		e.Value = make([]byte, vlen)
+	}
+	return e
 }
 
 // CheckSize take a maximum key and maximum value size and
@@ -38,6 +87,21 @@ func (de *Entry) Size() int {
 
 }
 
+// AppendEntry appends the encoded entry to the provided
+// buffer and returns the extended buffer. It uses the same
+// layout as EncodeEntry, so the result can be decoded with
+// DecodeEntry or DecodeEntryAt
+func AppendEntry(buf []byte, e *Entry) []byte {
+	var hdr [16]byte
+	// encode entry key and value length
+	binary.LittleEndian.PutUint64(hdr[0:8], encodeKeyLength(e))
+	binary.LittleEndian.PutUint64(hdr[8:16], uint64(len(e.Value)))
+	// append header, key and value
+	buf = append(buf, hdr[:]...)
+	buf = append(buf, e.Key...)
+	return append(buf, e.Value...)
+}
+
 // EncodeEntry writes the provided entry to the writer provided
 func EncodeEntry(w io.WriteSeeker, e *Entry) (int64, error) {
 	// error check
@@ -52,7 +116,7 @@ func EncodeEntry(w io.WriteSeeker, e *Entry) (int64, error) {
 	// make buffer
 	buf := make([]byte, 16)
 	// encode and write entry key length
-	binary.LittleEndian.PutUint64(buf[0:8], uint64(len(e.Key)))
+	binary.LittleEndian.PutUint64(buf[0:8], encodeKeyLength(e))
 	_, err = w.Write(buf[0:8])
 	if err != nil {
 		return -1, err
@@ -90,24 +154,23 @@ func DecodeEntry(r io.Reader) (*Entry, error) {
 	if err != nil {
 		return nil, err
 	}
-	// decode key length
-	klen := binary.LittleEndian.Uint64(buf[0:8])
+	// decode key length and entry type
+	klen, typ := decodeKeyLength(binary.LittleEndian.Uint64(buf[0:8]))
 	// decode value length
 	vlen := binary.LittleEndian.Uint64(buf[8:16])
 	// make entry to read data into
-	e := &Entry{
-		Key:   make([]byte, klen),
-		Value: make([]byte, vlen),
-	}
+	e := makeEntry(klen, vlen, typ)
 	// read key from data into entry key
 	_, err = r.Read(e.Key)
 	if err != nil {
 		return nil, err
 	}
-	// read value key from data into entry value
-	_, err = r.Read(e.Value)
-	if err != nil {
-		return nil, err
+	// read value key from data into entry value (if it has one)
+	if e.Value != nil {
+		_, err = r.Read(e.Value)
+		if err != nil {
+			return nil, err
+		}
 	}
 	// return entry
 	return e, nil
@@ -131,15 +194,12 @@ func DecodeEntryAt(r io.ReaderAt, offset int64) (*Entry, error) {
 	}
 	// update offset for reading key data a bit below
 	offset += int64(n)
-	// decode key length
-	klen := binary.LittleEndian.Uint64(buf[0:8])
+	// decode key length and entry type
+	klen, typ := decodeKeyLength(binary.LittleEndian.Uint64(buf[0:8]))
 	// decode value length
 	vlen := binary.LittleEndian.Uint64(buf[8:16])
 	// make entry to read data into
-	e := &Entry{
-		Key:   make([]byte, klen),
-		Value: make([]byte, vlen),
-	}
+	e := makeEntry(klen, vlen, typ)
 	// read key from data into entry key
 	n, err = r.ReadAt(e.Key, offset)
 	if err != nil {
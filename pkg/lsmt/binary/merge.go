@@ -0,0 +1,117 @@
+package binary
+
+import "encoding/binary"
+
+// MergeOperator combines merge operands with the existing value for a key.
+// It allows read-modify-write operations (counters, append-only lists and
+// so on) to be written without reading the existing value first.
+type MergeOperator interface {
+
+	// Name returns the name of the merge operator
+	Name() string
+
+	// FullMerge applies the operands (oldest first) to the existing value
+	// and returns the result. The existing value is nil if the key does not
+	// exist (or it was deleted.) It returns false if the merge failed.
+	FullMerge(key, existing []byte, operands [][]byte) ([]byte, bool)
+
+	// PartialMerge combines two operands (the left one being the older of
+	// the two) in to a single operand. It returns false if the operands
+	// cannot be combined without knowing the existing value.
+	PartialMerge(key, left, right []byte) ([]byte, bool)
+}
+
+// EncodeInt64 encodes the provided value for use with the Int64AddOperator
+func EncodeInt64(v int64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(v))
+	return b
+}
+
+// DecodeInt64 decodes a value encoded using EncodeInt64. It
+// returns false if the provided data is not a valid int64
+func DecodeInt64(b []byte) (int64, bool) {
+	if len(b) != 8 {
+		return 0, false
+	}
+	return int64(binary.LittleEndian.Uint64(b)), true
+}
+
+// Int64AddOperator treats the values and the operands as (little endian)
+// encoded int64's, see EncodeInt64, and adds the operands to the value.
+// A key that does not exist has a value of zero.
+var Int64AddOperator MergeOperator = int64AddOperator{}
+
+type int64AddOperator struct{}
+
+func (int64AddOperator) Name() string {
+	return "storage.Int64AddOperator"
+}
+
+func (int64AddOperator) FullMerge(key, existing []byte, operands [][]byte) ([]byte, bool) {
+	var sum int64
+	if existing != nil {
+		v, ok := DecodeInt64(existing)
+		if !ok {
+			return nil, false
+		}
+		sum = v
+	}
+	for _, op := range operands {
+		v, ok := DecodeInt64(op)
+		if !ok {
+			return nil, false
+		}
+		sum += v
+	}
+	return EncodeInt64(sum), true
+}
+
+func (int64AddOperator) PartialMerge(key, left, right []byte) ([]byte, bool) {
+	l, ok := DecodeInt64(left)
+	if !ok {
+		return nil, false
+	}
+	r, ok := DecodeInt64(right)
+	if !ok {
+		return nil, false
+	}
+	return EncodeInt64(l + r), true
+}
+
+// BytesAppendOperator appends the operands to the value
+var BytesAppendOperator = NewBytesAppendOperator(nil)
+
+// NewBytesAppendOperator returns a merge operator that appends the
+// operands to the value, separated using the provided delimiter
+func NewBytesAppendOperator(delim []byte) MergeOperator {
+	return &bytesAppendOperator{
+		delim: delim,
+	}
+}
+
+type bytesAppendOperator struct {
+	delim []byte
+}
+
+func (o *bytesAppendOperator) Name() string {
+	return "storage.BytesAppendOperator"
+}
+
+func (o *bytesAppendOperator) FullMerge(key, existing []byte, operands [][]byte) ([]byte, bool) {
+	b := append([]byte(nil), existing...)
+	for _, op := range operands {
+		if len(b) > 0 {
+			b = append(b, o.delim...)
+		}
+		b = append(b, op...)
+	}
+	return b, true
+}
+
+func (o *bytesAppendOperator) PartialMerge(key, left, right []byte) ([]byte, bool) {
+	b := make([]byte, 0, len(left)+len(o.delim)+len(right))
+	b = append(b, left...)
+	b = append(b, o.delim...)
+	return append(b, right...), true
+}
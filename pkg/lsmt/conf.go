@@ -2,6 +2,7 @@ package lsmt
 
 import (
 	"encoding/json"
+	"github.com/scottcagno/storage/pkg/lsmt/binary"
 	"math"
 )
 
@@ -19,16 +20,22 @@ const (
 	defaultWalDir  = "log"
 	defaultSstDir  = "sst"
 
+	// mem-table
+	defaultMemtable = MemtableRBTree
+
 	// syncing
 	defaultSyncOnWrite  = false
 	defaultLoggingLevel = LevelError
 
 	// default sizes
 	defaultFlushThreshold  = 2 * SizeMB
-	defaultBloomFilterSize = 4 * SizeMB
+	defaultBloomFilterSize = 4 * SizeMB // in bits, so 512 KB
 	defaultMaxKeySize      = maxKeySizeAllowed
 	defaultMaxValueSize    = maxValueSizeAllowed
 
+	// the bloom filter is sized for this false positive rate
+	bloomFalsePositiveRate = 0.01
+
 	// minimum size bounds
 	minFlushThresholdAllowed  = maxValueSizeAllowed * 16
 	minBloomFilterSizeAllowed = minFlushThresholdAllowed
@@ -42,9 +49,52 @@ const (
 	maxValueSizeAllowed       = math.MaxUint16 // 65,535 B
 )
 
+// Comparator defines the order of the keys. It is used consistently by
+// the mem-table, the ss-table indexes, merges and range checks. The name
+// of the comparator is persisted when the lsm-tree is created, and opening
+// it again with a comparator that has a different name will fail.
+type Comparator = binary.Comparator
+
+var (
+	// BytewiseComparator orders the keys lexicographically by
+	// their bytes. It is the default comparator.
+	BytewiseComparator = binary.BytewiseComparator
+
+	// ReverseBytewiseComparator orders the keys by their bytes, in reverse
+	ReverseBytewiseComparator = binary.ReverseBytewiseComparator
+)
+
+// NewComparator returns a Comparator with the provided name
+// which uses the provided function to order the keys
+func NewComparator(name string, compare func(a, b []byte) int) Comparator {
+	return binary.NewComparator(name, compare)
+}
+
+// MemtableType specifies which mem-table implementation to use
+type MemtableType string
+
+const (
+	// MemtableRBTree is a red-black tree mem-table. Every read and
+	// write is synchronized using the lsm-tree lock.
+	MemtableRBTree MemtableType = "rbtree"
+
+	// MemtableSkipList is an arena-backed skiplist mem-table. Readers
+	// do not lock, so reads that are satisfied by the mem-table are
+	// never blocked by writes.
+	MemtableSkipList MemtableType = "skiplist"
+
+	// MemtablePersistent is a persistent (path-copying) red-black tree
+	// mem-table. Readers do not lock, and taking a snapshot of the
+	// mem-table is O(1) which allows long scans and exports to run
+	// against a frozen view while writes continue.
+	MemtablePersistent MemtableType = "persistent"
+)
+
 // default config
 var defaultLSMConfig = &LSMConfig{
 	BaseDir:         defaultBaseDir,
+	Memtable:        defaultMemtable,
+	Comparator:      BytewiseComparator,
 	SyncOnWrite:     defaultSyncOnWrite,
 	LoggingLevel:    defaultLoggingLevel,
 	FlushThreshold:  defaultFlushThreshold,
@@ -60,13 +110,17 @@ func DefaultConfig(path string) *LSMConfig {
 
 // LSMConfig holds configuration settings for an LSMTree instance
 type LSMConfig struct {
-	BaseDir         string   // base directory
-	SyncOnWrite     bool     // perform sync every time an entry is written
-	LoggingLevel    logLevel // enable logging
-	FlushThreshold  int64    // mem-table flush threshold
-	BloomFilterSize uint     // specify the bloom filter size
-	MaxKeySize      int64    // the max allowed key size
-	MaxValueSize    int64    // the maximum allowed value size
+	BaseDir         string        // base directory
+	Memtable        MemtableType  // mem-table implementation
+	Comparator      Comparator    `json:"-"` // key comparator (the name is persisted on disk)
+	MergeOperator   MergeOperator `json:"-"` // merge operator used by Merge (optional)
+	SyncOnWrite     bool          // perform sync every time an entry is written
+	LoggingLevel    logLevel      // enable logging
+	FlushThreshold  int64         // mem-table flush threshold
+	BloomFilterSize uint          // bloom filter size in bits (the number of keys it is sized for follows from it)
+	MaxKeySize      int64         // the max allowed key size
+	MaxValueSize    int64         // the maximum allowed value size
+	HotKeys         int           // number of hot keys to track in the stats (0 disables tracking)
 }
 
 func (conf *LSMConfig) String() string {
@@ -86,6 +140,14 @@ func checkLSMConfig(conf *LSMConfig) *LSMConfig {
 	if conf.BaseDir == *new(string) {
 		conf.BaseDir = defaultBaseDir
 	}
+	switch conf.Memtable {
+	case MemtableRBTree, MemtableSkipList, MemtablePersistent:
+	default:
+		conf.Memtable = defaultMemtable
+	}
+	if conf.Comparator == nil {
+		conf.Comparator = BytewiseComparator
+	}
 	if conf.LoggingLevel <= 0 {
 		conf.LoggingLevel = defaultLoggingLevel
 	}
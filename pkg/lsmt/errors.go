@@ -2,6 +2,7 @@ package lsmt
 
 import (
 	"errors"
+	"github.com/scottcagno/storage/pkg/lsmt/sstable"
 )
 
 var (
@@ -18,5 +19,11 @@ var (
 	ErrBadValue      = errors.New("lsmt: bad value")
 	ErrValueTooLarge = errors.New("lsmt: value too large")
 
-	ErrBadChecksum = errors.New("lsmt: bad checksum")
+	ErrBadChecksum        = errors.New("lsmt: bad checksum")
+	ErrComparatorMismatch = errors.New("lsmt: comparator does not match the one the data was written with")
+
+	ErrSnapshotNotSupported = errors.New("lsmt: mem-table does not support snapshots")
+
+	ErrNoMergeOperator = sstable.ErrNoMergeOperator
+	ErrMergeFailed     = sstable.ErrMergeFailed
 )
@@ -0,0 +1,51 @@
+package lsmt
+
+import (
+	"github.com/scottcagno/storage/pkg/countmin"
+)
+
+// HotKey is a frequently accessed key along with an estimate of the
+// number of times it was accessed recently
+type HotKey = countmin.Item
+
+const (
+	// hot key access counts are estimated by a count-min sketch that
+	// overestimates by at most 0.1% of all accesses (99% of the time)
+	hotKeyEpsilon = 0.001
+	hotKeyDelta   = 0.01
+
+	// the counts are halved every hotKeyDecay accesses,
+	// so the hot keys reflect the recent workload
+	hotKeyDecay = 1 << 18
+)
+
+// newHotKeys returns a tracker for the n most frequently accessed keys,
+// or nil if n is not positive (which disables tracking)
+func newHotKeys(n int) *countmin.TopK {
+	if n <= 0 {
+		return nil
+	}
+	sketch, err := countmin.NewCountMinSketchEP(hotKeyEpsilon, hotKeyDelta)
+	if err != nil {
+		return nil
+	}
+	sketch.SetDecay(hotKeyDecay)
+	return countmin.NewTopK(n, sketch)
+}
+
+// trackKey records an access of the key if hot keys are being tracked
+func (lsm *LSMTree) trackKey(k string) {
+	if lsm.hot != nil {
+		lsm.hot.Add([]byte(k))
+	}
+}
+
+// HotKeys returns the most frequently accessed keys (by Get and Put),
+// ordered from the most to the least frequent. It returns nil unless
+// LSMConfig.HotKeys is set.
+func (lsm *LSMTree) HotKeys() []HotKey {
+	if lsm.hot == nil {
+		return nil
+	}
+	return lsm.hot.Items()
+}
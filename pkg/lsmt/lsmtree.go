@@ -4,18 +4,23 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/scottcagno/storage/pkg/bloom"
+	"github.com/scottcagno/storage/pkg/countmin"
 	"github.com/scottcagno/storage/pkg/lsmt/binary"
 	"github.com/scottcagno/storage/pkg/lsmt/mtbl"
 	"github.com/scottcagno/storage/pkg/lsmt/sstable"
 	"github.com/scottcagno/storage/pkg/lsmt/wal"
 	"github.com/scottcagno/storage/pkg/util"
 	"hash/crc32"
+	"math"
 	"os"
 	"path/filepath"
 	"sync"
 )
 
-const version = "v1.7.0"
+// version is written to the checksum file. An lsm-tree written by v1.7.0
+// has its write-ahead commit log upgraded to the framed format when it is
+// opened, any other version mismatch returns ErrBadChecksum.
+const version = "v1.8.0"
 
 var Tombstone = []byte(nil)
 
@@ -26,9 +31,11 @@ type LSMTree struct {
 	sstbase string              // sstbase is the ss-table and index base filepath where data resides
 	lock    sync.RWMutex        // lock is a mutex that synchronizes access to the data
 	wacl    *wal.WAL            // wacl is the write-ahead commit log
-	memt    *mtbl.RBTree        // memt is the main mem-table (red-black tree) instance
+	memt    mtbl.Memtable       // memt is the main mem-table instance
+	lfmt    bool                // lfmt is set when the mem-table supports lock-free reads
 	sstm    *sstable.SSTManager // sstm is the sorted-strings table manager
 	bloom   *bloom.BloomFilter  // bloom is a bloom filter
+	hot     *countmin.TopK      // hot tracks the most frequently accessed keys (optional)
 	logger  *Logger             // logger is a logger for the lsm-tree
 }
 
@@ -43,8 +50,15 @@ func OpenLSMTree(c *LSMConfig) (*LSMTree, error) {
 	}
 	// sanitize any path separators
 	base = filepath.ToSlash(base)
-	// check for checksum file
-	err = checkChecksum(version, base)
+	// check the comparator name (this must happen before
+	// the checksum file is initialized for a new lsm-tree)
+	err = checkComparator(conf.Comparator.Name(), base)
+	if err != nil {
+		return nil, err
+	}
+	// check for checksum file (and upgrade an lsm-tree
+	// written by an older version, if it can be)
+	err = checkVersion(base, conf)
 	if err != nil {
 		return nil, err
 	}
@@ -70,19 +84,22 @@ func OpenLSMTree(c *LSMConfig) (*LSMTree, error) {
 		return nil, err
 	}
 	// open ss-table-manager
-	sstm, err := sstable.OpenSSTManager(sstbase)
+	sstm, err := sstable.OpenSSTManagerWithComparator(sstbase, conf.Comparator)
 	if err != nil {
 		return nil, err
 	}
+	sstm.SetMergeOperator(conf.MergeOperator)
 	// create lsm-tree instance and return
 	lsmt := &LSMTree{
 		conf:    conf,
 		walbase: walbase,
 		sstbase: sstbase,
 		wacl:    wacl,
-		memt:    mtbl.NewRBTree(),
+		memt:    newMemtable(conf.Memtable, conf.Comparator),
+		lfmt:    conf.Memtable == MemtableSkipList || conf.Memtable == MemtablePersistent,
 		sstm:    sstm,
-		bloom:   bloom.NewBloomFilter(conf.BloomFilterSize),
+		bloom:   newBloomFilter(conf.BloomFilterSize),
+		hot:     newHotKeys(conf.HotKeys),
 		logger:  NewLogger(conf.LoggingLevel),
 	}
 	// load mem-table with commit log data
@@ -99,6 +116,29 @@ func OpenLSMTree(c *LSMConfig) (*LSMTree, error) {
 	return lsmt, nil
 }
 
+// newBloomFilter returns a bloom filter of (about) size bits. It is sized
+// for as many keys as size bits can hold at the bloom filter false
+// positive rate.
+func newBloomFilter(size uint) *bloom.BloomFilter {
+	bitsPerKey := -math.Log(bloomFalsePositiveRate) / (math.Ln2 * math.Ln2)
+	n := uint(float64(size) / bitsPerKey)
+	// the false positive rate is always valid
+	bf, _ := bloom.NewBloomFilterFP(n, bloomFalsePositiveRate)
+	return bf
+}
+
+// newMemtable returns a new mem-table of the provided type
+func newMemtable(kind MemtableType, cmp Comparator) mtbl.Memtable {
+	switch kind {
+	case MemtableSkipList:
+		return mtbl.NewSkipListWithComparator(cmp)
+	case MemtablePersistent:
+		return mtbl.NewPRBTreeWithComparator(cmp)
+	default:
+		return mtbl.NewRBTreeWithComparator(cmp)
+	}
+}
+
 func CalcCRC(d []byte) uint32 {
 	return crc32.Checksum(d, crc32.MakeTable(crc32.Koopman))
 }
@@ -144,6 +184,46 @@ func checkChecksum(against, base string) error {
 	return nil
 }
 
+// checkComparator makes sure the lsm-tree is opened with the same comparator
+// (by name) that the data was written with. The name is written out when a
+// new lsm-tree is created. An existing lsm-tree without a comparator file was
+// created before comparators existed, so its keys are ordered bytewise.
+func checkComparator(name, base string) error {
+	// sanitize the path
+	path := filepath.Join(base, ".cmp.txt")
+	// check to see if the path is there
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		// if not, check for an existing lsm-tree
+		if _, err := os.Stat(filepath.Join(base, ".sum.txt")); err == nil {
+			if name != BytewiseComparator.Name() {
+				return ErrComparatorMismatch
+			}
+		}
+		// initialize it
+		err = os.MkdirAll(base, os.ModeDir)
+		if err != nil {
+			return err
+		}
+		// then write the comparator name out to a new file
+		err = os.WriteFile(path, []byte(name), 0666)
+		if err != nil {
+			return err
+		}
+		// return (nil is good)
+		return nil
+	}
+	// file exists, so lets read the comparator file
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if name != string(data) {
+		return ErrComparatorMismatch
+	}
+	// return (nil is good)
+	return nil
+}
+
 // loadFromWriteAheadCommitLog loads any entries from the
 // segmented write-ahead commit file back into the mem-table
 func (lsm *LSMTree) loadFromWriteAheadCommitLog() error {
@@ -153,11 +233,23 @@ func (lsm *LSMTree) loadFromWriteAheadCommitLog() error {
 	// log info
 	lsm.logger.Info("adding write-ahead log entries to mem-table")
 	// scan through the write-ahead log...
+	var merr error
 	err := lsm.wacl.Scan(func(e *binary.Entry) bool {
+		// merge operands are combined with the mem-table
+		// entry, just like they were when they were written
+		if e.IsMerge() {
+			e, merr = lsm.mergeWithMemtable(e)
+			if merr != nil {
+				return false
+			}
+		}
 		// ... and insert data back into the mem-table
 		lsm.memt.Put(e)
 		return true
 	})
+	if err == nil {
+		err = merr
+	}
 	if err != nil {
 		// log error
 		lsm.logger.Error("scanning write-ahead log: %s", err)
@@ -213,25 +305,14 @@ func (lsm *LSMTree) populateBloomFilter() error {
 	return nil
 }
 
-// cycleWAL closes the current (open) active write-ahead commit
-// log--removes all the files on disk and opens a fresh one
+// cycleWAL resets the current (open) active write-ahead commit
+// log--retiring all the segment files so they can be recycled
 func (lsm *LSMTree) cycleWAL() error {
 	// let's reset the write-ahead commit log
-	err := lsm.wacl.CloseAndRemove()
+	err := lsm.wacl.Reset()
 	if err != nil {
 		// log error
-		lsm.logger.Error("closing and removing write-ahead log: %s", err)
-		return err
-	}
-	// open a fresh write-ahead commit log
-	lsm.wacl, err = wal.OpenWAL(&wal.WALConfig{
-		BasePath:    lsm.walbase,
-		MaxFileSize: lsm.conf.FlushThreshold,
-		SyncOnWrite: lsm.conf.SyncOnWrite,
-	})
-	if err != nil {
-		// log error
-		lsm.logger.Error("opening fresh write-ahead log: %s", err)
+		lsm.logger.Error("resetting write-ahead log: %s", err)
 		return err
 	}
 	return nil
@@ -244,7 +325,7 @@ func (lsm *LSMTree) needFlush(memTableSize int64) error {
 	return nil
 }
 
-func (lsm *LSMTree) FlushToSSTableAndCycleWAL(memt *mtbl.RBTree) error {
+func (lsm *LSMTree) FlushToSSTableAndCycleWAL(memt mtbl.Memtable) error {
 	/*
 		// check err properly
 		if err != nil {
@@ -372,6 +453,8 @@ func (lsm *LSMTree) Put(k string, v []byte) error {
 	if err != nil {
 		return err
 	}
+	// record key access
+	lsm.trackKey(k)
 	// write entry to the write-ahead commit log
 	_, err = lsm.wacl.Write(e)
 	if err != nil {
@@ -403,14 +486,29 @@ func (lsm *LSMTree) Put(k string, v []byte) error {
 // key in the ss-index and if that yields no result it will try to
 // find the entry by doing a linear search of the ss-table itself.
 func (lsm *LSMTree) Get(k string) ([]byte, error) {
-	// read lock
-	lsm.lock.RLock()
-	defer lsm.lock.RUnlock()
 	// check key
 	err := checkKey([]byte(k), lsm.conf.MaxKeySize)
 	if err != nil {
 		return nil, err
 	}
+	// record key access
+	lsm.trackKey(k)
+	// if the mem-table supports lock-free reads, search
+	// it first, before we have to take the read lock
+	if lsm.lfmt {
+		e, found := lsm.memt.Get(&binary.Entry{Key: []byte(k)})
+		if found && !e.IsMerge() {
+			if e.Value == nil {
+				// found tombstone entry
+				return nil, ErrNotFound
+			}
+			// we found it!
+			return e.Value, nil
+		}
+	}
+	// read lock
+	lsm.lock.RLock()
+	defer lsm.lock.RUnlock()
 	// check bloom filter
 	if ok := lsm.bloom.MayHave([]byte(k)); !ok {
 		// definitely not in the lsm tree
@@ -419,6 +517,10 @@ func (lsm *LSMTree) Get(k string) ([]byte, error) {
 	// according to the bloom filter, it "may" be in
 	// tree, so lets start by searching the mem-table
 	e, found := lsm.memt.Get(&binary.Entry{Key: []byte(k)})
+	if found && e.IsMerge() {
+		// apply the merge operand(s) to the older entries
+		return lsm.resolveMerge(k, e)
+	}
 	if found && e.Value != nil {
 		// we found it!
 		return e.Value, nil
@@ -448,6 +550,10 @@ func (lsm *LSMTree) Get(k string) ([]byte, error) {
 			if de == nil || de.Value == nil {
 				return nil, ErrNotFound
 			}
+			// apply any merge operands to the older entries
+			if de.IsMerge() {
+				return lsm.resolveMerge(k, nil)
+			}
 			// otherwise, we found it homey!
 			return de.Value, nil
 		}
@@ -460,6 +566,10 @@ func (lsm *LSMTree) Get(k string) ([]byte, error) {
 	if de == nil || de.Value == nil {
 		return nil, ErrNotFound
 	}
+	// apply any merge operands to the older entries
+	if de.IsMerge() {
+		return lsm.resolveMerge(k, nil)
+	}
 	// may have found it
 	return de.Value, nil
 }
@@ -471,14 +581,27 @@ func (lsm *LSMTree) Get(k string) ([]byte, error) {
 // to do a linear search directly of the ss-table itself. It can be
 // a bit quicker [if you know that your data is not memory resident.]
 func (lsm *LSMTree) GetLinear(k string) ([]byte, error) {
-	// read lock
-	lsm.lock.RLock()
-	defer lsm.lock.RUnlock()
 	// check key
 	err := checkKey([]byte(k), lsm.conf.MaxKeySize)
 	if err != nil {
 		return nil, err
 	}
+	// if the mem-table supports lock-free reads, search
+	// it first, before we have to take the read lock
+	if lsm.lfmt {
+		e, found := lsm.memt.Get(&binary.Entry{Key: []byte(k)})
+		if found && !e.IsMerge() {
+			if e.Value == nil {
+				// found tombstone entry
+				return nil, ErrNotFound
+			}
+			// we found it!
+			return e.Value, nil
+		}
+	}
+	// read lock
+	lsm.lock.RLock()
+	defer lsm.lock.RUnlock()
 	// check bloom filter
 	if ok := lsm.bloom.MayHave([]byte(k)); !ok {
 		// definitely not in the lsm tree
@@ -487,6 +610,10 @@ func (lsm *LSMTree) GetLinear(k string) ([]byte, error) {
 	// according to the bloom filter, it "may" be in
 	// tree, so lets start by searching the mem-table
 	e, found := lsm.memt.Get(&binary.Entry{Key: []byte(k)})
+	if found && e.IsMerge() {
+		// apply the merge operand(s) to the older entries
+		return lsm.resolveMerge(k, e)
+	}
 	if found && e.Value != nil {
 		// we found it!
 		return e.Value, nil
@@ -509,6 +636,10 @@ func (lsm *LSMTree) GetLinear(k string) ([]byte, error) {
 	if de == nil || de.Value == nil {
 		return nil, ErrNotFound
 	}
+	// apply any merge operands to the older entries
+	if de.IsMerge() {
+		return lsm.resolveMerge(k, nil)
+	}
 	// otherwise, we found it homey!
 	return de.Value, nil
 }
@@ -562,14 +693,29 @@ type ScanDirection = sstable.ScanDirection
 
 // Scan takes a scan direction and an iteration function and scans the ss-tables
 // in the provided direction (young to old, or old to young) and provides you with
-// a pointer to each entry during iteration. *It should be noted that modification
-// of the entry pointer has unknown effects.
+// a pointer to each entry during iteration. Merge entries are collapsed with the
+// older entries using the configured merge operator, as they are by Get. *It should
+// be noted that modification of the entry pointer has unknown effects.
 func (lsm *LSMTree) Scan(direction int, iter func(e *binary.Entry) bool) error {
 	// lock
 	lsm.lock.Lock()
 	defer lsm.lock.Unlock()
 	// ss-table-manager scan method
-	return lsm.sstm.Scan(sstable.ScanDirection(direction), iter)
+	return lsm.sstm.ScanMerged(sstable.ScanDirection(direction), iter)
+}
+
+// MemtableSnapshot returns a frozen, read-only view of the mem-table. Taking
+// the snapshot is O(1) and does not block writers, and the snapshot is not
+// affected by any writes (or flushes) that happen after it was taken. This
+// makes it suitable for long running scans and exports. Snapshots are only
+// supported by the persistent mem-table, for every other mem-table type
+// MemtableSnapshot returns ErrSnapshotNotSupported.
+func (lsm *LSMTree) MemtableSnapshot() (*mtbl.Snapshot, error) {
+	memt, ok := lsm.memt.(*mtbl.PRBTree)
+	if !ok {
+		return nil, ErrSnapshotNotSupported
+	}
+	return memt.Snapshot(), nil
 }
 
 // Sync forces a sync
@@ -643,6 +789,14 @@ func (lsm *LSMTree) GetBatch(keys ...string) (*binary.Batch, error) {
 		// according to the bloom filter, it "may" be in
 		// tree, so lets start by searching the mem-table
 		e, found := lsm.memt.Get(&binary.Entry{Key: []byte(key)})
+		if found && e.IsMerge() {
+			// apply the merge operand(s) to the older entries
+			v, err := lsm.resolveMerge(key, e)
+			if err == nil {
+				batch.Write(key, v)
+			}
+			continue // skip and look for next key
+		}
 		if found && e.Value != nil {
 			// we found a match! add match to batch, and...
 			batch.WriteEntry(e)
@@ -673,6 +827,14 @@ func (lsm *LSMTree) GetBatch(keys ...string) (*binary.Batch, error) {
 				if de == nil || de.Value == nil {
 					continue // skip and look for the next key
 				}
+				// apply any merge operands to the older entries
+				if de.IsMerge() {
+					v, err := lsm.resolveMerge(key, nil)
+					if err == nil {
+						batch.Write(key, v)
+					}
+					continue // skip and look for next key
+				}
 				// otherwise, we found it homey! add match to batch, and...
 				batch.WriteEntry(de)
 				continue // skip and lok for next key
@@ -686,6 +848,14 @@ func (lsm *LSMTree) GetBatch(keys ...string) (*binary.Batch, error) {
 		if de == nil || de.Value == nil {
 			continue // skip and lok for next key
 		}
+		// apply any merge operands to the older entries
+		if de.IsMerge() {
+			v, err := lsm.resolveMerge(key, nil)
+			if err == nil {
+				batch.Write(key, v)
+			}
+			continue // skip and look for next key
+		}
 		// may have found it; add match to batch, and...
 		batch.WriteEntry(de)
 		continue // skip and lok for next key
@@ -703,12 +873,41 @@ func (lsm *LSMTree) GetBatch(keys ...string) (*binary.Batch, error) {
 }
 
 func (lsm *LSMTree) Stats() (*LSMTreeStats, error) {
+	// read lock, so the mem-table is not written to or
+	// flushed while it is being scanned
+	lsm.lock.RLock()
+	defer lsm.lock.RUnlock()
+	// merge the sketches of the ss-tables with the mem-table keys
+	live, deleted, err := lsm.sstm.Sketch()
+	if err != nil {
+		return nil, err
+	}
+	lsm.memt.Scan(func(e *binary.Entry) bool {
+		if e.Value != nil && !bytes.Equal(e.Value, Tombstone) {
+			live.Add(e.Key)
+		} else {
+			deleted.Add(e.Key)
+		}
+		return true
+	})
+	// the live keys are all the keys, minus the deleted ones
+	all := live.Clone()
+	err = all.Merge(deleted)
+	if err != nil {
+		return nil, err
+	}
+	var liveKeys uint64
+	if n, d := all.Count(), deleted.Count(); n > d {
+		liveKeys = n - d
+	}
 	return &LSMTreeStats{
-		Config:    lsm.conf,
-		MtEntries: lsm.memt.Count(),
-		MtSize:    lsm.memt.Size(),
-		BfEntries: lsm.bloom.Count(),
-		BfSize:    int64(util.Sizeof(lsm.bloom)),
+		Config:           lsm.conf,
+		MtEntries:        lsm.memt.Count(),
+		MtSize:           lsm.memt.Size(),
+		BfEntries:        lsm.bloom.Count(),
+		BfSize:           int64(util.Sizeof(lsm.bloom)),
+		DistinctLiveKeys: liveKeys,
+		HotKeys:          lsm.HotKeys(),
 	}, nil
 }
 
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	binary2 "github.com/scottcagno/storage/pkg/lsmt/binary"
+	"github.com/scottcagno/storage/pkg/lsmt/wal"
 	"github.com/scottcagno/storage/pkg/util"
 	"log"
 	"math"
@@ -13,6 +14,8 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -59,6 +62,81 @@ func TestLSMChecksum(t *testing.T) {
 	}
 }
 
+func TestLSMTree_UpgradeLegacyWAL(t *testing.T) {
+	c := &LSMConfig{
+		BaseDir:         filepath.Join("lsm-testing", "upgrade"),
+		FlushThreshold:  -1,
+		BloomFilterSize: 1 << 16,
+	}
+	defer func() {
+		_ = os.RemoveAll(c.BaseDir)
+	}()
+	// write a v1.7.0 lsm-tree by hand: a checksum file and
+	// a write-ahead log made of plain (unframed) entries
+	walbase := filepath.Join(c.BaseDir, defaultWalDir)
+	err := os.MkdirAll(walbase, os.ModeDir|os.ModePerm)
+	if err != nil {
+		t.Fatalf("mkdir: %v\n", err)
+	}
+	_, str := calculateChecksum(legacyVersion)
+	err = os.WriteFile(filepath.Join(c.BaseDir, ".sum.txt"), []byte(str), 0666)
+	if err != nil {
+		t.Fatalf("write checksum: %v\n", err)
+	}
+	fd, err := os.Create(filepath.Join(walbase, wal.MakeFileNameFromIndex(1)))
+	if err != nil {
+		t.Fatalf("create segment: %v\n", err)
+	}
+	for i := 0; i < 10; i++ {
+		_, err = binary2.EncodeEntry(fd, &binary2.Entry{Key: []byte(makeKey(i)), Value: makeVal(i)})
+		if err != nil {
+			t.Fatalf("encode: %v\n", err)
+		}
+	}
+	_, err = binary2.EncodeEntry(fd, &binary2.Entry{Key: []byte(makeKey(3)), Value: Tombstone})
+	if err != nil {
+		t.Fatalf("encode: %v\n", err)
+	}
+	err = fd.Close()
+	if err != nil {
+		t.Fatalf("close segment: %v\n", err)
+	}
+	// it is upgraded when it is opened, and stays readable after
+	for n := 0; n < 2; n++ {
+		db, err := OpenLSMTree(c)
+		if err != nil {
+			t.Fatalf("open: %v\n", err)
+		}
+		for i := 0; i < 10; i++ {
+			v, err := db.Get(makeKey(i))
+			if i == 3 {
+				if err == nil {
+					t.Errorf("get(%q): expected the key to be deleted\n", makeKey(i))
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("get(%q): %v\n", makeKey(i), err)
+			}
+			util.AssertEqual(t, makeVal(i), v)
+		}
+		err = db.Close()
+		if err != nil {
+			t.Fatalf("close: %v\n", err)
+		}
+	}
+	_, err = os.Stat(filepath.Join(c.BaseDir, legacyWalDir))
+	util.AssertEqual(t, true, os.IsNotExist(err))
+	// any other version is still rejected
+	_, str = calculateChecksum("v1.6.0")
+	err = os.WriteFile(filepath.Join(c.BaseDir, ".sum.txt"), []byte(str), 0666)
+	if err != nil {
+		t.Fatalf("write checksum: %v\n", err)
+	}
+	_, err = OpenLSMTree(c)
+	util.AssertEqual(t, ErrBadChecksum, err)
+}
+
 func TestLSMTLogging(t *testing.T) {
 
 	level := LevelInfo
@@ -293,6 +371,509 @@ func TestLSMTreeReadEmptyDir(t *testing.T) {
 	}
 }
 
+func TestLSMTree_SkipListMemtable(t *testing.T) {
+	c := &LSMConfig{
+		BaseDir:         filepath.Join("lsm-testing", "skiplist"),
+		Memtable:        MemtableSkipList,
+		FlushThreshold:  -1,
+		BloomFilterSize: 1 << 16,
+	}
+	defer func() {
+		_ = os.RemoveAll(c.BaseDir)
+	}()
+	db, err := OpenLSMTree(c)
+	if err != nil {
+		t.Fatalf("open: %v\n", err)
+	}
+	// write enough data to force a few flushes
+	count := 5000
+	for i := 0; i < count; i++ {
+		err = db.Put(makeKey(i), makeCustomVal(i, smVal))
+		if err != nil {
+			t.Fatalf("put: %v\n", err)
+		}
+	}
+	// delete every tenth key
+	for i := 0; i < count; i += 10 {
+		err = db.Del(makeKey(i))
+		if err != nil {
+			t.Fatalf("del: %v\n", err)
+		}
+	}
+	// read everything back, concurrently
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				v, err := db.Get(makeKey(i))
+				if i%10 == 0 {
+					if err != ErrNotFound {
+						t.Errorf("get(%q): expected not found, got: %v\n", makeKey(i), err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Errorf("get(%q): %v\n", makeKey(i), err)
+					continue
+				}
+				if !bytes.Equal(v, makeCustomVal(i, smVal)) {
+					t.Errorf("get(%q): bad value %q\n", makeKey(i), v)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	err = db.Close()
+	if err != nil {
+		t.Fatalf("close: %v\n", err)
+	}
+}
+
+func TestLSMTree_MemtableSnapshot(t *testing.T) {
+	c := &LSMConfig{
+		BaseDir:         filepath.Join("lsm-testing", "persistent"),
+		Memtable:        MemtablePersistent,
+		FlushThreshold:  -1,
+		BloomFilterSize: 1 << 16,
+	}
+	defer func() {
+		_ = os.RemoveAll(c.BaseDir)
+	}()
+	db, err := OpenLSMTree(c)
+	if err != nil {
+		t.Fatalf("open: %v\n", err)
+	}
+	count := 100
+	for i := 0; i < count; i++ {
+		err = db.Put(makeKey(i), makeCustomVal(i, smVal))
+		if err != nil {
+			t.Fatalf("put: %v\n", err)
+		}
+	}
+	snap, err := db.MemtableSnapshot()
+	if err != nil {
+		t.Fatalf("snapshot: %v\n", err)
+	}
+	// keep writing, the snapshot should not change
+	for i := count; i < 2*count; i++ {
+		err = db.Put(makeKey(i), makeCustomVal(i, smVal))
+		if err != nil {
+			t.Fatalf("put: %v\n", err)
+		}
+	}
+	for i := 0; i < 2*count; i++ {
+		v, err := db.Get(makeKey(i))
+		if err != nil || !bytes.Equal(v, makeCustomVal(i, smVal)) {
+			t.Errorf("get(%q): %v\n", makeKey(i), err)
+		}
+	}
+	util.AssertLen(t, count, snap.Count())
+	var n int
+	snap.Scan(func(e *binary2.Entry) bool {
+		util.AssertEqual(t, makeKey(n), string(e.Key))
+		n++
+		return true
+	})
+	util.AssertLen(t, count, n)
+	err = db.Close()
+	if err != nil {
+		t.Fatalf("close: %v\n", err)
+	}
+	// other mem-tables do not support snapshots
+	c.Memtable = MemtableRBTree
+	db, err = OpenLSMTree(c)
+	if err != nil {
+		t.Fatalf("open: %v\n", err)
+	}
+	_, err = db.MemtableSnapshot()
+	util.AssertEqual(t, ErrSnapshotNotSupported, err)
+	err = db.Close()
+	if err != nil {
+		t.Fatalf("close: %v\n", err)
+	}
+}
+
+func TestLSMTree_Comparator(t *testing.T) {
+	// big-endian integer keys, ordered newest (largest) first
+	reverseUint64 := func() Comparator {
+		return NewComparator("test.ReverseUint64", func(a, b []byte) int {
+			x, y := binary.BigEndian.Uint64(a), binary.BigEndian.Uint64(b)
+			if x > y {
+				return -1
+			}
+			if x < y {
+				return 1
+			}
+			return 0
+		})
+	}
+	key := func(i int) string {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(i))
+		return string(b[:])
+	}
+	c := &LSMConfig{
+		BaseDir:         filepath.Join("lsm-testing", "comparator"),
+		Comparator:      reverseUint64(),
+		FlushThreshold:  -1,
+		BloomFilterSize: 1 << 16,
+	}
+	defer func() {
+		_ = os.RemoveAll(c.BaseDir)
+	}()
+	db, err := OpenLSMTree(c)
+	if err != nil {
+		t.Fatalf("open: %v\n", err)
+	}
+	// write the data, flushing a few times along the way
+	count := 1000
+	for i := 0; i < count; i++ {
+		if i > 0 && i%400 == 0 {
+			err = db.FlushToSSTableAndCycleWAL(db.memt)
+			if err != nil {
+				t.Fatalf("flush: %v\n", err)
+			}
+		}
+		err = db.Put(key(i), makeCustomVal(i, smVal))
+		if err != nil {
+			t.Fatalf("put: %v\n", err)
+		}
+	}
+	// the mem-table is ordered using the comparator
+	var prev []byte
+	db.memt.Scan(func(e *binary2.Entry) bool {
+		if prev != nil && binary.BigEndian.Uint64(prev) <= binary.BigEndian.Uint64(e.Key) {
+			t.Errorf("mem-table out of order: %x, %x\n", prev, e.Key)
+			return false
+		}
+		prev = e.Key
+		return true
+	})
+	err = db.Close()
+	if err != nil {
+		t.Fatalf("close: %v\n", err)
+	}
+	// opening with a different comparator should fail
+	c.Comparator = BytewiseComparator
+	_, err = OpenLSMTree(c)
+	util.AssertEqual(t, ErrComparatorMismatch, err)
+	// but opening with the same comparator should work
+	c.Comparator = reverseUint64()
+	db, err = OpenLSMTree(c)
+	if err != nil {
+		t.Fatalf("open: %v\n", err)
+	}
+	for i := 0; i < count; i++ {
+		v, err := db.Get(key(i))
+		if err != nil {
+			t.Errorf("get(%d): %v\n", i, err)
+			continue
+		}
+		if !bytes.Equal(v, makeCustomVal(i, smVal)) {
+			t.Errorf("get(%d): bad value %q\n", i, v)
+		}
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatalf("close: %v\n", err)
+	}
+}
+
+// maxOperator keeps the largest value, it cannot combine operands
+// on their own, so it is used to test the full merge fallbacks
+type maxOperator struct{}
+
+func (maxOperator) Name() string { return "test.MaxOperator" }
+
+func (maxOperator) FullMerge(key, existing []byte, operands [][]byte) ([]byte, bool) {
+	max := existing
+	for _, op := range operands {
+		if bytes.Compare(op, max) > 0 {
+			max = op
+		}
+	}
+	return max, true
+}
+
+func (maxOperator) PartialMerge(key, left, right []byte) ([]byte, bool) {
+	return nil, false
+}
+
+func TestLSMTree_Merge(t *testing.T) {
+	c := &LSMConfig{
+		BaseDir:         filepath.Join("lsm-testing", "merge"),
+		MergeOperator:   Int64AddOperator,
+		FlushThreshold:  -1,
+		BloomFilterSize: 1 << 16,
+	}
+	defer func() {
+		_ = os.RemoveAll(c.BaseDir)
+	}()
+	db, err := OpenLSMTree(c)
+	if err != nil {
+		t.Fatalf("open: %v\n", err)
+	}
+	flush := func() {
+		err := db.FlushToSSTableAndCycleWAL(db.memt)
+		if err != nil {
+			t.Fatalf("flush: %v\n", err)
+		}
+	}
+	get := func(k string) int64 {
+		v, err := db.Get(k)
+		if err != nil {
+			t.Fatalf("get(%q): %v\n", k, err)
+		}
+		n, ok := DecodeInt64(v)
+		if !ok {
+			t.Fatalf("get(%q): bad value %q\n", k, v)
+		}
+		return n
+	}
+	// a counter with a base value, and one without
+	err = db.Put("counter-a", EncodeInt64(100))
+	if err != nil {
+		t.Fatalf("put: %v\n", err)
+	}
+	flush()
+	for i := 0; i < 30; i++ {
+		if i%10 == 0 {
+			flush()
+		}
+		err = db.Merge("counter-a", EncodeInt64(1))
+		if err != nil {
+			t.Fatalf("merge: %v\n", err)
+		}
+		err = db.Merge("counter-b", EncodeInt64(2))
+		if err != nil {
+			t.Fatalf("merge: %v\n", err)
+		}
+	}
+	util.AssertEqual(t, int64(130), get("counter-a"))
+	util.AssertEqual(t, int64(60), get("counter-b"))
+	// a delete resets the counter
+	err = db.Del("counter-b")
+	if err != nil {
+		t.Fatalf("del: %v\n", err)
+	}
+	err = db.Merge("counter-b", EncodeInt64(5))
+	if err != nil {
+		t.Fatalf("merge: %v\n", err)
+	}
+	util.AssertEqual(t, int64(5), get("counter-b"))
+	// operands should survive a restart (using the write-ahead log)
+	err = db.Merge("counter-a", EncodeInt64(10))
+	if err != nil {
+		t.Fatalf("merge: %v\n", err)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatalf("close: %v\n", err)
+	}
+	db, err = OpenLSMTree(c)
+	if err != nil {
+		t.Fatalf("open: %v\n", err)
+	}
+	util.AssertEqual(t, int64(140), get("counter-a"))
+	util.AssertEqual(t, int64(5), get("counter-b"))
+	// and compaction should collapse them
+	flush()
+	err = db.sstm.CompactAllSSTables()
+	if err != nil {
+		t.Fatalf("compact: %v\n", err)
+	}
+	util.AssertEqual(t, int64(140), get("counter-a"))
+	util.AssertEqual(t, int64(5), get("counter-b"))
+	// bad operands are reported by the merge operator, either
+	// right away, or when the operand is read or compacted
+	err = db.Merge("counter-c", []byte("not an int64"))
+	if err != nil {
+		t.Fatalf("merge: %v\n", err)
+	}
+	_, err = db.Get("counter-c")
+	util.AssertEqual(t, ErrMergeFailed, err)
+	err = db.Merge("counter-c", []byte("not an int64"))
+	util.AssertEqual(t, ErrMergeFailed, err)
+	err = db.Close()
+	if err != nil {
+		t.Fatalf("close: %v\n", err)
+	}
+	// merging without a merge operator
+	c.MergeOperator = nil
+	db, err = OpenLSMTree(c)
+	if err != nil {
+		t.Fatalf("open: %v\n", err)
+	}
+	err = db.Merge("counter-a", EncodeInt64(1))
+	util.AssertEqual(t, ErrNoMergeOperator, err)
+	err = db.Close()
+	if err != nil {
+		t.Fatalf("close: %v\n", err)
+	}
+}
+
+func TestLSMTree_ScanMerge(t *testing.T) {
+	c := &LSMConfig{
+		BaseDir:         filepath.Join("lsm-testing", "scan-merge"),
+		MergeOperator:   Int64AddOperator,
+		FlushThreshold:  -1,
+		BloomFilterSize: 1 << 16,
+	}
+	defer func() {
+		_ = os.RemoveAll(c.BaseDir)
+	}()
+	db, err := OpenLSMTree(c)
+	if err != nil {
+		t.Fatalf("open: %v\n", err)
+	}
+	flush := func() {
+		err := db.FlushToSSTableAndCycleWAL(db.memt)
+		if err != nil {
+			t.Fatalf("flush: %v\n", err)
+		}
+	}
+	// a base value with merge operands in several newer tables
+	err = db.Put("counter", EncodeInt64(100))
+	if err != nil {
+		t.Fatalf("put: %v\n", err)
+	}
+	flush()
+	for i := 0; i < 3; i++ {
+		err = db.Merge("counter", EncodeInt64(10))
+		if err != nil {
+			t.Fatalf("merge: %v\n", err)
+		}
+		flush()
+	}
+	// the scan must only provide collapsed values, the
+	// newest one first when scanning from new to old
+	var values []int64
+	err = db.Scan(ScanNewToOld, func(e *binary2.Entry) bool {
+		util.AssertEqual(t, false, e.IsMerge())
+		n, ok := DecodeInt64(e.Value)
+		if !ok {
+			t.Fatalf("scan: bad value %q\n", e.Value)
+		}
+		values = append(values, n)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("scan: %v\n", err)
+	}
+	util.AssertEqual(t, []int64{130, 120, 110, 100}, values)
+	err = db.Close()
+	if err != nil {
+		t.Fatalf("close: %v\n", err)
+	}
+}
+
+func TestLSMTree_MergeOperators(t *testing.T) {
+	for _, op := range []MergeOperator{NewBytesAppendOperator([]byte(",")), maxOperator{}} {
+		c := &LSMConfig{
+			BaseDir:         filepath.Join("lsm-testing", "merge-operators"),
+			MergeOperator:   op,
+			FlushThreshold:  -1,
+			BloomFilterSize: 1 << 16,
+		}
+		db, err := OpenLSMTree(c)
+		if err != nil {
+			t.Fatalf("open: %v\n", err)
+		}
+		var want [][]byte
+		for i := 0; i < 9; i++ {
+			if i%3 == 0 {
+				err = db.FlushToSSTableAndCycleWAL(db.memt)
+				if err != nil {
+					t.Fatalf("flush: %v\n", err)
+				}
+			}
+			v := []byte(strconv.Itoa(i))
+			err = db.Merge("list", v)
+			if err != nil {
+				t.Fatalf("merge: %v\n", err)
+			}
+			want = append(want, v)
+		}
+		v, err := db.Get("list")
+		if err != nil {
+			t.Fatalf("get: %v\n", err)
+		}
+		expected, _ := op.FullMerge(nil, nil, want)
+		util.AssertEqual(t, string(expected), string(v))
+		err = db.Close()
+		if err != nil {
+			t.Fatalf("close: %v\n", err)
+		}
+		_ = os.RemoveAll(c.BaseDir)
+	}
+}
+
+func TestLSMTree_DistinctLiveKeys(t *testing.T) {
+	c := &LSMConfig{
+		BaseDir:         filepath.Join("lsm-testing", "distinct"),
+		FlushThreshold:  -1,
+		BloomFilterSize: 1 << 16,
+	}
+	defer func() {
+		_ = os.RemoveAll(c.BaseDir)
+	}()
+	db, err := OpenLSMTree(c)
+	if err != nil {
+		t.Fatalf("open: %v\n", err)
+	}
+	// write enough data to force a few flushes, and then
+	// overwrite some of the keys so they are in several tables
+	count := 5000
+	for i := 0; i < count; i++ {
+		err = db.Put(makeKey(i), makeCustomVal(i, smVal))
+		if err != nil {
+			t.Fatalf("put: %v\n", err)
+		}
+	}
+	for i := 0; i < count/2; i++ {
+		err = db.Put(makeKey(i), makeCustomVal(i, mdVal))
+		if err != nil {
+			t.Fatalf("put: %v\n", err)
+		}
+	}
+	// and delete some of them, which must not be counted
+	deleted := count / 5
+	for i := count - deleted; i < count; i++ {
+		err = db.Del(makeKey(i))
+		if err != nil {
+			t.Fatalf("del: %v\n", err)
+		}
+	}
+	check := func() {
+		st, err := db.Stats()
+		if err != nil {
+			t.Fatalf("stats: %v\n", err)
+		}
+		live := count - deleted
+		diff := math.Abs(float64(st.DistinctLiveKeys) - float64(live))
+		if diff > 0.05*float64(live) {
+			t.Errorf("distinct live keys: got %d, expected about %d\n", st.DistinctLiveKeys, live)
+		}
+	}
+	check()
+	// the sketches must survive reopening the tree
+	err = db.Close()
+	if err != nil {
+		t.Fatalf("close: %v\n", err)
+	}
+	db, err = OpenLSMTree(c)
+	if err != nil {
+		t.Fatalf("open: %v\n", err)
+	}
+	check()
+	err = db.Close()
+	if err != nil {
+		t.Fatalf("close: %v\n", err)
+	}
+}
+
 func testSSTableBehavior(t *testing.T) {
 
 	origPath := conf.BaseDir
@@ -936,3 +1517,59 @@ Mauris ac blandit nulla, ac dignissim quam. Ut ut est placerat quam suscipit sod
 lacus. Praesent hendrerit mattis diam et sodales. In a augue sit amet odio iaculis tempus sed 
 a erat. Donec quis nisi tellus. Nam hendrerit purus ligula, id bibendum metus pulvinar sed. 
 Nulla eu neque lobortis, porta elit quis, luctus purus. Vestibulum et ultrices nulla.`
+
+func TestLSMTree_HotKeys(t *testing.T) {
+	c := &LSMConfig{
+		BaseDir: filepath.Join("lsm-testing", "hotkeys"),
+		HotKeys: 3,
+	}
+	defer func() {
+		_ = os.RemoveAll(c.BaseDir)
+	}()
+	db, err := OpenLSMTree(c)
+	if err != nil {
+		t.Fatalf("open: %v\n", err)
+	}
+	defer db.Close()
+	for i := 0; i < 100; i++ {
+		err = db.Put(makeKey(i), makeCustomVal(i, smVal))
+		if err != nil {
+			t.Fatalf("put: %v\n", err)
+		}
+	}
+	// read a few keys much more often than the others
+	for i := 0; i < 50; i++ {
+		for _, j := range []int{7, 42, 99} {
+			_, err = db.Get(makeKey(j))
+			if err != nil {
+				t.Fatalf("get: %v\n", err)
+			}
+		}
+		_, err = db.Get(makeKey(i))
+		if err != nil {
+			t.Fatalf("get: %v\n", err)
+		}
+	}
+	// entries that are rejected are not counted
+	badKey := strings.Repeat("k", maxKeySizeAllowed+1)
+	for i := 0; i < 200; i++ {
+		err = db.Put(badKey, makeCustomVal(i, smVal))
+		if err == nil {
+			t.Fatalf("put: expected an error for a key that is too large\n")
+		}
+	}
+	st, err := db.Stats()
+	if err != nil {
+		t.Fatalf("stats: %v\n", err)
+	}
+	util.AssertLen(t, 3, len(st.HotKeys))
+	found := make(map[string]bool)
+	for _, hk := range st.HotKeys {
+		found[hk.Key] = true
+	}
+	for _, j := range []int{7, 42, 99} {
+		if !found[makeKey(j)] {
+			t.Errorf("hot key %q not found in %v\n", makeKey(j), st.HotKeys)
+		}
+	}
+}
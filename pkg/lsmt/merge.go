@@ -0,0 +1,142 @@
+package lsmt
+
+import "github.com/scottcagno/storage/pkg/lsmt/binary"
+
+// MergeOperator combines merge operands with the existing value for a
+// key. It is set in the LSMConfig and used by Merge, by reads of keys that
+// have merge operands, and by the ss-table manager during compaction.
+type MergeOperator = binary.MergeOperator
+
+var (
+	// Int64AddOperator adds (little endian) encoded int64 operands
+	// to the value. Use EncodeInt64 and DecodeInt64 for the values.
+	Int64AddOperator = binary.Int64AddOperator
+
+	// BytesAppendOperator appends the operands to the value
+	BytesAppendOperator = binary.BytesAppendOperator
+)
+
+// NewBytesAppendOperator returns a merge operator that appends the
+// operands to the value, separated using the provided delimiter
+func NewBytesAppendOperator(delim []byte) MergeOperator {
+	return binary.NewBytesAppendOperator(delim)
+}
+
+// EncodeInt64 encodes a value for use with the Int64AddOperator
+func EncodeInt64(v int64) []byte {
+	return binary.EncodeInt64(v)
+}
+
+// DecodeInt64 decodes a value encoded for the Int64AddOperator
+func DecodeInt64(b []byte) (int64, bool) {
+	return binary.DecodeInt64(b)
+}
+
+// Merge takes a key and a merge operand and adds the operand to the LSMTree.
+// The operand is combined with the existing value for the key using the
+// configured merge operator, without reading the existing value first. If
+// the mem-table has an entry for the key they are combined right away,
+// otherwise the operand is stored as a merge entry and collapsed lazily,
+// when the key is read or when the ss-tables are compacted.
+func (lsm *LSMTree) Merge(k string, operand []byte) error {
+	// lock
+	lsm.lock.Lock()
+	defer lsm.lock.Unlock()
+	// make sure we have a merge operator
+	if lsm.conf.MergeOperator == nil {
+		return ErrNoMergeOperator
+	}
+	// create binary entry
+	e := &binary.Entry{Key: []byte(k), Value: operand, Type: binary.EntryTypeMerge}
+	// check entry
+	err := lsm.checkEntry(e)
+	if err != nil {
+		return err
+	}
+	// combine the operand with the mem-table entry
+	me, err := lsm.mergeWithMemtable(e)
+	if err != nil {
+		return err
+	}
+	// write the operand to the write-ahead commit log
+	_, err = lsm.wacl.Write(e)
+	if err != nil {
+		return err
+	}
+	// write entry to mem-table
+	_, needFlush := lsm.memt.UpsertAndCheckIfFull(me, lsm.conf.FlushThreshold)
+	// check if we should do a flush
+	if needFlush {
+		// log info
+		lsm.logger.Info("mem-table needs flush, attempting to flush now", err)
+		// attempt to flush
+		err = lsm.FlushToSSTableAndCycleWAL(lsm.memt)
+		if err != nil {
+			// log error
+			lsm.logger.Error("flushing mem-table: %s", err)
+			return err
+		}
+	}
+	// add to bloom filter
+	lsm.bloom.Set([]byte(k))
+	return nil
+}
+
+// mergeWithMemtable combines the provided merge entry with the entry for
+// the same key in the mem-table (if there is one) and returns the entry
+// that should be written to the mem-table. The caller must hold the lock.
+func (lsm *LSMTree) mergeWithMemtable(e *binary.Entry) (*binary.Entry, error) {
+	op := lsm.conf.MergeOperator
+	cur, found := lsm.memt.Get(&binary.Entry{Key: e.Key})
+	if op == nil || !found {
+		// nothing to combine with (yet) so the operand is
+		// collapsed lazily, when it is read or compacted
+		return e, nil
+	}
+	if !cur.IsMerge() {
+		// the mem-table has a value (or a tombstone)
+		value, ok := op.FullMerge(e.Key, cur.Value, [][]byte{e.Value})
+		if !ok {
+			return nil, ErrMergeFailed
+		}
+		return lsm.mergedEntry(e.Key, value, binary.EntryTypeValue)
+	}
+	// the mem-table has a merge operand, attempt to combine them
+	operand, ok := op.PartialMerge(e.Key, cur.Value, e.Value)
+	if ok {
+		return lsm.mergedEntry(e.Key, operand, binary.EntryTypeMerge)
+	}
+	// otherwise, they have to be applied to the ss-table entries
+	value, err := lsm.sstm.ResolveMerge(string(e.Key), [][]byte{e.Value, cur.Value})
+	if err != nil {
+		return nil, err
+	}
+	return lsm.mergedEntry(e.Key, value, binary.EntryTypeValue)
+}
+
+// mergedEntry returns a new entry, as long as the value is not too large
+func (lsm *LSMTree) mergedEntry(key, value []byte, typ binary.EntryType) (*binary.Entry, error) {
+	err := checkValue(value, lsm.conf.MaxValueSize)
+	if err != nil {
+		return nil, err
+	}
+	return &binary.Entry{Key: key, Value: value, Type: typ}, nil
+}
+
+// resolveMerge returns the value for a key when the newest entry for it
+// is a merge entry. If the merge entry was found in the mem-table, it
+// is provided, otherwise it is found in the ss-tables.
+func (lsm *LSMTree) resolveMerge(k string, e *binary.Entry) ([]byte, error) {
+	var operands [][]byte
+	if e != nil {
+		operands = append(operands, e.Value)
+	}
+	value, err := lsm.sstm.ResolveMerge(k, operands)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
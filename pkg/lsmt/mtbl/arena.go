@@ -0,0 +1,78 @@
+package mtbl
+
+import (
+	"github.com/scottcagno/storage/pkg/lsmt/binary"
+	"unsafe"
+)
+
+const (
+	arenaDataSlabSize  = 64 << 10 // 64 KB
+	arenaNodeSlabSize  = 1024
+	arenaLinkSlabSize  = 4096
+	arenaEntrySlabSize = 1024
+)
+
+// arena hands out skiplist nodes, tower links, entries and key/value
+// bytes from larger slabs, so inserting into the skiplist does not
+// perform an allocation per node, per entry and per key/value. Only
+// the (single) skiplist writer allocates from the arena. Slabs are
+// never reused, so anything handed out stays valid for as long as
+// a reader holds on to it--even after the skiplist has been reset.
+type arena struct {
+	data    []byte
+	nodes   []skipNode
+	links   []unsafe.Pointer
+	entries []binary.Entry
+}
+
+func newArena() *arena {
+	return new(arena)
+}
+
+// copyBytes copies b into the arena. A nil slice stays
+// nil, so tombstone entries are preserved
+func (a *arena) copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	n := len(b)
+	if n > arenaDataSlabSize/4 {
+		// large values get their own allocation
+		return append(make([]byte, 0, n), b...)
+	}
+	if cap(a.data)-len(a.data) < n {
+		a.data = make([]byte, 0, arenaDataSlabSize)
+	}
+	off := len(a.data)
+	a.data = append(a.data, b...)
+	return a.data[off : off+n : off+n]
+}
+
+// newEntry copies the provided entry (key and value) into the arena
+func (a *arena) newEntry(e *binary.Entry) *binary.Entry {
+	if len(a.entries) == cap(a.entries) {
+		a.entries = make([]binary.Entry, 0, arenaEntrySlabSize)
+	}
+	a.entries = append(a.entries, binary.Entry{
+		Key:   a.copyBytes(e.Key),
+		Value: a.copyBytes(e.Value),
+		Type:  e.Type,
+	})
+	return &a.entries[len(a.entries)-1]
+}
+
+// newNode returns a new node with a tower of the provided height
+func (a *arena) newNode(height int) *skipNode {
+	if len(a.nodes) == cap(a.nodes) {
+		a.nodes = make([]skipNode, 0, arenaNodeSlabSize)
+	}
+	if cap(a.links)-len(a.links) < height {
+		a.links = make([]unsafe.Pointer, 0, arenaLinkSlabSize)
+	}
+	off := len(a.links)
+	a.links = a.links[:off+height]
+	a.nodes = append(a.nodes, skipNode{
+		next: a.links[off : off+height : off+height],
+	})
+	return &a.nodes[len(a.nodes)-1]
+}
@@ -0,0 +1,55 @@
+package mtbl
+
+import "github.com/scottcagno/storage/pkg/lsmt/binary"
+
+// Memtable is the interface implemented by all the mem-table types. It
+// covers everything the lsm-tree needs from a mem-table: upserting and
+// looking up entries, ordered iteration (for flushing to an ss-table)
+// and size accounting (for knowing when to flush).
+type Memtable interface {
+
+	// Put upserts the provided entry. It returns the entry along
+	// with a boolean reporting true if an existing entry was updated
+	Put(entry *binary.Entry) (*binary.Entry, bool)
+
+	// UpsertAndCheckIfFull upserts the provided entry and returns the
+	// current size in bytes, along with a boolean reporting true if the
+	// mem-table has met or exceeded the provided threshold
+	UpsertAndCheckIfFull(entry *binary.Entry, threshold int64) (int64, bool)
+
+	// UpsertBatchAndCheckIfFull upserts all the entries in the batch and
+	// returns the current size in bytes, along with a boolean reporting
+	// true if the mem-table has met or exceeded the provided threshold
+	UpsertBatchAndCheckIfFull(batch *binary.Batch, threshold int64) (int64, bool)
+
+	// Get returns the entry matching the key of the provided entry and
+	// a boolean reporting true if it was found. A found entry may be a
+	// tombstone (an entry with a nil value)
+	Get(entry *binary.Entry) (*binary.Entry, bool)
+
+	// HasKey reports true if the key exists and is not a tombstone
+	HasKey(k string) bool
+
+	// Scan iterates all the entries in ascending key order
+	Scan(iter Iterator)
+
+	// ScanRange iterates the entries in ascending key order starting
+	// with the start key (inclusive) up to the end key (exclusive)
+	ScanRange(start, end *binary.Entry, iter Iterator)
+
+	// Count returns the number of entries
+	Count() int
+
+	// Size returns the approximate size of the entries in bytes
+	Size() int64
+
+	// Reset removes all the entries
+	Reset()
+}
+
+// make sure the mem-table types implement the Memtable interface
+var (
+	_ Memtable = (*RBTree)(nil)
+	_ Memtable = (*SkipList)(nil)
+	_ Memtable = (*PRBTree)(nil)
+)
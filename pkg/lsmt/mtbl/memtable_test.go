@@ -0,0 +1,50 @@
+package mtbl
+
+import (
+	"github.com/scottcagno/storage/pkg/lsmt/binary"
+	"github.com/scottcagno/storage/pkg/util"
+	"math/rand"
+	"testing"
+)
+
+func TestMemtable_Comparator(t *testing.T) {
+	cmp := binary.ReverseBytewiseComparator
+	for _, mt := range []Memtable{
+		NewRBTreeWithComparator(cmp),
+		NewSkipListWithComparator(cmp),
+		NewPRBTreeWithComparator(cmp),
+	} {
+		for _, i := range rand.Perm(n * thousand) {
+			mt.Put(makeKey(i))
+		}
+		for i := 0; i < n*thousand; i++ {
+			e, ok := mt.Get(makeKey(i))
+			util.AssertEqual(t, true, ok)
+			util.AssertEqual(t, makeKey(i), e)
+		}
+		// scan should be in reverse order
+		var prev *binary.Entry
+		var count int
+		mt.Scan(func(e *binary.Entry) bool {
+			if prev != nil && cmp.Compare(prev.Key, e.Key) >= 0 {
+				t.Errorf("%T: scan out of order: %q, %q", mt, prev.Key, e.Key)
+				return false
+			}
+			prev = e
+			count++
+			return true
+		})
+		util.AssertLen(t, n*thousand, count)
+		// and so should a range scan
+		count = 0
+		mt.ScanRange(NewEntry("9", ""), NewEntry("8", ""), func(e *binary.Entry) bool {
+			if k := string(e.Key); k > "9" || k <= "8" {
+				t.Errorf("%T: scan range, issue with key: %q", mt, e.Key)
+			}
+			count++
+			return true
+		})
+		// 9, 80-89 and 800-899
+		util.AssertLen(t, 111, count)
+	}
+}
@@ -0,0 +1,347 @@
+package mtbl
+
+import (
+	"github.com/scottcagno/storage/pkg/lsmt/binary"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// prbNode is a node of a persistent red-black tree. Nodes are never
+// modified once they are reachable from a published root, so any
+// number of roots (versions) can share them.
+type prbNode struct {
+	left  *prbNode
+	right *prbNode
+	red   bool
+	entry *binary.Entry
+}
+
+func isRed(n *prbNode) bool {
+	return n != nil && n.red
+}
+
+func newPRBNode(red bool, left *prbNode, entry *binary.Entry, right *prbNode) *prbNode {
+	return &prbNode{
+		left:  left,
+		right: right,
+		red:   red,
+		entry: entry,
+	}
+}
+
+// balance returns a new node for the provided color, children and
+// entry, fixing up a red node with a red child below a black node
+// (the four cases described by Okasaki.) Only the nodes that change
+// are copied, everything else is shared with the previous version.
+func balance(red bool, l *prbNode, e *binary.Entry, r *prbNode) *prbNode {
+	if !red {
+		switch {
+		case isRed(l) && isRed(l.left):
+			return newPRBNode(true,
+				newPRBNode(false, l.left.left, l.left.entry, l.left.right),
+				l.entry,
+				newPRBNode(false, l.right, e, r))
+		case isRed(l) && isRed(l.right):
+			return newPRBNode(true,
+				newPRBNode(false, l.left, l.entry, l.right.left),
+				l.right.entry,
+				newPRBNode(false, l.right.right, e, r))
+		case isRed(r) && isRed(r.left):
+			return newPRBNode(true,
+				newPRBNode(false, l, e, r.left.left),
+				r.left.entry,
+				newPRBNode(false, r.left.right, r.entry, r.right))
+		case isRed(r) && isRed(r.right):
+			return newPRBNode(true,
+				newPRBNode(false, l, e, r.left),
+				r.entry,
+				newPRBNode(false, r.right.left, r.right.entry, r.right.right))
+		}
+	}
+	return newPRBNode(red, l, e, r)
+}
+
+// insert returns the new root of the subtree after inserting (or
+// updating) the entry, along with the entry that was replaced (if
+// any.) The nodes on the path to the entry are copied (path copying)
+func insert(cmp binary.Comparator, n *prbNode, e *binary.Entry) (*prbNode, *binary.Entry) {
+	if n == nil {
+		return newPRBNode(true, nil, e, nil), nil
+	}
+	c := cmp.Compare(e.Key, n.entry.Key)
+	if c < 0 {
+		left, old := insert(cmp, n.left, e)
+		return balance(n.red, left, n.entry, n.right), old
+	}
+	if c > 0 {
+		right, old := insert(cmp, n.right, e)
+		return balance(n.red, n.left, n.entry, right), old
+	}
+	// same key, so just copy the node with the new entry
+	return newPRBNode(n.red, n.left, e, n.right), n.entry
+}
+
+// prbRoot is a single version of the tree
+type prbRoot struct {
+	node  *prbNode
+	count int
+	size  int64
+}
+
+// PRBTree is a persistent (immutable) red-black tree mem-table. Every
+// update creates a new version of the tree that shares all unchanged
+// nodes with the previous version, and swaps it in atomically. This
+// means readers never lock, and taking a snapshot of the mem-table is
+// O(1): it simply holds on to the current version.
+type PRBTree struct {
+	lock sync.Mutex     // lock serializes the writers
+	root unsafe.Pointer // root is the current *prbRoot
+	cmp  binary.Comparator
+}
+
+// NewPRBTree creates and returns a new PRBTree
+func NewPRBTree() *PRBTree {
+	return NewPRBTreeWithComparator(binary.BytewiseComparator)
+}
+
+// NewPRBTreeWithComparator creates and returns a new PRBTree
+// that orders the keys using the provided comparator
+func NewPRBTreeWithComparator(cmp binary.Comparator) *PRBTree {
+	if cmp == nil {
+		cmp = binary.BytewiseComparator
+	}
+	return &PRBTree{
+		root: unsafe.Pointer(new(prbRoot)),
+		cmp:  cmp,
+	}
+}
+
+func (t *PRBTree) load() *prbRoot {
+	return (*prbRoot)(atomic.LoadPointer(&t.root))
+}
+
+func (t *PRBTree) putInternal(entry *binary.Entry) (*binary.Entry, bool) {
+	if entry == nil {
+		return nil, false
+	}
+	cur := t.load()
+	node, old := insert(t.cmp, cur.node, entry)
+	// the root is always a new node, so it's
+	// safe to change it before it is published
+	node.red = false
+	next := &prbRoot{
+		node:  node,
+		count: cur.count,
+		size:  cur.size + int64(entry.Size()),
+	}
+	if old != nil {
+		next.size -= int64(old.Size())
+	} else {
+		next.count++
+	}
+	atomic.StorePointer(&t.root, unsafe.Pointer(next))
+	return entry, old != nil
+}
+
+func (t *PRBTree) Put(entry *binary.Entry) (*binary.Entry, bool) {
+	// lock
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.putInternal(entry)
+}
+
+// UpsertAndCheckIfFull updates the provided entry if it already
+// exists or inserts the supplied entry as a new entry if it
+// does not exist. UpsertAndCheckIfFull returns the current size
+// in bytes after performing the insert or update. It also returns
+// a boolean reporting true if the tree has met or exceeded the
+// provided threshold, and false if the current size is less than
+// the provided threshold.
+func (t *PRBTree) UpsertAndCheckIfFull(entry *binary.Entry, threshold int64) (int64, bool) {
+	// lock
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	// insert the entry in to the mem-table
+	t.putInternal(entry)
+	size := t.load().size
+	return size, size >= threshold
+}
+
+// UpsertBatchAndCheckIfFull ranges the batch of entries, and it
+// updates the provided entry if it already exists or inserts the
+// supplied entry as a new entry if it does not exist. When it's
+// finished, UpsertBatchAndCheckIfFull returns the current size in
+// bytes after performing the insert or update. It also returns a
+// boolean value reporting true if the tree has met or exceeded the
+// provided threshold, and false if the current size is less than
+// the provided threshold.
+func (t *PRBTree) UpsertBatchAndCheckIfFull(batch *binary.Batch, threshold int64) (int64, bool) {
+	// lock
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	// range the batch entries
+	for _, e := range batch.Entries {
+		// insert the entry in to the mem-table
+		t.putInternal(e)
+	}
+	size := t.load().size
+	return size, size >= threshold
+}
+
+// Get returns the entry matching the key of the provided entry. It
+// does not lock, and is safe to call concurrently with writers
+func (t *PRBTree) Get(entry *binary.Entry) (*binary.Entry, bool) {
+	return t.Snapshot().Get(entry)
+}
+
+// HasKey tests and returns a boolean value if the
+// provided key exists in the tree (and is not a tombstone)
+func (t *PRBTree) HasKey(k string) bool {
+	return t.Snapshot().HasKey(k)
+}
+
+// Scan iterates all the entries in ascending order. It does not
+// lock, and it iterates the version of the tree that was current
+// when the scan started
+func (t *PRBTree) Scan(iter Iterator) {
+	t.Snapshot().Scan(iter)
+}
+
+// ScanRange iterates the entries in ascending order starting with the
+// start key (inclusive) and ending before the end key. It does not lock
+func (t *PRBTree) ScanRange(start, end *binary.Entry, iter Iterator) {
+	t.Snapshot().ScanRange(start, end, iter)
+}
+
+// Count returns the number of entries in the tree
+func (t *PRBTree) Count() int {
+	return t.load().count
+}
+
+// Len returns the number of entries in the tree
+func (t *PRBTree) Len() int {
+	return t.Count()
+}
+
+// Size returns the size in bytes
+func (t *PRBTree) Size() int64 {
+	return t.load().size
+}
+
+// Reset swaps in a new (empty) version of the tree. Any
+// snapshots of the old version remain valid
+func (t *PRBTree) Reset() {
+	// lock
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	atomic.StorePointer(&t.root, unsafe.Pointer(new(prbRoot)))
+}
+
+// Snapshot returns a frozen, read-only view of the tree in O(1). The
+// snapshot does not change as the tree is updated (or reset) so it
+// can be used for long running scans and exports while writes
+// continue.
+func (t *PRBTree) Snapshot() *Snapshot {
+	return &Snapshot{root: t.load(), cmp: t.cmp}
+}
+
+func (t *PRBTree) String() string {
+	return t.Snapshot().String()
+}
+
+// Snapshot is a frozen, read-only view of a PRBTree. It is
+// safe for concurrent use and never locks
+type Snapshot struct {
+	root *prbRoot
+	cmp  binary.Comparator
+}
+
+// Get returns the entry matching the key of the provided entry
+func (s *Snapshot) Get(entry *binary.Entry) (*binary.Entry, bool) {
+	if entry == nil {
+		return nil, false
+	}
+	n := s.root.node
+	for n != nil {
+		c := s.cmp.Compare(entry.Key, n.entry.Key)
+		if c < 0 {
+			n = n.left
+		} else if c > 0 {
+			n = n.right
+		} else {
+			return n.entry, true
+		}
+	}
+	return nil, false
+}
+
+// HasKey tests and returns a boolean value if the
+// provided key exists (and is not a tombstone)
+func (s *Snapshot) HasKey(k string) bool {
+	e, ok := s.Get(&binary.Entry{Key: []byte(k)})
+	return ok && e != nil && e.Value != nil
+}
+
+// Scan iterates all the entries in ascending order
+func (s *Snapshot) Scan(iter Iterator) {
+	ascend(s.root.node, iter)
+}
+
+// ScanRange iterates the entries in ascending order starting with
+// the start key (inclusive) and ending before the end key
+func (s *Snapshot) ScanRange(start, end *binary.Entry, iter Iterator) {
+	ascendRange(s.cmp, s.root.node, start.Key, end.Key, iter)
+}
+
+// Count returns the number of entries in the snapshot
+func (s *Snapshot) Count() int {
+	return s.root.count
+}
+
+// Size returns the size in bytes of the entries in the snapshot
+func (s *Snapshot) Size() int64 {
+	return s.root.size
+}
+
+func (s *Snapshot) String() string {
+	var sb strings.Builder
+	s.Scan(func(entry *binary.Entry) bool {
+		sb.WriteString(entry.String())
+		return true
+	})
+	return sb.String()
+}
+
+func ascend(n *prbNode, iter Iterator) bool {
+	if n == nil {
+		return true
+	}
+	if !ascend(n.left, iter) {
+		return false
+	}
+	if !iter(n.entry) {
+		return false
+	}
+	return ascend(n.right, iter)
+}
+
+func ascendRange(cmp binary.Comparator, n *prbNode, inf, sup []byte, iter Iterator) bool {
+	if n == nil {
+		return true
+	}
+	if cmp.Compare(n.entry.Key, sup) >= 0 {
+		return ascendRange(cmp, n.left, inf, sup, iter)
+	}
+	if cmp.Compare(n.entry.Key, inf) < 0 {
+		return ascendRange(cmp, n.right, inf, sup, iter)
+	}
+	if !ascendRange(cmp, n.left, inf, sup, iter) {
+		return false
+	}
+	if !iter(n.entry) {
+		return false
+	}
+	return ascendRange(cmp, n.right, inf, sup, iter)
+}
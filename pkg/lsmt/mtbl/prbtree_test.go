@@ -0,0 +1,198 @@
+package mtbl
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/scottcagno/storage/pkg/lsmt/binary"
+	"github.com/scottcagno/storage/pkg/util"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// checkPRBNode makes sure the red-black properties hold and
+// returns the black height of the subtree
+func checkPRBNode(t *testing.T, x *prbNode) int {
+	if x == nil {
+		return 1
+	}
+	if x.red && (isRed(x.left) || isRed(x.right)) {
+		t.Fatalf("red node %q has a red child\n", x.entry.Key)
+	}
+	if x.left != nil && bytes.Compare(x.left.entry.Key, x.entry.Key) >= 0 {
+		t.Fatalf("left child %q is not less than %q\n", x.left.entry.Key, x.entry.Key)
+	}
+	if x.right != nil && bytes.Compare(x.right.entry.Key, x.entry.Key) <= 0 {
+		t.Fatalf("right child %q is not greater than %q\n", x.right.entry.Key, x.entry.Key)
+	}
+	lh, rh := checkPRBNode(t, x.left), checkPRBNode(t, x.right)
+	if lh != rh {
+		t.Fatalf("black height mismatch at %q: %d != %d\n", x.entry.Key, lh, rh)
+	}
+	if !x.red {
+		lh++
+	}
+	return lh
+}
+
+// signature: Put(entry *binary.Entry) (*binary.Entry, bool)
+func TestPRBTree_Put(t *testing.T) {
+	tree := NewPRBTree()
+	var numBytes int64
+	for _, i := range rand.Perm(n * thousand) {
+		e := makeKey(i)
+		numBytes += int64(e.Size())
+		_, existing := tree.Put(e)
+		if existing {
+			t.Errorf("putting: %v", existing)
+		}
+	}
+	checkPRBNode(t, tree.load().node)
+	util.AssertLen(t, n*thousand, tree.Len())
+	util.AssertLen(t, numBytes, tree.Size())
+	// update every entry
+	for i := 0; i < n*thousand; i++ {
+		_, existing := tree.Put(&binary.Entry{Key: makeKey(i).Key, Value: []byte("updated")})
+		if !existing {
+			t.Errorf("updating: %v", existing)
+		}
+	}
+	checkPRBNode(t, tree.load().node)
+	util.AssertLen(t, n*thousand, tree.Len())
+	for i := 0; i < n*thousand; i++ {
+		e, ok := tree.Get(makeKey(i))
+		if !ok {
+			t.Errorf("getting: %v", ok)
+		}
+		util.AssertEqual(t, []byte("updated"), e.Value)
+	}
+	// tombstones are found, but HasKey reports false
+	tree.Put(NewEntry("10", ""))
+	e, ok := tree.Get(NewEntry("10", ""))
+	if !ok || e.Value != nil {
+		t.Errorf("getting tombstone: %v, %v", e, ok)
+	}
+	util.AssertEqual(t, false, tree.HasKey("10"))
+	util.AssertEqual(t, true, tree.HasKey("11"))
+}
+
+// signature: Scan(iter Iterator), ScanRange(start, end *binary.Entry, iter Iterator)
+func TestPRBTree_Scan(t *testing.T) {
+	tree := NewPRBTree()
+	key := func(i int) *binary.Entry {
+		return NewEntry(fmt.Sprintf("key-%06d", i), "v")
+	}
+	for _, i := range rand.Perm(n * thousand) {
+		tree.Put(key(i))
+	}
+	var i int
+	tree.Scan(func(e *binary.Entry) bool {
+		util.AssertEqual(t, key(i).Key, e.Key)
+		i++
+		return true
+	})
+	util.AssertLen(t, n*thousand, i)
+	i = 100
+	tree.ScanRange(key(100), key(200), func(e *binary.Entry) bool {
+		util.AssertEqual(t, key(i).Key, e.Key)
+		i++
+		return true
+	})
+	util.AssertEqual(t, 200, i)
+	// stopping early
+	i = 0
+	tree.Scan(func(e *binary.Entry) bool {
+		i++
+		return i < 10
+	})
+	util.AssertEqual(t, 10, i)
+}
+
+// signature: Snapshot() *Snapshot
+func TestPRBTree_Snapshot(t *testing.T) {
+	tree := NewPRBTree()
+	for i := 0; i < n*thousand; i++ {
+		tree.Put(makeKey(i))
+	}
+	snap := tree.Snapshot()
+	count, size := tree.Count(), tree.Size()
+	// update half, add some more and reset
+	for i := 0; i < n*thousand; i += 2 {
+		tree.Put(&binary.Entry{Key: makeKey(i).Key, Value: []byte("updated")})
+	}
+	for i := n * thousand; i < 2*n*thousand; i++ {
+		tree.Put(makeKey(i))
+	}
+	util.AssertLen(t, 2*n*thousand, tree.Count())
+	// the snapshot should not have changed
+	util.AssertLen(t, count, snap.Count())
+	util.AssertLen(t, size, snap.Size())
+	for i := 0; i < 2*n*thousand; i++ {
+		e, ok := snap.Get(makeKey(i))
+		if i >= n*thousand {
+			util.AssertEqual(t, false, ok)
+			continue
+		}
+		util.AssertEqual(t, true, ok)
+		util.AssertEqual(t, makeKey(i), e)
+	}
+	tree.Reset()
+	util.AssertLen(t, 0, tree.Count())
+	var i int
+	snap.Scan(func(e *binary.Entry) bool {
+		i++
+		return true
+	})
+	util.AssertLen(t, count, i)
+}
+
+func TestPRBTree_SnapshotConcurrent(t *testing.T) {
+	tree := NewPRBTree()
+	for i := 0; i < n*thousand; i++ {
+		tree.Put(makeKey(i))
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := n * thousand; i < 10*n*thousand; i++ {
+			tree.Put(makeKey(i))
+		}
+	}()
+	// scan snapshots while the writer is running, every
+	// snapshot should be complete and in order
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				snap := tree.Snapshot()
+				var count int
+				var prev []byte
+				snap.Scan(func(e *binary.Entry) bool {
+					if prev != nil && bytes.Compare(prev, e.Key) >= 0 {
+						t.Errorf("scan out of order: %q >= %q", prev, e.Key)
+						return false
+					}
+					prev = e.Key
+					count++
+					return true
+				})
+				if count != snap.Count() {
+					t.Errorf("snapshot count: expected %d, got %d", snap.Count(), count)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	util.AssertLen(t, 10*n*thousand, tree.Count())
+	checkPRBNode(t, tree.load().node)
+}
+
+func BenchmarkPRBTree_Put(b *testing.B) {
+	tree := NewPRBTree()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tree.Put(makeKey(i))
+	}
+}
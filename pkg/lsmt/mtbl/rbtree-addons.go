@@ -43,11 +43,11 @@ func BytesToInt(val []byte) int64 {
 }
 
 func (t *rbTree) ToList() (*list.List, error) {
-	if t.count < 1 {
+	if t.Len() < 1 {
 		return nil, fmt.Errorf("Error: there are not enough entrys in the tree\n")
 	}
 	li := list.New()
-	t.ascend(t.root, t.min(t.root).entry, func(e *binary.Entry) bool {
+	t.Scan(func(e *binary.Entry) bool {
 		li.PushBack(e)
 		return true
 	})
@@ -1,64 +1,46 @@
 package mtbl
 
 import (
-	"bytes"
+	"github.com/scottcagno/storage/pkg/generic/rbtree"
 	"github.com/scottcagno/storage/pkg/lsmt/binary"
 	"runtime"
 	"strings"
 )
 
-var empty *binary.Entry = nil
-
-func compare(this, that *binary.Entry) int {
-	return bytes.Compare(this.Key, that.Key)
-}
-
-const (
-	RED   = 0
-	BLACK = 1
-)
-
-type rbNode struct {
-	left   *rbNode
-	right  *rbNode
-	parent *rbNode
-	color  uint
-	entry  *binary.Entry
-}
-
 type RBTree = rbTree
 
-// rbTree is a struct representing a rbTree
+// rbTree is a red-black tree mem-table. It stores the entries in a
+// generic red-black tree keyed by the entry keys, and keeps track of
+// the size of the entries
 type rbTree struct {
-	NIL   *rbNode
-	root  *rbNode
-	count int
-	size  int64
+	tree *rbtree.RBTree[[]byte, *binary.Entry]
+	size int64
+	cmp  binary.Comparator
 }
 
 func NewRBTree() *rbTree {
-	return newRBTree()
+	return newRBTree(binary.BytewiseComparator)
 }
 
-// NewTree creates and returns a new rbTree
-func newRBTree() *rbTree {
-	n := &rbNode{
-		left:   nil,
-		right:  nil,
-		parent: nil,
-		color:  BLACK,
-		entry:  empty,
+// NewRBTreeWithComparator creates and returns a new rbTree
+// that orders the keys using the provided comparator
+func NewRBTreeWithComparator(cmp binary.Comparator) *rbTree {
+	if cmp == nil {
+		cmp = binary.BytewiseComparator
 	}
+	return newRBTree(cmp)
+}
+
+// NewTree creates and returns a new rbTree
+func newRBTree(cmp binary.Comparator) *rbTree {
 	return &rbTree{
-		NIL:   n,
-		root:  n,
-		count: 0,
-		size:  0,
+		tree: rbtree.NewRBTree[[]byte, *binary.Entry](cmp.Compare),
+		cmp:  cmp,
 	}
 }
 
 func (t *rbTree) Count() int {
-	return t.count
+	return t.tree.Len()
 }
 
 // Has tests and returns a boolean value if the
@@ -148,101 +130,90 @@ func (t *rbTree) PutBatch(batch *binary.Batch) {
 	}
 }
 
+// putInternal upserts the entry and returns it along with a boolean
+// value signaling true if an existing entry was updated, and false if
+// the entry was newly added
 func (t *rbTree) putInternal(entry *binary.Entry) (*binary.Entry, bool) {
 	if entry == nil {
 		return nil, false
 	}
-	// insert return the node along with
-	// a boolean value signaling true if
-	// the node was updated, and false if
-	// the node was newly added.
-	ret, ok := t.insert(&rbNode{
-		left:   t.NIL,
-		right:  t.NIL,
-		parent: t.NIL,
-		color:  RED,
-		entry:  entry,
-	})
-	return ret.entry, ok
+	old, ok := t.tree.Put(entry.Key, entry)
+	if ok {
+		t.size -= int64(old.Size())
+	}
+	t.size += int64(entry.Size())
+	return entry, ok
 }
 
 func (t *rbTree) Get(entry *binary.Entry) (*binary.Entry, bool) {
 	return t.getInternal(entry)
 }
 
-// GetNearMin performs an approximate search for the specified key
-// and returns the closest key that is less than (the predecessor)
-// to the searched key as well as a boolean reporting true if an
-// exact match was found for the key, and false if it is unknown
-// or and exact match was not found
+// GetNearMin returns the entry with the closest key that is less than
+// (the predecessor of) the searched key, or the first entry if there is
+// none, as well as a boolean reporting true if an exact match was found
+// for the key, and false if an exact match was not found
 func (t *rbTree) GetNearMin(entry *binary.Entry) (*binary.Entry, bool) {
 	if entry == nil {
 		return nil, false
 	}
-	ret := t.searchApprox(&rbNode{
-		left:   t.NIL,
-		right:  t.NIL,
-		parent: t.NIL,
-		color:  RED,
-		entry:  entry,
-	})
-	prev := t.predecessor(ret).entry
+	_, prev, _, ok := t.GetApproxPrevNext(entry)
 	if prev == nil {
 		prev, _ = t.Min()
 	}
-	return prev, compare(ret.entry, entry) == 0
+	return prev, ok
 }
 
-// GetNearMax performs an approximate search for the specified key
-// and returns the closest key that is greater than (the successor)
-// to the searched key as well as a boolean reporting true if an
-// exact match was found for the key, and false if it is unknown or
-// and exact match was not found
+// GetNearMax returns the entry with the closest key that is greater
+// than (the successor of) the searched key, as well as a boolean
+// reporting true if an exact match was found for the key, and false
+// if an exact match was not found
 func (t *rbTree) GetNearMax(entry *binary.Entry) (*binary.Entry, bool) {
 	if entry == nil {
 		return nil, false
 	}
-	ret := t.searchApprox(&rbNode{
-		left:   t.NIL,
-		right:  t.NIL,
-		parent: t.NIL,
-		color:  RED,
-		entry:  entry,
-	})
-	return t.successor(ret).entry, compare(ret.entry, entry) == 0
+	_, _, next, ok := t.GetApproxPrevNext(entry)
+	return next, ok
 }
 
 // GetApproxPrevNext performs an approximate search for the specified key
-// and returns the searched key, the predecessor, and the successor and a
-// boolean reporting true if an exact match was found for the key, and false
-// if it is unknown or and exact match was not found
+// and returns the searched entry (or the closest one, if there is no exact
+// match), the predecessor, and the successor and a boolean reporting true
+// if an exact match was found for the key, and false if it was not
 func (t *rbTree) GetApproxPrevNext(entry *binary.Entry) (*binary.Entry, *binary.Entry, *binary.Entry, bool) {
 	if entry == nil {
 		return nil, nil, nil, false
 	}
-	ret := t.searchApprox(&rbNode{
-		left:   t.NIL,
-		right:  t.NIL,
-		parent: t.NIL,
-		color:  RED,
-		entry:  entry,
-	})
-	return ret.entry, t.predecessor(ret).entry, t.successor(ret).entry,
-		compare(ret.entry, entry) == 0
+	var found, prev, next *binary.Entry
+	c := t.tree.Cursor()
+	exact := c.Seek(entry.Key) && t.cmp.Compare(c.Key(), entry.Key) == 0
+	if exact {
+		found = c.Value()
+		if c.Next() {
+			next = c.Value()
+		}
+	} else if c.Valid() {
+		found, next = c.Value(), c.Value()
+	}
+	if c.SeekLE(entry.Key) {
+		if exact {
+			c.Prev()
+		}
+		if c.Valid() {
+			prev = c.Value()
+			if found == nil {
+				found = prev
+			}
+		}
+	}
+	return found, prev, next, exact
 }
 
 func (t *rbTree) getInternal(entry *binary.Entry) (*binary.Entry, bool) {
 	if entry == nil {
 		return nil, false
 	}
-	ret := t.search(&rbNode{
-		left:   t.NIL,
-		right:  t.NIL,
-		parent: t.NIL,
-		color:  RED,
-		entry:  entry,
-	})
-	return ret.entry, ret.entry != nil
+	return t.tree.Get(entry.Key)
 }
 
 func (t *rbTree) Del(entry *binary.Entry) (*binary.Entry, bool) {
@@ -253,19 +224,43 @@ func (t *rbTree) delInternal(entry *binary.Entry) (*binary.Entry, bool) {
 	if entry == nil {
 		return nil, false
 	}
-	cnt := t.count
-	ret := t.delete(&rbNode{
-		left:   t.NIL,
-		right:  t.NIL,
-		parent: t.NIL,
-		color:  RED,
-		entry:  entry,
-	})
-	return ret.entry, cnt == t.count+1
+	old, ok := t.tree.Del(entry.Key)
+	if ok {
+		t.size -= int64(old.Size())
+	}
+	return old, ok
+}
+
+// Rank returns the number of entries in the tree with a key
+// that is less than the key of the provided entry. If the key
+// exists, this is its (zero based) index in sorted order
+func (t *rbTree) Rank(entry *binary.Entry) int {
+	if entry == nil {
+		return 0
+	}
+	return t.tree.Rank(entry.Key)
+}
+
+// Select returns the entry at the provided (zero based) index
+// in sorted order, along with a boolean reporting false if the
+// index is out of range
+func (t *rbTree) Select(i int) (*binary.Entry, bool) {
+	_, e, ok := t.tree.Select(i)
+	return e, ok
+}
+
+// CountRange returns the number of entries with a key that is
+// greater than or equal to the lo key, and less than the hi key
+func (t *rbTree) CountRange(lo, hi *binary.Entry) int {
+	n := t.Rank(hi) - t.Rank(lo)
+	if n < 0 {
+		return 0
+	}
+	return n
 }
 
 func (t *rbTree) Len() int {
-	return t.count
+	return t.tree.Len()
 }
 
 // Size returns the size in bytes
@@ -274,46 +269,38 @@ func (t *rbTree) Size() int64 {
 }
 
 func (t *rbTree) Min() (*binary.Entry, bool) {
-	x := t.min(t.root)
-	if x == t.NIL {
-		return nil, false
-	}
-	return x.entry, true
+	_, e, ok := t.tree.Min()
+	return e, ok
 }
 
 func (t *rbTree) Max() (*binary.Entry, bool) {
-	x := t.max(t.root)
-	if x == t.NIL {
-		return nil, false
-	}
-	return x.entry, true
-}
-
-// helper function for clone
-func (t *rbTree) cloneEntries(t2 *rbTree) {
-	t.ascend(t.root, t.min(t.root).entry, func(e *binary.Entry) bool {
-		t2.putInternal(e)
-		return true
-	})
+	_, e, ok := t.tree.Max()
+	return e, ok
 }
 
 type Iterator func(entry *binary.Entry) bool
 
 func (t *rbTree) Scan(iter Iterator) {
-	t.ascend(t.root, t.min(t.root).entry, iter)
+	t.tree.Ascend(func(_ []byte, e *binary.Entry) bool {
+		return iter(e)
+	})
 }
 
 func (t *rbTree) ScanBack(iter Iterator) {
-	t.descend(t.root, t.max(t.root).entry, iter)
+	t.tree.Descend(func(_ []byte, e *binary.Entry) bool {
+		return iter(e)
+	})
 }
 
 func (t *rbTree) ScanRange(start, end *binary.Entry, iter Iterator) {
-	t.ascendRange(t.root, start, end, iter)
+	t.tree.AscendRange(start.Key, end.Key, func(_ []byte, e *binary.Entry) bool {
+		return iter(e)
+	})
 }
 
 func (t *rbTree) String() string {
 	var sb strings.Builder
-	t.ascend(t.root, t.min(t.root).entry, func(entry *binary.Entry) bool {
+	t.Scan(func(entry *binary.Entry) bool {
 		sb.WriteString(entry.String())
 		return true
 	})
@@ -321,381 +308,13 @@ func (t *rbTree) String() string {
 }
 
 func (t *rbTree) Close() {
-	t.NIL = nil
-	t.root = nil
-	t.count = 0
+	t.tree.Reset()
+	t.size = 0
 	return
 }
 
 func (t *rbTree) Reset() {
-	t.NIL = nil
-	t.root = nil
-	t.count = 0
-	runtime.GC()
-	n := &rbNode{
-		left:   nil,
-		right:  nil,
-		parent: nil,
-		color:  BLACK,
-		entry:  empty,
-	}
-	t.NIL = n
-	t.root = n
-	t.count = 0
+	t.tree.Reset()
 	t.size = 0
-}
-
-func (t *rbTree) insert(z *rbNode) (*rbNode, bool) {
-	x := t.root
-	y := t.NIL
-	for x != t.NIL {
-		y = x
-		if compare(z.entry, x.entry) == -1 {
-			x = x.left
-		} else if compare(x.entry, z.entry) == -1 {
-			x = x.right
-		} else {
-			t.size -= int64(x.entry.Size())
-			t.size += int64(z.entry.Size())
-			// originally we were just returning x
-			// without updating the RBEntry, but if we
-			// want it to have similar behavior to
-			// a hashmap then we need to update any
-			// entries that already exist in the tree
-			x.entry = z.entry
-			return x, true // true means an existing
-			// value was found and updated. It should
-			// be noted that we don't need to re-balance
-			// the tree because they keys are not changing
-			// and the tree is balance is maintained by
-			// the keys and not their values.
-		}
-	}
-	z.parent = y
-	if y == t.NIL {
-		t.root = z
-	} else if compare(z.entry, y.entry) == -1 {
-		y.left = z
-	} else {
-		y.right = z
-	}
-	t.count++
-	t.size += int64(z.entry.Size())
-	t.insertFixup(z)
-	return z, false
-}
-
-func (t *rbTree) leftRotate(x *rbNode) {
-	if x.right == t.NIL {
-		return
-	}
-	y := x.right
-	x.right = y.left
-	if y.left != t.NIL {
-		y.left.parent = x
-	}
-	y.parent = x.parent
-	if x.parent == t.NIL {
-		t.root = y
-	} else if x == x.parent.left {
-		x.parent.left = y
-	} else {
-		x.parent.right = y
-	}
-	y.left = x
-	x.parent = y
-}
-
-func (t *rbTree) rightRotate(x *rbNode) {
-	if x.left == t.NIL {
-		return
-	}
-	y := x.left
-	x.left = y.right
-	if y.right != t.NIL {
-		y.right.parent = x
-	}
-	y.parent = x.parent
-
-	if x.parent == t.NIL {
-		t.root = y
-	} else if x == x.parent.left {
-		x.parent.left = y
-	} else {
-		x.parent.right = y
-	}
-
-	y.right = x
-	x.parent = y
-}
-
-func (t *rbTree) insertFixup(z *rbNode) {
-	for z.parent.color == RED {
-		if z.parent == z.parent.parent.left {
-			y := z.parent.parent.right
-			if y.color == RED {
-				z.parent.color = BLACK
-				y.color = BLACK
-				z.parent.parent.color = RED
-				z = z.parent.parent
-			} else {
-				if z == z.parent.right {
-					z = z.parent
-					t.leftRotate(z)
-				}
-				z.parent.color = BLACK
-				z.parent.parent.color = RED
-				t.rightRotate(z.parent.parent)
-			}
-		} else {
-			y := z.parent.parent.left
-			if y.color == RED {
-				z.parent.color = BLACK
-				y.color = BLACK
-				z.parent.parent.color = RED
-				z = z.parent.parent
-			} else {
-				if z == z.parent.left {
-					z = z.parent
-					t.rightRotate(z)
-				}
-				z.parent.color = BLACK
-				z.parent.parent.color = RED
-				t.leftRotate(z.parent.parent)
-			}
-		}
-	}
-	t.root.color = BLACK
-}
-
-// trying out a slightly different search method
-// that (hopefully) will not return nil values and
-// instead will return approximate node matches
-func (t *rbTree) searchApprox(x *rbNode) *rbNode {
-	p := t.root
-	for p != t.NIL {
-		if compare(p.entry, x.entry) == -1 {
-			if p.right == t.NIL {
-				break
-			}
-			p = p.right
-		} else if compare(x.entry, p.entry) == -1 {
-			if p.left == t.NIL {
-				break
-			}
-			p = p.left
-		} else {
-			break
-		}
-	}
-	return p
-}
-
-func (t *rbTree) search(x *rbNode) *rbNode {
-	p := t.root
-	for p != t.NIL {
-		if compare(p.entry, x.entry) == -1 {
-			p = p.right
-		} else if compare(x.entry, p.entry) == -1 {
-			p = p.left
-		} else {
-			break
-		}
-	}
-	return p
-}
-
-// min traverses from root to left recursively until left is NIL
-func (t *rbTree) min(x *rbNode) *rbNode {
-	if x == t.NIL {
-		return t.NIL
-	}
-	for x.left != t.NIL {
-		x = x.left
-	}
-	return x
-}
-
-// max traverses from root to right recursively until right is NIL
-func (t *rbTree) max(x *rbNode) *rbNode {
-	if x == t.NIL {
-		return t.NIL
-	}
-	for x.right != t.NIL {
-		x = x.right
-	}
-	return x
-}
-
-func (t *rbTree) predecessor(x *rbNode) *rbNode {
-	if x == t.NIL {
-		return t.NIL
-	}
-	if x.left != t.NIL {
-		return t.max(x.left)
-	}
-	y := x.parent
-	for y != t.NIL && x == y.left {
-		x = y
-		y = y.parent
-	}
-	return y
-}
-
-func (t *rbTree) successor(x *rbNode) *rbNode {
-	if x == t.NIL {
-		return t.NIL
-	}
-	if x.right != t.NIL {
-		return t.min(x.right)
-	}
-	y := x.parent
-	for y != t.NIL && x == y.right {
-		x = y
-		y = y.parent
-	}
-	return y
-}
-
-func (t *rbTree) delete(key *rbNode) *rbNode {
-	z := t.search(key)
-	if z == t.NIL {
-		return t.NIL
-	}
-	ret := &rbNode{t.NIL, t.NIL, t.NIL, z.color, z.entry}
-	var y *rbNode
-	var x *rbNode
-	if z.left == t.NIL || z.right == t.NIL {
-		y = z
-	} else {
-		y = t.successor(z)
-	}
-	if y.left != t.NIL {
-		x = y.left
-	} else {
-		x = y.right
-	}
-	x.parent = y.parent
-
-	if y.parent == t.NIL {
-		t.root = x
-	} else if y == y.parent.left {
-		y.parent.left = x
-	} else {
-		y.parent.right = x
-	}
-	if y != z {
-		z.entry = y.entry
-	}
-	if y.color == BLACK {
-		t.deleteFixup(x)
-	}
-	t.size -= int64(ret.entry.Size())
-	t.count--
-	return ret
-}
-
-func (t *rbTree) deleteFixup(x *rbNode) {
-	for x != t.root && x.color == BLACK {
-		if x == x.parent.left {
-			w := x.parent.right
-			if w.color == RED {
-				w.color = BLACK
-				x.parent.color = RED
-				t.leftRotate(x.parent)
-				w = x.parent.right
-			}
-			if w.left.color == BLACK && w.right.color == BLACK {
-				w.color = RED
-				x = x.parent
-			} else {
-				if w.right.color == BLACK {
-					w.left.color = BLACK
-					w.color = RED
-					t.rightRotate(w)
-					w = x.parent.right
-				}
-				w.color = x.parent.color
-				x.parent.color = BLACK
-				w.right.color = BLACK
-				t.leftRotate(x.parent)
-				// this is to exit while loop
-				x = t.root
-			}
-		} else {
-			w := x.parent.left
-			if w.color == RED {
-				w.color = BLACK
-				x.parent.color = RED
-				t.rightRotate(x.parent)
-				w = x.parent.left
-			}
-			if w.left.color == BLACK && w.right.color == BLACK {
-				w.color = RED
-				x = x.parent
-			} else {
-				if w.left.color == BLACK {
-					w.right.color = BLACK
-					w.color = RED
-					t.leftRotate(w)
-					w = x.parent.left
-				}
-				w.color = x.parent.color
-				x.parent.color = BLACK
-				w.left.color = BLACK
-				t.rightRotate(x.parent)
-				x = t.root
-			}
-		}
-	}
-	x.color = BLACK
-}
-
-func (t *rbTree) ascend(x *rbNode, entry *binary.Entry, iter Iterator) bool {
-	if x == t.NIL {
-		return true
-	}
-	if !(compare(x.entry, entry) == -1) {
-		if !t.ascend(x.left, entry, iter) {
-			return false
-		}
-		if !iter(x.entry) {
-			return false
-		}
-	}
-	return t.ascend(x.right, entry, iter)
-}
-
-func (t *rbTree) descend(x *rbNode, pivot *binary.Entry, iter Iterator) bool {
-	if x == t.NIL {
-		return true
-	}
-	if !(compare(pivot, x.entry) == -1) {
-		if !t.descend(x.right, pivot, iter) {
-			return false
-		}
-		if !iter(x.entry) {
-			return false
-		}
-	}
-	return t.descend(x.left, pivot, iter)
-}
-
-func (t *rbTree) ascendRange(x *rbNode, inf, sup *binary.Entry, iter Iterator) bool {
-	if x == t.NIL {
-		return true
-	}
-	if !(compare(x.entry, sup) == -1) {
-		return t.ascendRange(x.left, inf, sup, iter)
-	}
-	if compare(x.entry, inf) == -1 {
-		return t.ascendRange(x.right, inf, sup, iter)
-	}
-	if !t.ascendRange(x.left, inf, sup, iter) {
-		return false
-	}
-	if !iter(x.entry) {
-		return false
-	}
-	return t.ascendRange(x.right, inf, sup, iter)
+	runtime.GC()
 }
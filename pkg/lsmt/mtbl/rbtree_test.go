@@ -6,6 +6,7 @@ import (
 	"github.com/scottcagno/storage/pkg/lsmt/binary"
 	"github.com/scottcagno/storage/pkg/util"
 	"log"
+	"math/rand"
 	"strconv"
 	"testing"
 )
@@ -245,6 +246,45 @@ func TestRbTree_ScanRange(t *testing.T) {
 	tree.Close()
 }
 
+// signature: Rank(entry), Select(i), CountRange(lo, hi)
+func TestRbTree_OrderStatistics(t *testing.T) {
+	tree := NewRBTree()
+	key := func(i int) *binary.Entry {
+		return NewEntry(fmt.Sprintf("key-%06d", i), "v")
+	}
+	for _, i := range rand.Perm(n * thousand) {
+		tree.Put(key(i))
+	}
+	for i := 0; i < n*thousand; i++ {
+		util.AssertEqual(t, i, tree.Rank(key(i)))
+		e, ok := tree.Select(i)
+		util.AssertEqual(t, true, ok)
+		util.AssertEqual(t, string(e.Key), string(key(i).Key))
+	}
+	_, ok := tree.Select(n * thousand)
+	util.AssertEqual(t, false, ok)
+	// remove every third key
+	for _, i := range rand.Perm(n * thousand) {
+		if i%3 == 0 {
+			tree.Del(key(i))
+		}
+	}
+	var i int
+	tree.Scan(func(e *binary.Entry) bool {
+		util.AssertEqual(t, i, tree.Rank(e))
+		s, _ := tree.Select(i)
+		util.AssertEqual(t, e, s)
+		i++
+		return true
+	})
+	util.AssertLen(t, tree.Len(), i)
+	// keys 100 through 199, less the ones that were removed
+	util.AssertEqual(t, 67, tree.CountRange(key(100), key(200)))
+	util.AssertEqual(t, 0, tree.CountRange(key(200), key(100)))
+	util.AssertEqual(t, tree.Len(), tree.CountRange(key(0), key(n*thousand)))
+	tree.Close()
+}
+
 // signature: Close()
 func TestRbTree_Close(t *testing.T) {
 	var tree *RBTree
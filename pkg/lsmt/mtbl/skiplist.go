@@ -0,0 +1,292 @@
+package mtbl
+
+import (
+	"github.com/scottcagno/storage/pkg/lsmt/binary"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+const (
+	skipMaxHeight = 12
+	skipBranching = 4
+)
+
+// skipNode is a single node in the skiplist. The key is immutable once
+// the node has been linked in. The entry and the tower links are only
+// ever read and written atomically.
+type skipNode struct {
+	key   []byte
+	entry unsafe.Pointer   // *binary.Entry
+	next  []unsafe.Pointer // *skipNode
+}
+
+func (n *skipNode) loadEntry() *binary.Entry {
+	return (*binary.Entry)(atomic.LoadPointer(&n.entry))
+}
+
+func (n *skipNode) loadNext(level int) *skipNode {
+	return (*skipNode)(atomic.LoadPointer(&n.next[level]))
+}
+
+func (n *skipNode) storeNext(level int, x *skipNode) {
+	atomic.StorePointer(&n.next[level], unsafe.Pointer(x))
+}
+
+// skipList holds the state of a skiplist between resets
+type skipList struct {
+	head   *skipNode
+	arena  *arena
+	height int32 // height is the current height of the list
+	count  int64 // count is the number of entries
+	size   int64 // size is the size of the entries in bytes
+	cmp    binary.Comparator
+}
+
+func newSkipList(cmp binary.Comparator) *skipList {
+	a := newArena()
+	return &skipList{
+		head:   a.newNode(skipMaxHeight),
+		arena:  a,
+		height: 1,
+		cmp:    cmp,
+	}
+}
+
+// SkipList is an arena-backed skiplist mem-table. Writers are serialized
+// using a mutex, but readers never lock; they simply follow the links
+// using atomic loads, so reads are never blocked by writes (or by each
+// other.) A reset swaps in a fresh list, so any reader that is still
+// iterating over the old list can safely finish doing so.
+type SkipList struct {
+	lock sync.Mutex     // lock serializes the writers
+	list unsafe.Pointer // list is the current *skipList
+	rand *rand.Rand     // rand is used (by writers) to pick node heights
+	cmp  binary.Comparator
+}
+
+// NewSkipList creates and returns a new SkipList
+func NewSkipList() *SkipList {
+	return NewSkipListWithComparator(binary.BytewiseComparator)
+}
+
+// NewSkipListWithComparator creates and returns a new SkipList
+// that orders the keys using the provided comparator
+func NewSkipListWithComparator(cmp binary.Comparator) *SkipList {
+	if cmp == nil {
+		cmp = binary.BytewiseComparator
+	}
+	return &SkipList{
+		list: unsafe.Pointer(newSkipList(cmp)),
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+		cmp:  cmp,
+	}
+}
+
+func (s *SkipList) load() *skipList {
+	return (*skipList)(atomic.LoadPointer(&s.list))
+}
+
+// randomHeight returns a random height for a new node
+func (s *SkipList) randomHeight() int {
+	h := 1
+	for h < skipMaxHeight && s.rand.Intn(skipBranching) == 0 {
+		h++
+	}
+	return h
+}
+
+// findGreaterOrEqual returns the first node with a key that is greater
+// than or equal to the provided key. If prev is not nil, it is filled
+// out with the last node before the returned node on every level.
+func (l *skipList) findGreaterOrEqual(key []byte, prev []*skipNode) *skipNode {
+	x := l.head
+	level := int(atomic.LoadInt32(&l.height)) - 1
+	for {
+		next := x.loadNext(level)
+		if next != nil && l.cmp.Compare(next.key, key) < 0 {
+			// keep searching in this level
+			x = next
+			continue
+		}
+		if prev != nil {
+			prev[level] = x
+		}
+		if level == 0 {
+			return next
+		}
+		// move down a level
+		level--
+	}
+}
+
+func (s *SkipList) putInternal(entry *binary.Entry) (*binary.Entry, bool) {
+	if entry == nil {
+		return nil, false
+	}
+	l := s.load()
+	var prev [skipMaxHeight]*skipNode
+	x := l.findGreaterOrEqual(entry.Key, prev[:])
+	if x != nil && l.cmp.Compare(x.key, entry.Key) == 0 {
+		// update the existing entry in place
+		e := l.arena.newEntry(entry)
+		old := (*binary.Entry)(atomic.SwapPointer(&x.entry, unsafe.Pointer(e)))
+		atomic.AddInt64(&l.size, int64(e.Size()-old.Size()))
+		return e, true
+	}
+	// pick a height for the new node, and grow the list if needed
+	height := s.randomHeight()
+	if cur := int(atomic.LoadInt32(&l.height)); height > cur {
+		for i := cur; i < height; i++ {
+			prev[i] = l.head
+		}
+		atomic.StoreInt32(&l.height, int32(height))
+	}
+	// create the new node
+	e := l.arena.newEntry(entry)
+	n := l.arena.newNode(height)
+	n.key = e.Key
+	n.entry = unsafe.Pointer(e)
+	// link it in, from the bottom up, so a reader will always
+	// find the node once it is reachable from any level
+	for i := 0; i < height; i++ {
+		n.storeNext(i, prev[i].loadNext(i))
+		prev[i].storeNext(i, n)
+	}
+	atomic.AddInt64(&l.count, 1)
+	atomic.AddInt64(&l.size, int64(e.Size()))
+	return e, false
+}
+
+func (s *SkipList) Put(entry *binary.Entry) (*binary.Entry, bool) {
+	// lock
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.putInternal(entry)
+}
+
+// UpsertAndCheckIfFull updates the provided entry if it already
+// exists or inserts the supplied entry as a new entry if it
+// does not exist. UpsertAndCheckIfFull returns the current size
+// in bytes after performing the insert or update. It also returns
+// a boolean reporting true if the list has met or exceeded the
+// provided threshold, and false if the current size is less than
+// the provided threshold.
+func (s *SkipList) UpsertAndCheckIfFull(entry *binary.Entry, threshold int64) (int64, bool) {
+	// lock
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// insert the entry in to the mem-table
+	s.putInternal(entry)
+	size := atomic.LoadInt64(&s.load().size)
+	return size, size >= threshold
+}
+
+// UpsertBatchAndCheckIfFull ranges the batch of entries, and it
+// updates the provided entry if it already exists or inserts the
+// supplied entry as a new entry if it does not exist. When it's
+// finished, UpsertBatchAndCheckIfFull returns the current size in
+// bytes after performing the insert or update. It also returns a
+// boolean value reporting true if the list has met or exceeded the
+// provided threshold, and false if the current size is less than
+// the provided threshold.
+func (s *SkipList) UpsertBatchAndCheckIfFull(batch *binary.Batch, threshold int64) (int64, bool) {
+	// lock
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// range the batch entries
+	for _, e := range batch.Entries {
+		// insert the entry in to the mem-table
+		s.putInternal(e)
+	}
+	size := atomic.LoadInt64(&s.load().size)
+	return size, size >= threshold
+}
+
+// Get returns the entry matching the key of the provided entry. It
+// does not lock, and is safe to call concurrently with writers
+func (s *SkipList) Get(entry *binary.Entry) (*binary.Entry, bool) {
+	if entry == nil {
+		return nil, false
+	}
+	l := s.load()
+	x := l.findGreaterOrEqual(entry.Key, nil)
+	if x == nil || l.cmp.Compare(x.key, entry.Key) != 0 {
+		return nil, false
+	}
+	return x.loadEntry(), true
+}
+
+// Has tests and returns a boolean value if the
+// provided key exists in the list
+func (s *SkipList) Has(entry *binary.Entry) bool {
+	_, ok := s.Get(entry)
+	return ok
+}
+
+// HasKey tests and returns a boolean value if the
+// provided key exists in the list (and is not a tombstone)
+func (s *SkipList) HasKey(k string) bool {
+	e, ok := s.Get(&binary.Entry{Key: []byte(k)})
+	return ok && e != nil && e.Value != nil
+}
+
+// Scan iterates all the entries in ascending order. It does not lock
+func (s *SkipList) Scan(iter Iterator) {
+	l := s.load()
+	for x := l.head.loadNext(0); x != nil; x = x.loadNext(0) {
+		if !iter(x.loadEntry()) {
+			return
+		}
+	}
+}
+
+// ScanRange iterates the entries in ascending order starting with the
+// start key (inclusive) and ending before the end key. It does not lock
+func (s *SkipList) ScanRange(start, end *binary.Entry, iter Iterator) {
+	l := s.load()
+	for x := l.findGreaterOrEqual(start.Key, nil); x != nil; x = x.loadNext(0) {
+		if l.cmp.Compare(x.key, end.Key) >= 0 {
+			return
+		}
+		if !iter(x.loadEntry()) {
+			return
+		}
+	}
+}
+
+// Count returns the number of entries in the list
+func (s *SkipList) Count() int {
+	return int(atomic.LoadInt64(&s.load().count))
+}
+
+// Len returns the number of entries in the list
+func (s *SkipList) Len() int {
+	return s.Count()
+}
+
+// Size returns the size in bytes
+func (s *SkipList) Size() int64 {
+	return atomic.LoadInt64(&s.load().size)
+}
+
+// Reset swaps in a fresh (empty) list. Any readers still
+// using the old list can finish what they are doing
+func (s *SkipList) Reset() {
+	// lock
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	atomic.StorePointer(&s.list, unsafe.Pointer(newSkipList(s.cmp)))
+}
+
+func (s *SkipList) String() string {
+	var sb strings.Builder
+	s.Scan(func(entry *binary.Entry) bool {
+		sb.WriteString(entry.String())
+		return true
+	})
+	return sb.String()
+}
@@ -0,0 +1,196 @@
+package mtbl
+
+import (
+	"bytes"
+	"github.com/scottcagno/storage/pkg/lsmt/binary"
+	"github.com/scottcagno/storage/pkg/util"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestNewSkipList(t *testing.T) {
+	list := NewSkipList()
+	util.AssertNotNil(t, list)
+	util.AssertLen(t, 0, list.Len())
+}
+
+// signature: Put(entry *binary.Entry) (*binary.Entry, bool)
+func TestSkipList_Put(t *testing.T) {
+	list := NewSkipList()
+	for i := 0; i < n*thousand; i++ {
+		_, existing := list.Put(makeKey(i))
+		if existing { // existing=updated
+			t.Errorf("putting: %v", existing)
+		}
+	}
+	util.AssertLen(t, n*thousand, list.Len())
+	// update every entry
+	for i := 0; i < n*thousand; i++ {
+		_, existing := list.Put(&binary.Entry{Key: makeKey(i).Key, Value: []byte("updated")})
+		if !existing {
+			t.Errorf("updating: %v", existing)
+		}
+	}
+	util.AssertLen(t, n*thousand, list.Len())
+}
+
+// signature: Get(entry *binary.Entry) (*binary.Entry, bool)
+func TestSkipList_Get(t *testing.T) {
+	list := NewSkipList()
+	for i := 0; i < n*thousand; i++ {
+		list.Put(makeKey(i))
+	}
+	for i := 0; i < n*thousand; i++ {
+		e, ok := list.Get(makeKey(i))
+		if !ok {
+			t.Errorf("getting: %v", ok)
+		}
+		util.AssertEqual(t, makeKey(i), e)
+	}
+	_, ok := list.Get(NewEntry("not-found", ""))
+	if ok {
+		t.Errorf("getting: found a key that was never added")
+	}
+	// tombstones are found, but HasKey reports false
+	list.Put(NewEntry("10", ""))
+	e, ok := list.Get(NewEntry("10", ""))
+	if !ok || e.Value != nil {
+		t.Errorf("getting tombstone: %v, %v", e, ok)
+	}
+	if list.HasKey("10") {
+		t.Errorf("has key: tombstone reported as existing")
+	}
+}
+
+// signature: Size() int64
+func TestSkipList_Size(t *testing.T) {
+	list := NewSkipList()
+	tree := NewRBTree()
+	for i := 0; i < n*thousand; i++ {
+		list.Put(makeKey(i))
+		tree.Put(makeKey(i))
+	}
+	for i := 0; i < n*thousand; i += 2 {
+		e := &binary.Entry{Key: makeKey(i).Key, Value: []byte("a-longer-updated-value")}
+		list.Put(e)
+		tree.Put(e)
+	}
+	// size accounting should match the red-black tree
+	util.AssertLen(t, tree.Size(), list.Size())
+}
+
+// signature: Scan(iter Iterator)
+func TestSkipList_Scan(t *testing.T) {
+	list := NewSkipList()
+	tree := NewRBTree()
+	for i := n*thousand - 1; i >= 0; i-- {
+		list.Put(makeKey(i))
+		tree.Put(makeKey(i))
+	}
+	// the ordering should match the red-black tree
+	var want, got []*binary.Entry
+	tree.Scan(func(e *binary.Entry) bool {
+		want = append(want, e)
+		return true
+	})
+	list.Scan(func(e *binary.Entry) bool {
+		got = append(got, e)
+		return true
+	})
+	util.AssertLen(t, len(want), len(got))
+	for i := range want {
+		if !bytes.Equal(want[i].Key, got[i].Key) {
+			t.Fatalf("scan: expected %q, got %q", want[i].Key, got[i].Key)
+		}
+	}
+}
+
+// signature: ScanRange(start, end *binary.Entry, iter Iterator)
+func TestSkipList_ScanRange(t *testing.T) {
+	list := NewSkipList()
+	for i := 0; i < n*thousand; i++ {
+		list.Put(makeKey(i))
+	}
+	start, stop := makeKey(300), makeKey(700)
+	var count int
+	list.ScanRange(start, stop, func(e *binary.Entry) bool {
+		if bytes.Compare(e.Key, start.Key) == -1 || bytes.Compare(e.Key, stop.Key) != -1 {
+			t.Errorf("scan range, issue with key: %s", e)
+			return false
+		}
+		count++
+		return true
+	})
+	if count == 0 {
+		t.Errorf("scan range: no entries found")
+	}
+}
+
+// signature: Reset()
+func TestSkipList_Reset(t *testing.T) {
+	list := NewSkipList()
+	for i := 0; i < n*thousand; i++ {
+		list.Put(makeKey(i))
+	}
+	list.Reset()
+	util.AssertLen(t, 0, list.Len())
+	util.AssertLen(t, int64(0), list.Size())
+	_, ok := list.Get(makeKey(1))
+	if ok {
+		t.Errorf("getting: found a key after reset")
+	}
+}
+
+func TestSkipList_ConcurrentReaders(t *testing.T) {
+	list := NewSkipList()
+	var wg sync.WaitGroup
+	// one writer
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10*thousand; i++ {
+			list.Put(makeKey(i))
+		}
+	}()
+	// many readers
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10*thousand; i++ {
+				e, ok := list.Get(makeKey(i))
+				if ok && !bytes.Equal(e.Value, []byte(strconv.Itoa(i))) {
+					t.Errorf("getting: bad value %q", e.Value)
+					return
+				}
+			}
+			var prev []byte
+			list.Scan(func(e *binary.Entry) bool {
+				if prev != nil && bytes.Compare(prev, e.Key) != -1 {
+					t.Errorf("scan: keys out of order %q >= %q", prev, e.Key)
+					return false
+				}
+				prev = e.Key
+				return true
+			})
+		}()
+	}
+	wg.Wait()
+	util.AssertLen(t, 10*thousand, list.Len())
+}
+
+func BenchmarkSkipList_Get(b *testing.B) {
+	list := NewSkipList()
+	for i := 0; i < 10*thousand; i++ {
+		list.Put(makeKey(i))
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			list.Get(makeKey(i % (10 * thousand)))
+			i++
+		}
+	})
+}
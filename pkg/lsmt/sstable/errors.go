@@ -6,4 +6,6 @@ var (
 	ErrSSTIndexNotFound     = errors.New("sstable: gindex not found")
 	ErrSSTEmptyBatch        = errors.New("sstable: batch is empty or nil")
 	ErrInvalidScanDirection = errors.New("sstable: invalid scan direction")
+	ErrNoMergeOperator      = errors.New("sstable: no merge operator")
+	ErrMergeFailed          = errors.New("sstable: merge operator failed")
 )
@@ -2,8 +2,8 @@ package sstable
 
 import (
 	"fmt"
+	"github.com/scottcagno/storage/pkg/generic/rbtree"
 	"github.com/scottcagno/storage/pkg/lsmt/binary"
-	"github.com/scottcagno/storage/pkg/lsmt/trees/rbtree"
 	"io"
 	"math"
 	"os"
@@ -28,9 +28,14 @@ type SSTIndex struct {
 	first string
 	last  string
 	data  []*binary.Index
+	cmp   binary.Comparator
 }
 
 func OpenSSTIndex(base string, index int64) (*SSTIndex, error) {
+	return openSSTIndex(base, index, binary.BytewiseComparator)
+}
+
+func openSSTIndex(base string, index int64, cmp binary.Comparator) (*SSTIndex, error) {
 	// make sure we are working with absolute paths
 	base, err := filepath.Abs(base)
 	if err != nil {
@@ -50,6 +55,7 @@ func OpenSSTIndex(base string, index int64) (*SSTIndex, error) {
 		path: path,
 		file: file,
 		open: true,
+		cmp:  cmp,
 	}
 	// load sst data gindex info
 	err = ssi.LoadSSIndexData()
@@ -145,7 +151,7 @@ func (ssi *SSTIndex) searchDataIndex(key string) int {
 	// otherwise, perform binary search
 	for i < j {
 		h := i + (j-i)/2
-		if key >= string(ssi.data[h].Key) {
+		if ssi.cmp.Compare([]byte(key), ssi.data[h].Key) >= 0 {
 			i = h + 1
 		} else {
 			j = h
@@ -170,6 +176,11 @@ func (ssi *SSTIndex) Find(key string) (*binary.Index, error) {
 	if i == nil || i.Offset == -1 {
 		return nil, ErrSSTIndexNotFound
 	}
+	// the search returns the closest key that is less than
+	// or equal to the key, so make sure it is an exact match
+	if ssi.cmp.Compare(i.Key, []byte(key)) != 0 {
+		return nil, ErrSSTIndexNotFound
+	}
 	// return data entry
 	return i, nil
 }
@@ -208,7 +219,7 @@ func (ssi *SSTIndex) GenerateAndGetSparseIndex() ([]*binary.Index, error) {
 	return sparseSet, nil
 }
 
-func (ssi *SSTIndex) GenerateAndPutSparseIndex(sparseIndex *rbtree.RBTree) error {
+func (ssi *SSTIndex) GenerateAndPutSparseIndex(sparseIndex *rbtree.RBTree[string, spiEntry]) error {
 	if !ssi.open {
 		return binary.ErrFileClosed
 	}
@@ -220,7 +231,7 @@ func (ssi *SSTIndex) GenerateAndPutSparseIndex(sparseIndex *rbtree.RBTree) error
 	ratio := calculateSparseRatio(count)
 	for i := int64(0); i < count; i++ {
 		if i%(count/ratio) == 0 {
-			sparseIndex.Put(spiEntry{
+			sparseIndex.Put(string(ssi.data[i].Key), spiEntry{
 				Key:        string(ssi.data[i].Key),
 				SSTIndex:   index,
 				IndexEntry: ssi.data[i],
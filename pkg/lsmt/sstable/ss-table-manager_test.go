@@ -5,6 +5,7 @@ import (
 	"github.com/scottcagno/storage/pkg/lsmt/binary"
 	"github.com/scottcagno/storage/pkg/util"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -127,3 +128,36 @@ func TestSSTManager(t *testing.T) {
 		*/
 	}
 }
+
+func TestSSTManager_SearchWithComparator(t *testing.T) {
+	// keys that only differ in case are equal using this comparator
+	cmp := binary.NewComparator("test.CaseInsensitive", func(a, b []byte) int {
+		return strings.Compare(strings.ToLower(string(a)), strings.ToLower(string(b)))
+	})
+	sstm, err := OpenSSTManagerWithComparator(t.TempDir(), cmp)
+	if err != nil {
+		t.Fatalf("opening ss-table-manager: %v\n", err)
+	}
+	defer sstm.Close()
+	batch := binary.NewBatch()
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("Key-%04d", i)
+		batch.Write(key, []byte(key))
+	}
+	batch.SortWith(cmp)
+	err = sstm.flushBatchToSSTable(batch)
+	if err != nil {
+		t.Fatalf("flushing batch to ss-table: %v\n", err)
+	}
+	// none of these are stored with the same bytes, so they are
+	// only found when the keys are compared using the comparator
+	for _, key := range []string{"KEY-0000", "key-0042", "kEy-0050"} {
+		e, err := sstm.Search(key)
+		if err != nil {
+			t.Fatalf("searching for %q: %v\n", key, err)
+		}
+		if !strings.EqualFold(string(e.Value), key) {
+			t.Errorf("searching for %q: got %q\n", key, e.Value)
+		}
+	}
+}
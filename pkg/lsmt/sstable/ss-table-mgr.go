@@ -3,10 +3,11 @@ package sstable
 import (
 	"bytes"
 	"fmt"
+	"github.com/scottcagno/storage/pkg/generic/rbtree"
 	"github.com/scottcagno/storage/pkg/lsmt/binary"
 	"github.com/scottcagno/storage/pkg/lsmt/mtbl"
-	"github.com/scottcagno/storage/pkg/lsmt/trees/rbtree"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
@@ -28,14 +29,6 @@ type spiEntry struct {
 	IndexEntry *binary.Index
 }
 
-func (r spiEntry) Compare(that rbtree.RBEntry) int {
-	return strings.Compare(r.Key, that.(spiEntry).Key)
-}
-
-func (r spiEntry) Size() int {
-	return len(r.Key) + 16
-}
-
 func (r spiEntry) String() string {
 	return fmt.Sprintf("entry.LastKey=%q", r.Key)
 }
@@ -50,11 +43,23 @@ type SSTManager struct {
 	lock        sync.RWMutex
 	base        string
 	sequence    int64
-	sparseIndex *rbtree.RBTree
+	sparseIndex *rbtree.RBTree[string, spiEntry]
 	fileIndexes []int64
+	cmp         binary.Comparator
+	merge       binary.MergeOperator
 }
 
 func OpenSSTManager(base string) (*SSTManager, error) {
+	return OpenSSTManagerWithComparator(base, binary.BytewiseComparator)
+}
+
+// OpenSSTManagerWithComparator opens an SSTManager that orders the keys
+// (in the ss-tables, the indexes and the sparse index) using the provided
+// comparator. It must be the same comparator the tables were written with.
+func OpenSSTManagerWithComparator(base string, cmp binary.Comparator) (*SSTManager, error) {
+	if cmp == nil {
+		cmp = binary.BytewiseComparator
+	}
 	// make sure we are working with absolute paths
 	base, err := filepath.Abs(base)
 	if err != nil {
@@ -67,11 +72,16 @@ func OpenSSTManager(base string) (*SSTManager, error) {
 	if err != nil {
 		return nil, err
 	}
+	// the sparse index is ordered using the comparator
+	compare := func(a, b string) int {
+		return binary.CompareKeys(cmp, a, b)
+	}
 	// create ss-table-manager instance
 	sstm := &SSTManager{
 		base:        base,
 		sequence:    0,
-		sparseIndex: rbtree.NewRBTree(),
+		sparseIndex: rbtree.NewRBTree[string, spiEntry](compare),
+		cmp:         cmp,
 	}
 	// read the ss-table directory
 	files, err := os.ReadDir(base)
@@ -93,7 +103,7 @@ func OpenSSTManager(base string) (*SSTManager, error) {
 			return nil, err
 		}
 		// open the ss-index file
-		ssi, err := OpenSSTIndex(sstm.base, index)
+		ssi, err := openSSTIndex(sstm.base, index, sstm.cmp)
 		if err != nil {
 			return nil, err
 		}
@@ -117,12 +127,21 @@ func OpenSSTManager(base string) (*SSTManager, error) {
 	return sstm, nil
 }
 
-func (sstm *SSTManager) FlushToSSTable(mt *mtbl.RBTree) error {
+// SetMergeOperator sets the merge operator that is used to collapse
+// merge entries (and the entries they apply to) during compaction
+func (sstm *SSTManager) SetMergeOperator(op binary.MergeOperator) {
+	// lock
+	sstm.lock.Lock()
+	defer sstm.lock.Unlock()
+	sstm.merge = op
+}
+
+func (sstm *SSTManager) FlushToSSTable(mt mtbl.Memtable) error {
 	// lock
 	sstm.lock.Lock()
 	defer sstm.lock.Unlock()
 	// open new ss-table
-	sst, err := OpenSSTable(sstm.base, sstm.sequence+1)
+	sst, err := openSSTable(sstm.base, sstm.sequence+1, sstm.cmp)
 	if err != nil {
 		return err
 	}
@@ -150,6 +169,7 @@ func (sstm *SSTManager) FlushToSSTable(mt *mtbl.RBTree) error {
 	}
 	// in the clear, increment sequence number
 	sstm.sequence++
+	sstm.fileIndexes = append(sstm.fileIndexes, sstm.sequence)
 	// return
 	return nil
 }
@@ -159,7 +179,7 @@ func (sstm *SSTManager) flushBatchToSSTable(batch *binary.Batch) error {
 	sstm.lock.Lock()
 	defer sstm.lock.Unlock()
 	// open new ss-table
-	sst, err := OpenSSTable(sstm.base, sstm.sequence+1)
+	sst, err := openSSTable(sstm.base, sstm.sequence+1, sstm.cmp)
 	if err != nil {
 		return err
 	}
@@ -180,6 +200,7 @@ func (sstm *SSTManager) flushBatchToSSTable(batch *binary.Batch) error {
 	}
 	// in the clear, increment sequence
 	sstm.sequence++
+	sstm.fileIndexes = append(sstm.fileIndexes, sstm.sequence)
 	// return, dummy
 	return nil
 }
@@ -202,31 +223,39 @@ func (sstm *SSTManager) SearchSparseIndex(k string) (int64, error) {
 }
 
 func (sstm *SSTManager) searchSparseIndex(k string) (spiEntry, error) {
-	// search "sparse index"
-	e, nearMin, nearMax, exact := sstm.sparseIndex.GetApproxPrevNext(spiEntry{Key: k})
-	if exact {
+	// search "sparse index" for the first key that is
+	// greater than or equal to the key we are looking for
+	c := sstm.sparseIndex.Cursor()
+	if !c.Seek(k) {
+		// key is greater than every key in the sparse
+		// index, which means it is not located in a table
+		return spiEntry{SSTIndex: -1}, binary.ErrBadEntry
+	}
+	if sstm.cmp.Compare([]byte(c.Key()), []byte(k)) == 0 {
 		// found exact entry
-		return e.(spiEntry), nil
+		return c.Value(), nil
 	}
-	// check to see if key is greater than near max
-	if nearMax == nil || k > nearMax.(spiEntry).Key {
-		// note: nearMax should be nil if the key is out of range
-		// key is greater than the near max, which
-		// means it is not located in this table
+	// if we get here, key is less than the next sparse index key,
+	// so step back to the entry before it (the closest key that
+	// is less than the key) which is the table it is most likely in
+	if !c.Prev() {
+		// the key is less than every key in the sparse index
 		return spiEntry{SSTIndex: -1}, binary.ErrBadEntry
 	}
-	// if we get here, key is less than near max
-	if nearMin != nil && k >= nearMin.(spiEntry).Key {
-		// and key is greater than the near min which
-		// means that it is most likely in this table
-		//util.DEBUG("[nearMin] searchSparseIndex(%q) returning: entry found in near min\n", k)
-		return nearMin.(spiEntry), nil
-	}
-	//util.DEBUG("[weird end stage] searchSparseIndex(%q) returning: error bad entry\n", k)
-	// if we get here something bad happened?? this uaully
-	// means a key was searched for that is less than the near
-	// min or something that just doesn't compute well
-	return spiEntry{SSTIndex: -1}, binary.ErrBadEntry
+	return c.Value(), nil
+}
+
+// sortedFileIndexes returns a sorted copy of the ss-index files, so that
+// readers holding only the read lock do not reorder the shared slice
+func (sstm *SSTManager) sortedFileIndexes(reverse bool) []int64 {
+	indexes := make([]int64, len(sstm.fileIndexes))
+	copy(indexes, sstm.fileIndexes)
+	if reverse {
+		sort.Sort(sort.Reverse(Int64Slice(indexes)))
+	} else {
+		sort.Sort(Int64Slice(indexes))
+	}
+	return indexes
 }
 
 type ScanDirection int
@@ -237,27 +266,50 @@ const (
 )
 
 func (sstm *SSTManager) Scan(direction ScanDirection, iter func(e *binary.Entry) bool) error {
+	return sstm.scan(direction, false, iter)
+}
+
+// ScanMerged is like Scan, but it collapses any merge entries with the
+// entries of the older tables using the merge operator, so that iter is
+// only ever provided value entries and tombstones.
+func (sstm *SSTManager) ScanMerged(direction ScanDirection, iter func(e *binary.Entry) bool) error {
+	return sstm.scan(direction, true, iter)
+}
+
+func (sstm *SSTManager) scan(direction ScanDirection, collapse bool, iter func(e *binary.Entry) bool) error {
 	if direction != ScanOldToNew && direction != ScanNewToOld {
 		return ErrInvalidScanDirection
 	}
-	if direction == ScanNewToOld {
-		// sort the ss-index files so the most recent ones are first
-		sort.Sort(sort.Reverse(Int64Slice(sstm.fileIndexes)))
-	}
-	if direction == ScanOldToNew {
-		// sort the ss-index files so the least recent ones are first
-		sort.Sort(Int64Slice(sstm.fileIndexes))
-	}
+	// read lock
+	sstm.lock.RLock()
+	defer sstm.lock.RUnlock()
+	// sort a copy of the ss-index files so the most recent
+	// (or the least recent) ones are first
+	indexes := sstm.sortedFileIndexes(direction == ScanNewToOld)
 	// start iterating
-	for _, index := range sstm.fileIndexes {
+	for _, index := range indexes {
 		// open the ss-table
-		sst, err := OpenSSTable(sstm.base, index)
+		sst, err := openSSTable(sstm.base, index, sstm.cmp)
 		if err != nil {
 			return err
 		}
 		// scan the ss-table
-		err = sst.Scan(iter)
+		var merr error
+		err = sst.Scan(func(e *binary.Entry) bool {
+			// collapse any merge entries using the older tables
+			if collapse && e.IsMerge() {
+				e, merr = sstm.collapseMerge(e.Key, [][]byte{e.Value}, index)
+				if merr != nil {
+					return false
+				}
+			}
+			return iter(e)
+		})
+		if err == nil {
+			err = merr
+		}
 		if err != nil {
+			_ = sst.Close()
 			return err
 		}
 		// close the ss-table
@@ -273,12 +325,12 @@ func (sstm *SSTManager) Search0(k string) (*binary.Entry, error) {
 	// read lock
 	sstm.lock.RLock()
 	defer sstm.lock.RUnlock()
-	// sort the ss-index files so the most recent ones are first
-	sort.Sort(sort.Reverse(Int64Slice(sstm.fileIndexes)))
+	// sort a copy of the ss-index files so the most recent ones are first
+	indexes := sstm.sortedFileIndexes(true)
 	// start iterating
-	for _, index := range sstm.fileIndexes {
+	for _, index := range indexes {
 		// open the ss-table
-		sst, err := OpenSSTable(sstm.base, index)
+		sst, err := openSSTable(sstm.base, index, sstm.cmp)
 		if err != nil {
 			return nil, err
 		}
@@ -319,19 +371,19 @@ func (sstm *SSTManager) LinearSearch(k string) (*binary.Entry, error) {
 	// read lock
 	sstm.lock.RLock()
 	defer sstm.lock.RUnlock()
-	// sort the ss-index files so the most recent ones are first
-	sort.Sort(sort.Reverse(Int64Slice(sstm.fileIndexes)))
+	// sort a copy of the ss-index files so the most recent ones are first
+	indexes := sstm.sortedFileIndexes(true)
 	// iterate the ss-index files (backward)
-	for _, index := range sstm.fileIndexes {
+	for _, index := range indexes {
 		// open the ss-table
-		sst, err := OpenSSTable(sstm.base, index)
+		sst, err := openSSTable(sstm.base, index, sstm.cmp)
 		if err != nil {
 			return nil, err
 		}
 		// perform binary search, attempt to
 		// locate a matching entry
 		de, err := sst.Read(k)
-		if err != nil {
+		if err != nil && err != ErrSSTIndexNotFound {
 			return nil, err
 		}
 		// do not forget to close the ss-table
@@ -349,16 +401,125 @@ func (sstm *SSTManager) LinearSearch(k string) (*binary.Entry, error) {
 	return nil, binary.ErrEntryNotFound
 }
 
+// searchTables searches the tables with an index less than the one provided
+// (from newest to oldest) for the provided key, and calls iter with each of
+// the matching entries until iter returns false. It does not lock.
+func (sstm *SSTManager) searchTables(k string, before int64, iter func(e *binary.Entry) bool) error {
+	// sort a copy of the ss-index files so the most recent ones are first
+	indexes := make([]int64, 0, len(sstm.fileIndexes))
+	for _, index := range sstm.fileIndexes {
+		if index < before {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Sort(sort.Reverse(Int64Slice(indexes)))
+	for _, index := range indexes {
+		// open the ss-table
+		sst, err := openSSTable(sstm.base, index, sstm.cmp)
+		if err != nil {
+			return err
+		}
+		// attempt to locate a matching entry
+		de, err := sst.Read(k)
+		if err != nil && err != ErrSSTIndexNotFound {
+			_ = sst.Close()
+			return err
+		}
+		// do not forget to close the ss-table
+		err = sst.Close()
+		if err != nil {
+			return err
+		}
+		if de != nil && !iter(de) {
+			break
+		}
+	}
+	return nil
+}
+
+// SearchAll searches all the ss-tables (from newest to oldest) for the
+// provided key, and calls iter with each of the matching entries until
+// iter returns false.
+func (sstm *SSTManager) SearchAll(k string, iter func(e *binary.Entry) bool) error {
+	// read lock
+	sstm.lock.RLock()
+	defer sstm.lock.RUnlock()
+	return sstm.searchTables(k, math.MaxInt64, iter)
+}
+
+// collapseMerge applies the provided merge operands (newest first) along
+// with any merge entries found in the tables with an index less than the
+// one provided, to the newest value it finds, and returns the result as a
+// regular (value) entry. It does not lock.
+func (sstm *SSTManager) collapseMerge(key []byte, operands [][]byte, before int64) (*binary.Entry, error) {
+	if sstm.merge == nil {
+		return nil, ErrNoMergeOperator
+	}
+	var existing []byte
+	err := sstm.searchTables(string(key), before, func(e *binary.Entry) bool {
+		if e.IsMerge() {
+			operands = append(operands, e.Value)
+			return true
+		}
+		existing = e.Value
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the operands were collected newest first
+	for i, j := 0, len(operands)-1; i < j; i, j = i+1, j-1 {
+		operands[i], operands[j] = operands[j], operands[i]
+	}
+	value, ok := sstm.merge.FullMerge(key, existing, operands)
+	if !ok {
+		return nil, ErrMergeFailed
+	}
+	return &binary.Entry{Key: key, Value: value}, nil
+}
+
+// ResolveMerge applies the provided merge operands (newest first) along with
+// any merge entries found in the ss-tables to the newest value it finds, and
+// returns the resulting value.
+func (sstm *SSTManager) ResolveMerge(k string, operands [][]byte) ([]byte, error) {
+	// read lock
+	sstm.lock.RLock()
+	defer sstm.lock.RUnlock()
+	e, err := sstm.collapseMerge([]byte(k), operands, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	return e.Value, nil
+}
+
+// mergeEntries combines a merge entry with an older entry for the same
+// key (found in the table with the provided index) in to a single entry
+func (sstm *SSTManager) mergeEntries(older, newer *binary.Entry, index int64) (*binary.Entry, error) {
+	if !older.IsMerge() {
+		// the older entry is a value (or a tombstone)
+		value, ok := sstm.merge.FullMerge(newer.Key, older.Value, [][]byte{newer.Value})
+		if !ok {
+			return nil, ErrMergeFailed
+		}
+		return &binary.Entry{Key: newer.Key, Value: value}, nil
+	}
+	// both are merge operands, so attempt to combine them
+	operand, ok := sstm.merge.PartialMerge(newer.Key, older.Value, newer.Value)
+	if ok {
+		return &binary.Entry{Key: newer.Key, Value: operand, Type: binary.EntryTypeMerge}, nil
+	}
+	// otherwise, they have to be applied to the older tables
+	return sstm.collapseMerge(newer.Key, [][]byte{newer.Value, older.Value}, index)
+}
+
 func (sstm *SSTManager) CheckDeleteInSparseIndex(k string) {
 	// lock
 	sstm.lock.Lock()
 	defer sstm.lock.Unlock()
-	// make sparse index entry
-	sie := spiEntry{Key: k}
 	// search for exact key in sparse index
-	if sstm.sparseIndex.Has(sie) {
+	if sstm.sparseIndex.Has(k) {
 		// remove key from sparse index
-		sstm.sparseIndex.Del(sie)
+		sstm.sparseIndex.Del(k)
 	}
 }
 
@@ -372,7 +533,7 @@ func (sstm *SSTManager) Search(k string) (*binary.Entry, error) {
 		return nil, err
 	}
 	// open ss-table
-	sst, err := OpenSSTable(sstm.base, sie.SSTIndex)
+	sst, err := openSSTable(sstm.base, sie.SSTIndex, sstm.cmp)
 	if err != nil {
 		return nil, err
 	}
@@ -380,7 +541,7 @@ func (sstm *SSTManager) Search(k string) (*binary.Entry, error) {
 	matchedEntry := new(binary.Entry)
 	// for key match at offset in spiEntry
 	err = sst.ScanAt(sie.IndexEntry.Offset, func(e *binary.Entry) bool {
-		if string(e.Key) == k {
+		if sstm.cmp.Compare(e.Key, []byte(k)) == 0 {
 			// we found our match, write data into matchedEntry
 			matchedEntry = e
 			return false // to stop scanning
@@ -422,14 +583,22 @@ func (sstm *SSTManager) CompactSSTable(index int64) error {
 	sstm.lock.Lock()
 	defer sstm.lock.Unlock()
 	// load sstable
-	sst, err := OpenSSTable(sstm.base, index)
+	sst, err := openSSTable(sstm.base, index, sstm.cmp)
 	if err != nil {
 		return err
 	}
 	// make batch
 	batch := binary.NewBatch()
 	// iterate
+	var merr error
 	err = sst.Scan(func(e *binary.Entry) bool {
+		// collapse any merge entries using the older tables
+		if e.IsMerge() && sstm.merge != nil {
+			e, merr = sstm.collapseMerge(e.Key, [][]byte{e.Value}, index)
+			if merr != nil {
+				return false
+			}
+		}
 		// add any data entries that are not tombstones to batch
 		if e.Value != nil && !bytes.Equal(e.Value, Tombstone) {
 			batch.WriteEntry(e)
@@ -439,6 +608,9 @@ func (sstm *SSTManager) CompactSSTable(index int64) error {
 	if err != nil {
 		return err
 	}
+	if merr != nil {
+		return merr
+	}
 	// get path
 	tpath, ipath := sst.path, sst.index.path
 	// close sstable
@@ -457,7 +629,7 @@ func (sstm *SSTManager) CompactSSTable(index int64) error {
 		return err
 	}
 	// open new ss-table to write to
-	sst, err = OpenSSTable(sstm.base, index)
+	sst, err = openSSTable(sstm.base, index, sstm.cmp)
 	if err != nil {
 		return err
 	}
@@ -505,19 +677,19 @@ func (sstm *SSTManager) MergeSSTables(iA, iB int64) error {
 	sstm.lock.Lock()
 	defer sstm.lock.Unlock()
 	// load sstable A
-	sstA, err := OpenSSTable(sstm.base, iA)
+	sstA, err := openSSTable(sstm.base, iA, sstm.cmp)
 	if err != nil {
 		return err
 	}
 	// and sstable B
-	sstB, err := OpenSSTable(sstm.base, iB)
+	sstB, err := openSSTable(sstm.base, iB, sstm.cmp)
 	if err != nil {
 		return err
 	}
 	// make batch to write data to
 	batch := binary.NewBatch()
 	// pass tables to the merge writer
-	err = mergeTablesAndWriteToBatch(sstA, sstB, batch)
+	err = sstm.mergeTablesAndWriteToBatch(sstA, sstB, iA, batch)
 	if err != nil {
 		return err
 	}
@@ -532,7 +704,7 @@ func (sstm *SSTManager) MergeSSTables(iA, iB int64) error {
 		return err
 	}
 	// open new sstable to write to
-	sstC, err := OpenSSTable(sstm.base, iB+1)
+	sstC, err := openSSTable(sstm.base, iB+1, sstm.cmp)
 	if err != nil {
 		return err
 	}
@@ -551,27 +723,39 @@ func (sstm *SSTManager) Close() error {
 	return nil
 }
 
-func mergeTablesAndWriteToBatch(sstA, sstB *SSTable, batch *binary.Batch) error {
+func (sstm *SSTManager) mergeTablesAndWriteToBatch(sstA, sstB *SSTable, iA int64, batch *binary.Batch) error {
 
+	cmp := sstm.cmp
 	i, j := 0, 0
 	n1, n2 := sstA.index.Len(), sstB.index.Len()
 
 	var err error
 	var de *binary.Entry
 	for i < n1 && j < n2 {
-		if bytes.Compare(sstA.index.data[i].Key, sstB.index.data[j].Key) == 0 {
+		if cmp.Compare(sstA.index.data[i].Key, sstB.index.data[j].Key) == 0 {
 			// read entry from sstB
 			de, err = sstB.ReadAt(sstB.index.data[j].Offset)
 			if err != nil {
 				return err
 			}
+			// collapse merge entries with the entry from sstA
+			if de.IsMerge() && sstm.merge != nil {
+				older, err := sstA.ReadAt(sstA.index.data[i].Offset)
+				if err != nil {
+					return err
+				}
+				de, err = sstm.mergeEntries(older, de, iA)
+				if err != nil {
+					return err
+				}
+			}
 			// write entry to batch
 			batch.WriteEntry(de)
 			i++
 			j++
 			continue
 		}
-		if bytes.Compare(sstA.index.data[i].Key, sstB.index.data[j].Key) == -1 {
+		if cmp.Compare(sstA.index.data[i].Key, sstB.index.data[j].Key) < 0 {
 			// read entry from sstA
 			de, err = sstA.ReadAt(sstA.index.data[i].Offset)
 			if err != nil {
@@ -582,7 +766,7 @@ func mergeTablesAndWriteToBatch(sstA, sstB *SSTable, batch *binary.Batch) error
 			i++
 			continue
 		}
-		if bytes.Compare(sstB.index.data[j].Key, sstA.index.data[i].Key) == -1 {
+		if cmp.Compare(sstB.index.data[j].Key, sstA.index.data[i].Key) < 0 {
 			// read entry from sstB
 			de, err = sstB.ReadAt(sstB.index.data[j].Offset)
 			if err != nil {
@@ -0,0 +1,165 @@
+package sstable
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/scottcagno/storage/pkg/hyperloglog"
+	"github.com/scottcagno/storage/pkg/lsmt/binary"
+	"os"
+	"strconv"
+)
+
+// Every ss-table keeps a HyperLogLog sketch of the keys of its live
+// (non-tombstone) entries, and one of the keys of its tombstones, in
+// files next to the data and index files. The sketches of all the
+// tables can be merged to estimate the number of distinct live keys
+// on disk without scanning the tables.
+const (
+	sketchFileSuffix          = ".hll"
+	tombstoneSketchFileSuffix = ".hlt"
+	SketchPrecision           = 14
+)
+
+func SketchFileNameFromIndex(index int64) string {
+	hexa := strconv.FormatInt(index, 16)
+	return fmt.Sprintf("%s%010s%s", filePrefix, hexa, sketchFileSuffix)
+}
+
+func TombstoneSketchFileNameFromIndex(index int64) string {
+	hexa := strconv.FormatInt(index, 16)
+	return fmt.Sprintf("%s%010s%s", filePrefix, hexa, tombstoneSketchFileSuffix)
+}
+
+// isLive reports whether the entry holds a value (or a merge operand)
+func isLive(e *binary.Entry) bool {
+	return e.Value != nil && !bytes.Equal(e.Value, Tombstone)
+}
+
+// addToSketch adds the key of the entry to the live or the tombstone
+// sketch of the table. The sketches are created the first time it is
+// called, and are written out when the table is closed.
+func (sst *SSTable) addToSketch(e *binary.Entry) {
+	if sst.sketch == nil {
+		sst.sketch, _ = hyperloglog.NewHyperLogLog(SketchPrecision)
+		sst.tombs, _ = hyperloglog.NewHyperLogLog(SketchPrecision)
+	}
+	if e == nil {
+		return
+	}
+	if isLive(e) {
+		sst.sketch.Add(e.Key)
+	} else {
+		sst.tombs.Add(e.Key)
+	}
+}
+
+// writeSketches writes the live and the tombstone sketch to the
+// sketch files of the table
+func (sst *SSTable) writeSketches(live, deleted *hyperloglog.HyperLogLog) error {
+	data, err := live.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(sst.sketchPath, data, 0666)
+	if err != nil {
+		return err
+	}
+	data, err = deleted.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sst.tombsPath, data, 0666)
+}
+
+// readSketch reads a sketch file
+func readSketch(path string) (*hyperloglog.HyperLogLog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	h := new(hyperloglog.HyperLogLog)
+	err = h.UnmarshalBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Sketch returns the sketch of the keys of the live entries in the table,
+// and the sketch of the keys of its tombstones. If the table does not have
+// both sketch files yet (because it was written before they were kept)
+// the table is scanned once to create them.
+func (sst *SSTable) Sketch() (*hyperloglog.HyperLogLog, *hyperloglog.HyperLogLog, error) {
+	// error check
+	err := sst.errorCheckFileAndIndex()
+	if err != nil {
+		return nil, nil, err
+	}
+	live, err := readSketch(sst.sketchPath)
+	var deleted *hyperloglog.HyperLogLog
+	if err == nil {
+		deleted, err = readSketch(sst.tombsPath)
+		if err == nil {
+			return live, deleted, nil
+		}
+	}
+	if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	// build the sketches from the data
+	live, _ = hyperloglog.NewHyperLogLog(SketchPrecision)
+	deleted, _ = hyperloglog.NewHyperLogLog(SketchPrecision)
+	err = sst.ScanAt(0, func(e *binary.Entry) bool {
+		if isLive(e) {
+			live.Add(e.Key)
+		} else {
+			deleted.Add(e.Key)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	err = sst.writeSketches(live, deleted)
+	if err != nil {
+		return nil, nil, err
+	}
+	return live, deleted, nil
+}
+
+// Sketch returns the merged sketch of the keys of the live entries in all
+// of the ss-tables, and the merged sketch of the keys of their tombstones.
+// The two can be combined to estimate the number of distinct live keys.
+func (sstm *SSTManager) Sketch() (*hyperloglog.HyperLogLog, *hyperloglog.HyperLogLog, error) {
+	// read lock
+	sstm.lock.RLock()
+	defer sstm.lock.RUnlock()
+	live, _ := hyperloglog.NewHyperLogLog(SketchPrecision)
+	deleted, _ := hyperloglog.NewHyperLogLog(SketchPrecision)
+	for _, index := range sstm.fileIndexes {
+		// open the ss-table
+		sst, err := openSSTable(sstm.base, index, sstm.cmp)
+		if err != nil {
+			return nil, nil, err
+		}
+		l, d, err := sst.Sketch()
+		if err != nil {
+			_ = sst.Close()
+			return nil, nil, err
+		}
+		// do not forget to close the ss-table
+		err = sst.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		err = live.Merge(l)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = deleted.Merge(d)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return live, deleted, nil
+}
@@ -2,12 +2,12 @@ package sstable
 
 import (
 	"fmt"
+	"github.com/scottcagno/storage/pkg/hyperloglog"
 	"github.com/scottcagno/storage/pkg/lsmt/binary"
 	"github.com/scottcagno/storage/pkg/util"
 	"io"
 	"os"
 	"path/filepath"
-	"sort"
 	"strconv"
 )
 
@@ -22,13 +22,22 @@ func IndexFromDataFileName(name string) (int64, error) {
 }
 
 type SSTable struct {
-	path  string
-	file  *os.File
-	open  bool
-	index *SSTIndex
+	path       string
+	file       *os.File
+	open       bool
+	index      *SSTIndex
+	cmp        binary.Comparator
+	sketchPath string
+	sketch     *hyperloglog.HyperLogLog
+	tombsPath  string
+	tombs      *hyperloglog.HyperLogLog
 }
 
 func OpenSSTable(base string, index int64) (*SSTable, error) {
+	return openSSTable(base, index, binary.BytewiseComparator)
+}
+
+func openSSTable(base string, index int64, cmp binary.Comparator) (*SSTable, error) {
 	// make sure we are working with absolute paths
 	base, err := filepath.Abs(base)
 	if err != nil {
@@ -49,16 +58,19 @@ func OpenSSTable(base string, index int64) (*SSTable, error) {
 		return nil, err
 	}
 	// init sstable gindex
-	ssi, err := OpenSSTIndex(base, index)
+	ssi, err := openSSTIndex(base, index, cmp)
 	if err != nil {
 		return nil, err
 	}
 	// init and return SSTable
 	sst := &SSTable{
-		path:  path, // path is the filepath for the data
-		file:  file, // file is the file descriptor for the data
-		open:  true, // open reports the status of the file
-		index: ssi,  // SSIndex is an SSTableIndex file
+		path:       path, // path is the filepath for the data
+		file:       file, // file is the file descriptor for the data
+		open:       true, // open reports the status of the file
+		index:      ssi,  // SSIndex is an SSTableIndex file
+		cmp:        cmp,  // cmp is the comparator used to order the keys
+		sketchPath: filepath.Join(base, SketchFileNameFromIndex(index)),
+		tombsPath:  filepath.Join(base, TombstoneSketchFileNameFromIndex(index)),
 	}
 	return sst, nil
 }
@@ -142,6 +154,8 @@ func (sst *SSTable) Write(e *binary.Entry) error {
 	if err != nil {
 		return err
 	}
+	// add entry to the sketch
+	sst.addToSketch(e)
 	return nil
 }
 
@@ -155,10 +169,12 @@ func (sst *SSTable) WriteBatch(b *binary.Batch) error {
 	if b == nil {
 		return ErrSSTEmptyBatch
 	}
+	// make sure the sketches are rewritten, even if the batch is empty
+	sst.addToSketch(nil)
 	// check to see if batch is sorted
-	if !sort.IsSorted(b) {
+	if !b.IsSortedWith(sst.cmp) {
 		// if not, sort
-		sort.Stable(b)
+		b.SortWith(sst.cmp)
 	}
 	// range batch and write
 	for i := range b.Entries {
@@ -174,6 +190,8 @@ func (sst *SSTable) WriteBatch(b *binary.Batch) error {
 		if err != nil {
 			return err
 		}
+		// add entry to the sketch
+		sst.addToSketch(e)
 	}
 	return nil
 }
@@ -246,6 +264,14 @@ func (sst *SSTable) Sync() error {
 }
 
 func (sst *SSTable) Close() error {
+	// write the sketches if anything was written
+	if sst.open && sst.sketch != nil {
+		err := sst.writeSketches(sst.sketch, sst.tombs)
+		if err != nil {
+			return err
+		}
+		sst.sketch, sst.tombs = nil, nil
+	}
 	if sst.open {
 		err := sst.file.Sync()
 		if err != nil {
@@ -266,10 +292,10 @@ func (sst *SSTable) Close() error {
 	return nil
 }
 
-func between(data, first, last string) bool {
-	return first <= data && data <= last
+func between(cmp binary.Comparator, data, first, last string) bool {
+	return binary.CompareKeys(cmp, first, data) <= 0 && binary.CompareKeys(cmp, data, last) <= 0
 }
 
 func (sst *SSTable) KeyInTableRange(k string) bool {
-	return between(k, sst.index.first, sst.index.last)
+	return between(sst.cmp, k, sst.index.first, sst.index.last)
 }
@@ -3,6 +3,8 @@ package sstable
 import (
 	"fmt"
 	"github.com/scottcagno/storage/pkg/lsmt/binary"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -65,3 +67,67 @@ func TestSSTableAndSSTIndex(t *testing.T) {
 	}
 	fmt.Printf("ssi.Find(%q)=%s\n", key, i)
 }
+
+func TestSSTable_Sketch(t *testing.T) {
+	base := "sketch-testing"
+	defer os.RemoveAll(base)
+
+	// write a table with some live entries and a tombstone
+	sst, err := OpenSSTable(base, 1)
+	if err != nil {
+		t.Fatalf("creating sst: %v\n", err)
+	}
+	batch := binary.NewBatch()
+	for i := 0; i < 100; i++ {
+		batch.Write(fmt.Sprintf("key-%03d", i), []byte("value"))
+	}
+	batch.Write("deleted", nil)
+	err = sst.WriteBatch(batch)
+	if err != nil {
+		t.Fatalf("writing (batch) to sst: %v\n", err)
+	}
+	err = sst.Close()
+	if err != nil {
+		t.Fatalf("closing sst: %v\n", err)
+	}
+
+	check := func() {
+		sst, err := OpenSSTable(base, 1)
+		if err != nil {
+			t.Fatalf("opening sst: %v\n", err)
+		}
+		defer sst.Close()
+		live, deleted, err := sst.Sketch()
+		if err != nil {
+			t.Fatalf("sketch: %v\n", err)
+		}
+		if live.Count() != 100 {
+			t.Errorf("sketch count: got %d, expected 100\n", live.Count())
+		}
+		if deleted.Count() != 1 {
+			t.Errorf("tombstone sketch count: got %d, expected 1\n", deleted.Count())
+		}
+	}
+	// the sketch is written when the table is closed...
+	check()
+	// ...and rebuilt from the data when the file is missing
+	err = os.Remove(filepath.Join(base, SketchFileNameFromIndex(1)))
+	if err != nil {
+		t.Fatalf("removing sketch: %v\n", err)
+	}
+	check()
+	_, err = os.Stat(filepath.Join(base, SketchFileNameFromIndex(1)))
+	if err != nil {
+		t.Errorf("sketch was not rewritten: %v\n", err)
+	}
+	// ...or when only the tombstone sketch is missing
+	err = os.Remove(filepath.Join(base, TombstoneSketchFileNameFromIndex(1)))
+	if err != nil {
+		t.Fatalf("removing tombstone sketch: %v\n", err)
+	}
+	check()
+	_, err = os.Stat(filepath.Join(base, TombstoneSketchFileNameFromIndex(1)))
+	if err != nil {
+		t.Errorf("tombstone sketch was not rewritten: %v\n", err)
+	}
+}
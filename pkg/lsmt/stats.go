@@ -12,6 +12,15 @@ type LSMTreeStats struct {
 	MtSize    int64      `json:"mt_size,omitempty"`
 	BfEntries int        `json:"bf_entries,omitempty"`
 	BfSize    int64      `json:"bf_size,omitempty"`
+	// DistinctLiveKeys is an estimate of the number of distinct live keys
+	// in the mem-table and the ss-tables. It is made from a sketch of all
+	// the keys, minus a sketch of the deleted keys (and is never negative),
+	// so a key that was deleted and then written again is not counted until
+	// the tables holding its tombstone have been compacted.
+	DistinctLiveKeys uint64 `json:"distinct_live_keys,omitempty"`
+	// HotKeys are the most frequently accessed keys, if enabled
+	// with LSMConfig.HotKeys
+	HotKeys []HotKey `json:"hot_keys,omitempty"`
 }
 
 func (s *LSMTreeStats) String() string {
@@ -22,6 +31,8 @@ func (s *LSMTreeStats) String() string {
 	ss = append(ss, fmt.Sprintf("\tMtSize: %v", s.MtSize))
 	ss = append(ss, fmt.Sprintf("\tBfEntries: %v", s.BfEntries))
 	ss = append(ss, fmt.Sprintf("\tBfSize: %v", s.BfSize))
+	ss = append(ss, fmt.Sprintf("\tDistinctLiveKeys: %v", s.DistinctLiveKeys))
+	ss = append(ss, fmt.Sprintf("\tHotKeys: %v", s.HotKeys))
 	return strings.Join(ss, "\n")
 }
 
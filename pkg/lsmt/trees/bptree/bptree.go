@@ -7,6 +7,7 @@ package bptree
 
 import (
 	"encoding/binary"
+	"errors"
 	"log"
 	"strconv"
 	"strings"
@@ -16,6 +17,11 @@ import (
 var stringZero = *new(string)
 var ValTypeZero = *new([]byte)
 
+var (
+	ErrNotEmpty    = errors.New("bptree: tree is not empty")
+	ErrUnsortedKey = errors.New("bptree: keys are not sorted")
+)
+
 func Compare(a, b string) int {
 	return strings.Compare(a, b)
 }
@@ -42,6 +48,7 @@ type bpNode struct {
 	keys     [defaultOrder - 1]string
 	pointers [defaultOrder]unsafe.Pointer
 	parent   *bpNode
+	prev     *bpNode // prev links a leaf to the previous leaf
 	isLeaf   bool
 }
 
@@ -218,24 +225,195 @@ func (t *BPTree) DelInt(key int64) (int64, int64) {
 }
 
 func (t *BPTree) Range(iter func(k string, v []byte) bool) {
+	for c := findFirstLeaf(t.root); c != nil; c = c.nextLeaf() {
+		for i := 0; i < c.numKeys; i++ {
+			e := (*entry)(c.pointers[i])
+			if e != nil && !iter(e.Key, e.Value) {
+				return
+			}
+		}
+	}
+}
+
+// RangeBack iterates all the entries in reverse (descending)
+// order by following the leaf chain backwards
+func (t *BPTree) RangeBack(iter func(k string, v []byte) bool) {
+	for c := findLastLeaf(t.root); c != nil; c = c.prevLeaf() {
+		for i := c.numKeys - 1; i >= 0; i-- {
+			e := (*entry)(c.pointers[i])
+			if e != nil && !iter(e.Key, e.Value) {
+				return
+			}
+		}
+	}
+}
+
+// RangeFrom iterates the entries in ascending order starting with
+// the start key (inclusive) and ending before the end key. An empty
+// start key starts at the first key, and an empty end key continues
+// through to the last key
+func (t *BPTree) RangeFrom(start, end string, iter func(k string, v []byte) bool) {
 	c := findFirstLeaf(t.root)
-	if c == nil {
-		return
+	if start != stringZero {
+		c = findLeaf(t.root, start)
 	}
-	var e *entry
-	for {
+	for ; c != nil; c = c.nextLeaf() {
 		for i := 0; i < c.numKeys; i++ {
-			e = (*entry)(c.pointers[i])
+			if start != stringZero && Compare(c.keys[i], start) < 0 {
+				continue
+			}
+			if end != stringZero && Compare(c.keys[i], end) >= 0 {
+				return
+			}
+			e := (*entry)(c.pointers[i])
 			if e != nil && !iter(e.Key, e.Value) {
+				return
+			}
+		}
+	}
+}
+
+// RangeFromBack iterates the same entries as RangeFrom, but in
+// reverse (descending) order starting with the last key before
+// the end key, and ending with the start key (inclusive)
+func (t *BPTree) RangeFromBack(start, end string, iter func(k string, v []byte) bool) {
+	c := findLastLeaf(t.root)
+	if end != stringZero {
+		c = findLeaf(t.root, end)
+	}
+	for ; c != nil; c = c.prevLeaf() {
+		for i := c.numKeys - 1; i >= 0; i-- {
+			if end != stringZero && Compare(c.keys[i], end) >= 0 {
 				continue
 			}
+			if start != stringZero && Compare(c.keys[i], start) < 0 {
+				return
+			}
+			e := (*entry)(c.pointers[i])
+			if e != nil && !iter(e.Key, e.Value) {
+				return
+			}
 		}
-		if c.pointers[defaultOrder-1] != nil {
-			c = (*bpNode)(c.pointers[defaultOrder-1])
-		} else {
+	}
+}
+
+// BulkLoad builds the tree from a sorted sequence of entries. The next
+// function is called until it returns false, and it must return the
+// keys in strictly ascending order. Rather than inserting the entries
+// one at a time, the leaves are packed full and the tree is then built
+// from the bottom up, level by level, which only takes O(n) time. The
+// tree must be empty.
+func (t *BPTree) BulkLoad(next func() (string, []byte, bool)) error {
+	if t.root != nil {
+		return ErrNotEmpty
+	}
+	// fill up the leaves, and link them together
+	var leaves []*bpNode
+	var leaf *bpNode
+	var last string
+	for {
+		k, v, ok := next()
+		if !ok {
 			break
 		}
+		if leaf != nil && Compare(k, last) <= 0 {
+			return ErrUnsortedKey
+		}
+		if leaf == nil || leaf.numKeys == defaultOrder-1 {
+			nl := &bpNode{isLeaf: true}
+			if leaf != nil {
+				leaf.pointers[defaultOrder-1] = unsafe.Pointer(nl)
+				nl.prev = leaf
+			}
+			leaf = nl
+			leaves = append(leaves, leaf)
+		}
+		leaf.keys[leaf.numKeys] = k
+		leaf.pointers[leaf.numKeys] = unsafe.Pointer(&entry{k, v})
+		leaf.numKeys++
+		last = k
+	}
+	if len(leaves) == 0 {
+		return nil
+	}
+	balanceLastLeaves(leaves)
+	// build the branch levels from the bottom up
+	level := leaves
+	mins := make([]string, len(leaves))
+	for i, n := range leaves {
+		mins[i] = n.keys[0]
+	}
+	for len(level) > 1 {
+		sizes := groupSizes(len(level), defaultOrder, cut(defaultOrder))
+		parents := make([]*bpNode, 0, len(sizes))
+		parentMins := make([]string, 0, len(sizes))
+		var off int
+		for _, size := range sizes {
+			p := &bpNode{}
+			for j := 0; j < size; j++ {
+				child := level[off+j]
+				child.parent = p
+				p.pointers[j] = unsafe.Pointer(child)
+				if j > 0 {
+					p.keys[j-1] = mins[off+j]
+				}
+			}
+			p.numKeys = size - 1
+			parents = append(parents, p)
+			parentMins = append(parentMins, mins[off])
+			off += size
+		}
+		level, mins = parents, parentMins
 	}
+	t.root = level[0]
+	return nil
+}
+
+// balanceLastLeaves makes sure the last leaf has at least the minimum
+// number of keys by moving keys over from the leaf before it
+func balanceLastLeaves(leaves []*bpNode) {
+	if len(leaves) < 2 {
+		return
+	}
+	prev, last := leaves[len(leaves)-2], leaves[len(leaves)-1]
+	if last.numKeys >= cut(defaultOrder-1) {
+		return
+	}
+	total := prev.numKeys + last.numKeys
+	move := total/2 - last.numKeys
+	// make room at the front of the last leaf
+	copy(last.keys[move:], last.keys[:last.numKeys])
+	copy(last.pointers[move:], last.pointers[:last.numKeys])
+	// move the keys over from the end of the previous leaf
+	copy(last.keys[:move], prev.keys[prev.numKeys-move:prev.numKeys])
+	copy(last.pointers[:move], prev.pointers[prev.numKeys-move:prev.numKeys])
+	for i := prev.numKeys - move; i < prev.numKeys; i++ {
+		prev.keys[i] = stringZero
+		prev.pointers[i] = nil
+	}
+	prev.numKeys -= move
+	last.numKeys += move
+}
+
+// groupSizes splits count items into groups of at most max items. If
+// the last group ends up with fewer than min items, the items of the
+// last two groups are split evenly between them
+func groupSizes(count, max, min int) []int {
+	var sizes []int
+	for count > 0 {
+		size := max
+		if count < max {
+			size = count
+		}
+		sizes = append(sizes, size)
+		count -= size
+	}
+	if n := len(sizes); n > 1 && sizes[n-1] < min {
+		total := sizes[n-2] + sizes[n-1]
+		sizes[n-2] = total - total/2
+		sizes[n-1] = total / 2
+	}
+	return sizes
 }
 
 func (t *BPTree) Min() (string, []byte) {
@@ -575,6 +753,12 @@ func insertIntoLeafAfterSplitting(root, leaf *bpNode, key string, pointer *entry
 	newLeaf.pointers[defaultOrder-1] = leaf.pointers[defaultOrder-1]
 	leaf.pointers[defaultOrder-1] = unsafe.Pointer(newLeaf)
 
+	// link the new leaf back into the chain
+	newLeaf.prev = leaf
+	if next := newLeaf.nextLeaf(); next != nil {
+		next.prev = newLeaf
+	}
+
 	for i = leaf.numKeys; i < defaultOrder-1; i++ {
 		leaf.pointers[i] = nil
 	}
@@ -695,6 +879,16 @@ func (n *bpNode) nextLeaf() *bpNode {
 	return nil
 }
 
+/*
+ *  prevLeaf returns the previous leaf in the chain (to the left) of the current leaf
+ */
+func (n *bpNode) prevLeaf() *bpNode {
+	if n.prev != nil && n.prev.isLeaf {
+		return n.prev
+	}
+	return nil
+}
+
 /*
  * delete is the master delete function
  */
@@ -951,6 +1145,9 @@ func coalesceNodes(root, n, neighbor *bpNode, neighborIndex int, kPrime string)
 			neighbor.numKeys++
 		}
 		neighbor.pointers[defaultOrder-1] = n.pointers[defaultOrder-1]
+		if next := neighbor.nextLeaf(); next != nil {
+			next.prev = neighbor
+		}
 	}
 	root = deleteEntry(root, n.parent, kPrime, unsafe.Pointer(n))
 	n = nil // free
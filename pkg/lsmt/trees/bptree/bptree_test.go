@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/scottcagno/storage/pkg/util"
 	"log"
+	"math/rand"
 	"testing"
 )
 
@@ -227,6 +228,113 @@ func TestBPTree_Range(t *testing.T) {
 	tree.Close()
 }
 
+func TestBPTree_RangeFrom(t *testing.T) {
+	tree := NewBPTree()
+	for _, i := range rand.Perm(n * thousand) {
+		tree.Put(makeKey(i), makeVal(i))
+	}
+	// forward, bounded
+	var keys []string
+	tree.RangeFrom(makeKey(100), makeKey(200), func(key string, value []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	util.AssertLen(t, 100, len(keys))
+	for i, k := range keys {
+		util.AssertEqual(t, makeKey(100+i), k)
+	}
+	// reverse, bounded
+	keys = keys[:0]
+	tree.RangeFromBack(makeKey(100), makeKey(200), func(key string, value []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	util.AssertLen(t, 100, len(keys))
+	for i, k := range keys {
+		util.AssertEqual(t, makeKey(199-i), k)
+	}
+	// delete every other key, so leaves are merged
+	for i := 0; i < n*thousand; i += 2 {
+		tree.Del(makeKey(i))
+	}
+	// reverse, unbounded (and stopping early)
+	keys = keys[:0]
+	tree.RangeBack(func(key string, value []byte) bool {
+		keys = append(keys, key)
+		return len(keys) < n*thousand/2-10
+	})
+	util.AssertLen(t, n*thousand/2-10, len(keys))
+	for i, k := range keys {
+		util.AssertEqual(t, makeKey(n*thousand-1-i*2), k)
+	}
+	tree.Close()
+}
+
+func TestBPTree_BulkLoad(t *testing.T) {
+	for _, count := range []int{0, 1, defaultOrder, defaultOrder + 1, n * thousand} {
+		tree := NewBPTree()
+		var i int
+		err := tree.BulkLoad(func() (string, []byte, bool) {
+			if i == count {
+				return "", nil, false
+			}
+			i++
+			return makeKey(i - 1), makeVal(i - 1), true
+		})
+		if err != nil {
+			t.Fatalf("bulk load: %v\n", err)
+		}
+		util.AssertLen(t, count, tree.Len())
+		for i := 0; i < count; i++ {
+			_, v := tree.Get(makeKey(i))
+			util.AssertEqual(t, makeVal(i), v)
+		}
+		// the tree is usable afterwards
+		for i := count; i < count+thousand; i++ {
+			tree.Put(makeKey(i), makeVal(i))
+		}
+		for _, i := range rand.Perm(count + thousand) {
+			tree.Del(makeKey(i))
+		}
+		util.AssertLen(t, 0, tree.Len())
+		tree.Close()
+	}
+	// the keys must be sorted
+	tree := NewBPTree()
+	keys := []string{"a", "c", "b"}
+	err := tree.BulkLoad(func() (string, []byte, bool) {
+		if len(keys) == 0 {
+			return "", nil, false
+		}
+		k := keys[0]
+		keys = keys[1:]
+		return k, nil, true
+	})
+	util.AssertEqual(t, ErrUnsortedKey, err)
+	// and the tree must be empty
+	tree = NewBPTree()
+	tree.Put("a", nil)
+	err = tree.BulkLoad(func() (string, []byte, bool) {
+		return "", nil, false
+	})
+	util.AssertEqual(t, ErrNotEmpty, err)
+}
+
+func BenchmarkBPTree_BulkLoad(b *testing.B) {
+	b.ReportAllocs()
+	for j := 0; j < b.N; j++ {
+		tree := NewBPTree()
+		var i int
+		_ = tree.BulkLoad(func() (string, []byte, bool) {
+			if i == n*thousand {
+				return "", nil, false
+			}
+			i++
+			return makeKey(i - 1), makeVal(i - 1), true
+		})
+	}
+}
+
 func TestBPTree_Close(t *testing.T) {
 	var tree *BPTree
 	tree = NewBPTree()
@@ -0,0 +1,133 @@
+package lsmt
+
+import (
+	"github.com/scottcagno/storage/pkg/lsmt/binary"
+	"github.com/scottcagno/storage/pkg/lsmt/wal"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// legacyVersion is the last version that wrote the write-ahead
+// commit log as plain entries, without the record framing
+const legacyVersion = "v1.7.0"
+
+// legacyWalDir is where the legacy write-ahead commit log is
+// moved to while it is being upgraded
+const legacyWalDir = defaultWalDir + "-" + legacyVersion
+
+// checkVersion checks the checksum file against the current version. An
+// lsm-tree written by the legacy version is upgraded, and anything else
+// returns ErrBadChecksum.
+func checkVersion(base string, conf *LSMConfig) error {
+	err := checkChecksum(version, base)
+	if err != ErrBadChecksum {
+		return err
+	}
+	if checkChecksum(legacyVersion, base) != nil {
+		return ErrBadChecksum
+	}
+	return upgradeLegacyWAL(base, conf)
+}
+
+// upgradeLegacyWAL rewrites the legacy write-ahead commit log in the
+// current (framed) format, and then updates the checksum file. The ss-tables
+// do not need to be upgraded. The legacy log is moved aside first and only
+// removed once the checksum file is updated, so if the upgrade is interrupted
+// it starts over the next time the lsm-tree is opened.
+func upgradeLegacyWAL(base string, conf *LSMConfig) error {
+	walbase := filepath.Join(base, defaultWalDir)
+	oldbase := filepath.Join(base, legacyWalDir)
+	// move the legacy log aside, unless that was already done
+	if _, err := os.Stat(oldbase); os.IsNotExist(err) {
+		err = os.Rename(walbase, oldbase)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	// remove anything left over from an interrupted upgrade
+	err := os.RemoveAll(walbase)
+	if err != nil {
+		return err
+	}
+	// read the legacy entries
+	entries, err := readLegacyWAL(oldbase)
+	if err != nil {
+		return err
+	}
+	// and write them to a new log
+	wacl, err := wal.OpenWAL(&wal.WALConfig{
+		BasePath:    walbase,
+		MaxFileSize: conf.FlushThreshold,
+		SyncOnWrite: false,
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		_, err = wacl.Write(e)
+		if err != nil {
+			_ = wacl.Close()
+			return err
+		}
+	}
+	err = wacl.Close()
+	if err != nil {
+		return err
+	}
+	// update the checksum file
+	_, str := calculateChecksum(version)
+	err = os.WriteFile(filepath.Join(base, ".sum.txt"), []byte(str), 0666)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(oldbase)
+}
+
+// readLegacyWAL reads all the entries of the legacy write-ahead
+// commit log segments in the provided directory, oldest first
+func readLegacyWAL(path string) ([]*binary.Entry, error) {
+	files, err := os.ReadDir(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, file := range files {
+		if file.IsDir() ||
+			!strings.HasPrefix(file.Name(), wal.FilePrefix) ||
+			!strings.HasSuffix(file.Name(), wal.FileSuffix) {
+			continue
+		}
+		names = append(names, file.Name())
+	}
+	// the segment names are zero padded, so they sort by index
+	sort.Strings(names)
+	var entries []*binary.Entry
+	for _, name := range names {
+		fd, err := os.Open(filepath.Join(path, name))
+		if err != nil {
+			return nil, err
+		}
+		for {
+			e, err := binary.DecodeEntry(fd)
+			if err != nil {
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					break
+				}
+				_ = fd.Close()
+				return nil, err
+			}
+			entries = append(entries, e)
+		}
+		err = fd.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
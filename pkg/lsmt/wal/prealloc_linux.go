@@ -0,0 +1,21 @@
+//go:build linux
+// +build linux
+
+package wal
+
+import (
+	"os"
+	"syscall"
+)
+
+// preallocate reserves size bytes of disk space for the provided
+// file using fallocate, so appending to the segment does not have
+// to update the file metadata. Filesystems that do not support
+// fallocate fall back to extending the file with truncate.
+func preallocate(fd *os.File, size int64) error {
+	err := syscall.Fallocate(int(fd.Fd()), 0, 0, size)
+	if err == syscall.EOPNOTSUPP || err == syscall.ENOSYS {
+		return fd.Truncate(size)
+	}
+	return err
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package wal
+
+import "os"
+
+// preallocate extends the provided file to size bytes. The space
+// reads back as zeros, which marks the logical end of the data.
+func preallocate(fd *os.File, size int64) error {
+	fi, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() >= size {
+		return nil
+	}
+	return fd.Truncate(size)
+}
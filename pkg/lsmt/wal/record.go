@@ -0,0 +1,97 @@
+package wal
+
+import (
+	"bytes"
+	binaryStd "encoding/binary"
+	"github.com/scottcagno/storage/pkg/lsmt/binary"
+	"hash/crc32"
+	"io"
+)
+
+// recordHeaderSize is the size of the header that precedes every
+// entry written to a segment file. The header is laid out as:
+//
+//	[0:4] crc32 checksum (salted with the segment index)
+//	[4:8] length of the encoded entry that follows
+//
+// Segment files are preallocated (and recycled) so the bytes that
+// follow the last record are either zeros or stale records from
+// a previous use of the file. A zero length, a length that runs
+// past the end of the file, or a checksum that does not match the
+// current segment index all mark the logical end of the data.
+const recordHeaderSize = 8
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// checksum calculates the checksum of the payload salted with
+// the segment index, so records left over in a recycled segment
+// never validate against the segment that is reusing the file
+func checksum(salt int64, payload []byte) uint32 {
+	var buf [8]byte
+	binaryStd.LittleEndian.PutUint64(buf[:], uint64(salt))
+	crc := crc32.Update(0, crcTable, buf[:])
+	return crc32.Update(crc, crcTable, payload)
+}
+
+// encodeRecord appends the framed and checksummed encoding of
+// the provided entry to buf and returns the extended buffer
+func encodeRecord(buf []byte, salt int64, e *binary.Entry) []byte {
+	// reserve room for the header
+	start := len(buf)
+	buf = append(buf, make([]byte, recordHeaderSize)...)
+	// append the encoded entry
+	buf = binary.AppendEntry(buf, e)
+	// fill out the header
+	payload := buf[start+recordHeaderSize:]
+	binaryStd.LittleEndian.PutUint32(buf[start:start+4], checksum(salt, payload))
+	binaryStd.LittleEndian.PutUint32(buf[start+4:start+8], uint32(len(payload)))
+	return buf
+}
+
+// decodeRecordAt reads and decodes the record found at the provided
+// offset. The size is the size of the underlying file and is used to
+// bounds check the record. It returns the entry along with the offset
+// of the next record, or io.EOF if the logical end of the data has
+// been reached.
+func decodeRecordAt(r io.ReaderAt, salt, offset, size int64) (*binary.Entry, int64, error) {
+	// make sure there is room for a header
+	if offset+recordHeaderSize > size {
+		return nil, offset, io.EOF
+	}
+	// read record header
+	var hdr [recordHeaderSize]byte
+	_, err := r.ReadAt(hdr[:], offset)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, offset, io.EOF
+		}
+		return nil, offset, err
+	}
+	crc := binaryStd.LittleEndian.Uint32(hdr[0:4])
+	length := int64(binaryStd.LittleEndian.Uint32(hdr[4:8]))
+	// zeroed (preallocated) space, or a length that cannot
+	// possibly fit in the file, marks the end of the data
+	if length == 0 || offset+recordHeaderSize+length > size {
+		return nil, offset, io.EOF
+	}
+	// read the payload
+	payload := make([]byte, length)
+	_, err = r.ReadAt(payload, offset+recordHeaderSize)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, offset, io.EOF
+		}
+		return nil, offset, err
+	}
+	// torn writes and stale records from a recycled
+	// segment will both fail the checksum
+	if checksum(salt, payload) != crc {
+		return nil, offset, io.EOF
+	}
+	// decode the entry
+	e, err := binary.DecodeEntry(bytes.NewReader(payload))
+	if err != nil {
+		return nil, offset, io.EOF
+	}
+	return e, offset + recordHeaderSize + length, nil
+}
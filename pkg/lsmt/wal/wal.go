@@ -16,14 +16,15 @@ import (
 const (
 	FilePrefix               = "dat-"
 	FileSuffix               = ".seg"
+	RetiredPrefix            = "old-"
 	defaultMaxFileSize int64 = 16 << 10 // 16 KB
 	defaultBasePath          = "log"
 	defaultSyncOnWrite       = false
 	remainingTrigger         = 64
+	maxRetiredSegments       = 8
 )
 
 var (
-	maxFileSize       = defaultMaxFileSize
 	ErrOutOfBounds    = errors.New("error: out of bounds")
 	ErrSegmentFull    = errors.New("error: segment is full")
 	ErrFileClosed     = errors.New("error: file closed")
@@ -48,6 +49,7 @@ type segment struct {
 	path      string     // path is the full path to this segment file
 	index     int64      // starting index of the segment
 	entries   []segEntry // entries is an index of the entries in the segment
+	end       int64      // end is the offset of the logical end of the data
 	remaining int64      // remaining is the bytes left after max file size minus segEntry data
 }
 
@@ -57,6 +59,7 @@ func (s *segment) String() string {
 	ss += fmt.Sprintf("path: %q\n", filepath.Base(s.path))
 	ss += fmt.Sprintf("index: %d\n", s.index)
 	ss += fmt.Sprintf("entries: %d\n", len(s.entries))
+	ss += fmt.Sprintf("end: %d\n", s.end)
 	ss += fmt.Sprintf("remaining: %d\n", s.remaining)
 	return ss
 }
@@ -125,16 +128,20 @@ func checkWALConfig(conf *WALConfig) *WALConfig {
 	return conf
 }
 
-// WAL is a write-ahead log structure
+// WAL is a write-ahead log structure. Segment files are preallocated
+// to the configured max file size and, once they are no longer needed,
+// they are retired into a small pool and recycled instead of removed.
 type WAL struct {
 	lock       sync.RWMutex // lock is a mutual exclusion lock
+	rlock      sync.Mutex   // rlock guards the reader when only the read lock is held
 	conf       *WALConfig
-	r          *binary.Reader // r is a binary reader
-	w          *binary.Writer // w is a binary writer
-	firstIndex int64          // firstIndex is the index of the first segEntry
-	lastIndex  int64          // lastIndex is the index of the last segEntry
-	segments   []*segment     // segments is an index of the current file segments
-	active     *segment       // active is the current active segment
+	r          *os.File   // r is a read-only file for reading non-active segments
+	w          *os.File   // w is the active segment file
+	firstIndex int64      // firstIndex is the index of the first segEntry
+	lastIndex  int64      // lastIndex is the index of the next segEntry to be written
+	segments   []*segment // segments is an index of the current file segments
+	active     *segment   // active is the current active segment
+	retired    []string   // retired is a pool of retired segment files ready for reuse
 }
 
 // OpenWAL opens and returns a new write-ahead log structure
@@ -162,6 +169,7 @@ func OpenWAL(c *WALConfig) (*WAL, error) {
 		firstIndex: 0,
 		lastIndex:  1,
 		segments:   make([]*segment, 0),
+		retired:    make([]string, 0),
 	}
 	// attempt to load segments
 	err = l.loadIndex()
@@ -172,22 +180,22 @@ func OpenWAL(c *WALConfig) (*WAL, error) {
 	return l, nil
 }
 
+// CloseAndRemove closes the write-ahead log and removes all the files
+// on disk, including any retired segments. To start over without the
+// file churn, use Reset instead.
 func (l *WAL) CloseAndRemove() error {
 	// lock
 	l.lock.Lock()
 	defer l.lock.Unlock()
-	// sync and close writer
-	err := l.w.Close()
-	if err != nil {
-		return err
-	}
-	// close reader
-	err = l.r.Close()
+	// close any open files
+	err := l.closeFiles()
 	if err != nil {
 		return err
 	}
 	// reset the segments
 	l.segments = make([]*segment, 0)
+	l.retired = make([]string, 0)
+	l.active = nil
 	// reset first and last index
 	l.firstIndex = 0
 	l.lastIndex = 1
@@ -199,6 +207,72 @@ func (l *WAL) CloseAndRemove() error {
 	return nil
 }
 
+// Reset retires every segment currently in the write-ahead log and
+// starts a fresh active segment (recycling a retired segment if one
+// is available). Indexes are never reused, so entries written after
+// a reset continue on from the last index.
+func (l *WAL) Reset() error {
+	// lock
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	// close any open files
+	err := l.closeFiles()
+	if err != nil {
+		return err
+	}
+	// retire all the segments
+	for _, s := range l.segments {
+		err = l.retireSegmentFile(s.path)
+		if err != nil {
+			return err
+		}
+	}
+	l.segments = make([]*segment, 0)
+	// create a new segment file
+	s, err := l.makeSegmentFile(l.lastIndex)
+	if err != nil {
+		return err
+	}
+	// segment has been created successfully, append to the segments list
+	l.segments = append(l.segments, s)
+	// update the active segment pointer
+	l.active = s
+	// open the active segment file
+	l.w, err = os.OpenFile(l.active.path, os.O_RDWR, 0666)
+	if err != nil {
+		return err
+	}
+	// update first index
+	l.firstIndex = s.index
+	return nil
+}
+
+// closeFiles syncs and closes the active segment file and
+// closes the reader (if it is open)
+func (l *WAL) closeFiles() error {
+	if l.w != nil {
+		// sync and close active segment
+		err := l.w.Sync()
+		if err != nil {
+			return err
+		}
+		err = l.w.Close()
+		if err != nil {
+			return err
+		}
+		l.w = nil
+	}
+	if l.r != nil {
+		// close reader
+		err := l.r.Close()
+		if err != nil {
+			return err
+		}
+		l.r = nil
+	}
+	return nil
+}
+
 // loadIndex initializes the segment index. It looks for segment
 // files in the base directory and attempts to index the segment as
 // well as any of the entries within the segment. If this is a new
@@ -214,33 +288,37 @@ func (l *WAL) loadIndex() error {
 	}
 	// list the files in the base directory path and attempt to index the entries
 	for _, file := range files {
-		// skip non data files
-		if file.IsDir() ||
-			!strings.HasPrefix(file.Name(), FilePrefix) ||
-			!strings.HasSuffix(file.Name(), FileSuffix) {
+		// skip directories and non segment files
+		if file.IsDir() || !strings.HasSuffix(file.Name(), FileSuffix) {
 			continue // skip this, continue on to the next file
 		}
-		// check the size of segment file
-		fi, err := file.Info()
-		if err != nil {
-			return err
+		path := filepath.Join(l.conf.BasePath, file.Name())
+		// add any retired segments to the pool
+		if strings.HasPrefix(file.Name(), RetiredPrefix) {
+			l.retired = append(l.retired, path)
+			continue
 		}
-		// if the file is empty, remove it and skip to next file
-		if fi.Size() == 0 {
-			err = os.Remove(filepath.Join(l.conf.BasePath, file.Name()))
-			if err != nil {
-				return err
-			}
-			continue // make sure we skip to next segment
+		// skip non data files
+		if !strings.HasPrefix(file.Name(), FilePrefix) {
+			continue
 		}
 		// attempt to load segment (and index entries in segment)
-		s, err := l.loadSegmentFile(filepath.Join(l.conf.BasePath, file.Name()))
+		s, err := l.loadSegmentFile(path)
 		if err != nil {
 			return err
 		}
 		// segment has been loaded successfully, append to the segments list
 		l.segments = append(l.segments, s)
 	}
+	// retire any leading segments that do not hold any
+	// data, but always keep the last (active) segment
+	for len(l.segments) > 1 && len(l.segments[0].entries) == 0 {
+		err = l.retireSegmentFile(l.segments[0].path)
+		if err != nil {
+			return err
+		}
+		l.segments = l.segments[1:]
+	}
 	// check to see if any segments were found. If not, initialize a new one
 	if len(l.segments) == 0 {
 		// create a new segment file
@@ -255,36 +333,26 @@ func (l *WAL) loadIndex() error {
 	// should go about updating the active segment pointer to
 	// point to the "tail" (the last segment in the segment list)
 	l.active = l.getLastSegment()
-	// we should be good to go, lets attempt to open a file
-	// reader to work with the active segment
-	l.r, err = binary.OpenReader(l.active.path)
-	if err != nil {
-		return err
-	}
-	// and then attempt to open a file writer to also work
-	// with the active segment, so we can begin appending data
-	l.w, err = binary.OpenWriterWithSync(l.active.path, l.conf.SyncOnWrite)
+	// we should be good to go, lets attempt to open the active
+	// segment, so we can begin appending data (at the logical end)
+	l.w, err = os.OpenFile(l.active.path, os.O_RDWR, 0666)
 	if err != nil {
 		return err
 	}
 	// finally, update the firstIndex and lastIndex
 	l.firstIndex = l.segments[0].index
 	// and update last index
-	l.lastIndex = l.getLastSegment().getLastIndex()
+	l.lastIndex = l.active.index + int64(len(l.active.entries))
 	return nil
 }
 
 // loadSegment attempts to open the segment file at the path provided
-// and index the entries within the segment. It will return an os.PathError
-// if the file does not exist, an io.ErrUnexpectedEOF if the file exists
-// but is empty and has no data to read, and ErrSegmentFull if the file
-// has met the maxFileSize. It will return the segment and nil error on success.
+// and index the entries within the segment. Segment files are
+// preallocated, so loading stops at the logical end of the data (the
+// first record that is zeroed, torn or left over from a previous use
+// of the file) rather than the end of the file. It will return the
+// segment and nil error on success.
 func (l *WAL) loadSegmentFile(path string) (*segment, error) {
-	// check to make sure path exists before continuing
-	_, err := os.Stat(path)
-	if err != nil {
-		return nil, err
-	}
 	// attempt to open existing segment file for reading
 	fd, err := os.OpenFile(path, os.O_RDONLY, 0666)
 	if err != nil {
@@ -294,61 +362,75 @@ func (l *WAL) loadSegmentFile(path string) (*segment, error) {
 	defer func(fd *os.File) {
 		_ = fd.Close()
 	}(fd)
-	// create a new segment to append indexed entries to
-	s := &segment{
-		path:    path,
-		entries: make([]segEntry, 0),
+	// get the size of the segment file
+	fi, err := fd.Stat()
+	if err != nil {
+		return nil, err
 	}
 	// read segment file and index entries
 	index, err := GetIndexFromFileName(filepath.Base(fd.Name()))
 	if err != nil {
 		return nil, err
 	}
+	// create a new segment to append indexed entries to
+	s := &segment{
+		path:    path,
+		index:   index,
+		entries: make([]segEntry, 0),
+	}
+	var offset, next int64
 	for {
-		// get the current offset of the
-		// reader for the segEntry later
-		offset, err := binary.Offset(fd)
+		// read and decode the record
+		_, next, err = decodeRecordAt(fd, s.index, offset, fi.Size())
 		if err != nil {
-			return nil, err
-		}
-		// read and decode segEntry
-		_, err = binary.DecodeEntry(fd)
-		if err != nil {
-			if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if err == io.EOF {
 				break
 			}
 			return nil, err
 		}
-		// get current offset
 		// add segEntry index to segment entries list
 		s.entries = append(s.entries, segEntry{
 			index:  index,
 			offset: offset,
 		})
 		// continue to process the next segEntry
+		offset = next
 		index++
 	}
-	// make sure to fill out the segment index from the first segEntry index
-	s.index = s.entries[0].index
-	// get the offset of the reader to calculate bytes remaining
-	offset, err := binary.Offset(fd)
-	if err != nil {
-		return nil, err
-	}
-	// update the segment remaining bytes
-	s.remaining = maxFileSize - offset
+	// update the segment logical end and remaining bytes
+	s.end = offset
+	s.remaining = l.conf.MaxFileSize - offset
 	return s, nil
 }
 
-// makeSegment attempts to make a new segment automatically using the timestamp
-// as the segment name. On success, it will simply return a new segment and a nil error
+// makeSegment attempts to make a new segment using the index provided as
+// the segment name. If there are any retired segments available, one of
+// them will be recycled, otherwise a new file is created. Either way, the
+// segment file is preallocated to the max file size. On success, it will
+// simply return a new segment and a nil error
 func (l *WAL) makeSegmentFile(index int64) (*segment, error) {
-	// create a new file
+	// create a new file (or recycle an old one)
 	path := filepath.Join(l.conf.BasePath, MakeFileNameFromIndex(index))
-	fd, err := os.Create(path)
+	if n := len(l.retired); n > 0 {
+		// records left over in a retired file are checksummed
+		// using a different segment index, so a simple rename
+		// is all that is needed in order to reuse it
+		err := os.Rename(l.retired[n-1], path)
+		if err != nil {
+			return nil, err
+		}
+		l.retired = l.retired[:n-1]
+	}
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0666)
 	if err != nil {
 		return nil, err
 	}
+	// preallocate the file
+	err = preallocate(fd, l.conf.MaxFileSize)
+	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
 	// don't forget to close it
 	err = fd.Close()
 	if err != nil {
@@ -357,13 +439,35 @@ func (l *WAL) makeSegmentFile(index int64) (*segment, error) {
 	// create and return new segment
 	s := &segment{
 		path:      path,
-		index:     l.lastIndex,
+		index:     index,
 		entries:   make([]segEntry, 0),
 		remaining: l.conf.MaxFileSize,
 	}
 	return s, nil
 }
 
+// retireSegmentFile moves the segment file at the provided path into the
+// pool of retired segments so that it can be recycled. If the pool is
+// full the segment file is simply removed.
+func (l *WAL) retireSegmentFile(path string) error {
+	// check the pool size
+	if len(l.retired) >= maxRetiredSegments {
+		return os.Remove(path)
+	}
+	// move the segment into the retired pool
+	retired := filepath.Join(l.conf.BasePath, RetiredPrefix+filepath.Base(path))
+	if _, err := os.Stat(retired); err == nil {
+		// there is already a retired segment with this name
+		return os.Remove(path)
+	}
+	err := os.Rename(path, retired)
+	if err != nil {
+		return err
+	}
+	l.retired = append(l.retired, retired)
+	return nil
+}
+
 // findSegmentIndex performs binary search to find the segment containing provided index
 func (l *WAL) findSegmentIndex(index int64) int {
 	// declare for later
@@ -388,7 +492,11 @@ func (l *WAL) getLastSegment() *segment {
 // cycleSegment adds a new segment to replace the current (active) segment
 func (l *WAL) cycleSegment() error {
 	// sync and close current file segment
-	err := l.w.Close()
+	err := l.w.Sync()
+	if err != nil {
+		return err
+	}
+	err = l.w.Close()
 	if err != nil {
 		return err
 	}
@@ -401,17 +509,62 @@ func (l *WAL) cycleSegment() error {
 	l.segments = append(l.segments, s)
 	// update the active segment pointer
 	l.active = l.getLastSegment()
-	// open file writer associated with active segment
-	l.w, err = binary.OpenWriterWithSync(l.active.path, l.conf.SyncOnWrite)
+	// open file associated with active segment
+	l.w, err = os.OpenFile(l.active.path, os.O_RDWR, 0666)
 	if err != nil {
 		return err
 	}
-	// update file reader associated with the active segment
-	l.r, err = binary.OpenReader(l.active.path)
+	return nil
+}
+
+// readerFor returns a file that can be used to read from the
+// provided segment. It reuses the reader file descriptor if it
+// is already open for the segment
+func (l *WAL) readerFor(s *segment) (io.ReaderAt, error) {
+	// the active segment is already open
+	if s == l.active {
+		return l.w, nil
+	}
+	// check the reader
+	if l.r != nil {
+		if l.r.Name() == s.path {
+			return l.r, nil
+		}
+		err := l.r.Close()
+		if err != nil {
+			return nil, err
+		}
+		l.r = nil
+	}
+	// open a reader for the segment
+	fd, err := os.OpenFile(s.path, os.O_RDONLY, 0666)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	l.r = fd
+	return l.r, nil
+}
+
+// readEntry reads the segEntry at the provided offset in the provided segment
+func (l *WAL) readEntry(s *segment, offset int64) (*binary.Entry, error) {
+	if s != l.active {
+		// the reader may be swapped out, so readers
+		// holding the read lock take turns using it
+		l.rlock.Lock()
+		defer l.rlock.Unlock()
+	}
+	r, err := l.readerFor(s)
+	if err != nil {
+		return nil, err
+	}
+	e, _, err := decodeRecordAt(r, s.index, offset, s.end)
+	if err != nil {
+		if err == io.EOF {
+			return nil, binary.ErrBadEntry
+		}
+		return nil, err
+	}
+	return e, nil
 }
 
 // Read reads an segEntry from the write-ahead log at the specified index
@@ -420,58 +573,67 @@ func (l *WAL) Read(index int64) (*binary.Entry, error) {
 	l.lock.RLock()
 	defer l.lock.RUnlock()
 	// error checking
-	if index < l.firstIndex || index > l.lastIndex {
+	if index < l.firstIndex || index >= l.lastIndex {
 		return nil, ErrOutOfBounds
 	}
-	var err error
 	// find the segment containing the provided index
 	s := l.segments[l.findSegmentIndex(index)]
-	// make sure we are reading from the correct file
-	l.r, err = l.r.ReadFrom(s.path)
-	if err != nil {
-		return nil, err
-	}
 	// find the offset for the segEntry containing the provided index
 	offset := s.entries[s.findEntryIndex(index)].offset
 	// read segEntry at offset
-	e, err := l.r.ReadEntryAt(offset)
-	if err != nil {
-		return nil, err
-	}
-	return e, nil
+	return l.readEntry(s, offset)
 }
 
-// Write writes an segEntry to the write-ahead log in an append-only fashion
-func (l *WAL) Write(e *binary.Entry) (int64, error) {
-	// lock
-	l.lock.Lock()
-	defer l.lock.Unlock()
-	// write segEntry
-	offset, err := l.w.WriteEntry(e)
+// writeEntry appends an entry to the logical end of the active segment
+// and cycles the active segment if needed. It does not lock.
+func (l *WAL) writeEntry(e *binary.Entry, doSync bool) error {
+	// error check
+	if e == nil {
+		return binary.ErrBadEntry
+	}
+	// encode the record and write it at the logical end
+	rec := encodeRecord(nil, l.active.index, e)
+	_, err := l.w.WriteAt(rec, l.active.end)
 	if err != nil {
-		return 0, err
+		return err
+	}
+	// make sure we call sync!!
+	if doSync {
+		err = l.w.Sync()
+		if err != nil {
+			return err
+		}
 	}
 	// add new segEntry to the segment index
 	l.active.entries = append(l.active.entries, segEntry{
 		index:  l.lastIndex,
-		offset: offset,
+		offset: l.active.end,
 	})
 	// update lastIndex
 	l.lastIndex++
-	// grab the current offset written
-	offset2, err := l.w.Offset()
-	if err != nil {
-		return 0, err
-	}
-	// update segment remaining
-	l.active.remaining -= offset2 - offset
+	// update segment logical end and remaining
+	l.active.end += int64(len(rec))
+	l.active.remaining -= int64(len(rec))
 	// check to see if the active segment needs to be cycled
 	if l.active.remaining < remainingTrigger {
 		err = l.cycleSegment()
 		if err != nil {
-			return 0, err
+			return err
 		}
 	}
+	return nil
+}
+
+// Write writes an segEntry to the write-ahead log in an append-only fashion
+func (l *WAL) Write(e *binary.Entry) (int64, error) {
+	// lock
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	// write segEntry
+	err := l.writeEntry(e, l.conf.SyncOnWrite)
+	if err != nil {
+		return 0, err
+	}
 	return l.lastIndex - 1, nil
 }
 
@@ -480,48 +642,13 @@ func (l *WAL) WriteBatch(batch *binary.Batch) error {
 	// lock
 	l.lock.Lock()
 	defer l.lock.Unlock()
-	// check sync policy
-	changedSyncPolicy := false
-	if l.conf.SyncOnWrite == true {
-		l.conf.SyncOnWrite = false // if it's on, temporarily disable
-		l.w.SetSyncOnWrite(false)
-		changedSyncPolicy = true
-	}
 	// iterate batch
 	for i := range batch.Entries {
-		// entry
-		e := batch.Entries[i]
-		// write entry to data file
-		offset, err := l.w.WriteEntry(e)
+		// write entry to data file (without syncing)
+		err := l.writeEntry(batch.Entries[i], false)
 		if err != nil {
 			return err
 		}
-		// add new segEntry to the segment index
-		l.active.entries = append(l.active.entries, segEntry{
-			index:  l.lastIndex,
-			offset: offset,
-		})
-		// update lastIndex
-		l.lastIndex++
-		// grab the current offset written
-		offset2, err := l.w.Offset()
-		if err != nil {
-			return err
-		}
-		// update segment remaining
-		l.active.remaining -= offset2 - offset
-		// check to see if the active segment needs to be cycled
-		if l.active.remaining < remainingTrigger {
-			err = l.cycleSegment()
-			if err != nil {
-				return err
-			}
-		}
-	}
-	// after batch, set everything back how it was
-	if changedSyncPolicy {
-		l.conf.SyncOnWrite = true
-		l.w.SetSyncOnWrite(true)
 	}
 	// after batch has been written, do sync
 	err := l.w.Sync()
@@ -536,24 +663,13 @@ func (l *WAL) Scan(iter func(e *binary.Entry) bool) error {
 	// lock
 	l.lock.Lock()
 	defer l.lock.Unlock()
-	// init for any errors
-	var err error
 	// range the segment index
 	for _, sidx := range l.segments {
-		//fmt.Printf("segment: %s\n", sidx)
-		// make sure we are reading the right data
-		l.r, err = l.r.ReadFrom(sidx.path)
-		if err != nil {
-			return err
-		}
 		// range the segment entries index
 		for _, eidx := range sidx.entries {
 			// read segEntry
-			e, err := l.r.ReadEntryAt(eidx.offset)
+			e, err := l.readEntry(sidx, eidx.offset)
 			if err != nil {
-				if err == io.EOF || err == io.ErrUnexpectedEOF {
-					break
-				}
 				return err
 			}
 			// check segEntry against iterator boolean function
@@ -584,10 +700,10 @@ func (l *WAL) TruncateFront(index int64) error {
 	}
 	// locate segment in segment index list containing specified index
 	sidx := l.findSegmentIndex(index)
-	// isolate whole segments that can be removed
+	// isolate whole segments that can be retired
 	for i := 0; i < sidx; i++ {
-		// remove segment file
-		err := os.Remove(l.segments[i].path)
+		// retire segment file
+		err := l.retireSegmentFile(l.segments[i].path)
 		if err != nil {
 			return err
 		}
@@ -601,69 +717,112 @@ func (l *WAL) TruncateFront(index int64) error {
 	l.segments = l.segments[:len(l.segments)-j+i]
 	// update firstIndex
 	l.firstIndex = l.segments[0].index
+	// after the segment index cut, segment 0 will
+	// contain the partials that we must re-write
+	if l.segments[0].index < index {
+		err := l.rewriteSegmentFrom(l.segments[0], index)
+		if err != nil {
+			return err
+		}
+		l.firstIndex = index
+	}
+	return nil
+}
+
+// rewriteSegmentFrom re-writes the provided segment so that it only
+// contains the entries from the provided index onward. The segment is
+// renamed to reflect the new starting index.
+func (l *WAL) rewriteSegmentFrom(s *segment, index int64) error {
 	// prepare to re-write partial segment
-	var err error
-	var entries []segEntry
-	tmpfd, err := os.Create(filepath.Join(l.conf.BasePath, "tmp-partial.seg"))
+	path := filepath.Join(l.conf.BasePath, MakeFileNameFromIndex(index))
+	tmpPath := filepath.Join(l.conf.BasePath, "tmp-partial.seg")
+	tmpfd, err := os.Create(tmpPath)
 	if err != nil {
 		return err
 	}
-	// after the segment index cut, segment 0 will
-	// contain the partials that we must re-write
-	if l.segments[0].index < index {
-		// make sure we are reading from the correct path
-		l.r, err = l.r.ReadFrom(l.segments[0].path)
+	// close and remove the temp file if it never gets moved into place
+	var renamed bool
+	defer func() {
+		if !renamed {
+			_ = tmpfd.Close() // it may already be closed
+			_ = os.Remove(tmpPath)
+		}
+	}()
+	err = preallocate(tmpfd, l.conf.MaxFileSize)
+	if err != nil {
+		return err
+	}
+	// range the entries within this segment to find
+	// the ones that are greater than the index and
+	// write those to a temporary file....
+	var entries []segEntry
+	var offset int64
+	for _, ent := range s.entries {
+		if ent.index < index {
+			continue // skip
+		}
+		// read segEntry
+		e, err := l.readEntry(s, ent.offset)
 		if err != nil {
 			return err
 		}
-		// range the entries within this segment to find
-		// the ones that are greater than the index and
-		// write those to a temporary buffer....
-		for _, ent := range l.segments[0].entries {
-			if ent.index < index {
-				continue // skip
-			}
-			// read segEntry
-			e, err := l.r.ReadEntryAt(ent.offset)
-			if err != nil {
-				return err
-			}
-			// write segEntry to temp file
-			ent.offset, err = binary.EncodeEntry(tmpfd, e)
-			if err != nil {
-				return err
-			}
-			// sync write
-			err = tmpfd.Sync()
-			if err != nil {
-				return err
-			}
-			// append to a new entries list
-			entries = append(entries, ent)
+		// write segEntry to temp file
+		rec := encodeRecord(nil, index, e)
+		_, err = tmpfd.WriteAt(rec, offset)
+		if err != nil {
+			return err
 		}
-		// move reader back to active segment file
-		l.r, err = l.r.ReadFrom(l.active.path)
+		// append to a new entries list
+		entries = append(entries, segEntry{index: ent.index, offset: offset})
+		offset += int64(len(rec))
+	}
+	// sync and close temp file
+	err = tmpfd.Sync()
+	if err != nil {
+		return err
+	}
+	err = tmpfd.Close()
+	if err != nil {
+		return err
+	}
+	// close any files open on the old segment
+	if l.r != nil && l.r.Name() == s.path {
+		err = l.r.Close()
 		if err != nil {
 			return err
 		}
-		// close temp file
-		err = tmpfd.Close()
+		l.r = nil
+	}
+	if s == l.active {
+		err = l.w.Close()
 		if err != nil {
 			return err
 		}
-		// remove partial segment file
-		err = os.Remove(l.segments[0].path)
+	}
+	// move the temp file into place and remove the old segment
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return err
+	}
+	renamed = true
+	if path != s.path {
+		err = os.Remove(s.path)
 		if err != nil {
 			return err
 		}
-		// change temp file name
-		err = os.Rename(tmpfd.Name(), l.segments[0].path)
+	}
+	// update segment
+	s.path = path
+	s.index = index
+	s.entries = entries
+	s.end = offset
+	s.remaining = l.conf.MaxFileSize - offset
+	// re-open the active segment if needed
+	if s == l.active {
+		l.w, err = os.OpenFile(s.path, os.O_RDWR, 0666)
 		if err != nil {
 			return err
 		}
-		// update segment
-		l.segments[0].entries = entries
-		l.segments[0].index = entries[0].index
 	}
 	return nil
 }
@@ -721,22 +880,16 @@ func (l *WAL) Close() error {
 	// lock
 	l.lock.Lock()
 	defer l.lock.Unlock()
-	// sync and close writer
-	err := l.w.Close()
-	if err != nil {
-		return err
-	}
-	// close reader
-	err = l.r.Close()
+	// sync and close files
+	err := l.closeFiles()
 	if err != nil {
 		return err
 	}
 	// clean everything else up
-	l.r = nil
-	l.w = nil
 	l.firstIndex = 0
 	l.lastIndex = 0
 	l.segments = nil
+	l.retired = nil
 	l.active = nil
 	// force gc for good measure
 	runtime.GC()
@@ -751,6 +904,7 @@ func (l *WAL) String() string {
 	ss += fmt.Sprintf("firstIndex: %d\n", l.firstIndex)
 	ss += fmt.Sprintf("lastIndex: %d\n", l.lastIndex)
 	ss += fmt.Sprintf("segments: %d\n", len(l.segments))
+	ss += fmt.Sprintf("retired: %d\n", len(l.retired))
 	if l.active != nil {
 		ss += fmt.Sprintf("active: %q\n", filepath.Base(l.active.path))
 	}
@@ -760,6 +914,7 @@ func (l *WAL) String() string {
 			ss += fmt.Sprintf("\tpath: %q\n", filepath.Base(s.path))
 			ss += fmt.Sprintf("\tindex: %d\n", s.index)
 			ss += fmt.Sprintf("\tentries: %d\n", len(s.entries))
+			ss += fmt.Sprintf("\tend: %d\n", s.end)
 			ss += fmt.Sprintf("\tremaining: %d\n", s.remaining)
 		}
 	}
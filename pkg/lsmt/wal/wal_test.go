@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/scottcagno/storage/pkg/lsmt/binary"
 	"os"
+	"sync"
 	"testing"
 	"time"
 )
@@ -195,6 +196,195 @@ func TestLog_TruncateFront(t *testing.T) {
 	}
 }
 
+func TestWAL_Preallocate(t *testing.T) {
+	//
+	// open log
+	c := &WALConfig{BasePath: "wal-testing-prealloc", MaxFileSize: 64 << 10}
+	wal, err := OpenWAL(c)
+	if err != nil {
+		t.Fatalf("opening: %v\n", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(c.BasePath)
+	}()
+	//
+	// segment should already be the full size
+	fi, err := os.Stat(wal.active.path)
+	if err != nil {
+		t.Fatalf("stat: %v\n", err)
+	}
+	if fi.Size() != c.MaxFileSize {
+		t.Fatalf("expected segment size %d, got %d\n", c.MaxFileSize, fi.Size())
+	}
+	//
+	// do some writing
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%04d", i+1)
+		val := fmt.Sprintf("my-value-%06d", i+1)
+		_, err := wal.Write(&binary.Entry{Key: []byte(key), Value: []byte(val)})
+		if err != nil {
+			t.Fatalf("error writing: %v\n", err)
+		}
+	}
+	//
+	// close and re-open, the logical end should be found
+	err = wal.Close()
+	if err != nil {
+		t.Fatalf("closing: %v\n", err)
+	}
+	wal, err = OpenWAL(c)
+	if err != nil {
+		t.Fatalf("opening: %v\n", err)
+	}
+	if wal.Count() != 100 {
+		t.Fatalf("expected 100 entries, got %d\n", wal.Count())
+	}
+	if wal.LastIndex() != 101 {
+		t.Fatalf("expected last index 101, got %d\n", wal.LastIndex())
+	}
+	e, err := wal.Read(100)
+	if err != nil {
+		t.Fatalf("reading: %v\n", err)
+	}
+	if string(e.Key) != "key-0100" {
+		t.Fatalf("expected key-0100, got %q\n", e.Key)
+	}
+	//
+	// close log
+	err = wal.Close()
+	if err != nil {
+		t.Fatalf("closing: %v\n", err)
+	}
+}
+
+func TestWAL_TornWrite(t *testing.T) {
+	//
+	// open log
+	c := &WALConfig{BasePath: "wal-testing-torn", MaxFileSize: 64 << 10}
+	wal, err := OpenWAL(c)
+	if err != nil {
+		t.Fatalf("opening: %v\n", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(c.BasePath)
+	}()
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key-%04d", i+1)
+		_, err := wal.Write(&binary.Entry{Key: []byte(key), Value: []byte(smVal)})
+		if err != nil {
+			t.Fatalf("error writing: %v\n", err)
+		}
+	}
+	//
+	// simulate a torn write by writing half a record at the end
+	path, end := wal.active.path, wal.active.end
+	rec := encodeRecord(nil, wal.active.index, &binary.Entry{Key: []byte("torn"), Value: []byte(smVal)})
+	err = wal.Close()
+	if err != nil {
+		t.Fatalf("closing: %v\n", err)
+	}
+	fd, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatalf("opening segment: %v\n", err)
+	}
+	_, err = fd.WriteAt(rec[:len(rec)/2], end)
+	if err != nil {
+		t.Fatalf("writing segment: %v\n", err)
+	}
+	_ = fd.Close()
+	//
+	// re-open, the torn record should be ignored
+	wal, err = OpenWAL(c)
+	if err != nil {
+		t.Fatalf("opening: %v\n", err)
+	}
+	if wal.Count() != 10 {
+		t.Fatalf("expected 10 entries, got %d\n", wal.Count())
+	}
+	//
+	// and overwritten by the next write
+	_, err = wal.Write(&binary.Entry{Key: []byte("key-0011"), Value: []byte("small")})
+	if err != nil {
+		t.Fatalf("error writing: %v\n", err)
+	}
+	err = wal.Close()
+	if err != nil {
+		t.Fatalf("closing: %v\n", err)
+	}
+	wal, err = OpenWAL(c)
+	if err != nil {
+		t.Fatalf("opening: %v\n", err)
+	}
+	if wal.Count() != 11 {
+		t.Fatalf("expected 11 entries, got %d\n", wal.Count())
+	}
+	err = wal.Close()
+	if err != nil {
+		t.Fatalf("closing: %v\n", err)
+	}
+}
+
+func TestWAL_ResetRecycles(t *testing.T) {
+	//
+	// open log
+	c := &WALConfig{BasePath: "wal-testing-recycle", MaxFileSize: 16 << 10}
+	wal, err := OpenWAL(c)
+	if err != nil {
+		t.Fatalf("opening: %v\n", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(c.BasePath)
+	}()
+	write := func(n int) {
+		for i := 0; i < n; i++ {
+			key := fmt.Sprintf("key-%04d", i+1)
+			_, err := wal.Write(&binary.Entry{Key: []byte(key), Value: []byte(mdVal)})
+			if err != nil {
+				t.Fatalf("error writing: %v\n", err)
+			}
+		}
+	}
+	//
+	// fill a few segments and then reset
+	write(50)
+	segs := len(wal.segments)
+	if segs < 2 {
+		t.Fatalf("expected multiple segments, got %d\n", segs)
+	}
+	err = wal.Reset()
+	if err != nil {
+		t.Fatalf("reset: %v\n", err)
+	}
+	if wal.Count() != 0 {
+		t.Fatalf("expected 0 entries after reset, got %d\n", wal.Count())
+	}
+	if len(wal.retired) != segs-1 {
+		t.Fatalf("expected %d retired segments, got %d\n", segs-1, len(wal.retired))
+	}
+	//
+	// write a few entries into the recycled segment, and
+	// make sure none of the stale records come back
+	write(3)
+	err = wal.Close()
+	if err != nil {
+		t.Fatalf("closing: %v\n", err)
+	}
+	wal, err = OpenWAL(c)
+	if err != nil {
+		t.Fatalf("opening: %v\n", err)
+	}
+	if wal.Count() != 3 {
+		t.Fatalf("expected 3 entries, got %d\n", wal.Count())
+	}
+	if wal.FirstIndex() != 51 {
+		t.Fatalf("expected first index 51, got %d\n", wal.FirstIndex())
+	}
+	err = wal.Close()
+	if err != nil {
+		t.Fatalf("closing: %v\n", err)
+	}
+}
+
 var smVal = `Praesent efficitur, ante eget eleifend scelerisque, neque erat malesuada neque, vel euismod 
 dui leo a nisl. Donec a eleifend dui. Maecenas necleo odio. In maximus convallis ligula eget sodales.`
 
@@ -255,3 +445,53 @@ Mauris ac blandit nulla, ac dignissim quam. Ut ut est placerat quam suscipit sod
 lacus. Praesent hendrerit mattis diam et sodales. In a augue sit amet odio iaculis tempus sed 
 a erat. Donec quis nisi tellus. Nam hendrerit purus ligula, id bibendum metus pulvinar sed. 
 Nulla eu neque lobortis, porta elit quis, luctus purus. Vestibulum et ultrices nulla.`
+
+func TestWAL_ConcurrentRead(t *testing.T) {
+	//
+	// open log, with small segments so the reads go to many of them
+	c := &WALConfig{BasePath: "wal-testing-concurrent", MaxFileSize: 4 << 10}
+	wal, err := OpenWAL(c)
+	if err != nil {
+		t.Fatalf("opening: %v\n", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(c.BasePath)
+	}()
+	//
+	// do some writing
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("key-%04d", i+1)
+		val := fmt.Sprintf("my-value-%06d", i+1)
+		_, err := wal.Write(&binary.Entry{Key: []byte(key), Value: []byte(val)})
+		if err != nil {
+			t.Fatalf("error writing: %v\n", err)
+		}
+	}
+	//
+	// read from a few goroutines at once
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < 500; i += 3 {
+				e, err := wal.Read(int64(i + 1))
+				if err != nil {
+					t.Errorf("reading: %v\n", err)
+					return
+				}
+				if want := fmt.Sprintf("key-%04d", i+1); string(e.Key) != want {
+					t.Errorf("expected %s, got %q\n", want, e.Key)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	//
+	// close log
+	err = wal.Close()
+	if err != nil {
+		t.Fatalf("closing: %v\n", err)
+	}
+}
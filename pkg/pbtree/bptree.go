@@ -0,0 +1,376 @@
+// Package pbtree implements a persistent, page-based B+tree. The tree is
+// stored in a single data file made up of fixed size pages. Updates are
+// copy-on-write: a transaction writes the nodes it modifies to free
+// pages, syncs them and then switches between two meta pages to commit,
+// so the tree on disk is always consistent and there is no need for a
+// write-ahead log. Pages that are no longer in use are tracked
+// by a freelist (which is also stored in the data file) and
+// are reused by later transactions.
+package pbtree
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	dataFileName = "bptree.db"
+
+	defaultBaseDir     = "data"
+	defaultCacheSize   = 1024
+	defaultSyncOnWrite = false
+)
+
+// BPTreeConfig holds configuration settings for a BPTree instance
+type BPTreeConfig struct {
+	BaseDir     string // base directory
+	PageSize    int    // page size (only used when creating a new file)
+	CacheSize   int    // max number of decoded pages to cache
+	SyncOnWrite bool   // also sync after the meta page is written, so a committed tx is durable
+}
+
+func (conf *BPTreeConfig) String() string {
+	data, err := json.MarshalIndent(conf, "", "\t")
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+// checkBPTreeConfig is a helper to make sure the configuration
+// options are correct and handles and missing options
+func checkBPTreeConfig(conf *BPTreeConfig) *BPTreeConfig {
+	if conf == nil {
+		conf = &BPTreeConfig{}
+	}
+	if conf.BaseDir == *new(string) {
+		conf.BaseDir = defaultBaseDir
+	}
+	if conf.PageSize <= 0 {
+		conf.PageSize = defaultPageSize
+	}
+	if conf.CacheSize <= 0 {
+		conf.CacheSize = defaultCacheSize
+	}
+	return conf
+}
+
+// BPTree is a persistent B+tree. Any number of read-only transactions
+// may run at once, but read-write transactions are serialized and
+// block the readers while they run.
+type BPTree struct {
+	lock  sync.RWMutex
+	conf  *BPTreeConfig
+	file  *os.File
+	pager *pager
+	meta  meta
+	free  *freelist
+	cache *nodeCache
+}
+
+// OpenBPTree opens (or creates) the B+tree found in the base directory
+func OpenBPTree(conf *BPTreeConfig) (*BPTree, error) {
+	// check config
+	conf = checkBPTreeConfig(conf)
+	if conf.PageSize < minPageSize || conf.PageSize > maxPageSize ||
+		conf.PageSize&(conf.PageSize-1) != 0 {
+		return nil, ErrBadPageSize
+	}
+	// make sure the base directory exists
+	base, err := filepath.Abs(conf.BaseDir)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(base, os.ModeDir)
+	if err != nil {
+		return nil, err
+	}
+	// open the data file
+	file, err := os.OpenFile(filepath.Join(base, dataFileName), os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+	t := &BPTree{
+		conf:  conf,
+		file:  file,
+		free:  newFreelist(),
+		cache: newNodeCache(conf.CacheSize),
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		err = t.init()
+	} else {
+		err = t.load()
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// init initializes a new data file by writing both meta pages
+func (t *BPTree) init() error {
+	t.pager = newPager(t.file, t.conf.PageSize)
+	m := meta{
+		pageSize: uint32(t.conf.PageSize),
+		npages:   2,
+	}
+	for i := 0; i < 2; i++ {
+		m.txid = uint64(i)
+		if err := t.writeMeta(&m); err != nil {
+			return err
+		}
+	}
+	if err := t.pager.sync(); err != nil {
+		return err
+	}
+	t.meta = m
+	return nil
+}
+
+// load reads both meta pages, and uses the valid one with the
+// latest transaction id. It then loads the freelist.
+func (t *BPTree) load() error {
+	var m0, m1 meta
+	buf := make([]byte, metaSize)
+	_, err := t.file.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	err0 := m0.decode(buf)
+	// locate the second meta page using the page size found in the
+	// first one, or the configured page size if the first is bad
+	pageSize := int64(t.conf.PageSize)
+	if err0 == nil {
+		pageSize = int64(m0.pageSize)
+	}
+	_, err = t.file.ReadAt(buf, pageSize)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	err1 := m1.decode(buf)
+	switch {
+	case err0 != nil && err1 != nil:
+		return ErrInvalidFile
+	case err0 != nil:
+		t.meta = m1
+	case err1 != nil:
+		t.meta = m0
+	case m1.txid > m0.txid:
+		t.meta = m1
+	default:
+		t.meta = m0
+	}
+	if t.meta.pageSize < minPageSize || t.meta.pageSize > maxPageSize {
+		return ErrBadPageSize
+	}
+	t.pager = newPager(t.file, int(t.meta.pageSize))
+	return t.loadFreelist()
+}
+
+// loadFreelist (re)loads the freelist of the last committed tx
+func (t *BPTree) loadFreelist() error {
+	t.free = newFreelist()
+	if t.meta.freelist == 0 {
+		return nil
+	}
+	buf, err := t.pager.read(t.meta.freelist)
+	if err != nil {
+		return err
+	}
+	err = t.free.decode(buf)
+	if err != nil {
+		return err
+	}
+	_, _, t.free.overflow = readPageHeader(buf)
+	t.free.pgid = t.meta.freelist
+	return nil
+}
+
+// writeMeta writes the meta data to one of the two meta pages,
+// which one is decided by the transaction id
+func (t *BPTree) writeMeta(m *meta) error {
+	buf := make([]byte, t.pager.pageSize)
+	m.encode(buf)
+	return t.pager.write(pgid(m.txid%2), buf)
+}
+
+// node returns the node found at the provided page
+func (t *BPTree) node(id pgid) (*node, error) {
+	if n, ok := t.cache.get(id); ok {
+		return n, nil
+	}
+	buf, err := t.pager.read(id)
+	if err != nil {
+		return nil, err
+	}
+	n, err := decodeNode(id, buf)
+	if err != nil {
+		return nil, err
+	}
+	t.cache.put(id, n)
+	return n, nil
+}
+
+// rollback discards anything a failed commit may have changed
+func (t *BPTree) rollback() {
+	t.cache.reset()
+	if err := t.loadFreelist(); err != nil {
+		// the freelist cannot be read, so start with an empty
+		// one; this only leaks pages, it never loses data
+		t.free = newFreelist()
+	}
+}
+
+// View runs the provided function within a read-only transaction
+func (t *BPTree) View(fn func(tx *Tx) error) error {
+	// read lock
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	if t.file == nil {
+		return ErrTreeIsClosed
+	}
+	tx := newTx(t, false)
+	defer func() {
+		tx.closed = true
+	}()
+	return fn(tx)
+}
+
+// Update runs the provided function within a read-write transaction. If
+// the function returns an error none of the changes are committed.
+func (t *BPTree) Update(fn func(tx *Tx) error) error {
+	// lock
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.file == nil {
+		return ErrTreeIsClosed
+	}
+	tx := newTx(t, true)
+	defer func() {
+		tx.closed = true
+	}()
+	err := fn(tx)
+	if err != nil {
+		return err
+	}
+	err = tx.commit()
+	if err != nil {
+		t.rollback()
+		return err
+	}
+	return nil
+}
+
+// Has returns a boolean reporting true if the key exists
+func (t *BPTree) Has(key string) bool {
+	var ok bool
+	_ = t.View(func(tx *Tx) error {
+		ok = tx.Has(key)
+		return nil
+	})
+	return ok
+}
+
+// Get returns the value stored for the provided key
+func (t *BPTree) Get(key string) ([]byte, error) {
+	var val []byte
+	err := t.View(func(tx *Tx) error {
+		var err error
+		val, err = tx.Get(key)
+		return err
+	})
+	return val, err
+}
+
+// Put inserts or updates the value for the provided key
+func (t *BPTree) Put(key string, value []byte) error {
+	return t.Update(func(tx *Tx) error {
+		return tx.Put(key, value)
+	})
+}
+
+// Del removes the provided key
+func (t *BPTree) Del(key string) error {
+	return t.Update(func(tx *Tx) error {
+		return tx.Del(key)
+	})
+}
+
+// Range iterates the keys (and values) in ascending order starting
+// with the start key (inclusive) and ending before the end key. An
+// empty start key starts at the first key, and an empty end key
+// continues through to the last key. The iteration stops if the
+// iterator function returns false
+func (t *BPTree) Range(start, end string, iter func(k string, v []byte) bool) error {
+	return t.View(func(tx *Tx) error {
+		c := tx.Cursor()
+		ok := c.First()
+		if start != "" {
+			ok = c.Seek(start)
+		}
+		for ; ok; ok = c.Next() {
+			k := c.Key()
+			if end != "" && k >= end {
+				break
+			}
+			if !iter(k, c.Value()) {
+				break
+			}
+		}
+		return c.Err()
+	})
+}
+
+// Len returns the number of keys in the tree
+func (t *BPTree) Len() (int, error) {
+	var count int
+	err := t.View(func(tx *Tx) error {
+		c := tx.Cursor()
+		for ok := c.First(); ok; ok = c.Next() {
+			count++
+		}
+		return c.Err()
+	})
+	return count, err
+}
+
+// Sync flushes the data file to disk
+func (t *BPTree) Sync() error {
+	// lock
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.file == nil {
+		return ErrTreeIsClosed
+	}
+	return t.pager.sync()
+}
+
+// Close syncs and closes the data file
+func (t *BPTree) Close() error {
+	// lock
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.file == nil {
+		return ErrTreeIsClosed
+	}
+	err := t.pager.sync()
+	if err != nil {
+		return err
+	}
+	err = t.file.Close()
+	if err != nil {
+		return err
+	}
+	t.file = nil
+	t.cache.reset()
+	return nil
+}
@@ -0,0 +1,327 @@
+package pbtree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/scottcagno/storage/pkg/util"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	thousand = 1000
+	n        = 10
+)
+
+func makeKey(i int) string {
+	return fmt.Sprintf("key-%06d", i)
+}
+
+func makeVal(i int) []byte {
+	return []byte(fmt.Sprintf("value-%08d", i))
+}
+
+func openTree(t *testing.T, dir string) *BPTree {
+	tree, err := OpenBPTree(&BPTreeConfig{
+		BaseDir:  dir,
+		PageSize: minPageSize,
+	})
+	if err != nil {
+		t.Fatalf("open: %v\n", err)
+	}
+	return tree
+}
+
+func TestBPTree_PutGetDel(t *testing.T) {
+	dir := "bptree-testing-putgetdel"
+	defer os.RemoveAll(dir)
+	tree := openTree(t, dir)
+	// insert in random order
+	perm := rand.Perm(n * thousand)
+	for _, i := range perm {
+		if err := tree.Put(makeKey(i), makeVal(i)); err != nil {
+			t.Fatalf("put: %v\n", err)
+		}
+	}
+	count, err := tree.Len()
+	if err != nil {
+		t.Fatalf("len: %v\n", err)
+	}
+	util.AssertLen(t, n*thousand, count)
+	for i := 0; i < n*thousand; i++ {
+		v, err := tree.Get(makeKey(i))
+		if err != nil {
+			t.Fatalf("get(%d): %v\n", i, err)
+		}
+		util.AssertEqual(t, makeVal(i), v)
+	}
+	// update every other key
+	for i := 0; i < n*thousand; i += 2 {
+		if err := tree.Put(makeKey(i), []byte("updated")); err != nil {
+			t.Fatalf("put: %v\n", err)
+		}
+	}
+	v, err := tree.Get(makeKey(42))
+	if err != nil {
+		t.Fatalf("get: %v\n", err)
+	}
+	util.AssertEqual(t, []byte("updated"), v)
+	// remove all the keys, in a different random order
+	for _, i := range rand.Perm(n * thousand) {
+		if err := tree.Del(makeKey(i)); err != nil {
+			t.Fatalf("del: %v\n", err)
+		}
+		if tree.Has(makeKey(i)) {
+			t.Fatalf("del: key %q still exists\n", makeKey(i))
+		}
+	}
+	count, err = tree.Len()
+	if err != nil {
+		t.Fatalf("len: %v\n", err)
+	}
+	util.AssertLen(t, 0, count)
+	_, err = tree.Get(makeKey(1))
+	util.AssertEqual(t, ErrKeyNotFound, err)
+	if err = tree.Close(); err != nil {
+		t.Fatalf("close: %v\n", err)
+	}
+}
+
+func TestBPTree_Reopen(t *testing.T) {
+	dir := "bptree-testing-reopen"
+	defer os.RemoveAll(dir)
+	tree := openTree(t, dir)
+	for i := 0; i < n*thousand; i++ {
+		if err := tree.Put(makeKey(i), makeVal(i)); err != nil {
+			t.Fatalf("put: %v\n", err)
+		}
+	}
+	for i := 0; i < n*thousand; i += 3 {
+		if err := tree.Del(makeKey(i)); err != nil {
+			t.Fatalf("del: %v\n", err)
+		}
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("close: %v\n", err)
+	}
+	tree = openTree(t, dir)
+	defer tree.Close()
+	for i := 0; i < n*thousand; i++ {
+		v, err := tree.Get(makeKey(i))
+		if i%3 == 0 {
+			util.AssertEqual(t, ErrKeyNotFound, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("get(%d): %v\n", i, err)
+		}
+		util.AssertEqual(t, makeVal(i), v)
+	}
+}
+
+func TestBPTree_Cursor(t *testing.T) {
+	dir := "bptree-testing-cursor"
+	defer os.RemoveAll(dir)
+	tree := openTree(t, dir)
+	defer tree.Close()
+	for i := 0; i < n*thousand; i++ {
+		if err := tree.Put(makeKey(i), makeVal(i)); err != nil {
+			t.Fatalf("put: %v\n", err)
+		}
+	}
+	err := tree.View(func(tx *Tx) error {
+		c := tx.Cursor()
+		// forward
+		var i int
+		for ok := c.First(); ok; ok = c.Next() {
+			util.AssertEqual(t, makeKey(i), c.Key())
+			util.AssertEqual(t, makeVal(i), c.Value())
+			i++
+		}
+		util.AssertLen(t, n*thousand, i)
+		// reverse
+		for ok := c.Last(); ok; ok = c.Prev() {
+			i--
+			util.AssertEqual(t, makeKey(i), c.Key())
+		}
+		util.AssertLen(t, 0, i)
+		// seek to an existing key, and to a key in between
+		util.AssertTrue(t, c.Seek(makeKey(500)))
+		util.AssertEqual(t, makeKey(500), c.Key())
+		util.AssertTrue(t, c.Seek(makeKey(500)+"x"))
+		util.AssertEqual(t, makeKey(501), c.Key())
+		util.AssertTrue(t, c.Prev())
+		util.AssertEqual(t, makeKey(500), c.Key())
+		// seek past the end
+		util.AssertEqual(t, false, c.Seek("zzz"))
+		return c.Err()
+	})
+	if err != nil {
+		t.Fatalf("view: %v\n", err)
+	}
+	// bounded range
+	var keys []string
+	err = tree.Range(makeKey(100), makeKey(200), func(k string, v []byte) bool {
+		keys = append(keys, k)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("range: %v\n", err)
+	}
+	util.AssertLen(t, 100, len(keys))
+	util.AssertEqual(t, makeKey(100), keys[0])
+	util.AssertEqual(t, makeKey(199), keys[99])
+}
+
+func TestBPTree_LargeValues(t *testing.T) {
+	dir := "bptree-testing-large"
+	defer os.RemoveAll(dir)
+	tree := openTree(t, dir)
+	val := func(i int) []byte {
+		return bytes.Repeat([]byte{byte(i)}, (i%7)*minPageSize+i)
+	}
+	for i := 0; i < 200; i++ {
+		if err := tree.Put(makeKey(i), val(i)); err != nil {
+			t.Fatalf("put: %v\n", err)
+		}
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("close: %v\n", err)
+	}
+	tree = openTree(t, dir)
+	defer tree.Close()
+	for i := 0; i < 200; i++ {
+		v, err := tree.Get(makeKey(i))
+		if err != nil {
+			t.Fatalf("get(%d): %v\n", i, err)
+		}
+		if !bytes.Equal(val(i), v) {
+			t.Fatalf("get(%d): value mismatch\n", i)
+		}
+	}
+	err := tree.Put(string(bytes.Repeat([]byte{'k'}, minPageSize)), nil)
+	util.AssertEqual(t, ErrKeyTooLarge, err)
+}
+
+func TestBPTree_PagesAreReused(t *testing.T) {
+	dir := "bptree-testing-reuse"
+	defer os.RemoveAll(dir)
+	tree := openTree(t, dir)
+	defer tree.Close()
+	for i := 0; i < thousand; i++ {
+		if err := tree.Put(makeKey(i), makeVal(i)); err != nil {
+			t.Fatalf("put: %v\n", err)
+		}
+	}
+	npages := tree.meta.npages
+	// overwriting keys frees as many pages as it allocates, so
+	// the file should not keep growing
+	for j := 0; j < 5; j++ {
+		for i := 0; i < thousand; i++ {
+			if err := tree.Put(makeKey(i), makeVal(i+j)); err != nil {
+				t.Fatalf("put: %v\n", err)
+			}
+		}
+	}
+	if tree.meta.npages > npages+npages/2 {
+		t.Fatalf("pages: expected pages to be reused, went from %d to %d\n", npages, tree.meta.npages)
+	}
+}
+
+func TestBPTree_Update(t *testing.T) {
+	dir := "bptree-testing-update"
+	defer os.RemoveAll(dir)
+	tree := openTree(t, dir)
+	defer tree.Close()
+	// a batch of writes is committed as a whole
+	err := tree.Update(func(tx *Tx) error {
+		for i := 0; i < thousand; i++ {
+			if err := tx.Put(makeKey(i), makeVal(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("update: %v\n", err)
+	}
+	// or not at all
+	errAbort := errors.New("abort")
+	err = tree.Update(func(tx *Tx) error {
+		for i := 0; i < thousand; i++ {
+			if err := tx.Del(makeKey(i)); err != nil {
+				return err
+			}
+		}
+		util.AssertEqual(t, false, tx.Has(makeKey(1)))
+		return errAbort
+	})
+	util.AssertEqual(t, errAbort, err)
+	count, err := tree.Len()
+	if err != nil {
+		t.Fatalf("len: %v\n", err)
+	}
+	util.AssertLen(t, thousand, count)
+	// read-only transactions cannot write
+	err = tree.View(func(tx *Tx) error {
+		return tx.Put("foo", []byte("bar"))
+	})
+	util.AssertEqual(t, ErrTxNotWritable, err)
+}
+
+func TestBPTree_TornMeta(t *testing.T) {
+	dir := "bptree-testing-torn"
+	defer os.RemoveAll(dir)
+	tree := openTree(t, dir)
+	for i := 0; i < thousand; i++ {
+		if err := tree.Put(makeKey(i), makeVal(i)); err != nil {
+			t.Fatalf("put: %v\n", err)
+		}
+	}
+	last := tree.meta.txid
+	if err := tree.Close(); err != nil {
+		t.Fatalf("close: %v\n", err)
+	}
+	// corrupt the latest meta page, as if the final
+	// write of the last commit never made it to disk
+	fd, err := os.OpenFile(filepath.Join(dir, dataFileName), os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatalf("open: %v\n", err)
+	}
+	_, err = fd.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, int64(last%2)*minPageSize+24)
+	if err != nil {
+		t.Fatalf("write: %v\n", err)
+	}
+	if err = fd.Close(); err != nil {
+		t.Fatalf("close: %v\n", err)
+	}
+	// the tree falls back to the previous commit
+	tree = openTree(t, dir)
+	defer tree.Close()
+	util.AssertEqual(t, last-1, tree.meta.txid)
+	count, err := tree.Len()
+	if err != nil {
+		t.Fatalf("len: %v\n", err)
+	}
+	util.AssertLen(t, thousand-1, count)
+	util.AssertEqual(t, false, tree.Has(makeKey(thousand-1)))
+}
+
+func BenchmarkBPTree_Put(b *testing.B) {
+	dir := "bptree-testing-bench"
+	defer os.RemoveAll(dir)
+	tree, err := OpenBPTree(&BPTreeConfig{BaseDir: dir})
+	if err != nil {
+		b.Fatalf("open: %v\n", err)
+	}
+	defer tree.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := tree.Put(makeKey(i), makeVal(i)); err != nil {
+			b.Fatalf("put: %v\n", err)
+		}
+	}
+}
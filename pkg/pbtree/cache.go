@@ -0,0 +1,58 @@
+package pbtree
+
+import (
+	"sync"
+)
+
+// nodeCache caches the decoded nodes read from the data file. Pages
+// are never modified once written, so a cached node stays valid
+// until its page is freed and then written again, at which point
+// it is evicted. When the cache is full an arbitrary node is
+// evicted to make room.
+type nodeCache struct {
+	lock  sync.Mutex
+	max   int
+	nodes map[pgid]*node
+}
+
+func newNodeCache(max int) *nodeCache {
+	return &nodeCache{
+		max:   max,
+		nodes: make(map[pgid]*node),
+	}
+}
+
+func (c *nodeCache) get(id pgid) (*node, bool) {
+	// lock
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	n, ok := c.nodes[id]
+	return n, ok
+}
+
+func (c *nodeCache) put(id pgid, n *node) {
+	// lock
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.nodes) >= c.max {
+		for k := range c.nodes {
+			delete(c.nodes, k)
+			break
+		}
+	}
+	c.nodes[id] = n
+}
+
+func (c *nodeCache) evict(id pgid) {
+	// lock
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.nodes, id)
+}
+
+func (c *nodeCache) reset() {
+	// lock
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.nodes = make(map[pgid]*node)
+}
@@ -0,0 +1,221 @@
+package pbtree
+
+// elemRef references an element (or a child) of a node
+type elemRef struct {
+	node  *node
+	index int
+}
+
+// Cursor iterates over the keys of a tree in ascending or descending
+// order. It keeps a stack of the nodes from the root down to the
+// current leaf, so no sibling links are needed between the leaves
+// (which would be impossible to maintain with copy-on-write pages.)
+// Keys and values returned by the cursor must not be modified, and
+// are only valid for as long as the tx is open.
+type Cursor struct {
+	tx    *Tx
+	stack []elemRef
+	err   error
+}
+
+// First moves the cursor to the first key
+func (c *Cursor) First() bool {
+	if !c.reset() {
+		return false
+	}
+	c.descend(true)
+	return c.valid() || c.next()
+}
+
+// Last moves the cursor to the last key
+func (c *Cursor) Last() bool {
+	if !c.reset() {
+		return false
+	}
+	c.stack[0].index = len(c.stack[0].node.keys) - 1
+	c.descend(false)
+	return c.valid() || c.prev()
+}
+
+// Seek moves the cursor to the first key that is greater
+// than or equal to the provided key
+func (c *Cursor) Seek(key string) bool {
+	if !c.reset() {
+		return false
+	}
+	k := []byte(key)
+	for {
+		ref := &c.stack[len(c.stack)-1]
+		if ref.node.leaf {
+			ref.index, _ = ref.node.search(k)
+			break
+		}
+		ref.index = ref.node.route(k)
+		child, err := c.tx.child(ref.node, ref.index)
+		if err != nil {
+			c.fail(err)
+			return false
+		}
+		c.stack = append(c.stack, elemRef{node: child})
+	}
+	if c.valid() {
+		return true
+	}
+	// the key is greater than every key in the leaf
+	leaf := &c.stack[len(c.stack)-1]
+	leaf.index = len(leaf.node.keys) - 1
+	return c.next()
+}
+
+// Next moves the cursor to the next key
+func (c *Cursor) Next() bool {
+	if !c.valid() {
+		return false
+	}
+	return c.next()
+}
+
+// Prev moves the cursor to the previous key
+func (c *Cursor) Prev() bool {
+	if !c.valid() {
+		return false
+	}
+	return c.prev()
+}
+
+// Key returns the key at the current position of the
+// cursor, or an empty string if the cursor is not valid
+func (c *Cursor) Key() string {
+	if !c.valid() {
+		return ""
+	}
+	ref := c.stack[len(c.stack)-1]
+	return string(ref.node.keys[ref.index])
+}
+
+// Value returns the value at the current position of
+// the cursor, or nil if the cursor is not valid
+func (c *Cursor) Value() []byte {
+	if !c.valid() {
+		return nil
+	}
+	ref := c.stack[len(c.stack)-1]
+	return ref.node.vals[ref.index]
+}
+
+// Err returns the error (if any) the cursor encountered
+// while reading a page from the data file
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// reset positions the cursor at the root
+func (c *Cursor) reset() bool {
+	c.stack = c.stack[:0]
+	if c.err != nil {
+		return false
+	}
+	if err := c.tx.check(false); err != nil {
+		c.fail(err)
+		return false
+	}
+	root, err := c.tx.rootNode()
+	if err != nil {
+		c.fail(err)
+		return false
+	}
+	if root == nil {
+		return false
+	}
+	c.stack = append(c.stack, elemRef{node: root})
+	return true
+}
+
+// fail records the error and invalidates the cursor
+func (c *Cursor) fail(err error) {
+	c.err = err
+	c.stack = c.stack[:0]
+}
+
+// valid reports true if the cursor is positioned at a key
+func (c *Cursor) valid() bool {
+	if len(c.stack) == 0 {
+		return false
+	}
+	ref := c.stack[len(c.stack)-1]
+	return ref.node.leaf && ref.index >= 0 && ref.index < len(ref.node.keys)
+}
+
+// descend follows the current element of the top node down to
+// a leaf, taking the first (or last) element at every level
+func (c *Cursor) descend(first bool) {
+	for {
+		ref := c.stack[len(c.stack)-1]
+		if ref.node.leaf {
+			return
+		}
+		child, err := c.tx.child(ref.node, ref.index)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		index := 0
+		if !first {
+			index = len(child.keys) - 1
+		}
+		c.stack = append(c.stack, elemRef{node: child, index: index})
+	}
+}
+
+// next moves to the next key, moving up the stack until a node that
+// has a next element is found and then back down to the leaf level
+func (c *Cursor) next() bool {
+	for {
+		i := len(c.stack) - 1
+		for ; i >= 0; i-- {
+			ref := c.stack[i]
+			if ref.index < len(ref.node.keys)-1 {
+				break
+			}
+		}
+		if i < 0 {
+			c.stack = c.stack[:0]
+			return false
+		}
+		c.stack = c.stack[:i+1]
+		c.stack[i].index++
+		c.descend(true)
+		if len(c.stack) == 0 {
+			return false
+		}
+		if c.valid() {
+			return true
+		}
+	}
+}
+
+// prev moves to the previous key, moving up the stack until a node that
+// has a previous element is found and then back down to the leaf level
+func (c *Cursor) prev() bool {
+	for {
+		i := len(c.stack) - 1
+		for ; i >= 0; i-- {
+			if c.stack[i].index > 0 {
+				break
+			}
+		}
+		if i < 0 {
+			c.stack = c.stack[:0]
+			return false
+		}
+		c.stack = c.stack[:i+1]
+		c.stack[i].index--
+		c.descend(false)
+		if len(c.stack) == 0 {
+			return false
+		}
+		if c.valid() {
+			return true
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package pbtree
+
+import (
+	"errors"
+)
+
+var (
+	ErrKeyNotFound = errors.New("pbtree: key not found")
+	ErrBadKey      = errors.New("pbtree: bad key")
+	ErrKeyTooLarge = errors.New("pbtree: key too large")
+
+	ErrTxNotWritable = errors.New("pbtree: tx not writable")
+	ErrTxClosed      = errors.New("pbtree: tx closed")
+
+	ErrInvalidFile  = errors.New("pbtree: invalid or corrupt file")
+	ErrBadPageSize  = errors.New("pbtree: bad page size")
+	ErrBadChecksum  = errors.New("pbtree: bad checksum")
+	ErrTreeIsClosed = errors.New("pbtree: tree is closed")
+)
@@ -0,0 +1,108 @@
+package pbtree
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// freelist keeps track of the pages that can be reused. Pages that are
+// freed by a transaction are still referenced by the last committed
+// meta page, so they are held as pending until the transaction that
+// freed them has committed; only then can they be allocated again.
+type freelist struct {
+	ids      []pgid // ids holds the (sorted) page ids that are free to use
+	pending  []pgid // pending holds the page ids freed by the current tx
+	pgid     pgid   // pgid is the page the freelist was read from
+	overflow int    // overflow is the overflow count of that page
+}
+
+func newFreelist() *freelist {
+	return new(freelist)
+}
+
+// allocate returns the first page id of a contiguous run of n free
+// pages and removes the run from the freelist. It returns zero if
+// there is no run of n pages available.
+func (f *freelist) allocate(n int) pgid {
+	if len(f.ids) == 0 {
+		return 0
+	}
+	var start int
+	for i := range f.ids {
+		// check if the run is broken
+		if i > 0 && f.ids[i] != f.ids[i-1]+1 {
+			start = i
+		}
+		if i-start+1 == n {
+			id := f.ids[start]
+			f.ids = append(f.ids[:start], f.ids[i+1:]...)
+			return id
+		}
+	}
+	return 0
+}
+
+// free marks the provided page (and its overflow pages) as pending
+func (f *freelist) free(id pgid, overflow int) {
+	for i := 0; i <= overflow; i++ {
+		f.pending = append(f.pending, id+pgid(i))
+	}
+}
+
+// release moves all the pending pages into the free pages
+func (f *freelist) release() {
+	if len(f.pending) == 0 {
+		return
+	}
+	f.ids = f.all()
+	f.pending = f.pending[:0]
+}
+
+// all returns all the free and the pending page ids, sorted
+func (f *freelist) all() []pgid {
+	ids := make([]pgid, 0, len(f.ids)+len(f.pending))
+	ids = append(ids, f.ids...)
+	ids = append(ids, f.pending...)
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// count returns the number of free and pending pages
+func (f *freelist) count() int {
+	return len(f.ids) + len(f.pending)
+}
+
+// size returns the encoded size of the freelist in bytes
+func (f *freelist) size() int {
+	return pageHeaderSize + 8*f.count()
+}
+
+// encode writes all the free and pending page ids into the
+// provided buffer (which must be at least size bytes)
+func (f *freelist) encode(b []byte, overflow int) {
+	ids := f.all()
+	putPageHeader(b, pageFreelist, len(ids), overflow)
+	off := pageHeaderSize
+	for _, id := range ids {
+		binary.LittleEndian.PutUint64(b[off:off+8], uint64(id))
+		off += 8
+	}
+}
+
+// decode reads the page ids found in the provided buffer
+func (f *freelist) decode(b []byte) error {
+	typ, count, _ := readPageHeader(b)
+	if typ != pageFreelist || pageHeaderSize+8*count > len(b) {
+		return ErrInvalidFile
+	}
+	f.ids = make([]pgid, count)
+	off := pageHeaderSize
+	for i := range f.ids {
+		f.ids[i] = pgid(binary.LittleEndian.Uint64(b[off : off+8]))
+		off += 8
+	}
+	f.pending = f.pending[:0]
+	return nil
+}
@@ -0,0 +1,274 @@
+package pbtree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// node is the in-memory representation of a branch or a leaf page.
+// Nodes that are read from the data file are shared (and cached) so
+// they are never modified; a write transaction clones a node before
+// it changes it. Every branch key is a lower bound of the keys found
+// in the corresponding child. Any key smaller than the first branch
+// key is routed to the first child.
+type node struct {
+	leaf     bool
+	pgid     pgid     // pgid is the page the node was read from (0 if new)
+	overflow int      // overflow is the overflow page count of that page
+	keys     [][]byte // keys holds the keys of the node
+	vals     [][]byte // vals holds the values of a leaf node
+	children []pgid   // children holds the child page ids of a branch node
+	nodes    []*node  // nodes holds the (materialized) children of a branch
+	parent   *node    // parent is set for materialized nodes
+	dirty    bool     // dirty reports if the node needs to be written
+}
+
+// elemSize returns the encoded size of the element at index i
+func (n *node) elemSize(i int) int {
+	if n.leaf {
+		return leafElemSize + len(n.keys[i]) + len(n.vals[i])
+	}
+	return branchElemSize + len(n.keys[i])
+}
+
+// size returns the encoded size of the node in bytes
+func (n *node) size() int {
+	sz := pageHeaderSize
+	for i := range n.keys {
+		sz += n.elemSize(i)
+	}
+	return sz
+}
+
+// search returns the index of the first key that is greater than or
+// equal to the provided key, and a boolean reporting true if the key
+// at that index is an exact match
+func (n *node) search(key []byte) (int, bool) {
+	i := sort.Search(len(n.keys), func(i int) bool {
+		return bytes.Compare(n.keys[i], key) >= 0
+	})
+	return i, i < len(n.keys) && bytes.Equal(n.keys[i], key)
+}
+
+// route returns the index of the child of a branch node
+// that the provided key belongs in
+func (n *node) route(key []byte) int {
+	i, found := n.search(key)
+	if !found && i > 0 {
+		i--
+	}
+	return i
+}
+
+// indexOf returns the index of the provided materialized child
+func (n *node) indexOf(child *node) int {
+	for i := range n.nodes {
+		if n.nodes[i] == child {
+			return i
+		}
+	}
+	return -1
+}
+
+// ensureNodes makes sure the materialized children slice is
+// allocated, and that it is the same length as the children
+func (n *node) ensureNodes() {
+	if n.nodes == nil {
+		n.nodes = make([]*node, len(n.children))
+	}
+}
+
+// insertChild inserts a child (and its lower bound key) at index i
+func (n *node) insertChild(i int, key []byte, child *node) {
+	n.ensureNodes()
+	n.keys = append(n.keys, nil)
+	copy(n.keys[i+1:], n.keys[i:])
+	n.keys[i] = key
+	n.children = append(n.children, 0)
+	copy(n.children[i+1:], n.children[i:])
+	n.children[i] = child.pgid
+	n.nodes = append(n.nodes, nil)
+	copy(n.nodes[i+1:], n.nodes[i:])
+	n.nodes[i] = child
+	child.parent = n
+}
+
+// removeChild removes the child at index i
+func (n *node) removeChild(i int) {
+	n.ensureNodes()
+	n.keys = append(n.keys[:i], n.keys[i+1:]...)
+	n.children = append(n.children[:i], n.children[i+1:]...)
+	n.nodes = append(n.nodes[:i], n.nodes[i+1:]...)
+}
+
+// put inserts or updates the key and value in a leaf node
+func (n *node) put(key, value []byte) {
+	i, found := n.search(key)
+	if found {
+		n.vals[i] = value
+		return
+	}
+	n.keys = append(n.keys, nil)
+	copy(n.keys[i+1:], n.keys[i:])
+	n.keys[i] = key
+	n.vals = append(n.vals, nil)
+	copy(n.vals[i+1:], n.vals[i:])
+	n.vals[i] = value
+}
+
+// del removes the key (and value) from a leaf node. It
+// returns a boolean reporting true if the key was found
+func (n *node) del(key []byte) bool {
+	i, found := n.search(key)
+	if !found {
+		return false
+	}
+	n.keys = append(n.keys[:i], n.keys[i+1:]...)
+	n.vals = append(n.vals[:i], n.vals[i+1:]...)
+	return true
+}
+
+// markDirty marks the node and all of its parents as dirty
+func (n *node) markDirty() {
+	for x := n; x != nil && !x.dirty; x = x.parent {
+		x.dirty = true
+	}
+}
+
+// clone returns a copy of the node that can be modified. The
+// key and value bytes themselves are never modified, so they
+// are shared with the original node.
+func (n *node) clone() *node {
+	c := &node{
+		leaf:     n.leaf,
+		pgid:     n.pgid,
+		overflow: n.overflow,
+		keys:     append(make([][]byte, 0, len(n.keys)+1), n.keys...),
+	}
+	if n.leaf {
+		c.vals = append(make([][]byte, 0, len(n.vals)+1), n.vals...)
+	} else {
+		c.children = append(make([]pgid, 0, len(n.children)+1), n.children...)
+	}
+	return c
+}
+
+// splitIndex returns the index the node should be split at, so
+// the first half is filled up to (about) the provided threshold.
+// Both halves always get at least one element.
+func (n *node) splitIndex(threshold int) int {
+	sz := pageHeaderSize
+	for i := range n.keys {
+		esz := n.elemSize(i)
+		if i > 0 && sz+esz > threshold {
+			return i
+		}
+		sz += esz
+	}
+	return len(n.keys) - 1
+}
+
+// splitAt splits the node at index i. The node keeps the elements
+// before the index, and a new node holding the rest is returned
+func (n *node) splitAt(i int) *node {
+	right := &node{
+		leaf:  n.leaf,
+		keys:  append([][]byte{}, n.keys[i:]...),
+		dirty: true,
+	}
+	n.keys = n.keys[:i:i]
+	if n.leaf {
+		right.vals = append([][]byte{}, n.vals[i:]...)
+		n.vals = n.vals[:i:i]
+		return right
+	}
+	n.ensureNodes()
+	right.children = append([]pgid{}, n.children[i:]...)
+	right.nodes = append([]*node{}, n.nodes[i:]...)
+	for _, c := range right.nodes {
+		if c != nil {
+			c.parent = right
+		}
+	}
+	n.children = n.children[:i:i]
+	n.nodes = n.nodes[:i:i]
+	return right
+}
+
+// encode returns the encoded node, padded out to a multiple of the
+// page size. The returned buffer may span several (overflow) pages.
+func (n *node) encode(pageSize int) []byte {
+	count := (n.size() + pageSize - 1) / pageSize
+	b := make([]byte, count*pageSize)
+	typ := pageBranch
+	if n.leaf {
+		typ = pageLeaf
+	}
+	putPageHeader(b, typ, len(n.keys), count-1)
+	off := pageHeaderSize
+	for i, key := range n.keys {
+		binary.LittleEndian.PutUint32(b[off:off+4], uint32(len(key)))
+		if n.leaf {
+			binary.LittleEndian.PutUint32(b[off+4:off+8], uint32(len(n.vals[i])))
+			off += leafElemSize
+			off += copy(b[off:], key)
+			off += copy(b[off:], n.vals[i])
+			continue
+		}
+		binary.LittleEndian.PutUint64(b[off+4:off+12], uint64(n.children[i]))
+		off += branchElemSize
+		off += copy(b[off:], key)
+	}
+	return b
+}
+
+// decodeNode decodes the node found in the provided page buffer
+func decodeNode(id pgid, b []byte) (*node, error) {
+	typ, count, overflow := readPageHeader(b)
+	if typ != pageBranch && typ != pageLeaf {
+		return nil, ErrInvalidFile
+	}
+	n := &node{
+		leaf:     typ == pageLeaf,
+		pgid:     id,
+		overflow: overflow,
+		keys:     make([][]byte, count),
+	}
+	if n.leaf {
+		n.vals = make([][]byte, count)
+	} else {
+		n.children = make([]pgid, count)
+	}
+	elemSize := branchElemSize
+	if n.leaf {
+		elemSize = leafElemSize
+	}
+	off := pageHeaderSize
+	for i := 0; i < count; i++ {
+		if off+elemSize > len(b) {
+			return nil, ErrInvalidFile
+		}
+		klen := int(binary.LittleEndian.Uint32(b[off : off+4]))
+		if n.leaf {
+			vlen := int(binary.LittleEndian.Uint32(b[off+4 : off+8]))
+			off += leafElemSize
+			if off+klen+vlen > len(b) {
+				return nil, ErrInvalidFile
+			}
+			n.keys[i] = b[off : off+klen : off+klen]
+			off += klen
+			n.vals[i] = b[off : off+vlen : off+vlen]
+			off += vlen
+			continue
+		}
+		n.children[i] = pgid(binary.LittleEndian.Uint64(b[off+4 : off+12]))
+		off += branchElemSize
+		if off+klen > len(b) {
+			return nil, ErrInvalidFile
+		}
+		n.keys[i] = b[off : off+klen : off+klen]
+		off += klen
+	}
+	return n, nil
+}
@@ -0,0 +1,117 @@
+package pbtree
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// pgid is the id (the index) of a page in the data file
+type pgid uint64
+
+const (
+	magic   uint32 = 0x62707472 // "bptr"
+	version uint32 = 1
+
+	minPageSize     = 1 << 10 //  1 KB
+	maxPageSize     = 1 << 16 // 64 KB
+	defaultPageSize = 1 << 12 //  4 KB
+
+	// pageHeaderSize is the size of the header found at the start of
+	// every page. The header is laid out as:
+	//
+	//	[0:1]  page type
+	//	[1:4]  unused
+	//	[4:8]  element count
+	//	[8:12] overflow (the number of additional contiguous pages)
+	//
+	pageHeaderSize = 12
+
+	// leafElemSize is the size of the (fixed) part of a leaf element,
+	// the key length and the value length
+	leafElemSize = 8
+
+	// branchElemSize is the size of the (fixed) part of a branch
+	// element, the key length and the child page id
+	branchElemSize = 12
+
+	// metaSize is the size of the encoded meta data (including
+	// the page header and the checksum)
+	metaSize = pageHeaderSize + 52
+)
+
+// page types
+const (
+	pageMeta uint8 = iota + 1
+	pageBranch
+	pageLeaf
+	pageFreelist
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func putPageHeader(b []byte, typ uint8, count, overflow int) {
+	b[0] = typ
+	b[1], b[2], b[3] = 0, 0, 0
+	binary.LittleEndian.PutUint32(b[4:8], uint32(count))
+	binary.LittleEndian.PutUint32(b[8:12], uint32(overflow))
+}
+
+func readPageHeader(b []byte) (uint8, int, int) {
+	typ := b[0]
+	count := int(binary.LittleEndian.Uint32(b[4:8]))
+	overflow := int(binary.LittleEndian.Uint32(b[8:12]))
+	return typ, count, overflow
+}
+
+// meta is the root of everything stored in the data file. The first
+// two pages of the file are meta pages and they are written to in
+// turn. A transaction only becomes visible once its meta page has
+// been written, so a crash part way through a commit leaves the
+// previous meta page (and everything it points to) intact.
+type meta struct {
+	pageSize uint32 // pageSize is the size of every page in the file
+	root     pgid   // root is the page id of the root node (0 if empty)
+	freelist pgid   // freelist is the page id of the freelist (0 if none)
+	npages   pgid   // npages is the number of pages in use (high water mark)
+	txid     uint64 // txid is the id of the last committed transaction
+}
+
+// encode writes the meta data, along with a checksum, into the
+// provided buffer (which must be at least metaSize bytes)
+func (m *meta) encode(b []byte) {
+	putPageHeader(b, pageMeta, 0, 0)
+	binary.LittleEndian.PutUint32(b[12:16], magic)
+	binary.LittleEndian.PutUint32(b[16:20], version)
+	binary.LittleEndian.PutUint32(b[20:24], m.pageSize)
+	binary.LittleEndian.PutUint64(b[24:32], uint64(m.root))
+	binary.LittleEndian.PutUint64(b[32:40], uint64(m.freelist))
+	binary.LittleEndian.PutUint64(b[40:48], uint64(m.npages))
+	binary.LittleEndian.PutUint64(b[48:56], m.txid)
+	binary.LittleEndian.PutUint32(b[56:60], 0)
+	binary.LittleEndian.PutUint32(b[60:64], crc32.Checksum(b[:60], crcTable))
+}
+
+// decode reads and validates the meta data found in the provided buffer
+func (m *meta) decode(b []byte) error {
+	if len(b) < metaSize {
+		return ErrInvalidFile
+	}
+	if typ, _, _ := readPageHeader(b); typ != pageMeta {
+		return ErrInvalidFile
+	}
+	if binary.LittleEndian.Uint32(b[12:16]) != magic {
+		return ErrInvalidFile
+	}
+	if binary.LittleEndian.Uint32(b[16:20]) != version {
+		return ErrInvalidFile
+	}
+	if binary.LittleEndian.Uint32(b[60:64]) != crc32.Checksum(b[:60], crcTable) {
+		return ErrBadChecksum
+	}
+	m.pageSize = binary.LittleEndian.Uint32(b[20:24])
+	m.root = pgid(binary.LittleEndian.Uint64(b[24:32]))
+	m.freelist = pgid(binary.LittleEndian.Uint64(b[32:40]))
+	m.npages = pgid(binary.LittleEndian.Uint64(b[40:48]))
+	m.txid = binary.LittleEndian.Uint64(b[48:56])
+	return nil
+}
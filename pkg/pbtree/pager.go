@@ -0,0 +1,63 @@
+package pbtree
+
+import (
+	"os"
+)
+
+// pager reads and writes fixed size pages to and from the data file. A
+// node that does not fit in a single page is written to a contiguous
+// run of pages; the page header of the first page records how many
+// additional (overflow) pages follow it.
+type pager struct {
+	file     *os.File
+	pageSize int
+}
+
+func newPager(file *os.File, pageSize int) *pager {
+	return &pager{
+		file:     file,
+		pageSize: pageSize,
+	}
+}
+
+// offset returns the file offset of the provided page
+func (p *pager) offset(id pgid) int64 {
+	return int64(id) * int64(p.pageSize)
+}
+
+// read reads the provided page, along with any overflow pages
+func (p *pager) read(id pgid) ([]byte, error) {
+	buf := make([]byte, p.pageSize)
+	_, err := p.file.ReadAt(buf, p.offset(id))
+	if err != nil {
+		return nil, err
+	}
+	_, _, overflow := readPageHeader(buf)
+	if overflow > 0 {
+		full := make([]byte, (overflow+1)*p.pageSize)
+		copy(full, buf)
+		_, err = p.file.ReadAt(full[p.pageSize:], p.offset(id+1))
+		if err != nil {
+			return nil, err
+		}
+		buf = full
+	}
+	return buf, nil
+}
+
+// write writes the provided buffer (which must be a multiple
+// of the page size) starting at the provided page
+func (p *pager) write(id pgid, buf []byte) error {
+	_, err := p.file.WriteAt(buf, p.offset(id))
+	return err
+}
+
+// sync flushes the data file to disk
+func (p *pager) sync() error {
+	return p.file.Sync()
+}
+
+// pages returns the number of pages needed to hold n bytes
+func (p *pager) pages(n int) int {
+	return (n + p.pageSize - 1) / p.pageSize
+}
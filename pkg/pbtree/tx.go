@@ -0,0 +1,449 @@
+package pbtree
+
+import (
+	"bytes"
+)
+
+// Tx is a read-only or a read-write transaction. A read-write transaction
+// works on (in-memory) copies of the nodes that it modifies, and writes
+// them to newly allocated pages when it commits, so the pages of the
+// last committed tree are never overwritten (copy-on-write.) Only one
+// read-write transaction is open at a time.
+type Tx struct {
+	tree     *BPTree
+	meta     meta   // meta is a copy of the meta data the tx started with
+	root     *node  // root is the materialized root (in a read-write tx)
+	freed    []span // freed holds the pages of nodes removed by the tx
+	writable bool
+	modified bool
+	closed   bool
+}
+
+// span is a page id along with its overflow page count
+type span struct {
+	pgid     pgid
+	overflow int
+}
+
+func newTx(t *BPTree, writable bool) *Tx {
+	return &Tx{
+		tree:     t,
+		meta:     t.meta,
+		writable: writable,
+	}
+}
+
+// pageSize returns the page size
+func (tx *Tx) pageSize() int {
+	return int(tx.meta.pageSize)
+}
+
+// page returns the (shared) node found at the provided page
+func (tx *Tx) page(id pgid) (*node, error) {
+	return tx.tree.node(id)
+}
+
+// rootNode returns the current root node, or nil if the tree is empty
+func (tx *Tx) rootNode() (*node, error) {
+	if tx.root != nil {
+		return tx.root, nil
+	}
+	if tx.meta.root == 0 {
+		return nil, nil
+	}
+	return tx.page(tx.meta.root)
+}
+
+// child returns the child at index i of the provided branch node
+func (tx *Tx) child(n *node, i int) (*node, error) {
+	if n.nodes != nil && n.nodes[i] != nil {
+		return n.nodes[i], nil
+	}
+	return tx.page(n.children[i])
+}
+
+// writableRoot returns the materialized root, creating a new (empty)
+// leaf node if the tree is empty
+func (tx *Tx) writableRoot() (*node, error) {
+	if tx.root != nil {
+		return tx.root, nil
+	}
+	if tx.meta.root == 0 {
+		tx.root = &node{leaf: true, dirty: true}
+		return tx.root, nil
+	}
+	n, err := tx.page(tx.meta.root)
+	if err != nil {
+		return nil, err
+	}
+	tx.root = n.clone()
+	return tx.root, nil
+}
+
+// materialize returns a modifiable copy of the child at index i
+// of the provided (materialized) branch node
+func (tx *Tx) materialize(n *node, i int) (*node, error) {
+	n.ensureNodes()
+	if n.nodes[i] != nil {
+		return n.nodes[i], nil
+	}
+	c, err := tx.page(n.children[i])
+	if err != nil {
+		return nil, err
+	}
+	c = c.clone()
+	c.parent = n
+	n.nodes[i] = c
+	return c, nil
+}
+
+// findLeaf returns the materialized leaf node the key belongs in
+func (tx *Tx) findLeaf(key []byte) (*node, error) {
+	n, err := tx.writableRoot()
+	if err != nil {
+		return nil, err
+	}
+	for !n.leaf {
+		i := n.route(key)
+		if i == 0 && bytes.Compare(key, n.keys[0]) < 0 {
+			// keep the first key a lower bound of the first child,
+			// so a separator taken from it later stays in order
+			n.keys[0] = key
+		}
+		n, err = tx.materialize(n, i)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// check makes sure the tx is still open and, if write
+// is true, that the tx is a read-write transaction
+func (tx *Tx) check(write bool) error {
+	if tx.closed {
+		return ErrTxClosed
+	}
+	if write && !tx.writable {
+		return ErrTxNotWritable
+	}
+	return nil
+}
+
+// checkKey makes sure the key is not empty and that it is
+// small enough that a branch page can always hold a few
+func (tx *Tx) checkKey(key string) error {
+	if key == "" {
+		return ErrBadKey
+	}
+	if len(key) > tx.pageSize()/4-branchElemSize {
+		return ErrKeyTooLarge
+	}
+	return nil
+}
+
+// Has returns a boolean reporting true if the key exists
+func (tx *Tx) Has(key string) bool {
+	_, err := tx.Get(key)
+	return err == nil
+}
+
+// Get returns a copy of the value stored for the provided key. If the
+// key cannot be found, ErrKeyNotFound is returned
+func (tx *Tx) Get(key string) ([]byte, error) {
+	if err := tx.check(false); err != nil {
+		return nil, err
+	}
+	n, err := tx.rootNode()
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
+		return nil, ErrKeyNotFound
+	}
+	k := []byte(key)
+	for !n.leaf {
+		n, err = tx.child(n, n.route(k))
+		if err != nil {
+			return nil, err
+		}
+	}
+	i, found := n.search(k)
+	if !found {
+		return nil, ErrKeyNotFound
+	}
+	return append([]byte{}, n.vals[i]...), nil
+}
+
+// Put inserts or updates the value for the provided key
+func (tx *Tx) Put(key string, value []byte) error {
+	if err := tx.check(true); err != nil {
+		return err
+	}
+	if err := tx.checkKey(key); err != nil {
+		return err
+	}
+	k := []byte(key)
+	n, err := tx.findLeaf(k)
+	if err != nil {
+		return err
+	}
+	// copy the value, the caller may reuse it
+	n.put(k, append([]byte{}, value...))
+	n.markDirty()
+	tx.modified = true
+	tx.split(n)
+	return nil
+}
+
+// Del removes the provided key. It is not an error
+// to remove a key that does not exist
+func (tx *Tx) Del(key string) error {
+	if err := tx.check(true); err != nil {
+		return err
+	}
+	if tx.meta.root == 0 && tx.root == nil {
+		return nil
+	}
+	k := []byte(key)
+	n, err := tx.findLeaf(k)
+	if err != nil {
+		return err
+	}
+	if !n.del(k) {
+		return nil
+	}
+	n.markDirty()
+	tx.modified = true
+	return tx.rebalance(n)
+}
+
+// Cursor returns a new cursor. A cursor is only valid for as long as
+// the tx is open, and must not be used after the tx has been modified
+func (tx *Tx) Cursor() *Cursor {
+	return &Cursor{tx: tx}
+}
+
+// free records the page(s) of a node that was removed from the tree
+func (tx *Tx) free(n *node) {
+	if n.pgid != 0 {
+		tx.freed = append(tx.freed, span{n.pgid, n.overflow})
+	}
+}
+
+// split splits the provided node (and its parents) if it has grown
+// larger than a page. A node holding a single element that is larger
+// than a page is left alone and is written to several pages.
+func (tx *Tx) split(n *node) {
+	if n.size() <= tx.pageSize() || len(n.keys) < 2 {
+		return
+	}
+	right := n.splitAt(n.splitIndex(tx.pageSize() / 2))
+	parent := n.parent
+	if parent == nil {
+		// splitting the root, so grow a new one
+		parent = &node{dirty: true}
+		parent.insertChild(0, n.keys[0], n)
+		tx.root = parent
+	}
+	parent.insertChild(parent.indexOf(n)+1, right.keys[0], right)
+	// either half may still be too large
+	tx.split(n)
+	tx.split(right)
+	tx.split(parent)
+}
+
+// rebalance merges the provided node with a sibling if it has become
+// too small, and then rebalances the parent. The root is collapsed if
+// it is a branch that only has a single child.
+func (tx *Tx) rebalance(n *node) error {
+	if n.size() >= tx.pageSize()/4 && len(n.keys) > 1 {
+		return nil
+	}
+	parent := n.parent
+	if parent == nil {
+		if len(n.keys) == 0 {
+			// the tree is empty
+			tx.free(n)
+			tx.root = nil
+			tx.meta.root = 0
+			return nil
+		}
+		if !n.leaf && len(n.keys) == 1 {
+			// the root only has one child, so make it the root
+			child, err := tx.materialize(n, 0)
+			if err != nil {
+				return err
+			}
+			child.parent = nil
+			tx.free(n)
+			tx.root = child
+			return tx.rebalance(child)
+		}
+		return nil
+	}
+	i := parent.indexOf(n)
+	if len(n.keys) == 0 {
+		// the node is empty, so simply remove it
+		parent.removeChild(i)
+		tx.free(n)
+		parent.markDirty()
+		return tx.rebalance(parent)
+	}
+	if len(parent.keys) < 2 {
+		return nil
+	}
+	// merge with the right sibling, or with the left
+	// sibling if the node is the last child
+	var left, right *node
+	var err error
+	if i == 0 {
+		left = n
+		right, err = tx.materialize(parent, 1)
+	} else {
+		left, err = tx.materialize(parent, i-1)
+		right = n
+	}
+	if err != nil {
+		return err
+	}
+	if left.size()+right.size()-pageHeaderSize > tx.pageSize() {
+		return nil
+	}
+	left.keys = append(left.keys, right.keys...)
+	if left.leaf {
+		left.vals = append(left.vals, right.vals...)
+	} else {
+		left.ensureNodes()
+		right.ensureNodes()
+		left.children = append(left.children, right.children...)
+		left.nodes = append(left.nodes, right.nodes...)
+		for _, c := range right.nodes {
+			if c != nil {
+				c.parent = left
+			}
+		}
+	}
+	parent.removeChild(parent.indexOf(right))
+	tx.free(right)
+	left.markDirty()
+	return tx.rebalance(parent)
+}
+
+// allocate returns the first page id of a run of n pages, reusing
+// free pages if possible and growing the file if not
+func (tx *Tx) allocate(n int) pgid {
+	id := tx.tree.free.allocate(n)
+	if id == 0 {
+		id = tx.meta.npages
+		tx.meta.npages += pgid(n)
+	}
+	return id
+}
+
+// write writes the provided buffer to newly allocated page(s)
+// and returns the first page id along with the overflow count
+func (tx *Tx) write(buf []byte) (pgid, int, error) {
+	count := len(buf) / tx.pageSize()
+	id := tx.allocate(count)
+	err := tx.tree.pager.write(id, buf)
+	if err != nil {
+		return 0, 0, err
+	}
+	// any cached node that was read from one
+	// of these pages is no longer valid
+	for i := 0; i < count; i++ {
+		tx.tree.cache.evict(id + pgid(i))
+	}
+	return id, count - 1, nil
+}
+
+// spill writes the provided node, and all of its dirty children,
+// to newly allocated pages and frees the pages they were read from
+func (tx *Tx) spill(n *node) error {
+	if !n.leaf {
+		for i, c := range n.nodes {
+			if c == nil || !c.dirty {
+				continue
+			}
+			if err := tx.spill(c); err != nil {
+				return err
+			}
+			n.children[i] = c.pgid
+		}
+	}
+	if n.pgid != 0 {
+		tx.tree.free.free(n.pgid, n.overflow)
+	}
+	id, overflow, err := tx.write(n.encode(tx.pageSize()))
+	if err != nil {
+		return err
+	}
+	n.pgid, n.overflow, n.dirty = id, overflow, false
+	return nil
+}
+
+// commit writes all the changes made by the tx, followed by the
+// freelist and finally the meta page (which makes the changes visible)
+func (tx *Tx) commit() error {
+	if !tx.modified {
+		return nil
+	}
+	t := tx.tree
+	for _, s := range tx.freed {
+		t.free.free(s.pgid, s.overflow)
+	}
+	// write the dirty nodes
+	if tx.root != nil {
+		if tx.root.dirty {
+			if err := tx.spill(tx.root); err != nil {
+				return err
+			}
+		}
+		tx.meta.root = tx.root.pgid
+	}
+	// write the freelist. the old freelist pages are freed first so
+	// they are included, and the new pages are allocated before the
+	// freelist is encoded. allocating can only shrink the freelist.
+	if t.free.pgid != 0 {
+		t.free.free(t.free.pgid, t.free.overflow)
+	}
+	count := t.pager.pages(t.free.size())
+	id := tx.allocate(count)
+	buf := make([]byte, count*tx.pageSize())
+	t.free.encode(buf, count-1)
+	err := t.pager.write(id, buf)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		t.cache.evict(id + pgid(i))
+	}
+	tx.meta.freelist = id
+	// make sure everything is on disk before the meta page is written,
+	// otherwise after a crash the meta page could point at pages that
+	// never made it to disk. this is what keeps the tree consistent,
+	// so it is done whether or not SyncOnWrite is set.
+	if err = t.pager.sync(); err != nil {
+		return err
+	}
+	// write the meta page
+	tx.meta.txid++
+	err = t.writeMeta(&tx.meta)
+	if err != nil {
+		return err
+	}
+	// without this sync a committed tx can be lost in a crash, but
+	// the tree on disk is still the one from the previous commit
+	if t.conf.SyncOnWrite {
+		if err = t.pager.sync(); err != nil {
+			return err
+		}
+	}
+	// the tx is committed, so the pages it
+	// freed can now be reused
+	t.free.release()
+	t.free.pgid, t.free.overflow = id, count-1
+	t.meta = tx.meta
+	return nil
+}
@@ -0,0 +1,121 @@
+package roaring
+
+import (
+	"sort"
+)
+
+// arrayContainer stores the values of a sparse chunk in a sorted array
+type arrayContainer struct {
+	values []uint16
+}
+
+// search returns the index of x, or where x would be inserted
+func (ac *arrayContainer) search(x uint16) (int, bool) {
+	i := sort.Search(len(ac.values), func(i int) bool {
+		return ac.values[i] >= x
+	})
+	return i, i < len(ac.values) && ac.values[i] == x
+}
+
+func (ac *arrayContainer) add(x uint16) container {
+	i, ok := ac.search(x)
+	if ok {
+		return ac
+	}
+	if len(ac.values) >= arrayMaxSize {
+		// the array is full, so switch to a bitmap
+		return ac.toBitmap().add(x)
+	}
+	ac.values = append(ac.values, 0)
+	copy(ac.values[i+1:], ac.values[i:])
+	ac.values[i] = x
+	return ac
+}
+
+func (ac *arrayContainer) remove(x uint16) container {
+	if i, ok := ac.search(x); ok {
+		ac.values = append(ac.values[:i], ac.values[i+1:]...)
+	}
+	return ac
+}
+
+func (ac *arrayContainer) contains(x uint16) bool {
+	_, ok := ac.search(x)
+	return ok
+}
+
+func (ac *arrayContainer) cardinality() int {
+	return len(ac.values)
+}
+
+func (ac *arrayContainer) numRuns() int {
+	var n int
+	for i, x := range ac.values {
+		if i == 0 || int(ac.values[i-1])+1 != int(x) {
+			n++
+		}
+	}
+	return n
+}
+
+func (ac *arrayContainer) iterate(fn func(x uint16) bool) bool {
+	for _, x := range ac.values {
+		if !fn(x) {
+			return false
+		}
+	}
+	return true
+}
+
+func (ac *arrayContainer) toBitmap() *bitmapContainer {
+	bc := newBitmapContainer()
+	for _, x := range ac.values {
+		bc.words[x>>6] |= 1 << (x & 63)
+	}
+	bc.card = len(ac.values)
+	return bc
+}
+
+func (ac *arrayContainer) clone() container {
+	values := make([]uint16, len(ac.values))
+	copy(values, ac.values)
+	return &arrayContainer{values: values}
+}
+
+func (ac *arrayContainer) kind() containerType {
+	return arrayType
+}
+
+// filter returns an array of the values that are (or are not) in c
+func (ac *arrayContainer) filter(c container, in bool) container {
+	res := &arrayContainer{values: make([]uint16, 0, len(ac.values))}
+	for _, x := range ac.values {
+		if c.contains(x) == in {
+			res.values = append(res.values, x)
+		}
+	}
+	return res
+}
+
+// union merges two arrays, the result must fit in an array
+func (ac *arrayContainer) union(o *arrayContainer) container {
+	res := &arrayContainer{values: make([]uint16, 0, len(ac.values)+len(o.values))}
+	i, j := 0, 0
+	for i < len(ac.values) && j < len(o.values) {
+		switch a, b := ac.values[i], o.values[j]; {
+		case a < b:
+			res.values = append(res.values, a)
+			i++
+		case a > b:
+			res.values = append(res.values, b)
+			j++
+		default:
+			res.values = append(res.values, a)
+			i++
+			j++
+		}
+	}
+	res.values = append(res.values, ac.values[i:]...)
+	res.values = append(res.values, o.values[j:]...)
+	return res
+}
@@ -0,0 +1,108 @@
+package roaring
+
+import (
+	mathbits "math/bits"
+)
+
+// bitmapContainer stores the values of a dense chunk in a bitmap
+type bitmapContainer struct {
+	words []uint64
+	card  int
+}
+
+func newBitmapContainer() *bitmapContainer {
+	return &bitmapContainer{words: make([]uint64, bitmapWords)}
+}
+
+func (bc *bitmapContainer) add(x uint16) container {
+	w, bit := x>>6, uint64(1)<<(x&63)
+	if bc.words[w]&bit == 0 {
+		bc.words[w] |= bit
+		bc.card++
+	}
+	return bc
+}
+
+func (bc *bitmapContainer) remove(x uint16) container {
+	w, bit := x>>6, uint64(1)<<(x&63)
+	if bc.words[w]&bit != 0 {
+		bc.words[w] &^= bit
+		bc.card--
+	}
+	if bc.card <= arrayMaxSize {
+		return toArray(bc)
+	}
+	return bc
+}
+
+func (bc *bitmapContainer) contains(x uint16) bool {
+	return bc.words[x>>6]&(1<<(x&63)) != 0
+}
+
+func (bc *bitmapContainer) cardinality() int {
+	return bc.card
+}
+
+func (bc *bitmapContainer) numRuns() int {
+	var n int
+	var carry uint64 // the last bit of the previous word
+	for _, w := range bc.words {
+		// count the bits that start a run
+		n += mathbits.OnesCount64(w &^ (w<<1 | carry))
+		carry = w >> 63
+	}
+	return n
+}
+
+func (bc *bitmapContainer) iterate(fn func(x uint16) bool) bool {
+	for i, w := range bc.words {
+		for w != 0 {
+			t := mathbits.TrailingZeros64(w)
+			if !fn(uint16(i<<6 + t)) {
+				return false
+			}
+			w &= w - 1
+		}
+	}
+	return true
+}
+
+func (bc *bitmapContainer) toBitmap() *bitmapContainer {
+	return bc
+}
+
+func (bc *bitmapContainer) clone() container {
+	words := make([]uint64, bitmapWords)
+	copy(words, bc.words)
+	return &bitmapContainer{words: words, card: bc.card}
+}
+
+func (bc *bitmapContainer) kind() containerType {
+	return bitmapType
+}
+
+// setRange sets every bit from start up to (and including) last. It
+// does not update the cardinality.
+func (bc *bitmapContainer) setRange(start, last uint16) {
+	for x := int(start); x <= int(last); {
+		w := x >> 6
+		if x&63 == 0 && int(last)-x >= 63 {
+			// set the whole word at once
+			bc.words[w] = ^uint64(0)
+			x += 64
+			continue
+		}
+		bc.words[w] |= 1 << (x & 63)
+		x++
+	}
+}
+
+// normalize recounts the bitmap and switches to an array if the
+// bitmap no longer holds enough values to be worth it
+func (bc *bitmapContainer) normalize() container {
+	bc.card = popcount(bc.words)
+	if bc.card <= arrayMaxSize {
+		return toArray(bc)
+	}
+	return bc
+}
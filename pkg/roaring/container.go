@@ -0,0 +1,146 @@
+package roaring
+
+import (
+	mathbits "math/bits"
+)
+
+// containerType is the type of container used to store a chunk
+type containerType uint16
+
+const (
+	arrayType  containerType = 1 // a sorted array of values
+	bitmapType containerType = 2 // a bitmap of 65536 bits
+	runType    containerType = 3 // a sorted list of runs of values
+)
+
+const (
+	arrayMaxSize = 4096         // array containers hold at most this many values
+	bitmapWords  = 1 << 16 / 64 // number of words in a bitmap container
+	bitmapBytes  = bitmapWords * 8
+	maxRuns      = bitmapBytes / 4 // run containers with more runs are converted
+)
+
+// container stores the low 16 bits of the values in a chunk. Methods
+// that change the container return the container to use afterwards,
+// which may be a different type of container.
+type container interface {
+	add(x uint16) container
+	remove(x uint16) container
+	contains(x uint16) bool
+	cardinality() int
+	numRuns() int
+	iterate(fn func(x uint16) bool) bool
+	toBitmap() *bitmapContainer // a bitmap container returns itself
+	clone() container
+	kind() containerType
+}
+
+// bestType returns the smallest type of container for the provided
+// cardinality and number of runs. An array is never larger than a
+// bitmap, so arrays are used for small chunks unless runs are smaller.
+func bestType(card, runs int) containerType {
+	arrayBytes, runBytes := 2*card, 4*runs
+	if card <= arrayMaxSize {
+		if runBytes < arrayBytes {
+			return runType
+		}
+		return arrayType
+	}
+	if runBytes < bitmapBytes {
+		return runType
+	}
+	return bitmapType
+}
+
+// optimize converts the container to the smallest type of container
+func optimize(c container) container {
+	want := bestType(c.cardinality(), c.numRuns())
+	if want == c.kind() {
+		return c
+	}
+	switch want {
+	case arrayType:
+		return toArray(c)
+	case runType:
+		return toRun(c)
+	}
+	return c.toBitmap()
+}
+
+// toArray returns an array container holding the values of c
+func toArray(c container) *arrayContainer {
+	ac := &arrayContainer{values: make([]uint16, 0, c.cardinality())}
+	c.iterate(func(x uint16) bool {
+		ac.values = append(ac.values, x)
+		return true
+	})
+	return ac
+}
+
+// toRun returns a run container holding the values of c
+func toRun(c container) *runContainer {
+	rc := &runContainer{runs: make([]interval, 0, c.numRuns())}
+	c.iterate(func(x uint16) bool {
+		n := len(rc.runs)
+		if n > 0 && int(rc.runs[n-1].last)+1 == int(x) {
+			rc.runs[n-1].last = x
+			return true
+		}
+		rc.runs = append(rc.runs, interval{start: x, last: x})
+		return true
+	})
+	return rc
+}
+
+// and returns a container holding the values that are in both containers
+func and(a, b container) container {
+	if aa, ok := a.(*arrayContainer); ok {
+		return aa.filter(b, true)
+	}
+	if ba, ok := b.(*arrayContainer); ok {
+		return ba.filter(a, true)
+	}
+	bc := a.toBitmap().clone().(*bitmapContainer)
+	bo := b.toBitmap()
+	for i := range bc.words {
+		bc.words[i] &= bo.words[i]
+	}
+	return bc.normalize()
+}
+
+// or returns a container holding the values that are in either container
+func or(a, b container) container {
+	aa, aok := a.(*arrayContainer)
+	ba, bok := b.(*arrayContainer)
+	if aok && bok && len(aa.values)+len(ba.values) <= arrayMaxSize {
+		return aa.union(ba)
+	}
+	bc := a.toBitmap().clone().(*bitmapContainer)
+	bo := b.toBitmap()
+	for i := range bc.words {
+		bc.words[i] |= bo.words[i]
+	}
+	return bc.normalize()
+}
+
+// andNot returns a container holding the values that are in a but not in b
+func andNot(a, b container) container {
+	if aa, ok := a.(*arrayContainer); ok {
+		return aa.filter(b, false)
+	}
+	bc := a.toBitmap().clone().(*bitmapContainer)
+	bo := b.toBitmap()
+	for i := range bc.words {
+		bc.words[i] &^= bo.words[i]
+	}
+	return bc.normalize()
+}
+
+// popcount returns the number of set bits in the words
+func popcount(words []uint64) int {
+	var n int
+	for _, w := range words {
+		n += mathbits.OnesCount64(w)
+	}
+	return n
+}
@@ -0,0 +1,242 @@
+package roaring
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// The serialized format is stable and is laid out as a header followed
+// by every chunk in ascending order of its key. Every chunk is made up
+// of a descriptor followed by the contents of its container. All values
+// are little endian.
+//
+//	header:     | magic (4B) | version (2B) | reserved (2B) | chunks (4B) |
+//	descriptor: | key (2B) | type (2B) | n (4B) |
+//
+//	array:  n values (2B each), sorted
+//	bitmap: 1024 words (8B each), n is the cardinality
+//	run:    n runs, each one a start (2B) and a length (2B), where
+//	        the run holds the values from start to start+length
+const (
+	magic          = uint32(0x504d4252) // "RBMP"
+	version        = uint16(1)
+	headerSize     = 12
+	descriptorSize = 8
+)
+
+var (
+	ErrBadFormat  = errors.New("roaring: bad bitmap format")
+	ErrBadVersion = errors.New("roaring: unsupported bitmap version")
+)
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface
+func (b *Bitmap) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface
+func (b *Bitmap) UnmarshalBinary(data []byte) error {
+	n, err := b.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrBadFormat
+		}
+		return err
+	}
+	if n != int64(len(data)) {
+		return ErrBadFormat
+	}
+	return nil
+}
+
+// WriteTo implements the io.WriterTo interface
+func (b *Bitmap) WriteTo(w io.Writer) (int64, error) {
+	buf := make([]byte, descriptorSize+bitmapBytes)
+	// write header
+	binary.LittleEndian.PutUint32(buf[0:4], magic)
+	binary.LittleEndian.PutUint16(buf[4:6], version)
+	binary.LittleEndian.PutUint16(buf[6:8], 0)
+	binary.LittleEndian.PutUint32(buf[8:12], uint32(len(b.keys)))
+	n, err := w.Write(buf[:headerSize])
+	total := int64(n)
+	if err != nil {
+		return total, err
+	}
+	// write chunks
+	for i, c := range b.containers {
+		size := encodeChunk(buf, b.keys[i], c)
+		n, err = w.Write(buf[:size])
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// encodeChunk encodes the descriptor and the container into
+// buf, and returns the number of bytes that were used
+func encodeChunk(buf []byte, key uint16, c container) int {
+	binary.LittleEndian.PutUint16(buf[0:2], key)
+	binary.LittleEndian.PutUint16(buf[2:4], uint16(c.kind()))
+	off := descriptorSize
+	switch c := c.(type) {
+	case *arrayContainer:
+		binary.LittleEndian.PutUint32(buf[4:8], uint32(len(c.values)))
+		for _, x := range c.values {
+			binary.LittleEndian.PutUint16(buf[off:], x)
+			off += 2
+		}
+	case *bitmapContainer:
+		binary.LittleEndian.PutUint32(buf[4:8], uint32(c.card))
+		for _, w := range c.words {
+			binary.LittleEndian.PutUint64(buf[off:], w)
+			off += 8
+		}
+	case *runContainer:
+		binary.LittleEndian.PutUint32(buf[4:8], uint32(len(c.runs)))
+		for _, r := range c.runs {
+			binary.LittleEndian.PutUint16(buf[off:], r.start)
+			binary.LittleEndian.PutUint16(buf[off+2:], r.last-r.start)
+			off += 4
+		}
+	}
+	return off
+}
+
+// ReadFrom implements the io.ReaderFrom interface. It reads exactly
+// one serialized bitmap from r, replacing the contents of the bitmap.
+func (b *Bitmap) ReadFrom(r io.Reader) (int64, error) {
+	buf := make([]byte, bitmapBytes)
+	// read header
+	n, err := io.ReadFull(r, buf[:headerSize])
+	total := int64(n)
+	if err != nil {
+		return total, err
+	}
+	if binary.LittleEndian.Uint32(buf[0:4]) != magic {
+		return total, ErrBadFormat
+	}
+	if binary.LittleEndian.Uint16(buf[4:6]) != version {
+		return total, ErrBadVersion
+	}
+	count := int(binary.LittleEndian.Uint32(buf[8:12]))
+	if count > 1<<16 {
+		return total, ErrBadFormat
+	}
+	// read chunks
+	res := New()
+	for i := 0; i < count; i++ {
+		n, err = io.ReadFull(r, buf[:descriptorSize])
+		total += int64(n)
+		if err != nil {
+			return total, unexpected(err)
+		}
+		key := binary.LittleEndian.Uint16(buf[0:2])
+		kind := containerType(binary.LittleEndian.Uint16(buf[2:4]))
+		size := int(binary.LittleEndian.Uint32(buf[4:8]))
+		if i > 0 && key <= res.keys[i-1] {
+			return total, ErrBadFormat
+		}
+		var c container
+		switch kind {
+		case arrayType:
+			if size < 1 || size > arrayMaxSize {
+				return total, ErrBadFormat
+			}
+			n, err = io.ReadFull(r, buf[:size*2])
+			c = decodeArray(buf[:n], size)
+		case bitmapType:
+			n, err = io.ReadFull(r, buf[:bitmapBytes])
+			c = decodeBitmap(buf[:n], size)
+		case runType:
+			if size < 1 || size > maxRuns {
+				return total, ErrBadFormat
+			}
+			n, err = io.ReadFull(r, buf[:size*4])
+			c = decodeRun(buf[:n], size)
+		default:
+			return total, ErrBadFormat
+		}
+		total += int64(n)
+		if err != nil {
+			return total, unexpected(err)
+		}
+		if c == nil {
+			return total, ErrBadFormat
+		}
+		res.keys = append(res.keys, key)
+		res.containers = append(res.containers, c)
+	}
+	*b = *res
+	return total, nil
+}
+
+// unexpected turns an io.EOF in the middle of a bitmap into an
+// io.ErrUnexpectedEOF
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// decodeArray decodes an array container, or returns
+// nil if the values are not sorted
+func decodeArray(data []byte, size int) container {
+	if len(data) != size*2 {
+		return nil
+	}
+	ac := &arrayContainer{values: make([]uint16, size)}
+	for i := range ac.values {
+		ac.values[i] = binary.LittleEndian.Uint16(data[i*2:])
+		if i > 0 && ac.values[i] <= ac.values[i-1] {
+			return nil
+		}
+	}
+	return ac
+}
+
+// decodeBitmap decodes a bitmap container, or returns nil
+// if the cardinality does not match the bitmap
+func decodeBitmap(data []byte, card int) container {
+	if len(data) != bitmapBytes {
+		return nil
+	}
+	bc := newBitmapContainer()
+	for i := range bc.words {
+		bc.words[i] = binary.LittleEndian.Uint64(data[i*8:])
+	}
+	bc.card = popcount(bc.words)
+	if bc.card != card || card == 0 {
+		return nil
+	}
+	return bc
+}
+
+// decodeRun decodes a run container, or returns nil if the runs
+// are not sorted, overlap or touch each other
+func decodeRun(data []byte, size int) container {
+	if len(data) != size*4 {
+		return nil
+	}
+	rc := &runContainer{runs: make([]interval, size)}
+	for i := range rc.runs {
+		start := binary.LittleEndian.Uint16(data[i*4:])
+		length := binary.LittleEndian.Uint16(data[i*4+2:])
+		if int(start)+int(length) > 0xffff {
+			return nil
+		}
+		rc.runs[i] = interval{start: start, last: start + length}
+		if i > 0 && int(start) <= int(rc.runs[i-1].last)+1 {
+			return nil
+		}
+	}
+	return rc
+}
@@ -0,0 +1,265 @@
+package roaring
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Bitmap is a compressed bitmap of uint32 values. The values are split
+// into chunks using the high 16 bits, and the low 16 bits of the values
+// in each chunk are stored in whichever container is the smallest: a
+// sorted array for sparse chunks, a bitmap for dense chunks or a list of
+// runs for chunks with long runs of consecutive values.
+type Bitmap struct {
+	keys       []uint16    // keys holds the high 16 bits of each chunk
+	containers []container // containers holds the low 16 bits
+}
+
+// New returns a new empty bitmap
+func New() *Bitmap {
+	return &Bitmap{}
+}
+
+// BitmapOf returns a new bitmap holding the provided values
+func BitmapOf(values ...uint32) *Bitmap {
+	b := New()
+	for _, x := range values {
+		b.Add(x)
+	}
+	return b
+}
+
+// split returns the high and low 16 bits of x
+func split(x uint32) (uint16, uint16) {
+	return uint16(x >> 16), uint16(x)
+}
+
+// search returns the index of the chunk with the key, or
+// where it would be inserted
+func (b *Bitmap) search(key uint16) (int, bool) {
+	i := sort.Search(len(b.keys), func(i int) bool {
+		return b.keys[i] >= key
+	})
+	return i, i < len(b.keys) && b.keys[i] == key
+}
+
+// insert adds a chunk with the key and container at index i
+func (b *Bitmap) insert(i int, key uint16, c container) {
+	b.keys = append(b.keys, 0)
+	copy(b.keys[i+1:], b.keys[i:])
+	b.keys[i] = key
+	b.containers = append(b.containers, nil)
+	copy(b.containers[i+1:], b.containers[i:])
+	b.containers[i] = c
+}
+
+// delete removes the chunk at index i
+func (b *Bitmap) delete(i int) {
+	b.keys = append(b.keys[:i], b.keys[i+1:]...)
+	b.containers = append(b.containers[:i], b.containers[i+1:]...)
+}
+
+// Add adds x to the bitmap
+func (b *Bitmap) Add(x uint32) {
+	hi, lo := split(x)
+	i, ok := b.search(hi)
+	if !ok {
+		b.insert(i, hi, &arrayContainer{})
+	}
+	b.containers[i] = b.containers[i].add(lo)
+}
+
+// AddMany adds all the values to the bitmap
+func (b *Bitmap) AddMany(values ...uint32) {
+	for _, x := range values {
+		b.Add(x)
+	}
+}
+
+// Remove removes x from the bitmap
+func (b *Bitmap) Remove(x uint32) {
+	hi, lo := split(x)
+	i, ok := b.search(hi)
+	if !ok {
+		return
+	}
+	b.containers[i] = b.containers[i].remove(lo)
+	if b.containers[i].cardinality() == 0 {
+		b.delete(i)
+	}
+}
+
+// Contains returns true if x is in the bitmap
+func (b *Bitmap) Contains(x uint32) bool {
+	hi, lo := split(x)
+	i, ok := b.search(hi)
+	return ok && b.containers[i].contains(lo)
+}
+
+// Cardinality returns the number of values in the bitmap
+func (b *Bitmap) Cardinality() uint64 {
+	var n uint64
+	for _, c := range b.containers {
+		n += uint64(c.cardinality())
+	}
+	return n
+}
+
+// IsEmpty returns true if the bitmap holds no values
+func (b *Bitmap) IsEmpty() bool {
+	return len(b.keys) == 0
+}
+
+// Iterate calls fn for every value in the bitmap in ascending
+// order, until fn returns false
+func (b *Bitmap) Iterate(fn func(x uint32) bool) {
+	for i, c := range b.containers {
+		hi := uint32(b.keys[i]) << 16
+		ok := c.iterate(func(lo uint16) bool {
+			return fn(hi | uint32(lo))
+		})
+		if !ok {
+			return
+		}
+	}
+}
+
+// ToArray returns all the values in the bitmap in ascending order
+func (b *Bitmap) ToArray() []uint32 {
+	values := make([]uint32, 0, b.Cardinality())
+	b.Iterate(func(x uint32) bool {
+		values = append(values, x)
+		return true
+	})
+	return values
+}
+
+// Clone returns a copy of the bitmap
+func (b *Bitmap) Clone() *Bitmap {
+	cp := &Bitmap{
+		keys:       make([]uint16, len(b.keys)),
+		containers: make([]container, len(b.containers)),
+	}
+	copy(cp.keys, b.keys)
+	for i, c := range b.containers {
+		cp.containers[i] = c.clone()
+	}
+	return cp
+}
+
+// RunOptimize converts every container to the smallest type of
+// container. It is worth calling once a bitmap has been built.
+func (b *Bitmap) RunOptimize() {
+	for i, c := range b.containers {
+		b.containers[i] = optimize(c)
+	}
+}
+
+// appendChunk adds a chunk to the end of the bitmap, unless it is empty
+func (b *Bitmap) appendChunk(key uint16, c container) {
+	if c.cardinality() > 0 {
+		b.keys = append(b.keys, key)
+		b.containers = append(b.containers, c)
+	}
+}
+
+// And returns a new bitmap holding the values that are in both bitmaps
+func (b *Bitmap) And(o *Bitmap) *Bitmap {
+	res := New()
+	i, j := 0, 0
+	for i < len(b.keys) && j < len(o.keys) {
+		switch {
+		case b.keys[i] < o.keys[j]:
+			i++
+		case b.keys[i] > o.keys[j]:
+			j++
+		default:
+			res.appendChunk(b.keys[i], and(b.containers[i], o.containers[j]))
+			i++
+			j++
+		}
+	}
+	return res
+}
+
+// Or returns a new bitmap holding the values that are in either bitmap
+func (b *Bitmap) Or(o *Bitmap) *Bitmap {
+	res := New()
+	i, j := 0, 0
+	for i < len(b.keys) || j < len(o.keys) {
+		switch {
+		case j == len(o.keys) || (i < len(b.keys) && b.keys[i] < o.keys[j]):
+			res.appendChunk(b.keys[i], b.containers[i].clone())
+			i++
+		case i == len(b.keys) || b.keys[i] > o.keys[j]:
+			res.appendChunk(o.keys[j], o.containers[j].clone())
+			j++
+		default:
+			res.appendChunk(b.keys[i], or(b.containers[i], o.containers[j]))
+			i++
+			j++
+		}
+	}
+	return res
+}
+
+// AndNot returns a new bitmap holding the values that are in
+// this bitmap but not in the other bitmap
+func (b *Bitmap) AndNot(o *Bitmap) *Bitmap {
+	res := New()
+	j := 0
+	for i := range b.keys {
+		for j < len(o.keys) && o.keys[j] < b.keys[i] {
+			j++
+		}
+		if j < len(o.keys) && o.keys[j] == b.keys[i] {
+			res.appendChunk(b.keys[i], andNot(b.containers[i], o.containers[j]))
+			continue
+		}
+		res.appendChunk(b.keys[i], b.containers[i].clone())
+	}
+	return res
+}
+
+// Equal returns true if both bitmaps hold the same values
+func (b *Bitmap) Equal(o *Bitmap) bool {
+	if len(b.keys) != len(o.keys) {
+		return false
+	}
+	for i := range b.keys {
+		if b.keys[i] != o.keys[i] || b.containers[i].cardinality() != o.containers[i].cardinality() {
+			return false
+		}
+		c := o.containers[i]
+		ok := b.containers[i].iterate(func(x uint16) bool {
+			return c.contains(x)
+		})
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the values in the bitmap, up to a limit
+func (b *Bitmap) String() string {
+	const limit = 32
+	var sb strings.Builder
+	sb.WriteByte('{')
+	var n int
+	b.Iterate(func(x uint32) bool {
+		if n > 0 {
+			sb.WriteByte(',')
+		}
+		if n == limit {
+			sb.WriteString("...")
+			return false
+		}
+		fmt.Fprintf(&sb, "%d", x)
+		n++
+		return true
+	})
+	sb.WriteByte('}')
+	return sb.String()
+}
@@ -0,0 +1,255 @@
+package roaring
+
+import (
+	"bytes"
+	"github.com/scottcagno/storage/pkg/util"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+const (
+	thousand = 1000
+	n        = 1
+)
+
+// reference is a plain set used to check the results of the bitmap
+type reference map[uint32]bool
+
+func (ref reference) sorted() []uint32 {
+	values := make([]uint32, 0, len(ref))
+	for x := range ref {
+		values = append(values, x)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i] < values[j]
+	})
+	return values
+}
+
+func checkBitmap(t *testing.T, b *Bitmap, ref reference) {
+	util.AssertEqual(t, uint64(len(ref)), b.Cardinality())
+	util.AssertEqual(t, ref.sorted(), b.ToArray())
+	for x := range ref {
+		if !b.Contains(x) {
+			t.Fatalf("contains %d: expected=%v, got=%v\n", x, true, false)
+		}
+	}
+	for i, c := range b.containers {
+		if c.cardinality() == 0 {
+			t.Fatalf("chunk %d is empty\n", b.keys[i])
+		}
+	}
+}
+
+// randomBitmap returns a bitmap using every type of container: a
+// sparse chunk, a dense chunk and a chunk made up of long runs
+func randomBitmap(seed int64) (*Bitmap, reference) {
+	r := rand.New(rand.NewSource(seed))
+	b, ref := New(), reference{}
+	add := func(x uint32) {
+		b.Add(x)
+		ref[x] = true
+	}
+	for i := 0; i < n*thousand; i++ {
+		add(r.Uint32() % (1 << 20)) // sparse
+	}
+	for i := 0; i < 20*n*thousand; i++ {
+		add(3<<16 | uint32(r.Intn(1<<16))) // dense
+	}
+	for i := 0; i < 20; i++ {
+		start := 5<<16 | uint32(r.Intn(1<<16-500))
+		for x := start; x < start+uint32(r.Intn(500)); x++ {
+			add(x) // runs
+		}
+	}
+	return b, ref
+}
+
+func TestBitmap_AddRemoveContains(t *testing.T) {
+	b, ref := randomBitmap(1)
+	checkBitmap(t, b, ref)
+	// remove half of the values, so dense chunks turn sparse
+	var i int
+	for x := range ref {
+		if i%2 == 0 {
+			b.Remove(x)
+			delete(ref, x)
+		}
+		i++
+	}
+	checkBitmap(t, b, ref)
+	// removing values that are not there does nothing
+	b.Remove(1<<32 - 1)
+	checkBitmap(t, b, ref)
+	// remove everything else
+	for x := range ref {
+		b.Remove(x)
+	}
+	util.AssertEqual(t, true, b.IsEmpty())
+	util.AssertEqual(t, uint64(0), b.Cardinality())
+}
+
+func TestBitmap_Containers(t *testing.T) {
+	b := New()
+	// an array turns into a bitmap once it is full
+	for x := uint32(0); x <= arrayMaxSize*2; x += 2 {
+		b.Add(x)
+	}
+	util.AssertEqual(t, bitmapType, b.containers[0].kind())
+	// and back into an array when enough values are removed
+	for x := uint32(0); x <= arrayMaxSize; x += 2 {
+		b.Remove(x)
+	}
+	util.AssertEqual(t, arrayType, b.containers[0].kind())
+	// long runs are stored as runs after optimizing
+	b = New()
+	ref := reference{}
+	for x := uint32(100); x < 60000; x++ {
+		b.Add(x)
+		ref[x] = true
+	}
+	b.RunOptimize()
+	util.AssertEqual(t, runType, b.containers[0].kind())
+	checkBitmap(t, b, ref)
+	// and runs can be changed in place
+	for _, x := range []uint32{99, 60000, 500, 501, 101, 100, 5, 61000} {
+		if ref[x] {
+			b.Remove(x)
+			delete(ref, x)
+			continue
+		}
+		b.Add(x)
+		ref[x] = true
+	}
+	util.AssertEqual(t, runType, b.containers[0].kind())
+	checkBitmap(t, b, ref)
+	for _, x := range []uint32{500, 501, 100, 101} {
+		b.Add(x)
+		ref[x] = true
+	}
+	checkBitmap(t, b, ref)
+	util.AssertEqual(t, 3, b.containers[0].numRuns()) // 5, 99-60000 and 61000
+	// too many runs turn into a bitmap
+	for x := uint32(1 << 16); x < 2<<16; x += 2 {
+		b.Add(x)
+		ref[x] = true
+	}
+	b.RunOptimize()
+	util.AssertEqual(t, bitmapType, b.containers[1].kind())
+	checkBitmap(t, b, ref)
+}
+
+func TestBitmap_SetAlgebra(t *testing.T) {
+	a, ra := randomBitmap(1)
+	b, rb := randomBitmap(2)
+	// mix in some different container types
+	b.RunOptimize()
+	op := func(x, y reference, fn func(p, q bool) bool) reference {
+		res := reference{}
+		for v := range x {
+			if fn(true, y[v]) {
+				res[v] = true
+			}
+		}
+		for v := range y {
+			if fn(x[v], true) {
+				res[v] = true
+			}
+		}
+		return res
+	}
+	and := func(p, q bool) bool { return p && q }
+	or := func(p, q bool) bool { return p || q }
+	andNot := func(p, q bool) bool { return p && !q }
+	checkBitmap(t, a.And(b), op(ra, rb, and))
+	checkBitmap(t, b.And(a), op(rb, ra, and))
+	checkBitmap(t, a.Or(b), op(ra, rb, or))
+	checkBitmap(t, b.Or(a), op(rb, ra, or))
+	checkBitmap(t, a.AndNot(b), op(ra, rb, andNot))
+	checkBitmap(t, b.AndNot(a), op(rb, ra, andNot))
+	util.AssertEqual(t, true, a.AndNot(a).IsEmpty())
+	util.AssertEqual(t, true, a.Or(a).Equal(a))
+	util.AssertEqual(t, false, a.Equal(b))
+	// the originals are unchanged
+	checkBitmap(t, a, ra)
+	checkBitmap(t, b, rb)
+	// and so are clones
+	c := a.Clone()
+	c.Add(1<<32 - 1)
+	checkBitmap(t, a, ra)
+	util.AssertEqual(t, a.Cardinality()+1, c.Cardinality())
+}
+
+func TestBitmap_Iterate(t *testing.T) {
+	b := BitmapOf(1, 2, 3, 1<<16, 1<<31)
+	var values []uint32
+	b.Iterate(func(x uint32) bool {
+		values = append(values, x)
+		return len(values) < 4
+	})
+	util.AssertEqual(t, []uint32{1, 2, 3, 1 << 16}, values)
+	util.AssertEqual(t, "{1,2,3,65536,2147483648}", b.String())
+}
+
+func TestBitmap_Marshal(t *testing.T) {
+	b, ref := randomBitmap(3)
+	b.RunOptimize()
+	kinds := map[containerType]bool{}
+	for _, c := range b.containers {
+		kinds[c.kind()] = true
+	}
+	util.AssertLen(t, 3, len(kinds))
+	data, err := b.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal: %v\n", err)
+	}
+	var buf bytes.Buffer
+	n, err := b.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("write to: %v\n", err)
+	}
+	util.AssertEqual(t, int64(len(data)), n)
+	util.AssertEqual(t, data, buf.Bytes())
+	cp := New()
+	if err = cp.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal: %v\n", err)
+	}
+	checkBitmap(t, cp, ref)
+	util.AssertEqual(t, true, cp.Equal(b))
+	cp = New()
+	n, err = cp.ReadFrom(&buf)
+	if err != nil {
+		t.Fatalf("read from: %v\n", err)
+	}
+	util.AssertEqual(t, int64(len(data)), n)
+	checkBitmap(t, cp, ref)
+	// the format is stable
+	small, err := BitmapOf(1, 2, 3, 1<<16).MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal: %v\n", err)
+	}
+	util.AssertEqual(t, []byte{
+		'R', 'B', 'M', 'P', 1, 0, 0, 0, 2, 0, 0, 0,
+		0, 0, 1, 0, 3, 0, 0, 0, 1, 0, 2, 0, 3, 0,
+		1, 0, 1, 0, 1, 0, 0, 0, 0, 0,
+	}, small)
+	// bad data
+	util.AssertEqual(t, ErrBadFormat, cp.UnmarshalBinary(data[:len(data)-1]))
+	util.AssertEqual(t, ErrBadFormat, cp.UnmarshalBinary(append(data, 0)))
+	bad := append([]byte(nil), small...)
+	bad[22] = 9 // unsorted array
+	util.AssertEqual(t, ErrBadFormat, cp.UnmarshalBinary(bad))
+	// and a failed read leaves the bitmap alone
+	checkBitmap(t, cp, ref)
+}
+
+func BenchmarkBitmap_Add(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bm := New()
+		for x := uint32(0); x < 100*thousand; x++ {
+			bm.Add(x * 7)
+		}
+	}
+}
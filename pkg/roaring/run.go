@@ -0,0 +1,127 @@
+package roaring
+
+import (
+	"sort"
+)
+
+// interval is a run of values from start up to (and including) last
+type interval struct {
+	start uint16
+	last  uint16
+}
+
+// runContainer stores the values of a chunk as a sorted list of runs
+type runContainer struct {
+	runs []interval
+}
+
+// search returns the index of the first run that ends at or after x
+func (rc *runContainer) search(x uint16) int {
+	return sort.Search(len(rc.runs), func(i int) bool {
+		return rc.runs[i].last >= x
+	})
+}
+
+func (rc *runContainer) add(x uint16) container {
+	// find the first run that ends at or after x-1, so
+	// a run that can be extended by x is found too
+	i := sort.Search(len(rc.runs), func(i int) bool {
+		return int(rc.runs[i].last)+1 >= int(x)
+	})
+	switch {
+	case i < len(rc.runs) && rc.runs[i].start <= x && x <= rc.runs[i].last:
+		// already in a run
+		return rc
+	case i < len(rc.runs) && int(rc.runs[i].last)+1 == int(x):
+		// extend the run, and merge it with the next run if they touch
+		rc.runs[i].last = x
+		if i+1 < len(rc.runs) && int(rc.runs[i+1].start) == int(x)+1 {
+			rc.runs[i].last = rc.runs[i+1].last
+			rc.runs = append(rc.runs[:i+1], rc.runs[i+2:]...)
+		}
+	case i < len(rc.runs) && int(rc.runs[i].start) == int(x)+1:
+		// extend the next run backwards
+		rc.runs[i].start = x
+	default:
+		rc.runs = append(rc.runs, interval{})
+		copy(rc.runs[i+1:], rc.runs[i:])
+		rc.runs[i] = interval{start: x, last: x}
+	}
+	if len(rc.runs) > maxRuns {
+		return rc.toBitmap()
+	}
+	return rc
+}
+
+func (rc *runContainer) remove(x uint16) container {
+	i := rc.search(x)
+	if i == len(rc.runs) || rc.runs[i].start > x {
+		return rc
+	}
+	r := rc.runs[i]
+	switch {
+	case r.start == r.last:
+		rc.runs = append(rc.runs[:i], rc.runs[i+1:]...)
+	case x == r.start:
+		rc.runs[i].start++
+	case x == r.last:
+		rc.runs[i].last--
+	default:
+		// split the run in two
+		rc.runs = append(rc.runs, interval{})
+		copy(rc.runs[i+2:], rc.runs[i+1:])
+		rc.runs[i] = interval{start: r.start, last: x - 1}
+		rc.runs[i+1] = interval{start: x + 1, last: r.last}
+		if len(rc.runs) > maxRuns {
+			return rc.toBitmap()
+		}
+	}
+	return rc
+}
+
+func (rc *runContainer) contains(x uint16) bool {
+	i := rc.search(x)
+	return i < len(rc.runs) && rc.runs[i].start <= x
+}
+
+func (rc *runContainer) cardinality() int {
+	var n int
+	for _, r := range rc.runs {
+		n += int(r.last) - int(r.start) + 1
+	}
+	return n
+}
+
+func (rc *runContainer) numRuns() int {
+	return len(rc.runs)
+}
+
+func (rc *runContainer) iterate(fn func(x uint16) bool) bool {
+	for _, r := range rc.runs {
+		for x := int(r.start); x <= int(r.last); x++ {
+			if !fn(uint16(x)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (rc *runContainer) toBitmap() *bitmapContainer {
+	bc := newBitmapContainer()
+	for _, r := range rc.runs {
+		bc.setRange(r.start, r.last)
+	}
+	bc.card = rc.cardinality()
+	return bc
+}
+
+func (rc *runContainer) clone() container {
+	runs := make([]interval, len(rc.runs))
+	copy(runs, rc.runs)
+	return &runContainer{runs: runs}
+}
+
+func (rc *runContainer) kind() containerType {
+	return runType
+}